@@ -33,7 +33,7 @@ func main() {
 	// Create MQTT client
 	mqttConfig := cfg.MQTT
 	mqttConfig.CleanSession = false
-	mqttConfig.ClientID = "mqtt-receiver-" + time.Now().Format("20060102150405")
+	mqttConfig.ClientID = mqtt.ClientID("mqtt-receiver", cfg.MQTT.IDStrategy)
 	client := mqtt.NewClient(&mqttConfig)
 
 	// Connect to MQTT broker
@@ -64,7 +64,11 @@ func main() {
 	}
 
 	// Subscribe to exact topics (no wildcard for testing)
-	err = client.Subscribe("devices/device001/data", func(topic string, payload []byte) {
+	device001DataTopic := mqtt.DeviceDataTopic(mqttConfig.TopicPrefix, "device001")
+	device001StatusTopic := mqtt.DeviceStatusTopic(mqttConfig.TopicPrefix, "device001")
+	device002DataTopic := mqtt.DeviceDataTopic(mqttConfig.TopicPrefix, "device002")
+
+	err = client.Subscribe(device001DataTopic, func(topic string, payload []byte) {
 		message := fmt.Sprintf("📡 RECEIVED DEVICE DATA from %s: %s", topic, string(payload))
 		log.Print(message)
 		logToFile(message)
@@ -74,7 +78,7 @@ func main() {
 		log.Fatalf("Failed to subscribe to device001/data: %v", err)
 	}
 
-	err = client.Subscribe("devices/device001/status", func(topic string, payload []byte) {
+	err = client.Subscribe(device001StatusTopic, func(topic string, payload []byte) {
 		message := fmt.Sprintf("📡 RECEIVED DEVICE STATUS from %s: %s", topic, string(payload))
 		log.Print(message)
 		logToFile(message)
@@ -84,7 +88,7 @@ func main() {
 		log.Fatalf("Failed to subscribe to device001/status: %v", err)
 	}
 
-	err = client.Subscribe("devices/device002/data", func(topic string, payload []byte) {
+	err = client.Subscribe(device002DataTopic, func(topic string, payload []byte) {
 		message := fmt.Sprintf("📡 RECEIVED DEVICE DATA from %s: %s", topic, string(payload))
 		log.Print(message)
 		logToFile(message)
@@ -95,9 +99,9 @@ func main() {
 	}
 
 	log.Println("✅ RECEIVER Subscribed to topics:")
-	log.Println("   - devices/device001/data")
-	log.Println("   - devices/device001/status")
-	log.Println("   - devices/device002/data")
+	log.Printf("   - %s", device001DataTopic)
+	log.Printf("   - %s", device001StatusTopic)
+	log.Printf("   - %s", device002DataTopic)
 	log.Println("")
 
 	// Log startup message
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"iot-platform-go/internal/mqtt"
+)
+
+// outboundMessage is a message of a test data batch
+type outboundMessage struct {
+	Topic   string
+	Payload []byte
+	Status  bool // device status rather than device data
+}
+
+// publisher publishes a payload with the given options
+type publisher interface {
+	PublishWithOptions(topic string, qos byte, retained bool, payload interface{}) error
+}
+
+var statuses = []string{"online", "offline", "error", "maintenance"}
+
+// buildBatch builds batch number sequence: device data for every device and,
+// every statusSendInterval batches, device status as well
+func buildBatch(sequence int, deviceIDs []string, topicPrefix string, now time.Time) ([]outboundMessage, error) {
+	var messages []outboundMessage
+
+	for _, deviceID := range deviceIDs {
+		// Generate random sensor data
+		deviceData := DeviceDataMessage{
+			DeviceID:  deviceID,
+			Timestamp: now.Format(time.RFC3339),
+			Data: map[string]interface{}{
+				"temperature": temperatureBase + rand.Float64()*temperatureRange, // 20-30°C
+				"humidity":    humidityBase + rand.Float64()*humidityRange,       // 40-70%
+				"pressure":    pressureBase + rand.Float64()*pressureRange,       // 1000-1050 hPa
+				"voltage":     voltageBase + rand.Float64()*voltageRange,         // 3.0-3.5V
+			},
+			Metadata: map[string]interface{}{
+				"sequence": sequence,
+				"quality":  "good",
+			},
+		}
+
+		payload, err := json.Marshal(deviceData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal device data: %w", err)
+		}
+		messages = append(messages, outboundMessage{Topic: mqtt.DeviceDataTopic(topicPrefix, deviceID), Payload: payload})
+	}
+
+	// Send device status less frequently
+	if sequence%statusSendInterval != 0 {
+		return messages, nil
+	}
+
+	for _, deviceID := range deviceIDs {
+		deviceStatus := DeviceStatusMessage{
+			DeviceID: deviceID,
+			Status:   statuses[rand.Intn(len(statuses))],
+			LastSeen: now.Format(time.RFC3339),
+			Metadata: map[string]interface{}{
+				"battery": batteryBase + rand.Intn(batteryRange), // 80-100%
+				"signal":  signalBase + rand.Intn(signalRange),   // 70-100%
+			},
+		}
+
+		payload, err := json.Marshal(deviceStatus)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal device status: %w", err)
+		}
+		messages = append(messages, outboundMessage{Topic: mqtt.DeviceStatusTopic(topicPrefix, deviceID), Payload: payload, Status: true})
+	}
+
+	return messages, nil
+}
+
+// senderStats counts sent batches and messages and aggregates publish errors.
+// It is safe for concurrent use.
+type senderStats struct {
+	batches   atomic.Int64
+	published atomic.Int64
+	failed    atomic.Int64
+
+	mu     sync.Mutex
+	errors map[string]int // occurrences by error message
+}
+
+func newSenderStats() *senderStats {
+	return &senderStats{errors: make(map[string]int)}
+}
+
+// recordError counts a failed message
+func (s *senderStats) recordError(err error) {
+	s.failed.Add(1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[err.Error()]++
+}
+
+// Err returns the distinct errors with their number of occurrences, or nil when nothing failed
+func (s *senderStats) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]string, 0, len(s.errors))
+	for msg := range s.errors {
+		messages = append(messages, msg)
+	}
+	sort.Strings(messages)
+
+	errs := make([]error, 0, len(messages))
+	for _, msg := range messages {
+		errs = append(errs, fmt.Errorf("%s (x%d)", msg, s.errors[msg]))
+	}
+	return errors.Join(errs...)
+}
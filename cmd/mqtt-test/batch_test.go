@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher records published topics and fails publishes to failTopic
+type recordingPublisher struct {
+	mu        sync.Mutex
+	topics    []string
+	failTopic string
+}
+
+func (p *recordingPublisher) PublishWithOptions(topic string, qos byte, retained bool, payload interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if topic == p.failTopic {
+		return errors.New("not connected")
+	}
+	p.topics = append(p.topics, topic)
+	return nil
+}
+
+func TestBuildBatch(t *testing.T) {
+	deviceIDs := []string{"device001", "device002"}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("data only", func(t *testing.T) {
+		messages, err := buildBatch(1, deviceIDs, "", now)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+
+		var data DeviceDataMessage
+		require.NoError(t, json.Unmarshal(messages[0].Payload, &data))
+		assert.Equal(t, "devices/device001/data", messages[0].Topic)
+		assert.False(t, messages[0].Status)
+		assert.Equal(t, "device001", data.DeviceID)
+		assert.Equal(t, "2024-01-01T00:00:00Z", data.Timestamp)
+		assert.Equal(t, float64(1), data.Metadata["sequence"])
+	})
+
+	t.Run("with status", func(t *testing.T) {
+		messages, err := buildBatch(statusSendInterval, deviceIDs, "tenant-a", now)
+		require.NoError(t, err)
+		require.Len(t, messages, 4)
+
+		assert.True(t, messages[2].Status)
+		assert.Equal(t, "tenant-a/devices/device001/status", messages[2].Topic)
+
+		var status DeviceStatusMessage
+		require.NoError(t, json.Unmarshal(messages[3].Payload, &status))
+		assert.Equal(t, "device002", status.DeviceID)
+		assert.Contains(t, statuses, status.Status)
+	})
+}
+
+func TestSendTestData_Count(t *testing.T) {
+	opts := &senderOptions{Interval: time.Millisecond, DeviceIDs: []string{"device001", "device002"}, Count: 4}
+	publisher := &recordingPublisher{failTopic: "devices/device002/status"}
+	stats := newSenderStats()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sendTestData(context.Background(), publisher, "", opts, stats)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sender did not stop after -count batches")
+	}
+
+	// 4 batches of data for 2 devices, plus status for 2 devices in batch 3
+	assert.Equal(t, int64(4), stats.batches.Load())
+	assert.Equal(t, int64(9), stats.published.Load())
+	assert.Equal(t, int64(1), stats.failed.Load())
+	assert.Len(t, publisher.topics, 9)
+	assert.EqualError(t, stats.Err(), "not connected (x1)")
+}
+
+func TestSenderStats_Concurrent(t *testing.T) {
+	stats := newSenderStats()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stats.published.Add(1)
+				stats.recordError(errors.New("timeout"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1000), stats.published.Load())
+	assert.Equal(t, int64(1000), stats.failed.Load())
+	assert.EqualError(t, stats.Err(), "timeout (x1000)")
+	assert.NoError(t, newSenderStats().Err())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDeviceID = "0a0e35e6-eeba-49ea-a02f-444a722fabe1" // Test Temperature Sensor
+	maxQoS          = 2
+)
+
+// senderOptions holds the command line options of the test sender
+type senderOptions struct {
+	QoS       byte
+	Retained  bool
+	Interval  time.Duration
+	DeviceIDs []string
+	Count     int // number of batches to send before exiting; 0 runs until interrupted
+}
+
+// parseSenderOptions parses the command line flags, using defaultQoS when -qos is not given
+func parseSenderOptions(args []string, defaultQoS byte) (*senderOptions, error) {
+	fs := flag.NewFlagSet("mqtt-test", flag.ContinueOnError)
+	qos := fs.Int("qos", int(defaultQoS), "MQTT QoS level for published messages (0, 1 or 2)")
+	retained := fs.Bool("retained", false, "publish messages with the retained flag")
+	interval := fs.Duration("interval", dataSendInterval, "interval between data batches")
+	devices := fs.String("device", defaultDeviceID, "comma-separated device IDs to send data for")
+	count := fs.Int("count", 0, "number of data batches to send before exiting (0 runs until interrupted)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *qos < 0 || *qos > maxQoS {
+		return nil, fmt.Errorf("invalid -qos %d: must be 0, 1 or 2", *qos)
+	}
+
+	if *interval <= 0 {
+		return nil, fmt.Errorf("invalid -interval %s: must be positive", *interval)
+	}
+
+	if *count < 0 {
+		return nil, fmt.Errorf("invalid -count %d: must not be negative", *count)
+	}
+
+	var deviceIDs []string
+	for _, id := range strings.Split(*devices, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+	if len(deviceIDs) == 0 {
+		return nil, fmt.Errorf("at least one -device is required")
+	}
+
+	return &senderOptions{
+		QoS:       byte(*qos),
+		Retained:  *retained,
+		Interval:  *interval,
+		DeviceIDs: deviceIDs,
+		Count:     *count,
+	}, nil
+}
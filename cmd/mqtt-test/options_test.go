@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/mqtt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSenderOptions(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		opts, err := parseSenderOptions(nil, 1)
+		require.NoError(t, err)
+		assert.Equal(t, byte(1), opts.QoS)
+		assert.False(t, opts.Retained)
+		assert.Equal(t, dataSendInterval, opts.Interval)
+		assert.Equal(t, []string{defaultDeviceID}, opts.DeviceIDs)
+		assert.Equal(t, 0, opts.Count)
+	})
+
+	t.Run("all flags", func(t *testing.T) {
+		opts, err := parseSenderOptions([]string{
+			"-qos", "2", "-retained", "-interval", "500ms", "-device", "device001, device002", "-count", "10",
+		}, 1)
+		require.NoError(t, err)
+		assert.Equal(t, byte(2), opts.QoS)
+		assert.True(t, opts.Retained)
+		assert.Equal(t, 500*time.Millisecond, opts.Interval)
+		assert.Equal(t, []string{"device001", "device002"}, opts.DeviceIDs)
+		assert.Equal(t, 10, opts.Count)
+	})
+
+	invalid := map[string][]string{
+		"qos out of range":  {"-qos", "3"},
+		"negative qos":      {"-qos", "-1"},
+		"zero interval":     {"-interval", "0s"},
+		"empty device list": {"-device", " , "},
+		"negative count":    {"-count", "-1"},
+		"unknown flag":      {"-verbose"},
+	}
+	for name, args := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSenderOptions(args, 1)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSenderTopics(t *testing.T) {
+	opts, err := parseSenderOptions([]string{"-device", "device001"}, 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, "devices/device001/data", mqtt.DeviceDataTopic("", opts.DeviceIDs[0]))
+	assert.Equal(t, "tenant-a/devices/device001/status", mqtt.DeviceStatusTopic("tenant-a", opts.DeviceIDs[0]))
+}
@@ -1,15 +1,14 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log"
-	"math/rand"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"iot-platform-go/internal/background"
 	"iot-platform-go/internal/config"
 	"iot-platform-go/internal/mqtt"
 )
@@ -34,6 +33,7 @@ const (
 	// Test data generation constants
 	dataSendInterval   = 5 * time.Second
 	statusSendInterval = 3 // Send status every 3 data batches
+	shutdownTimeout    = 5 * time.Second
 	temperatureBase    = 20.0
 	temperatureRange   = 10.0
 	humidityBase       = 40.0
@@ -52,9 +52,15 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Parse command line options
+	opts, err := parseSenderOptions(os.Args[1:], cfg.MQTT.QoS)
+	if err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+
 	// Create MQTT client
 	mqttConfig := cfg.MQTT
-	mqttConfig.ClientID = "test-sender-" + time.Now().Format("20060102150405")
+	mqttConfig.ClientID = mqtt.ClientID("test-sender", cfg.MQTT.IDStrategy)
 	client := mqtt.NewClient(&mqttConfig)
 
 	// Connect to MQTT broker
@@ -62,101 +68,85 @@ func main() {
 	if err := client.Connect(); err != nil {
 		log.Fatalf("Failed to connect to MQTT broker: %v", err)
 	}
-	defer client.Disconnect()
 
 	log.Println("✅ Connected to MQTT broker")
+	log.Printf("📤 Sending to %d device(s) every %s (QoS %d, retained: %t)",
+		len(opts.DeviceIDs), opts.Interval, opts.QoS, opts.Retained)
+	if opts.Count > 0 {
+		log.Printf("📤 Exiting after %d batches", opts.Count)
+	}
 
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start sending test data
-	go sendTestData(client)
-
-	// Wait for shutdown signal
-	<-sigChan
-	log.Println("🛑 Shutting down test sender...")
-}
+	stats := newSenderStats()
+	done := make(chan struct{})
+	loops := background.NewGroup()
+	loops.Go(func(ctx context.Context) {
+		defer close(done)
+		sendTestData(ctx, client, mqttConfig.TopicPrefix, opts, stats)
+	})
+
+	// Wait for shutdown signal or the last batch
+	select {
+	case <-sigChan:
+		log.Println("🛑 Shutting down test sender...")
+	case <-done:
+	}
 
-func sendTestData(client *mqtt.Client) {
-	// Use the created device ID
-	deviceIDs := []string{
-		"0a0e35e6-eeba-49ea-a02f-444a722fabe1", // Test Temperature Sensor
+	// Let an in-flight batch finish before disconnecting
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := loops.Stop(ctx); err != nil {
+		log.Printf("⚠️ %v", err)
 	}
+	client.Disconnect()
 
-	statuses := []string{"online", "offline", "error", "maintenance"}
+	log.Printf("📊 Sent %d batches: %d messages published, %d failed",
+		stats.batches.Load(), stats.published.Load(), stats.failed.Load())
+	if err := stats.Err(); err != nil {
+		log.Printf("❌ Publish errors:\n%v", err)
+		os.Exit(1)
+	}
+}
 
-	ticker := time.NewTicker(dataSendInterval) // Send data every 5 seconds
+// sendTestData publishes a batch of test data every interval until ctx is done
+// or opts.Count batches have been sent
+func sendTestData(ctx context.Context, client publisher, topicPrefix string, opts *senderOptions, stats *senderStats) {
+	ticker := time.NewTicker(opts.Interval) // Send data every 5 seconds by default
 	defer ticker.Stop()
 
-	counter := 0
-	for range ticker.C {
-		counter++
-
-		// Send device data
-		for _, deviceID := range deviceIDs {
-			// Generate random sensor data
-			data := map[string]interface{}{
-				"temperature": temperatureBase + rand.Float64()*temperatureRange, // 20-30°C
-				"humidity":    humidityBase + rand.Float64()*humidityRange,       // 40-70%
-				"pressure":    pressureBase + rand.Float64()*pressureRange,       // 1000-1050 hPa
-				"voltage":     voltageBase + rand.Float64()*voltageRange,         // 3.0-3.5V
-			}
+	for sequence := 1; opts.Count == 0 || sequence <= opts.Count; sequence++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-			deviceData := DeviceDataMessage{
-				DeviceID:  deviceID,
-				Timestamp: time.Now().Format(time.RFC3339),
-				Data:      data,
-				Metadata: map[string]interface{}{
-					"sequence": counter,
-					"quality":  "good",
-				},
-			}
+		messages, err := buildBatch(sequence, opts.DeviceIDs, topicPrefix, time.Now())
+		if err != nil {
+			stats.recordError(err)
+			log.Printf("❌ Failed to build batch #%d: %v", sequence, err)
+			continue
+		}
 
-			payload, err := json.Marshal(deviceData)
-			if err != nil {
-				log.Printf("❌ Failed to marshal device data: %v", err)
+		for _, msg := range messages {
+			if err := client.PublishWithOptions(msg.Topic, opts.QoS, opts.Retained, msg.Payload); err != nil {
+				stats.recordError(err)
+				log.Printf("❌ Failed to publish to %s: %v", msg.Topic, err)
 				continue
 			}
-
-			topic := fmt.Sprintf("devices/%s/data", deviceID)
-			if err := client.Publish(topic, payload); err != nil {
-				log.Printf("❌ Failed to publish device data: %v", err)
+			stats.published.Add(1)
+			if msg.Status {
+				log.Printf("📤 Sent device status to %s", msg.Topic)
 			} else {
-				log.Printf("📤 Sent device data to %s", topic)
-			}
-		}
-
-		// Send device status (less frequently)
-		if counter%statusSendInterval == 0 { // Every 15 seconds
-			for _, deviceID := range deviceIDs {
-				status := statuses[rand.Intn(len(statuses))]
-
-				deviceStatus := DeviceStatusMessage{
-					DeviceID: deviceID,
-					Status:   status,
-					LastSeen: time.Now().Format(time.RFC3339),
-					Metadata: map[string]interface{}{
-						"battery": batteryBase + rand.Intn(batteryRange), // 80-100%
-						"signal":  signalBase + rand.Intn(signalRange),   // 70-100%
-					},
-				}
-
-				payload, err := json.Marshal(deviceStatus)
-				if err != nil {
-					log.Printf("❌ Failed to marshal device status: %v", err)
-					continue
-				}
-
-				topic := fmt.Sprintf("devices/%s/status", deviceID)
-				if err := client.Publish(topic, payload); err != nil {
-					log.Printf("❌ Failed to publish device status: %v", err)
-				} else {
-					log.Printf("📤 Sent device status to %s: %s", topic, status)
-				}
+				log.Printf("📤 Sent device data to %s", msg.Topic)
 			}
 		}
 
-		log.Printf("📊 Sent test data batch #%d", counter)
+		stats.batches.Add(1)
+		log.Printf("📊 Sent test data batch #%d", sequence)
 	}
 }
@@ -3,67 +3,139 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"iot-platform-go/internal/api"
+	"iot-platform-go/internal/background"
 	"iot-platform-go/internal/config"
 	"iot-platform-go/internal/database"
 	"iot-platform-go/internal/device"
 	"iot-platform-go/internal/influxdb"
+	"iot-platform-go/internal/logging"
+	"iot-platform-go/internal/metrics"
 	"iot-platform-go/internal/mqtt"
+	"iot-platform-go/internal/schema"
 	"iot-platform-go/pkg/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
-// Device data structure for MQTT messages
-type DeviceDataMessage struct {
-	DeviceID  string                 `json:"device_id"`
-	Timestamp string                 `json:"timestamp"`
-	Data      map[string]interface{} `json:"data"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-}
+// statusReplayTimeout bounds the wait for the broker's retained device statuses when subscribing
+const statusReplayTimeout = 2 * time.Second
 
-// Device status structure for MQTT messages
-type DeviceStatusMessage struct {
-	DeviceID string                 `json:"device_id"`
-	Status   string                 `json:"status"`
-	LastSeen string                 `json:"last_seen"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
-}
+// influxHealthCacheTTL is how long an InfluxDB ping result is reused by the health check
+const influxHealthCacheTTL = 10 * time.Second
+
+// mqttHealthCacheTTL is how long an MQTT broker check result is reused by the health check
+const mqttHealthCacheTTL = 10 * time.Second
 
 // Application holds all dependencies
 type Application struct {
 	config       *config.Config
 	db           *database.Database
+	dbReady      *database.Availability
 	deviceRepo   *device.Repository
-	dataRepo     *device.DataRepository
+	dataRepo     device.DataRepositoryInterface
+	dataBuffer   *device.DataBuffer      // nil when readings are saved synchronously
+	lastSeen     *device.LastSeenBatcher // nil when last seen is updated per message
+	rollup       *device.DataRollup      // nil unless old raw data is rolled up
+	eventRepo    *device.EventRepository
+	processor    *MessageProcessor
+	timestamps   device.TimestampPolicy
+	defaults     device.ReadingDefaults
 	influxClient *influxdb.Client
+	influxHealth *influxdb.HealthChecker
 	mqttClient   *mqtt.Client
+	mqttMonitor  *mqtt.Monitor
+	commands     *mqtt.Commands
+	brokerCheck  *mqtt.BrokerCheck // nil unless MQTT_HEALTH_CHECK is enabled
+	mqttLog      *logging.RotatingFile
+	deadLetters  *logging.RotatingFile // nil unless dead letters go to a file
 	router       *gin.Engine
 	server       *http.Server
+	background   *background.Group
 }
 
 // NewApplication creates a new application instance
 func NewApplication(cfg *config.Config) (*Application, error) {
-	// Initialize database
-	db, err := database.New(cfg)
+	// Initialize database. Unless it is required, a database that is down only degrades the server
+	// until the background reconnect succeeds, like the MQTT broker.
+	db, err := database.Open(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %v", err)
 	}
+	dbAvailability := database.NewAvailability(db.Init, cfg.Database.ReconnectInterval)
+	if err := dbAvailability.TryConnect(); err != nil {
+		if cfg.Database.Required {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialize database: %v", err)
+		}
+		log.Printf("⚠️ Database unavailable, starting in degraded mode: %v", err)
+	}
+
+	metrics.Default.RegisterGauge("db_pool", func() interface{} {
+		return db.PoolStats()
+	})
 
 	// Initialize repositories
 	deviceRepo := device.NewRepository(db)
-	dataRepo := device.NewDataRepository(db)
+	postgresDataRepo := device.NewDataRepository(db)
+	eventRepo := device.NewEventRepository(db)
+	if cfg.Data.NormalizeUnits {
+		postgresDataRepo.SetUnitNormalizer(device.NewUnitNormalizer(device.DefaultUnitAliases()))
+	}
+
+	// Serve the latest reading from memory; saves through dataRepo keep it fresh
+	var dataRepo device.DataRepositoryInterface = postgresDataRepo
+	var roller device.DataRoller = postgresDataRepo
+	if cfg.Data.LatestCacheEnabled && cfg.Data.LatestCacheTTL > 0 {
+		cached := device.NewCachedDataRepository(postgresDataRepo, cfg.Data.LatestCacheTTL)
+		dataRepo = cached
+		roller = cached
+	}
+
+	// Average old raw readings into hourly or daily buckets and prune them,
+	// through the cache so it stops serving pruned readings
+	var rollup *device.DataRollup
+	if cfg.Data.RollupEnabled {
+		rollup = device.NewDataRollup(roller, device.RollupPolicy{
+			AfterDays:   cfg.Data.RollupAfterDays,
+			Granularity: cfg.Data.RollupGranularity,
+		}, cfg.Data.RollupInterval)
+	}
+
+	// Retry reading saves that hit a transient database error so a brief outage does not drop readings
+	retryingSaver := device.NewRetryingSaver(dataRepo, device.RetryPolicy{
+		Attempts: cfg.Data.SaveRetryAttempts,
+		Backoff:  cfg.Data.SaveRetryBackoff,
+	})
+
+	// Buffer readings so MQTT handling is not tied to per-row database latency
+	// and batch last seen updates into one statement per flush
+	var dataBuffer *device.DataBuffer
+	var lastSeen *device.LastSeenBatcher
+	if cfg.Data.BufferWrites {
+		capacity := max(device.DefaultBufferCapacity, cfg.Data.BufferSize)
+		dataBuffer = device.NewDataBuffer(retryingSaver, capacity, cfg.Data.BufferSize, cfg.Data.BufferFlushInterval)
+		metrics.Default.RegisterGauge("data_buffer", func() interface{} {
+			return dataBuffer.Stats()
+		})
+		lastSeen = device.NewLastSeenBatcher(deviceRepo, cfg.Data.BufferFlushInterval)
+	}
+
+	// Load the device data schema
+	dataSchema, err := loadDataSchema(cfg.Data)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize InfluxDB client
 	influxClient, err := influxdb.NewClient(&cfg.InfluxDB)
@@ -76,70 +148,252 @@ func NewApplication(cfg *config.Config) (*Application, error) {
 	// Initialize MQTT client
 	mqttConfig := cfg.MQTT
 	mqttConfig.CleanSession = false
-	mqttConfig.ClientID = "iot-platform-server-" + time.Now().Format("20060102150405")
+	mqttConfig.ClientID = mqtt.ClientID(cfg.MQTT.ClientID, cfg.MQTT.IDStrategy)
 	mqttClient := mqtt.NewClient(&mqttConfig)
+	metrics.Default.RegisterGauge("mqtt_publish_queue", func() interface{} {
+		return mqttClient.QueueStats()
+	})
+
+	// Count MQTT messages and keep the unparseable ones
+	deadLetterSink, deadLetters, err := newDeadLetterSink(cfg, mqttClient)
+	if err != nil {
+		log.Printf("⚠️ Failed to open MQTT dead-letter sink: %v", err)
+	}
+	mqttMonitor := mqtt.NewMonitor(metrics.Default, deadLetterSink)
+	if dataBuffer != nil && deadLetterSink != nil {
+		dataBuffer.SetRejectHandler(deadLetterReading(deadLetterSink, cfg.MQTT.TopicPrefix))
+	}
+	mqttMonitor.SetMaxPayloadBytes(cfg.MQTT.MaxPayloadSize)
+
+	// Send commands to devices, correlating the responses they publish back
+	commands := mqtt.NewCommands(mqttClient, cfg.MQTT.TopicPrefix)
+
+	// Check that the broker still accepts publishes when /health is polled
+	var brokerCheck *mqtt.BrokerCheck
+	if cfg.MQTT.HealthCheckEnabled {
+		brokerCheck = mqtt.NewBrokerCheck(mqttClient, cfg.MQTT.TopicPrefix, mqttConfig.ClientID,
+			cfg.MQTT.HealthCheckTimeout, mqttHealthCacheTTL)
+	}
+
+	// Open MQTT receive log
+	mqttLog, err := logging.NewRotatingFile(cfg.Logging.MQTTLogPath, logging.MegabytesToBytes(cfg.Logging.MQTTLogMaxMB))
+	if err != nil {
+		log.Printf("⚠️ Failed to open MQTT receive log: %v", err)
+		mqttLog = nil
+	}
 
 	// Setup Gin router
-	router := gin.Default()
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-	router.Use(corsMiddleware())
+	router, err := newRouter(cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache InfluxDB pings reported by the health check
+	var influxPinger influxdb.Pinger
+	if influxClient != nil {
+		influxPinger = influxClient
+	}
+	influxHealth := influxdb.NewHealthChecker(influxPinger, influxHealthCacheTTL)
+
+	timestamps := device.TimestampPolicy{
+		Source:    cfg.Data.TimestampSource,
+		MaxSkew:   cfg.Data.TimestampMaxSkew,
+		Tolerance: cfg.Data.TimestampTolerance,
+	}
+	defaults := device.ReadingDefaults{
+		DataType: cfg.Data.DefaultDataType,
+		Unit:     cfg.Data.DefaultUnit,
+		Reject:   cfg.Data.RejectMissingType,
+	}
+
+	// Parse and save device messages received over MQTT
+	processor := NewMessageProcessor(deviceRepo, retryingSaver)
+	processor.SetEventRepository(eventRepo)
+	processor.SetBuffers(dataBuffer, lastSeen)
+	processor.SetSchema(dataSchema)
+	processor.SetTimestampPolicy(timestamps)
+	processor.SetReadingDefaults(defaults)
+	if influxClient != nil {
+		processor.SetSeriesWriter(influxClient)
+	}
 
 	app := &Application{
 		config:       cfg,
 		db:           db,
+		dbReady:      dbAvailability,
 		deviceRepo:   deviceRepo,
 		dataRepo:     dataRepo,
+		dataBuffer:   dataBuffer,
+		lastSeen:     lastSeen,
+		rollup:       rollup,
+		eventRepo:    eventRepo,
+		processor:    processor,
+		timestamps:   timestamps,
+		defaults:     defaults,
 		influxClient: influxClient,
+		influxHealth: influxHealth,
 		mqttClient:   mqttClient,
+		mqttMonitor:  mqttMonitor,
+		commands:     commands,
+		brokerCheck:  brokerCheck,
+		mqttLog:      mqttLog,
+		deadLetters:  deadLetters,
 		router:       router,
+		background:   background.NewGroup(),
 	}
 
+	// Keep received messages in the MQTT receive log
+	processor.SetReceiveLog(app.logToFile)
+
 	// Setup routes
 	app.setupRoutes()
 
 	return app, nil
 }
 
+// authMiddleware returns the JWT middleware guarding provisioning and the admin routes, or nil, which leaves
+// those routes unregistered, when JWT_SECRET is not set or is still the public placeholder
+func authMiddleware(cfg config.JWTConfig) gin.HandlerFunc {
+	if !cfg.SecretConfigured() {
+		log.Println("⚠️ JWT_SECRET is not set, provisioning and admin endpoints are disabled")
+		return nil
+	}
+	return api.JWTAuthMiddleware(cfg.Secret)
+}
+
+// newRouter sets the configured gin mode, which gin reads when an engine is created, and builds the router
+func newRouter(cfg config.ServerConfig) (*gin.Engine, error) {
+	gin.SetMode(cfg.Mode)
+	router := api.NewRouter(gin.DefaultWriter, corsMiddleware())
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+	return router, nil
+}
+
+// loadDataSchema returns the schema device data messages are validated against, or nil when validation is disabled
+func loadDataSchema(cfg config.DataConfig) (*schema.Schema, error) {
+	if !cfg.ValidateSchema {
+		return nil, nil
+	}
+	if cfg.SchemaPath == "" {
+		return schema.DeviceData(), nil
+	}
+
+	dataSchema, err := schema.Load(cfg.SchemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device data schema: %w", err)
+	}
+	log.Printf("Validating device data against %s", cfg.SchemaPath)
+	return dataSchema, nil
+}
+
+// newDeadLetterSink returns the configured sink for unparseable MQTT messages and,
+// for the file sink, the file it writes to so it can be closed on shutdown
+func newDeadLetterSink(cfg *config.Config, client *mqtt.Client) (mqtt.DeadLetterSink, *logging.RotatingFile, error) {
+	switch cfg.MQTT.DeadLetterSink {
+	case mqtt.DeadLetterFile:
+		file, err := logging.NewRotatingFile(cfg.MQTT.DeadLetterPath, logging.MegabytesToBytes(cfg.Logging.MQTTLogMaxMB))
+		if err != nil {
+			return nil, nil, err
+		}
+		return mqtt.NewWriterDeadLetterSink(file), file, nil
+	case mqtt.DeadLetterTopic:
+		topic := cfg.MQTT.DeadLetterTopic
+		if topic == "" {
+			topic = mqtt.DeadLetterTopicName(cfg.MQTT.TopicPrefix)
+		}
+		return mqtt.NewTopicDeadLetterSink(client, topic), nil, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// deadLetterReading returns a reject handler sending buffered readings that could not be saved to sink,
+// under the data topic of their device
+func deadLetterReading(sink mqtt.DeadLetterSink, prefix string) func(data *models.DeviceData, err error) {
+	return func(data *models.DeviceData, err error) {
+		payload, encodeErr := json.Marshal(data)
+		if encodeErr != nil {
+			log.Printf("Failed to encode unsaved reading for device %s: %v", data.DeviceID, encodeErr)
+			return
+		}
+
+		topic := mqtt.DeviceDataTopic(prefix, data.DeviceID)
+		letter := mqtt.DeadLetter{Topic: topic, Error: err.Error(), Payload: payload, ReceivedAt: time.Now()}
+		if err := sink.Send(letter); err != nil {
+			log.Printf("Failed to dead-letter unsaved reading from %s: %v", topic, err)
+		}
+	}
+}
+
 // setupRoutes configures all application routes
 func (app *Application) setupRoutes() {
 	// Health check endpoint
 	app.router.GET("/health", app.healthCheckHandler)
+	app.router.GET("/ready", app.readinessHandler)
 
-	// API routes
-	apiGroup := app.router.Group("/api")
-	{
-		// Device routes
-		deviceHandler := api.NewDeviceHandler(app.deviceRepo, app.dataRepo)
-		devices := apiGroup.Group("/devices")
-		{
-			devices.POST("", deviceHandler.CreateDevice)
-			devices.GET("", deviceHandler.GetAllDevices)
-			devices.GET("/:id", deviceHandler.GetDevice)
-			devices.PUT("/:id", deviceHandler.UpdateDevice)
-			devices.DELETE("/:id", deviceHandler.DeleteDevice)
-			devices.GET("/:id/status", deviceHandler.GetDeviceStatus)
-			devices.GET("/:id/data", deviceHandler.GetDeviceData)
-			devices.GET("/:id/data/latest", deviceHandler.GetLatestDeviceData)
-		}
+	// OpenAPI specification
+	app.router.GET("/swagger.json", api.GetSwaggerJSON)
 
-		// InfluxDB routes (if available)
-		if app.influxClient != nil {
-			influxHandler := api.NewInfluxDBHandler(app.influxClient)
-			influx := apiGroup.Group("/influxdb")
-			{
-				influx.GET("/devices/:id/data", influxHandler.GetDeviceDataFromInfluxDB)
-				influx.GET("/devices/:id/data/latest", influxHandler.GetLatestDeviceDataFromInfluxDB)
-			}
+	// Metrics endpoint
+	app.router.GET("/metrics", api.MetricsHandler(metrics.Default))
+
+	// API routes
+	limits := api.Limits{Default: app.config.API.DefaultLimit, Max: app.config.API.MaxLimit}
+	handlers := api.Handlers{
+		Devices:  api.NewDeviceHandler(app.deviceRepo, app.dataRepo),
+		Admin:    api.NewAdminHandler(app.dataRepo),
+		Auth:     authMiddleware(app.config.JWT),
+		Database: api.RequireDatabaseMiddleware(app.dbReady.Ready),
+	}
+	if handlers.Auth != nil {
+		handlers.Identify = api.OptionalJWTMiddleware(app.config.JWT.Secret)
+	}
+	handlers.Devices.SetLimits(limits)
+	handlers.Devices.SetEventRepository(app.eventRepo)
+	handlers.Devices.SetTimestampPolicy(app.timestamps)
+	handlers.Devices.SetReadingDefaults(app.defaults)
+	handlers.Devices.SetCommandSender(app.commands)
+	handlers.Devices.SetSettingsDefaults(device.ParseSettingsDefaults(app.config.Devices.SettingsDefaults))
+	if app.mqttClient != nil && app.config.Devices.PublishSettings {
+		handlers.Devices.SetSettingsPublisher(app.mqttClient)
+	}
+	handlers.Admin.SetConfig(app.config)
+	if app.mqttClient != nil {
+		handlers.Admin.SetMQTTClient(app.mqttClient)
+		handlers.Admin.SetMQTTResubscriber(mqttSubscriptions{app: app})
+	}
+	if app.config.Data.Store == api.DataStoreInfluxDB && app.influxClient == nil {
+		log.Println("⚠️ DATA_STORE is influxdb but InfluxDB is not available, reading device data from PostgreSQL")
+	}
+	if app.influxClient != nil {
+		handlers.Devices.SetSeriesPurger(app.influxClient)
+		handlers.Devices.SetSeriesWriter(app.influxClient)
+		if app.config.Data.Store == api.DataStoreInfluxDB {
+			handlers.Devices.SetInfluxReader(app.influxClient)
 		}
+		handlers.InfluxDB = api.NewInfluxDBHandler(app.influxClient)
+		handlers.InfluxDB.SetLimits(limits)
 	}
+	api.RegisterRoutes(app.router, handlers,
+		api.BodyLimitMiddleware(int64(app.config.Server.MaxBodyBytes)),
+		api.RequireJSONMiddleware(),
+	)
 }
 
 // healthCheckHandler handles health check requests
 func (app *Application) healthCheckHandler(c *gin.Context) {
-	mqttStatus := "disconnected"
-	if app.mqttClient != nil && app.mqttClient.IsConnected() {
-		mqttStatus = "connected"
+	mqttStatus := mqtt.LivenessDisconnected
+	var lastHeartbeat interface{}
+	if app.mqttClient != nil {
+		mqttStatus = app.mqttClient.Liveness()
+		if mqttStatus == mqtt.LivenessConnected && app.brokerCheck != nil {
+			mqttStatus = app.brokerCheck.Status()
+		}
+		if last := app.mqttClient.LastHeartbeatOK(); !last.IsZero() {
+			lastHeartbeat = last.Format(time.RFC3339)
+		}
 	}
 
 	influxStatus := "unavailable"
@@ -148,11 +402,41 @@ func (app *Application) healthCheckHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":        "ok",
-		"message":       "IoT Platform is running",
-		"mqtt_status":   mqttStatus,
-		"influx_status": influxStatus,
-		"timestamp":     time.Now().Format(time.RFC3339),
+		"status":              "ok",
+		"message":             "IoT Platform is running",
+		"mqtt_status":         mqttStatus,
+		"mqtt_last_heartbeat": lastHeartbeat,
+		"influx_status":       influxStatus,
+		"influxdb":            app.influxHealth.Status(c.Request.Context()),
+		"timestamp":           time.Now().Format(time.RFC3339),
+	})
+}
+
+// readinessHandler reports whether the server can serve traffic.
+// The database is required, including in degraded mode; InfluxDB is optional and only reported.
+func (app *Application) readinessHandler(c *gin.Context) {
+	influxStatus := app.influxHealth.Status(c.Request.Context())
+
+	err := app.db.HealthCheck(c.Request.Context())
+	if err == nil && !app.dbReady.Ready() {
+		err = errors.New("database tables are not initialized yet")
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":    "not_ready",
+			"database":  "unhealthy",
+			"influxdb":  influxStatus,
+			"error":     err.Error(),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "ready",
+		"database":  "healthy",
+		"influxdb":  influxStatus,
+		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
 
@@ -173,7 +457,7 @@ func (app *Application) Start() error {
 			log.Printf("✅ MQTT client is ready")
 
 			// Subscribe to MQTT topics
-			if err := app.subscribeToMQTTTopics(); err != nil {
+			if err := app.subscribeToMQTTTopics(app.background.Context()); err != nil {
 				log.Printf("⚠️ Failed to subscribe to MQTT topics: %v", err)
 			} else {
 				log.Printf("✅ Successfully subscribed to MQTT topics")
@@ -183,6 +467,33 @@ func (app *Application) Start() error {
 		}
 	}
 
+	// Check the broker is still there, which paho's IsConnected can miss
+	if app.config.MQTT.HeartbeatEnabled {
+		app.background.Go(app.mqttClient.RunHeartbeat)
+	}
+
+	// Keep connecting to a database that was down at startup
+	if !app.dbReady.Ready() {
+		app.background.Go(app.dbReady.Run)
+	}
+
+	// Start data retention sweep
+	sweeper := device.NewRetentionSweeper(app.dataRepo, app.config.Data.RetentionDays, app.config.Data.RetentionSweepInterval)
+	app.background.Go(sweeper.Run)
+
+	// Start data rollup
+	if app.rollup != nil {
+		app.background.Go(app.rollup.Run)
+	}
+
+	// Start flushing buffered readings
+	if app.dataBuffer != nil {
+		app.background.Go(app.dataBuffer.Run)
+	}
+	if app.lastSeen != nil {
+		app.background.Go(app.lastSeen.Run)
+	}
+
 	// Setup HTTP server
 	addr := fmt.Sprintf("%s:%s", app.config.Server.Host, app.config.Server.Port)
 	app.server = &http.Server{
@@ -193,7 +504,9 @@ func (app *Application) Start() error {
 
 	log.Printf("Starting server on %s", addr)
 	log.Printf("Health check: http://%s/health", addr)
-	log.Printf("API documentation: http://%s/api", addr)
+	log.Printf("API: http://%s%s", addr, api.V1Prefix)
+	log.Printf("API documentation: http://%s/swagger.json", addr)
+	log.Printf("Metrics: http://%s/metrics", addr)
 
 	return app.server.ListenAndServe()
 }
@@ -204,10 +517,30 @@ func (app *Application) Stop(ctx context.Context) error {
 
 	var shutdownErrors []error
 
-	// Disconnect MQTT client
-	if app.mqttClient != nil && app.mqttClient.IsConnected() {
-		app.mqttClient.Disconnect()
-		log.Println("✅ MQTT client disconnected")
+	// Stop ingestion first, so no reading arrives after the data buffer drains or the database closes
+	if app.server != nil {
+		if err := app.server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+			shutdownErrors = append(shutdownErrors, fmt.Errorf("server shutdown error: %w", err))
+		}
+	}
+
+	// Disconnect MQTT client and wait for the messages it is still handling
+	if app.mqttClient != nil {
+		if app.mqttClient.IsConnected() {
+			app.mqttClient.Disconnect()
+			log.Println("✅ MQTT client disconnected")
+		}
+		if err := app.mqttClient.WaitHandlers(ctx); err != nil {
+			log.Printf("Error waiting for MQTT message handlers: %v", err)
+			shutdownErrors = append(shutdownErrors, err)
+		}
+	}
+
+	// Stop background loops, flushing buffered readings, before closing what they use
+	if err := app.background.Stop(ctx); err != nil {
+		log.Printf("Error stopping background loops: %v", err)
+		shutdownErrors = append(shutdownErrors, err)
 	}
 
 	// Close InfluxDB client
@@ -216,6 +549,20 @@ func (app *Application) Stop(ctx context.Context) error {
 		log.Println("✅ InfluxDB client closed")
 	}
 
+	// Close MQTT receive log
+	if app.mqttLog != nil {
+		if err := app.mqttLog.Close(); err != nil {
+			log.Printf("Error closing MQTT receive log: %v", err)
+		}
+	}
+
+	// Close MQTT dead-letter file
+	if app.deadLetters != nil {
+		if err := app.deadLetters.Close(); err != nil {
+			log.Printf("Error closing MQTT dead-letter file: %v", err)
+		}
+	}
+
 	// Close database
 	if app.db != nil {
 		if err := app.db.Close(); err != nil {
@@ -224,14 +571,6 @@ func (app *Application) Stop(ctx context.Context) error {
 		}
 	}
 
-	// Shutdown HTTP server
-	if app.server != nil {
-		if err := app.server.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down server: %v", err)
-			shutdownErrors = append(shutdownErrors, fmt.Errorf("server shutdown error: %w", err))
-		}
-	}
-
 	log.Println("✅ Server shutdown complete")
 
 	// Return error if any shutdown operations failed
@@ -242,214 +581,96 @@ func (app *Application) Stop(ctx context.Context) error {
 	return nil
 }
 
-// subscribeToMQTTTopics subscribes to device data and status topics
-func (app *Application) subscribeToMQTTTopics() error {
+// subscribeToMQTTTopics subscribes to device data and status topics, giving up once ctx is done
+func (app *Application) subscribeToMQTTTopics(ctx context.Context) error {
+	prefix := app.config.MQTT.TopicPrefix
+	dataTopic := mqtt.DeviceDataTopic(prefix, mqtt.SingleLevelWildcard)
+	statusTopic := mqtt.DeviceStatusTopic(prefix, mqtt.SingleLevelWildcard)
+	responseTopic := mqtt.DeviceCommandResponseTopic(prefix, mqtt.SingleLevelWildcard)
+	allTopic := mqtt.AllDevicesTopic(prefix)
+
 	// Subscribe to device data topics with wildcard
-	if err := app.mqttClient.Subscribe("devices/+/data", app.handleDeviceData); err != nil {
+	if err := app.mqttClient.SubscribeContext(ctx, dataTopic, app.mqttMonitor.Wrap(dataTopic, app.processor.HandleDeviceData)); err != nil {
 		return fmt.Errorf("failed to subscribe to device data topics: %v", err)
 	}
 
-	// Subscribe to device status topics with wildcard
-	if err := app.mqttClient.Subscribe("devices/+/status", app.handleDeviceStatus); err != nil {
+	// Subscribe to device status topics with wildcard, seeding statuses from retained messages
+	replayed, err := app.mqttClient.SubscribeAndWaitContext(ctx, statusTopic, app.mqttMonitor.Wrap(statusTopic, app.processor.HandleDeviceStatus), statusReplayTimeout)
+	if err != nil {
 		return fmt.Errorf("failed to subscribe to device status topics: %v", err)
 	}
+	if !replayed {
+		log.Printf("No retained device status received within %s", statusReplayTimeout)
+	}
+
+	// Subscribe to device responses to the commands the server sends
+	if err := app.mqttClient.SubscribeContext(ctx, responseTopic, app.mqttMonitor.Guard(responseTopic, app.commands.HandleResponse)); err != nil {
+		return fmt.Errorf("failed to subscribe to device command responses: %v", err)
+	}
 
 	// Subscribe to all device topics (optional - for debugging)
-	if err := app.mqttClient.Subscribe("devices/#", app.handleAllDeviceMessages); err != nil {
+	if err := app.mqttClient.SubscribeContext(ctx, allTopic, app.mqttMonitor.Guard(allTopic, app.handleAllDeviceMessages)); err != nil {
 		log.Printf("⚠️ Failed to subscribe to all device topics: %v", err)
 	}
 
 	log.Println("📡 Subscribed to MQTT topics:")
-	log.Println("   - devices/+/data (device data)")
-	log.Println("   - devices/+/status (device status)")
-	log.Println("   - devices/# (all device messages - debug)")
+	log.Printf("   - %s (device data)", dataTopic)
+	log.Printf("   - %s (device status)", statusTopic)
+	log.Printf("   - %s (device command responses)", responseTopic)
+	log.Printf("   - %s (all device messages - debug)", allTopic)
 
 	return nil
 }
 
-// handleDeviceData processes incoming device data messages
-func (app *Application) handleDeviceData(topic string, payload []byte) {
-	msg := fmt.Sprintf("📡 RECEIVED DEVICE DATA from %s: %s", topic, string(payload))
-	log.Println(msg)
-	logToFile(msg)
-
-	// Parse the JSON payload
-	var deviceData DeviceDataMessage
-	if err := json.Unmarshal(payload, &deviceData); err != nil {
-		log.Printf("❌ Failed to parse device data JSON: %v", err)
-		log.Printf("   Raw payload: %s", string(payload))
-		return
-	}
-
-	// Validate required fields
-	if deviceData.DeviceID == "" {
-		log.Printf("❌ Device data missing required field: device_id")
-		return
-	}
-
-	if deviceData.Timestamp == "" {
-		log.Printf("❌ Device data missing required field: timestamp")
-		return
-	}
-
-	// Parse timestamp
-	timestamp, err := time.Parse(time.RFC3339, deviceData.Timestamp)
-	if err != nil {
-		log.Printf("❌ Failed to parse timestamp '%s': %v", deviceData.Timestamp, err)
-		return
-	}
-
-	// Log the received data
-	log.Printf("✅ Processed device data:")
-	log.Printf("   Device ID: %s", deviceData.DeviceID)
-	log.Printf("   Timestamp: %s", timestamp.Format(time.RFC3339))
-	log.Printf("   Data points: %d", len(deviceData.Data))
-
-	// Check if device exists first
-	_, err = app.deviceRepo.GetByID(deviceData.DeviceID)
-	if err != nil {
-		log.Printf("⚠️ Device %s not found in database, skipping data save", deviceData.DeviceID)
-		return
-	}
-
-	// Save each data point to database
-	savedCount := 0
-	for dataType, value := range deviceData.Data {
-		// Convert value to float64
-		var floatValue float64
-		switch v := value.(type) {
-		case float64:
-			floatValue = v
-		case int:
-			floatValue = float64(v)
-		case int64:
-			floatValue = float64(v)
-		case string:
-			// Try to parse string as float
-			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
-				floatValue = parsed
-			} else {
-				log.Printf("⚠️ Skipping non-numeric value for %s: %v", dataType, v)
-				continue
-			}
-		default:
-			log.Printf("⚠️ Skipping unsupported value type for %s: %T", dataType, v)
-			continue
-		}
-
-		// Create device data record
-		dataRecord := &models.DeviceData{
-			ID:        uuid.New().String(),
-			DeviceID:  deviceData.DeviceID,
-			Timestamp: timestamp,
-			DataType:  dataType,
-			Value:     floatValue,
-			Unit:      "", // TODO: Extract unit from metadata if available
-			Metadata:  "", // TODO: Extract metadata if available
-		}
-
-		// Save to database
-		if err := app.dataRepo.SaveData(dataRecord); err != nil {
-			log.Printf("❌ Failed to save data for %s: %v", dataType, err)
-			continue
-		}
-
-		// Save to InfluxDB if available
-		if app.influxClient != nil {
-			if err := app.influxClient.WriteDeviceData(dataRecord); err != nil {
-				log.Printf("⚠️ Failed to save data to InfluxDB for %s: %v", dataType, err)
-			} else {
-				log.Printf("📊 Saved data point to InfluxDB: %s = %.2f", dataType, floatValue)
-			}
-		}
-
-		savedCount++
-		log.Printf("💾 Saved data point: %s = %.2f", dataType, floatValue)
-	}
-
-	log.Printf("📊 Successfully saved %d/%d data points to database", savedCount, len(deviceData.Data))
-
-	// Update device status to online
-	if err := app.deviceRepo.UpdateStatus(deviceData.DeviceID, "online"); err != nil {
-		log.Printf("⚠️ Failed to update device status: %v", err)
-	} else {
-		log.Printf("✅ Updated device status to online")
-	}
+// mqttSubscriptions lets the admin API resubscribe the server's MQTT topics
+type mqttSubscriptions struct {
+	app *Application
 }
 
-// handleDeviceStatus processes incoming device status messages
-func (app *Application) handleDeviceStatus(topic string, payload []byte) {
-	msg := fmt.Sprintf("📡 RECEIVED DEVICE STATUS from %s: %s", topic, string(payload))
-	log.Println(msg)
-	logToFile(msg)
-
-	// Parse the JSON payload
-	var deviceStatus DeviceStatusMessage
-	if err := json.Unmarshal(payload, &deviceStatus); err != nil {
-		log.Printf("❌ Failed to parse device status JSON: %v", err)
-		log.Printf("   Raw payload: %s", string(payload))
-		return
-	}
+// UnsubscribeAll unsubscribes every topic the server subscribed to
+func (s mqttSubscriptions) UnsubscribeAll() error {
+	return s.app.mqttClient.UnsubscribeAll()
+}
 
-	// Validate required fields
-	if deviceStatus.DeviceID == "" {
-		log.Printf("❌ Device status missing required field: device_id")
-		return
-	}
+// SubscribeAll subscribes the device topics under the configured prefix
+func (s mqttSubscriptions) SubscribeAll() error {
+	return s.app.subscribeToMQTTTopics(s.app.background.Context())
+}
 
-	if deviceStatus.Status == "" {
-		log.Printf("❌ Device status missing required field: status")
+// handleAllDeviceMessages processes all device messages for debugging
+func (app *Application) handleAllDeviceMessages(topic string, payload []byte) {
+	// The server's own heartbeat and health check are not device messages
+	if topic == mqtt.HeartbeatTopic(app.config.MQTT.TopicPrefix) || topic == mqtt.HealthTopic(app.config.MQTT.TopicPrefix) {
 		return
 	}
 
-	// Parse last seen timestamp if provided
-	var lastSeen time.Time
-	var err error
-	if deviceStatus.LastSeen != "" {
-		lastSeen, err = time.Parse(time.RFC3339, deviceStatus.LastSeen)
-		if err != nil {
-			log.Printf("❌ Failed to parse last_seen timestamp '%s': %v", deviceStatus.LastSeen, err)
-			lastSeen = time.Now()
-		}
-	} else {
-		lastSeen = time.Now()
-	}
-
-	// Log the received status
-	log.Printf("✅ Processed device status:")
-	log.Printf("   Device ID: %s", deviceStatus.DeviceID)
-	log.Printf("   Status: %s", deviceStatus.Status)
-	log.Printf("   Last Seen: %s", lastSeen.Format(time.RFC3339))
-
-	// Check if device exists first
-	_, err = app.deviceRepo.GetByID(deviceStatus.DeviceID)
-	if err != nil {
-		log.Printf("⚠️ Device %s not found in database, skipping status update", deviceStatus.DeviceID)
+	// Nor are the settings it publishes to devices
+	if mqtt.MatchTopic(mqtt.DeviceConfigTopic(app.config.MQTT.TopicPrefix, mqtt.SingleLevelWildcard), topic) {
 		return
 	}
 
-	// Update device status in database
-	if err := app.deviceRepo.UpdateStatus(deviceStatus.DeviceID, deviceStatus.Status); err != nil {
-		log.Printf("❌ Failed to update device status in database: %v", err)
+	// This subscription overlaps the command responses one, which either may receive
+	if mqtt.MatchTopic(mqtt.DeviceCommandResponseTopic(app.config.MQTT.TopicPrefix, mqtt.SingleLevelWildcard), topic) {
+		app.commands.HandleResponse(topic, payload)
 		return
 	}
 
-	log.Printf("💾 Successfully updated device status in database")
-}
-
-// handleAllDeviceMessages processes all device messages for debugging
-func (app *Application) handleAllDeviceMessages(topic string, payload []byte) {
 	// Only log if it's not already handled by specific handlers
 	if !strings.HasSuffix(topic, "/data") && !strings.HasSuffix(topic, "/status") {
 		msg := fmt.Sprintf("📡 RECEIVED OTHER DEVICE MESSAGE from %s: %s", topic, string(payload))
 		log.Println(msg)
-		logToFile(msg)
+		app.logToFile(msg)
 	}
 }
 
 func main() {
 	// Load configuration
 	cfg := config.Load()
+	logging.SetLevel(cfg.Logging.Level)
+	logging.SetFormat(cfg.Logging.Format)
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Create application
 	app, err := NewApplication(cfg)
@@ -486,7 +707,7 @@ func main() {
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 
 		if c.Request.Method == "OPTIONS" {
@@ -499,17 +720,14 @@ func corsMiddleware() gin.HandlerFunc {
 }
 
 // --- ファイル出力用の関数 ---
-func logToFile(message string) {
-	logFile, err := os.OpenFile("cmd/server/mqtt-received.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Printf("Failed to open mqtt-received.log: %v", err)
+func (app *Application) logToFile(message string) {
+	if app.mqttLog == nil {
 		return
 	}
-	defer logFile.Close()
 
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logEntry := fmt.Sprintf("[%s] %s\n", timestamp, message)
-	if _, err := logFile.WriteString(logEntry); err != nil {
-		log.Printf("Failed to write to mqtt-received.log: %v", err)
+	logEntry := fmt.Sprintf("[%s] %s\n", timestamp, logging.Sanitize(message))
+	if _, err := app.mqttLog.Write([]byte(logEntry)); err != nil {
+		log.Printf("Failed to write to %s: %v", app.mqttLog.Path(), err)
 	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"iot-platform-go/internal/api"
+	"iot-platform-go/internal/config"
+	"iot-platform-go/internal/device"
+	"iot-platform-go/internal/mqtt"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRouter_SetsModeFromConfig(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+
+	for _, mode := range []string{gin.ReleaseMode, gin.DebugMode, gin.TestMode} {
+		t.Run(mode, func(t *testing.T) {
+			router, err := newRouter(config.ServerConfig{Mode: mode, TrustedProxies: []string{"127.0.0.1"}})
+			require.NoError(t, err)
+			assert.NotNil(t, router)
+			assert.Equal(t, mode, gin.Mode())
+		})
+	}
+}
+
+func TestNewRouter_InvalidTrustedProxies(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+
+	_, err := newRouter(config.ServerConfig{Mode: gin.TestMode, TrustedProxies: []string{"not-an-ip"}})
+	assert.Error(t, err)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+
+	router, err := newRouter(config.ServerConfig{Mode: gin.TestMode})
+	require.NoError(t, err)
+	api.RegisterRoutes(router, api.Handlers{Devices: api.NewDeviceHandler(device.NewMockRepository(), nil)})
+
+	// Browsers preflight every method that is not GET, HEAD or POST
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api/v1/devices/test-id/metadata", nil)
+			req.Header.Set("Origin", "http://example.com")
+			req.Header.Set("Access-Control-Request-Method", method)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.Contains(t, strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", "), method)
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		registered bool
+	}{
+		{name: "secret not set", secret: "", registered: false},
+		{name: "placeholder secret", secret: config.DefaultJWTSecret, registered: false},
+		{name: "secret set", secret: "a-real-secret", registered: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := authMiddleware(config.JWTConfig{Secret: tt.secret})
+			assert.Equal(t, tt.registered, auth != nil)
+		})
+	}
+}
+
+// recordingSink keeps the dead letters sent to it
+type recordingSink struct {
+	letters []mqtt.DeadLetter
+}
+
+func (s *recordingSink) Send(letter mqtt.DeadLetter) error {
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+func TestDeadLetterReading(t *testing.T) {
+	sink := &recordingSink{}
+	reading := &models.DeviceData{ID: "data-1", DeviceID: "device-1", DataType: "temperature", Value: 21.5}
+
+	deadLetterReading(sink, "factory")(reading, errors.New("foreign key violation"))
+
+	require.Len(t, sink.letters, 1)
+	letter := sink.letters[0]
+	assert.Equal(t, mqtt.DeviceDataTopic("factory", "device-1"), letter.Topic)
+	assert.Equal(t, "foreign key violation", letter.Error)
+
+	var payload models.DeviceData
+	require.NoError(t, json.Unmarshal(letter.Payload, &payload))
+	assert.Equal(t, "data-1", payload.ID)
+	assert.Equal(t, 21.5, payload.Value)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"iot-platform-go/internal/api"
+	"iot-platform-go/internal/device"
+	"iot-platform-go/internal/schema"
+	"iot-platform-go/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// statusChangeActor is the actor recorded for status changes reported over MQTT
+const statusChangeActor = "mqtt"
+
+// Device data structure for MQTT messages
+type DeviceDataMessage struct {
+	DeviceID  string                 `json:"device_id"`
+	Timestamp json.RawMessage        `json:"timestamp"` // RFC3339 string or Unix seconds/millis
+	Data      map[string]interface{} `json:"data"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	DedupKey  string                 `json:"dedup_key,omitempty"`
+
+	// A single value, saved as a reading of DataType and Unit, which are defaulted when missing
+	Value    *float64 `json:"value,omitempty"`
+	DataType string   `json:"data_type,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+}
+
+// Device status structure for MQTT messages
+type DeviceStatusMessage struct {
+	DeviceID string                 `json:"device_id"`
+	Status   string                 `json:"status"`
+	LastSeen string                 `json:"last_seen"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MessageProcessor parses device data and status messages received over MQTT and persists them
+type MessageProcessor struct {
+	devices    device.RepositoryInterface
+	data       device.ReadingSaver
+	events     device.EventRepositoryInterface // nil disables the audit log
+	series     api.SeriesWriter                // nil writes readings to PostgreSQL only
+	buffer     *device.DataBuffer              // nil saves readings synchronously
+	lastSeen   *device.LastSeenBatcher         // nil updates last seen per message
+	schema     *schema.Schema                  // nil disables validation
+	timestamps device.TimestampPolicy
+	defaults   device.ReadingDefaults
+	receiveLog func(message string)
+	now        func() time.Time
+}
+
+// NewMessageProcessor creates a message processor that saves readings synchronously
+func NewMessageProcessor(devices device.RepositoryInterface, data device.ReadingSaver) *MessageProcessor {
+	return &MessageProcessor{
+		devices:    devices,
+		data:       data,
+		receiveLog: func(string) {},
+		now:        time.Now,
+	}
+}
+
+// SetEventRepository sets the repository status changes are recorded to
+func (p *MessageProcessor) SetEventRepository(events device.EventRepositoryInterface) {
+	p.events = events
+}
+
+// SetSeriesWriter sets where saved readings are also written
+func (p *MessageProcessor) SetSeriesWriter(writer api.SeriesWriter) {
+	p.series = writer
+}
+
+// SetBuffers batches reading saves and last seen updates; either may be nil.
+// Buffered readings are written to the series writer once the buffer has stored them,
+// so it must be called before the buffer runs.
+func (p *MessageProcessor) SetBuffers(buffer *device.DataBuffer, lastSeen *device.LastSeenBatcher) {
+	p.buffer = buffer
+	p.lastSeen = lastSeen
+	if buffer != nil {
+		buffer.SetSaveHandler(p.writeSeries)
+	}
+}
+
+// SetSchema sets the schema device data payloads are validated against
+func (p *MessageProcessor) SetSchema(dataSchema *schema.Schema) {
+	p.schema = dataSchema
+}
+
+// SetTimestampPolicy sets how device timestamps are parsed and resolved
+func (p *MessageProcessor) SetTimestampPolicy(policy device.TimestampPolicy) {
+	p.timestamps = policy
+}
+
+// SetReadingDefaults sets the data type and unit given to single values sent without them
+func (p *MessageProcessor) SetReadingDefaults(defaults device.ReadingDefaults) {
+	p.defaults = defaults
+}
+
+// SetReceiveLog sets where received messages are logged besides the standard log
+func (p *MessageProcessor) SetReceiveLog(fn func(message string)) {
+	p.receiveLog = fn
+}
+
+// HandleDeviceData processes incoming device data messages.
+// It returns an error only when the payload cannot be parsed, so the message is dead-lettered.
+func (p *MessageProcessor) HandleDeviceData(topic string, payload []byte) error {
+	msg := fmt.Sprintf("📡 RECEIVED DEVICE DATA from %s: %s", topic, string(payload))
+	log.Println(msg)
+	p.receiveLog(msg)
+
+	// Reject payloads that do not match the schema, listing every invalid field
+	if p.schema != nil {
+		if err := p.schema.Validate(payload); err != nil {
+			return err
+		}
+	}
+
+	// Parse the JSON payload
+	var deviceData DeviceDataMessage
+	if err := json.Unmarshal(payload, &deviceData); err != nil {
+		return fmt.Errorf("failed to parse device data JSON: %w", err)
+	}
+
+	// Validate required fields
+	if deviceData.DeviceID == "" {
+		return errors.New("device data missing required field: device_id")
+	}
+
+	if len(deviceData.Timestamp) == 0 || string(deviceData.Timestamp) == "null" {
+		return errors.New("device data missing required field: timestamp")
+	}
+
+	// Parse timestamp
+	timestamp, err := p.parseTimestamp(deviceData.Timestamp)
+	if err != nil {
+		return err
+	}
+	timestamp = p.resolveTimestamp(deviceData.DeviceID, timestamp)
+
+	// A single value needs a data type, sent or defaulted
+	var valueType, valueUnit string
+	if deviceData.Value != nil {
+		valueType, valueUnit, err = p.defaults.Apply(deviceData.DataType, deviceData.Unit)
+		if err != nil {
+			return fmt.Errorf("invalid device data value: %w", err)
+		}
+	}
+
+	// Log the received data
+	log.Printf("✅ Processed device data:")
+	log.Printf("   Device ID: %s", deviceData.DeviceID)
+	log.Printf("   Timestamp: %s", timestamp.Format(time.RFC3339))
+	log.Printf("   Data points: %d", len(deviceData.Data))
+
+	// Check if device exists first
+	existing, err := p.devices.GetByID(deviceData.DeviceID)
+	if err != nil {
+		log.Printf("⚠️ Device %s not found in database, skipping data save", deviceData.DeviceID)
+		return nil
+	}
+	previousStatus := existing.Status
+
+	// Any received reading counts as activity, even if individual points fail to save
+	if p.lastSeen != nil {
+		p.lastSeen.Touch(deviceData.DeviceID, p.now())
+	} else if err := p.devices.Touch(deviceData.DeviceID, p.now()); err != nil {
+		log.Printf("⚠️ Failed to update device last seen: %v", err)
+	}
+
+	// Numeric values become data points; anything else is kept as metadata on those points
+	readings, extras := device.SplitReadings(deviceData.Data)
+	for dataType, value := range extras {
+		log.Printf("⚠️ Storing non-numeric value for %s as metadata: %v", dataType, value)
+	}
+	metadata := device.ExtrasMetadata(extras)
+	units := make(map[string]string)
+	if deviceData.Value != nil {
+		readings[valueType] = *deviceData.Value
+		units[valueType] = valueUnit
+	}
+
+	// Save each data point to database
+	savedCount := 0
+	for dataType, floatValue := range readings {
+
+		// Create device data record
+		dataRecord := &models.DeviceData{
+			ID:        uuid.New().String(),
+			DeviceID:  deviceData.DeviceID,
+			Timestamp: timestamp,
+			DataType:  dataType,
+			Value:     floatValue,
+			Unit:      units[dataType],
+			Metadata:  metadata,
+		}
+
+		// The message-level dedup key covers all readings, so scope it per data type
+		if deviceData.DedupKey != "" {
+			dataRecord.DedupKey = deviceData.DedupKey + ":" + dataType
+		}
+
+		// Save to database
+		inserted, err := p.saveData(dataRecord)
+		if err != nil {
+			log.Printf("❌ Failed to save data for %s: %v", dataType, err)
+			continue
+		}
+		if !inserted {
+			log.Printf("🔁 Skipping duplicate data point: %s (dedup key %s)", dataType, dataRecord.DedupKey)
+			continue
+		}
+
+		savedCount++
+		log.Printf("💾 Saved data point: %s = %.2f", dataType, floatValue)
+	}
+
+	log.Printf("📊 Successfully saved %d/%d data points to database", savedCount, len(readings))
+
+	// Update device status to online
+	if err := p.devices.UpdateStatus(deviceData.DeviceID, "online"); err != nil {
+		log.Printf("⚠️ Failed to update device status: %v", err)
+	} else {
+		log.Printf("✅ Updated device status to online")
+		p.recordStatusChange(existing.ID, previousStatus, "online")
+	}
+
+	return nil
+}
+
+// saveData saves a reading, through the buffer when buffering is enabled, and writes stored readings to the series writer.
+// Buffered readings count as inserted; duplicates among them are dropped, and the rest written, when the buffer flushes.
+func (p *MessageProcessor) saveData(data *models.DeviceData) (bool, error) {
+	if p.buffer != nil {
+		err := p.buffer.Enqueue(context.Background(), data)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, device.ErrBufferClosed) {
+			return false, err
+		}
+		// Shutting down; save directly rather than lose the reading
+	}
+
+	inserted, err := p.data.SaveData(data)
+	if err == nil && inserted {
+		p.writeSeries(data)
+	}
+	return inserted, err
+}
+
+// writeSeries writes a stored reading to InfluxDB if available
+func (p *MessageProcessor) writeSeries(data *models.DeviceData) {
+	if p.series == nil {
+		return
+	}
+	if err := p.series.WriteDeviceData(context.Background(), data); err != nil {
+		log.Printf("⚠️ Failed to save data to InfluxDB for %s: %v", data.DataType, err)
+	} else {
+		log.Printf("📊 Saved data point to InfluxDB: %s = %.2f", data.DataType, data.Value)
+	}
+}
+
+// parseTimestamp parses a device data timestamp with the configured tolerance.
+// A flexible tolerance falls back to the receive time as a last resort.
+func (p *MessageProcessor) parseTimestamp(raw json.RawMessage) (time.Time, error) {
+	tolerance := p.timestamps.Tolerance
+	timestamp, err := device.ParseTimestamp(raw, tolerance)
+	if err == nil {
+		return timestamp, nil
+	}
+	if tolerance == device.TimestampStrict {
+		return time.Time{}, fmt.Errorf("failed to parse timestamp %s: %w", raw, err)
+	}
+
+	log.Printf("⚠️ Failed to parse timestamp %s, using receive time: %v", raw, err)
+	return p.now(), nil
+}
+
+// resolveTimestamp applies the configured timestamp source to a device's timestamp, logging when it is clamped
+func (p *MessageProcessor) resolveTimestamp(deviceID string, deviceTime time.Time) time.Time {
+	timestamp, clamped := p.timestamps.Resolve(deviceTime, p.now())
+	if clamped {
+		log.Printf("⚠️ Clamped timestamp %s from device %s to %s", deviceTime.Format(time.RFC3339), deviceID, timestamp.Format(time.RFC3339))
+	}
+	return timestamp
+}
+
+// HandleDeviceStatus processes incoming device status messages.
+// It returns an error only when the payload cannot be parsed, so the message is dead-lettered.
+func (p *MessageProcessor) HandleDeviceStatus(topic string, payload []byte) error {
+	msg := fmt.Sprintf("📡 RECEIVED DEVICE STATUS from %s: %s", topic, string(payload))
+	log.Println(msg)
+	p.receiveLog(msg)
+
+	// Parse the JSON payload
+	var deviceStatus DeviceStatusMessage
+	if err := json.Unmarshal(payload, &deviceStatus); err != nil {
+		return fmt.Errorf("failed to parse device status JSON: %w", err)
+	}
+
+	// Validate required fields
+	if deviceStatus.DeviceID == "" {
+		return errors.New("device status missing required field: device_id")
+	}
+
+	if deviceStatus.Status == "" {
+		return errors.New("device status missing required field: status")
+	}
+
+	// Parse last seen timestamp if provided
+	var lastSeen time.Time
+	var err error
+	if deviceStatus.LastSeen != "" {
+		lastSeen, err = time.Parse(time.RFC3339, deviceStatus.LastSeen)
+		if err != nil {
+			log.Printf("❌ Failed to parse last_seen timestamp '%s': %v", deviceStatus.LastSeen, err)
+			lastSeen = p.now()
+		}
+	} else {
+		lastSeen = p.now()
+	}
+
+	// Log the received status
+	log.Printf("✅ Processed device status:")
+	log.Printf("   Device ID: %s", deviceStatus.DeviceID)
+	log.Printf("   Status: %s", deviceStatus.Status)
+	log.Printf("   Last Seen: %s", lastSeen.Format(time.RFC3339))
+
+	// Check if device exists first
+	existing, err := p.devices.GetByID(deviceStatus.DeviceID)
+	if err != nil {
+		log.Printf("⚠️ Device %s not found in database, skipping status update", deviceStatus.DeviceID)
+		return nil
+	}
+	previousStatus := existing.Status
+
+	// Update device status in database
+	if err := p.devices.UpdateStatus(deviceStatus.DeviceID, deviceStatus.Status); err != nil {
+		log.Printf("❌ Failed to update device status in database: %v", err)
+		return nil
+	}
+
+	log.Printf("💾 Successfully updated device status in database")
+	p.recordStatusChange(existing.ID, previousStatus, deviceStatus.Status)
+	return nil
+}
+
+// recordStatusChange appends a status change to the device's audit log when the status differs from before
+func (p *MessageProcessor) recordStatusChange(deviceID, previous, status string) {
+	if p.events == nil || previous == status {
+		return
+	}
+
+	details := map[string]string{"from": previous, "to": status}
+	event, err := device.NewEvent(deviceID, models.EventStatusChanged, statusChangeActor, details)
+	if err == nil {
+		err = p.events.Record(event)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to record status change for device %s: %v", deviceID, err)
+	}
+}
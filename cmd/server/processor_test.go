@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/background"
+	"iot-platform-go/internal/device"
+	"iot-platform-go/internal/schema"
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSaver keeps saved readings, reporting duplicates of an already saved dedup key
+type recordingSaver struct {
+	mu    sync.Mutex
+	saved []*models.DeviceData
+	err   error
+}
+
+func (s *recordingSaver) SaveData(data *models.DeviceData) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	for _, existing := range s.saved {
+		if data.DedupKey != "" && existing.DedupKey == data.DedupKey {
+			return false, nil
+		}
+	}
+	s.saved = append(s.saved, data)
+	return true, nil
+}
+
+func (s *recordingSaver) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	var inserted []*models.DeviceData
+	for _, d := range data {
+		ok, err := s.SaveData(d)
+		if err != nil {
+			return inserted, err
+		}
+		if ok {
+			inserted = append(inserted, d)
+		}
+	}
+	return inserted, nil
+}
+
+// recordingWriter keeps readings written to secondary storage
+type recordingWriter struct {
+	written []*models.DeviceData
+}
+
+func (w *recordingWriter) WriteDeviceData(_ context.Context, data *models.DeviceData) error {
+	w.written = append(w.written, data)
+	return nil
+}
+
+var processorNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+type processorFixture struct {
+	processor *MessageProcessor
+	devices   *device.MockRepository
+	saver     *recordingSaver
+	writer    *recordingWriter
+	events    *device.MockEventRepository
+	touched   *[]time.Time
+}
+
+func newProcessorFixture() processorFixture {
+	devices := device.NewMockRepository()
+	devices.AddDevice(&models.Device{ID: "device-1", Name: "Sensor", Status: "offline"})
+
+	f := processorFixture{
+		devices: devices,
+		saver:   &recordingSaver{},
+		writer:  &recordingWriter{},
+		events:  device.NewMockEventRepository(),
+		touched: &[]time.Time{},
+	}
+	devices.SetTouchFunc(func(id string, t time.Time) error {
+		*f.touched = append(*f.touched, t)
+		return nil
+	})
+	f.processor = NewMessageProcessor(devices, f.saver)
+	f.processor.SetEventRepository(f.events)
+	f.processor.SetSeriesWriter(f.writer)
+	f.processor.now = func() time.Time { return processorNow }
+	return f
+}
+
+func (f processorFixture) device(t *testing.T) *models.Device {
+	found, err := f.devices.GetByID("device-1")
+	require.NoError(t, err)
+	return found
+}
+
+func TestHandleDeviceData_Valid(t *testing.T) {
+	f := newProcessorFixture()
+
+	payload := `{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5,"humidity":40,"mode":"eco"}}`
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", []byte(payload)))
+
+	require.Len(t, f.saver.saved, 2)
+	byType := map[string]*models.DeviceData{}
+	for _, data := range f.saver.saved {
+		byType[data.DataType] = data
+	}
+	require.Contains(t, byType, "temperature")
+	assert.Equal(t, 21.5, byType["temperature"].Value)
+	assert.Equal(t, "device-1", byType["temperature"].DeviceID)
+	assert.True(t, byType["temperature"].Timestamp.Equal(time.Date(2024, 6, 1, 11, 59, 0, 0, time.UTC)))
+	assert.Equal(t, 40.0, byType["humidity"].Value)
+
+	// Non-numeric values are kept as metadata on the readings
+	assert.JSONEq(t, `{"mode":"eco"}`, byType["temperature"].Metadata)
+
+	// Saved readings also go to secondary storage
+	assert.Len(t, f.writer.written, 2)
+
+	// The device is seen and online, and the transition is audited
+	assert.Equal(t, "online", f.device(t).Status)
+	assert.Equal(t, []time.Time{processorNow}, *f.touched)
+
+	events := f.events.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, models.EventStatusChanged, events[0].EventType)
+	assert.Equal(t, statusChangeActor, events[0].Actor)
+	assert.JSONEq(t, `{"from":"offline","to":"online"}`, string(events[0].Details))
+}
+
+func TestHandleDeviceData_TouchesLastSeen(t *testing.T) {
+	payload := []byte(`{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5}}`)
+
+	t.Run("per message", func(t *testing.T) {
+		f := newProcessorFixture()
+		var ids []string
+		f.devices.SetTouchFunc(func(id string, _ time.Time) error {
+			ids = append(ids, id)
+			return nil
+		})
+
+		require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", payload))
+
+		assert.Equal(t, []string{"device-1"}, ids)
+	})
+
+	t.Run("batched", func(t *testing.T) {
+		f := newProcessorFixture()
+		var ids []string
+		var seen time.Time
+		f.devices.SetTouchManyFunc(func(batch []string, at time.Time) (int64, error) {
+			ids = append(ids, batch...)
+			seen = at
+			return int64(len(batch)), nil
+		})
+		lastSeen := device.NewLastSeenBatcher(f.devices, time.Hour)
+		f.processor.SetBuffers(nil, lastSeen)
+
+		require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", payload))
+		lastSeen.Flush()
+
+		// The batcher replaces the per-message touch
+		assert.Empty(t, *f.touched)
+		assert.Equal(t, []string{"device-1"}, ids)
+		assert.Equal(t, processorNow, seen)
+	})
+}
+
+func TestHandleDeviceData_DedupKey(t *testing.T) {
+	f := newProcessorFixture()
+
+	payload := []byte(`{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5,"humidity":40},"dedup_key":"msg-1"}`)
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", payload))
+
+	// The message key is scoped per data type
+	keys := []string{}
+	for _, data := range f.saver.saved {
+		keys = append(keys, data.DedupKey)
+	}
+	assert.ElementsMatch(t, []string{"msg-1:temperature", "msg-1:humidity"}, keys)
+
+	// A redelivery saves and writes nothing more, and the device is already online
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", payload))
+	assert.Len(t, f.saver.saved, 2)
+	assert.Len(t, f.writer.written, 2)
+	assert.Len(t, f.events.Events(), 1)
+}
+
+func TestHandleDeviceData_BufferedWritesSeriesOnceStored(t *testing.T) {
+	f := newProcessorFixture()
+	buffer := device.NewDataBuffer(f.saver, 10, 10, time.Hour)
+	f.processor.SetBuffers(buffer, nil)
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+
+	payload := []byte(`{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5},"dedup_key":"msg-1"}`)
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", payload))
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", payload))
+
+	// Nothing is written before the buffer stores the readings
+	assert.Empty(t, f.writer.written)
+
+	require.NoError(t, group.Stop(context.Background()))
+
+	// The redelivery is dropped by its dedup key, so only the stored reading is written
+	assert.Len(t, f.saver.saved, 1)
+	require.Len(t, f.writer.written, 1)
+	assert.Equal(t, f.saver.saved[0], f.writer.written[0])
+}
+
+func TestHandleDeviceData_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"invalid JSON", `{"device_id":`},
+		{"missing device_id", `{"timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5}}`},
+		{"missing timestamp", `{"device_id":"device-1","data":{"temperature":21.5}}`},
+		{"null timestamp", `{"device_id":"device-1","timestamp":null,"data":{"temperature":21.5}}`},
+		{"bad timestamp", `{"device_id":"device-1","timestamp":"yesterday","data":{"temperature":21.5}}`},
+		{"numeric timestamp", `{"device_id":"device-1","timestamp":1717243140,"data":{"temperature":21.5}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProcessorFixture()
+			f.processor.SetTimestampPolicy(device.TimestampPolicy{Tolerance: device.TimestampStrict})
+
+			err := f.processor.HandleDeviceData("devices/device-1/data", []byte(tt.payload))
+			assert.Error(t, err)
+
+			// Nothing is saved and the device is untouched
+			assert.Empty(t, f.saver.saved)
+			assert.Empty(t, *f.touched)
+			assert.Equal(t, "offline", f.device(t).Status)
+			assert.Empty(t, f.events.Events())
+		})
+	}
+}
+
+func TestHandleDeviceData_FlexibleTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected time.Time
+	}{
+		{"unix seconds", `1717243140`, time.Date(2024, 6, 1, 11, 59, 0, 0, time.UTC)},
+		{"unparseable falls back to the receive time", `"yesterday"`, processorNow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProcessorFixture()
+			f.processor.SetTimestampPolicy(device.TimestampPolicy{Tolerance: device.TimestampFlexible})
+
+			payload := `{"device_id":"device-1","timestamp":` + tt.raw + `,"data":{"temperature":21.5}}`
+			require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", []byte(payload)))
+
+			require.Len(t, f.saver.saved, 1)
+			assert.True(t, tt.expected.Equal(f.saver.saved[0].Timestamp), "timestamp %s", f.saver.saved[0].Timestamp)
+		})
+	}
+}
+
+func TestHandleDeviceData_ClampedTimestamp(t *testing.T) {
+	f := newProcessorFixture()
+	f.processor.SetTimestampPolicy(device.TimestampPolicy{Source: device.TimestampSourceClamp, MaxSkew: time.Minute})
+
+	payload := `{"device_id":"device-1","timestamp":"2030-01-01T00:00:00Z","data":{"temperature":21.5}}`
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", []byte(payload)))
+
+	require.Len(t, f.saver.saved, 1)
+	assert.True(t, f.saver.saved[0].Timestamp.Equal(processorNow.Add(time.Minute)))
+}
+
+func TestHandleDeviceData_SchemaViolation(t *testing.T) {
+	f := newProcessorFixture()
+	f.processor.SetSchema(schema.DeviceData())
+
+	err := f.processor.HandleDeviceData("devices/device-1/data", []byte(`{"device_id":"device-1","data":"hot"}`))
+
+	var validationErr *schema.ValidationError
+	assert.True(t, errors.As(err, &validationErr), "expected a validation error, got %v", err)
+	assert.Empty(t, f.saver.saved)
+}
+
+func TestHandleDeviceData_ReadingDefaults(t *testing.T) {
+	tests := []struct {
+		name             string
+		defaults         device.ReadingDefaults
+		payload          string
+		expectedErr      bool
+		expectedDataType string
+		expectedUnit     string
+	}{
+		{
+			name:             "sent type and unit are kept",
+			defaults:         device.ReadingDefaults{DataType: "value", Unit: "raw"},
+			payload:          `{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","value":21.5,"data_type":"temperature","unit":"celsius"}`,
+			expectedDataType: "temperature",
+			expectedUnit:     "celsius",
+		},
+		{
+			name:             "missing type and unit are defaulted",
+			defaults:         device.ReadingDefaults{DataType: "value", Unit: "raw"},
+			payload:          `{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","value":21.5}`,
+			expectedDataType: "value",
+			expectedUnit:     "raw",
+		},
+		{
+			name:        "missing type without a default",
+			payload:     `{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","value":21.5}`,
+			expectedErr: true,
+		},
+		{
+			name:        "missing type rejected despite a default",
+			defaults:    device.ReadingDefaults{DataType: "value", Unit: "raw", Reject: true},
+			payload:     `{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","value":21.5}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProcessorFixture()
+			f.processor.SetReadingDefaults(tt.defaults)
+
+			err := f.processor.HandleDeviceData("devices/device-1/data", []byte(tt.payload))
+			if tt.expectedErr {
+				assert.ErrorIs(t, err, device.ErrMissingDataType)
+				assert.Empty(t, f.saver.saved)
+				assert.Empty(t, *f.touched)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, f.saver.saved, 1)
+			assert.Equal(t, tt.expectedDataType, f.saver.saved[0].DataType)
+			assert.Equal(t, tt.expectedUnit, f.saver.saved[0].Unit)
+			assert.Equal(t, 21.5, f.saver.saved[0].Value)
+		})
+	}
+}
+
+func TestHandleDeviceData_UnknownDevice(t *testing.T) {
+	f := newProcessorFixture()
+
+	// Unknown devices are skipped rather than dead-lettered
+	payload := `{"device_id":"device-2","timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5}}`
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-2/data", []byte(payload)))
+
+	assert.Empty(t, f.saver.saved)
+	assert.Empty(t, f.events.Events())
+}
+
+func TestHandleDeviceData_SaveFailure(t *testing.T) {
+	f := newProcessorFixture()
+	f.saver.err = errors.New("database is down")
+
+	// A failed save is logged, not dead-lettered, and still counts as activity
+	payload := `{"device_id":"device-1","timestamp":"2024-06-01T11:59:00Z","data":{"temperature":21.5}}`
+	require.NoError(t, f.processor.HandleDeviceData("devices/device-1/data", []byte(payload)))
+
+	assert.Empty(t, f.writer.written)
+	assert.Equal(t, "online", f.device(t).Status)
+	assert.Equal(t, []time.Time{processorNow}, *f.touched)
+}
+
+func TestHandleDeviceStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        string
+		expectedErr    bool
+		expectedStatus string
+		expectedEvents int
+	}{
+		{
+			name:           "status change",
+			payload:        `{"device_id":"device-1","status":"online","last_seen":"2024-06-01T11:59:00Z"}`,
+			expectedStatus: "online",
+			expectedEvents: 1,
+		},
+		{
+			name:           "unchanged status is not audited",
+			payload:        `{"device_id":"device-1","status":"offline"}`,
+			expectedStatus: "offline",
+		},
+		{
+			name:           "bad last_seen is not fatal",
+			payload:        `{"device_id":"device-1","status":"maintenance","last_seen":"yesterday"}`,
+			expectedStatus: "maintenance",
+			expectedEvents: 1,
+		},
+		{
+			name:           "unknown device is skipped",
+			payload:        `{"device_id":"device-2","status":"online"}`,
+			expectedStatus: "offline",
+		},
+		{
+			name:           "invalid JSON",
+			payload:        `not json`,
+			expectedErr:    true,
+			expectedStatus: "offline",
+		},
+		{
+			name:           "missing device_id",
+			payload:        `{"status":"online"}`,
+			expectedErr:    true,
+			expectedStatus: "offline",
+		},
+		{
+			name:           "missing status",
+			payload:        `{"device_id":"device-1"}`,
+			expectedErr:    true,
+			expectedStatus: "offline",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProcessorFixture()
+
+			err := f.processor.HandleDeviceStatus("devices/device-1/status", []byte(tt.payload))
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.expectedStatus, f.device(t).Status)
+			assert.Len(t, f.events.Events(), tt.expectedEvents)
+		})
+	}
+}
+
+func TestHandleDeviceStatus_ReceiveLog(t *testing.T) {
+	f := newProcessorFixture()
+
+	var logged []string
+	f.processor.SetReceiveLog(func(message string) {
+		logged = append(logged, message)
+	})
+
+	payload := []byte(`{"device_id":"device-1","status":"online"}`)
+	require.NoError(t, f.processor.HandleDeviceStatus("devices/device-1/status", payload))
+
+	require.Len(t, logged, 1)
+	assert.Contains(t, logged[0], "devices/device-1/status")
+	assert.Contains(t, logged[0], string(payload))
+
+	// The details are valid JSON for the audit log
+	var details map[string]string
+	require.NoError(t, json.Unmarshal(f.events.Events()[0].Details, &details))
+	assert.Equal(t, "online", details["to"])
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"iot-platform-go/internal/config"
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MQTTSubscriptionSource reports the MQTT client's subscriptions and connection state
+type MQTTSubscriptionSource interface {
+	Subscriptions() []string
+	IsConnected() bool
+}
+
+// MQTTResubscriber drops the server's MQTT subscriptions and subscribes again from the current configuration
+type MQTTResubscriber interface {
+	UnsubscribeAll() error
+	SubscribeAll() error
+}
+
+// AdminHandler handles administrative maintenance operations
+type AdminHandler struct {
+	dataRepo     device.DataRepositoryInterface
+	mqtt         MQTTSubscriptionSource // nil when MQTT is not configured
+	resubscriber MQTTResubscriber       // nil when MQTT is not configured
+	resubscribe  sync.Mutex             // serializes resubscriptions so they do not interleave
+	config       *config.Config         // nil when the effective configuration is not reported
+	now          func() time.Time
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(dataRepo device.DataRepositoryInterface) *AdminHandler {
+	return &AdminHandler{dataRepo: dataRepo, now: time.Now}
+}
+
+// SetMQTTClient sets the MQTT client whose subscriptions are reported
+func (h *AdminHandler) SetMQTTClient(client MQTTSubscriptionSource) {
+	h.mqtt = client
+}
+
+// SetMQTTResubscriber sets what resubscribes the server's MQTT topics
+func (h *AdminHandler) SetMQTTResubscriber(resubscriber MQTTResubscriber) {
+	h.resubscriber = resubscriber
+}
+
+// SetConfig sets the configuration the server loaded, reported with its secrets redacted
+func (h *AdminHandler) SetConfig(cfg *config.Config) {
+	h.config = cfg
+}
+
+// GetConfig handles GET /api/admin/config.
+// It reports the effective non-sensitive configuration; passwords, tokens and secrets are redacted.
+func (h *AdminHandler) GetConfig(c *gin.Context) {
+	if h.config == nil {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeInternal, "Configuration is not available")
+		return
+	}
+	cfg := h.config.Redacted()
+
+	c.JSON(http.StatusOK, gin.H{
+		"server": gin.H{
+			"host":           cfg.Server.Host,
+			"port":           cfg.Server.Port,
+			"environment":    cfg.Server.Environment,
+			"mode":           cfg.Server.Mode,
+			"max_body_bytes": cfg.Server.MaxBodyBytes,
+		},
+		"database": gin.H{
+			"host":     cfg.Database.Host,
+			"port":     cfg.Database.Port,
+			"name":     cfg.Database.Name,
+			"user":     cfg.Database.User,
+			"password": cfg.Database.Password,
+			"ssl_mode": cfg.Database.SSLMode,
+			"required": cfg.Database.Required,
+		},
+		"mqtt": gin.H{
+			"broker":       cfg.MQTT.Broker,
+			"client_id":    cfg.MQTT.ClientID,
+			"username":     cfg.MQTT.Username,
+			"password":     cfg.MQTT.Password,
+			"topic_prefix": cfg.MQTT.TopicPrefix,
+			"qos":          cfg.MQTT.QoS,
+			"status_topic": cfg.MQTT.StatusTopic,
+		},
+		"influxdb": gin.H{
+			"url":      cfg.InfluxDB.URL,
+			"org":      cfg.InfluxDB.Org,
+			"bucket":   cfg.InfluxDB.Bucket,
+			"username": cfg.InfluxDB.Username,
+			"password": cfg.InfluxDB.Password,
+			"token":    cfg.InfluxDB.Token,
+		},
+		"jwt": gin.H{
+			"secret":     cfg.JWT.Secret,
+			"expiration": cfg.JWT.Expiration,
+		},
+		"logging": gin.H{
+			"level":  cfg.Logging.Level,
+			"format": cfg.Logging.Format,
+		},
+	})
+}
+
+// ResubscribeMQTT handles POST /api/admin/mqtt/resubscribe.
+// It unsubscribes every current topic and subscribes again, so repeating it leaves the same subscriptions.
+func (h *AdminHandler) ResubscribeMQTT(c *gin.Context) {
+	if h.resubscriber == nil || h.mqtt == nil {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeMQTTUnavailable, "MQTT is not configured")
+		return
+	}
+	if !h.mqtt.IsConnected() {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeMQTTUnavailable, "MQTT client is not connected")
+		return
+	}
+
+	h.resubscribe.Lock()
+	defer h.resubscribe.Unlock()
+
+	previous := h.mqtt.Subscriptions()
+	if err := h.resubscriber.UnsubscribeAll(); err != nil {
+		respondErrorWithDetails(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to unsubscribe MQTT topics", err.Error())
+		return
+	}
+	if err := h.resubscriber.SubscribeAll(); err != nil {
+		respondErrorWithDetails(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to subscribe MQTT topics", err.Error())
+		return
+	}
+
+	subscriptions := append([]string{}, h.mqtt.Subscriptions()...)
+	c.JSON(http.StatusOK, gin.H{
+		"previous":      append([]string{}, previous...),
+		"subscriptions": subscriptions,
+		"count":         len(subscriptions),
+	})
+}
+
+// GetMQTTSubscriptions handles GET /api/admin/mqtt/subscriptions.
+func (h *AdminHandler) GetMQTTSubscriptions(c *gin.Context) {
+	subscriptions := []string{}
+	connected := false
+	if h.mqtt != nil {
+		subscriptions = append(subscriptions, h.mqtt.Subscriptions()...)
+		connected = h.mqtt.IsConnected()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"connected":     connected,
+		"subscriptions": subscriptions,
+		"count":         len(subscriptions),
+	})
+}
+
+// Cleanup handles POST /api/admin/cleanup.
+func (h *AdminHandler) Cleanup(c *gin.Context) {
+	var req models.CleanupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	olderThan, err := time.Parse(time.RFC3339, req.OlderThan)
+	if err != nil {
+		respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "older_than must be an RFC3339 timestamp", err.Error())
+		return
+	}
+	if !olderThan.Before(h.now()) {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "older_than must be in the past")
+		return
+	}
+
+	deleted, err := h.dataRepo.DeleteOldData(req.DeviceID, olderThan)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to delete old device data", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted":    deleted,
+		"device_id":  req.DeviceID,
+		"older_than": olderThan,
+	})
+}
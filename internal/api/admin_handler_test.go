@@ -0,0 +1,459 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+	"iot-platform-go/internal/device"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testJWTSecret = "test-secret"
+
+// testToken returns an HS256 token for subject that expires at exp
+func testToken(secret, subject string, exp time.Time) string {
+	return testTokenWithClaims(secret, fmt.Sprintf(`{"sub":%q,"exp":%d}`, subject, exp.Unix()))
+}
+
+// testTokenWithClaims returns an HS256 token carrying the given JSON claims
+func testTokenWithClaims(secret, claimsJSON string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(claimsJSON))
+	signature := base64.RawURLEncoding.EncodeToString(signJWT(header+"."+claims, []byte(secret)))
+	return header + "." + claims + "." + signature
+}
+
+func setupAdminTestRouter(dataRepo device.DataRepositoryInterface) *gin.Engine {
+	router := setupTestRouter()
+	RegisterRoutes(router, Handlers{
+		Devices: NewDeviceHandler(device.NewMockRepository(), dataRepo),
+		Admin:   NewAdminHandler(dataRepo),
+		Auth:    JWTAuthMiddleware(testJWTSecret),
+	})
+	return router
+}
+
+func cleanupRequest(body, token string) *http.Request {
+	req := httptest.NewRequest("POST", "/api/v1/admin/cleanup", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAdminCleanup(t *testing.T) {
+	validToken := testToken(testJWTSecret, "admin", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedDevice string
+		expectedStatus int
+		expectedCode   string
+		expectedCalled bool
+	}{
+		{
+			name:           "single device",
+			body:           `{"device_id":"device-1","older_than":"2024-01-01T00:00:00Z"}`,
+			expectedDevice: "device-1",
+			expectedStatus: http.StatusOK,
+			expectedCalled: true,
+		},
+		{
+			name:           "all devices",
+			body:           `{"older_than":"2024-01-01T00:00:00Z"}`,
+			expectedDevice: "",
+			expectedStatus: http.StatusOK,
+			expectedCalled: true,
+		},
+		{
+			name:           "missing older_than",
+			body:           `{"device_id":"device-1"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "invalid older_than",
+			body:           `{"older_than":"yesterday"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "future older_than",
+			body:           fmt.Sprintf(`{"older_than":%q}`, time.Now().Add(time.Hour).Format(time.RFC3339)),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			var gotDevice string
+			var gotOlderThan time.Time
+
+			dataRepo := NewMockDataRepository()
+			dataRepo.SetDeleteOldDataFunc(func(deviceID string, olderThan time.Time) (int64, error) {
+				called = true
+				gotDevice = deviceID
+				gotOlderThan = olderThan
+				return 42, nil
+			})
+			router := setupAdminTestRouter(dataRepo)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, cleanupRequest(tt.body, validToken))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedCalled, called)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			assert.Equal(t, tt.expectedDevice, gotDevice)
+			assert.True(t, gotOlderThan.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, float64(42), response["deleted"])
+			assert.Equal(t, tt.expectedDevice, response["device_id"])
+		})
+	}
+}
+
+func TestAdminCleanup_RequiresAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "missing token", token: ""},
+		{name: "wrong secret", token: testToken("other-secret", "admin", time.Now().Add(time.Hour))},
+		{name: "expired token", token: testToken(testJWTSecret, "admin", time.Now().Add(-time.Hour))},
+		{name: "token without expiry", token: testTokenWithClaims(testJWTSecret, `{"sub":"admin"}`)},
+		{name: "malformed token", token: "not-a-jwt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataRepo := NewMockDataRepository()
+			dataRepo.SetDeleteOldDataFunc(func(string, time.Time) (int64, error) {
+				t.Fatal("DeleteOldData must not be called without authentication")
+				return 0, nil
+			})
+			router := setupAdminTestRouter(dataRepo)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, cleanupRequest(`{"older_than":"2024-01-01T00:00:00Z"}`, tt.token))
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+			var apiErr APIError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+			assert.Equal(t, ErrCodeUnauthorized, apiErr.Code)
+		})
+	}
+}
+
+// stubSubscriptions is a fixed MQTTSubscriptionSource
+type stubSubscriptions struct {
+	topics    []string
+	connected bool
+}
+
+func (s *stubSubscriptions) Subscriptions() []string { return s.topics }
+func (s *stubSubscriptions) IsConnected() bool       { return s.connected }
+
+func TestAdminMQTTSubscriptions(t *testing.T) {
+	validToken := testToken(testJWTSecret, "admin", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name           string
+		source         MQTTSubscriptionSource
+		token          string
+		expectedStatus int
+		expectedTopics []string
+		expectedConn   bool
+	}{
+		{
+			name:           "connected client",
+			source:         &stubSubscriptions{topics: []string{"devices/+/data", "devices/+/status"}, connected: true},
+			token:          validToken,
+			expectedStatus: http.StatusOK,
+			expectedTopics: []string{"devices/+/data", "devices/+/status"},
+			expectedConn:   true,
+		},
+		{
+			name:           "MQTT not configured",
+			token:          validToken,
+			expectedStatus: http.StatusOK,
+			expectedTopics: []string{},
+		},
+		{
+			name:           "missing token",
+			source:         &stubSubscriptions{connected: true},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataRepo := NewMockDataRepository()
+			admin := NewAdminHandler(dataRepo)
+			if tt.source != nil {
+				admin.SetMQTTClient(tt.source)
+			}
+			router := setupTestRouter()
+			RegisterRoutes(router, Handlers{
+				Devices: NewDeviceHandler(device.NewMockRepository(), dataRepo),
+				Admin:   admin,
+				Auth:    JWTAuthMiddleware(testJWTSecret),
+			})
+
+			req := httptest.NewRequest("GET", "/api/v1/admin/mqtt/subscriptions", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Connected     bool     `json:"connected"`
+				Subscriptions []string `json:"subscriptions"`
+				Count         int      `json:"count"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedConn, response.Connected)
+			assert.Equal(t, tt.expectedTopics, response.Subscriptions)
+			assert.Equal(t, len(tt.expectedTopics), response.Count)
+		})
+	}
+}
+
+// mockMQTTSubscriptions records the calls made to resubscribe
+type mockMQTTSubscriptions struct {
+	topics         []string
+	connected      bool
+	subscribeTopic []string
+	calls          []string
+	unsubscribeErr error
+}
+
+func (m *mockMQTTSubscriptions) Subscriptions() []string { return m.topics }
+func (m *mockMQTTSubscriptions) IsConnected() bool       { return m.connected }
+
+func (m *mockMQTTSubscriptions) UnsubscribeAll() error {
+	m.calls = append(m.calls, "unsubscribe")
+	if m.unsubscribeErr != nil {
+		return m.unsubscribeErr
+	}
+	m.topics = nil
+	return nil
+}
+
+func (m *mockMQTTSubscriptions) SubscribeAll() error {
+	m.calls = append(m.calls, "subscribe")
+	m.topics = append([]string{}, m.subscribeTopic...)
+	return nil
+}
+
+func TestAdminResubscribeMQTT(t *testing.T) {
+	validToken := testToken(testJWTSecret, "admin", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name           string
+		mqtt           *mockMQTTSubscriptions
+		token          string
+		requests       int
+		expectedStatus int
+		expectedCode   string
+		expectedCalls  []string
+	}{
+		{
+			name: "resubscribes",
+			mqtt: &mockMQTTSubscriptions{
+				topics:         []string{"old/+/data"},
+				subscribeTopic: []string{"devices/+/data", "devices/+/status"},
+				connected:      true,
+			},
+			token:          validToken,
+			requests:       1,
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"unsubscribe", "subscribe"},
+		},
+		{
+			name: "repeated requests leave the same subscriptions",
+			mqtt: &mockMQTTSubscriptions{
+				subscribeTopic: []string{"devices/+/data", "devices/+/status"},
+				connected:      true,
+			},
+			token:          validToken,
+			requests:       2,
+			expectedStatus: http.StatusOK,
+			expectedCalls:  []string{"unsubscribe", "subscribe", "unsubscribe", "subscribe"},
+		},
+		{
+			name:           "unsubscribe fails",
+			mqtt:           &mockMQTTSubscriptions{connected: true, unsubscribeErr: assert.AnError},
+			token:          validToken,
+			requests:       1,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+			expectedCalls:  []string{"unsubscribe"},
+		},
+		{
+			name:           "not connected",
+			mqtt:           &mockMQTTSubscriptions{},
+			token:          validToken,
+			requests:       1,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   ErrCodeMQTTUnavailable,
+		},
+		{
+			name:           "MQTT not configured",
+			token:          validToken,
+			requests:       1,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   ErrCodeMQTTUnavailable,
+		},
+		{
+			name:           "missing token",
+			mqtt:           &mockMQTTSubscriptions{connected: true},
+			requests:       1,
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   ErrCodeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataRepo := NewMockDataRepository()
+			admin := NewAdminHandler(dataRepo)
+			if tt.mqtt != nil {
+				admin.SetMQTTClient(tt.mqtt)
+				admin.SetMQTTResubscriber(tt.mqtt)
+			}
+			router := setupTestRouter()
+			RegisterRoutes(router, Handlers{
+				Devices: NewDeviceHandler(device.NewMockRepository(), dataRepo),
+				Admin:   admin,
+				Auth:    JWTAuthMiddleware(testJWTSecret),
+			})
+
+			var w *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				req := httptest.NewRequest("POST", "/api/v1/admin/mqtt/resubscribe", nil)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+			}
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.mqtt != nil {
+				assert.Equal(t, tt.expectedCalls, tt.mqtt.calls)
+			}
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response struct {
+				Subscriptions []string `json:"subscriptions"`
+				Count         int      `json:"count"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.mqtt.subscribeTopic, response.Subscriptions)
+			assert.Equal(t, len(tt.mqtt.subscribeTopic), response.Count)
+		})
+	}
+}
+
+func TestAdminGetConfig(t *testing.T) {
+	cfg := &config.Config{
+		Server:   config.ServerConfig{Host: "0.0.0.0", Port: "8080", Environment: "production", Mode: "release"},
+		Database: config.DatabaseConfig{Host: "db.internal", Port: "5432", Name: "iot_platform", User: "iot", Password: "db-password"},
+		MQTT:     config.MQTTConfig{Broker: "tcp://broker.internal:1883", ClientID: "iot-server", Username: "server", Password: "mqtt-password", TopicPrefix: "site-a", QoS: 1},
+		InfluxDB: config.InfluxDBConfig{URL: "http://influx.internal:8086", Org: "iot", Bucket: "devices", Token: "influx-token"},
+		JWT:      config.JWTConfig{Secret: "jwt-secret", Expiration: "24h"},
+		Logging:  config.LoggingConfig{Level: "debug", Format: "json"},
+	}
+
+	// Served while the database is down, so a misconfigured connection can be diagnosed
+	dataRepo := NewMockDataRepository()
+	admin := NewAdminHandler(dataRepo)
+	admin.SetConfig(cfg)
+	router := setupTestRouter()
+	RegisterRoutes(router, Handlers{
+		Devices:  NewDeviceHandler(device.NewMockRepository(), dataRepo),
+		Admin:    admin,
+		Auth:     JWTAuthMiddleware(testJWTSecret),
+		Database: RequireDatabaseMiddleware(func() bool { return false }),
+	})
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/admin/config", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("").Code)
+
+	w := get(testToken(testJWTSecret, "admin", time.Now().Add(time.Hour)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Secrets are redacted wherever they appear
+	body := w.Body.String()
+	for _, secret := range []string{"db-password", "mqtt-password", "influx-token", "jwt-secret"} {
+		assert.NotContains(t, body, secret)
+	}
+
+	var response map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, config.RedactedValue, response["database"]["password"])
+	assert.Equal(t, config.RedactedValue, response["mqtt"]["password"])
+	assert.Equal(t, config.RedactedValue, response["influxdb"]["token"])
+	assert.Equal(t, config.RedactedValue, response["jwt"]["secret"])
+
+	// An unset secret stays empty
+	assert.Equal(t, "", response["influxdb"]["password"])
+
+	// Non-secrets are reported as loaded
+	assert.Equal(t, "8080", response["server"]["port"])
+	assert.Equal(t, "production", response["server"]["environment"])
+	assert.Equal(t, "tcp://broker.internal:1883", response["mqtt"]["broker"])
+	assert.Equal(t, "site-a", response["mqtt"]["topic_prefix"])
+	assert.Equal(t, "db.internal", response["database"]["host"])
+	assert.Equal(t, "iot_platform", response["database"]["name"])
+	assert.Equal(t, "debug", response["logging"]["level"])
+
+	// The loaded config itself is left intact
+	assert.Equal(t, "db-password", cfg.Database.Password)
+}
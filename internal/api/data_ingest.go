@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SeriesWriter writes readings to secondary storage (InfluxDB)
+type SeriesWriter interface {
+	WriteDeviceData(ctx context.Context, data *models.DeviceData) error
+}
+
+// SetSeriesWriter sets where readings ingested over HTTP are also written; nil writes them to PostgreSQL only
+func (h *DeviceHandler) SetSeriesWriter(writer SeriesWriter) {
+	h.writer = writer
+}
+
+// SetTimestampPolicy sets how the timestamps sent with ingested readings are treated
+func (h *DeviceHandler) SetTimestampPolicy(policy device.TimestampPolicy) {
+	h.timestamps = policy
+}
+
+// SetReadingDefaults sets the data type and unit given to ingested single-value readings sent without them
+func (h *DeviceHandler) SetReadingDefaults(defaults device.ReadingDefaults) {
+	h.defaults = defaults
+}
+
+// IngestDeviceData handles POST /api/devices/:id/data.
+// It stores a single reading sent by the device and marks the device as seen.
+func (h *DeviceHandler) IngestDeviceData(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req models.IngestDataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	// Metadata is stored as JSONB, so it must be valid JSON when set
+	if req.Metadata != "" && !json.Valid([]byte(req.Metadata)) {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "metadata must be valid JSON")
+		return
+	}
+	dataType, unit, err := h.defaults.Apply(req.DataType, req.Unit)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "data_type is required")
+		return
+	}
+
+	now := time.Now()
+	data := &models.DeviceData{
+		ID:        uuid.New().String(),
+		DeviceID:  deviceID,
+		Timestamp: now,
+		DataType:  dataType,
+		Value:     *req.Value,
+		Unit:      unit,
+		Metadata:  req.Metadata,
+	}
+	if req.Timestamp != nil {
+		data.Timestamp = h.resolveTimestamp(deviceID, *req.Timestamp, now)
+	}
+
+	if _, err := h.dataRepo.SaveData(data); err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to save device data", err)
+		return
+	}
+
+	if err := h.repo.Touch(deviceID, now); err != nil {
+		log.Printf("⚠️ Failed to update device last seen: %v", err)
+	}
+
+	if h.writer != nil {
+		if err := h.writer.WriteDeviceData(c.Request.Context(), data); err != nil {
+			log.Printf("⚠️ Failed to save data to InfluxDB for %s: %v", data.DataType, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, data)
+}
+
+// IngestDeviceDataBulk handles POST /api/devices/:id/data/bulk.
+// It accepts the MQTT message shape, saving each numeric entry of data as a reading in one batch.
+// Non-numeric entries are coerced and set aside exactly as for MQTT: kept as metadata on the readings.
+// A single value is saved as one more reading, its data type and unit defaulted like IngestDeviceData.
+func (h *DeviceHandler) IngestDeviceDataBulk(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req models.BulkIngestDataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.DeviceID != "" && req.DeviceID != deviceID {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "device_id does not match the device in the path")
+		return
+	}
+
+	now := time.Now()
+	timestamp := now
+	if len(req.Timestamp) > 0 && string(req.Timestamp) != "null" {
+		deviceTime, err := device.ParseTimestamp(req.Timestamp, h.timestamps.Tolerance)
+		if err != nil {
+			respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid timestamp", err.Error())
+			return
+		}
+		timestamp = h.resolveTimestamp(deviceID, deviceTime, now)
+	}
+
+	readings, extras := device.SplitReadings(req.Data)
+	units := make(map[string]string)
+	if req.Value != nil {
+		dataType, unit, err := h.defaults.Apply(req.DataType, req.Unit)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "data_type is required for a single value")
+			return
+		}
+		readings[dataType] = *req.Value
+		units[dataType] = unit
+	}
+	if len(readings) == 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Data has no numeric readings")
+		return
+	}
+	metadata := device.ExtrasMetadata(extras)
+
+	// Sorted so the rows and the response are in a stable order
+	dataTypes := make([]string, 0, len(readings))
+	for dataType := range readings {
+		dataTypes = append(dataTypes, dataType)
+	}
+	sort.Strings(dataTypes)
+
+	rows := make([]*models.DeviceData, 0, len(dataTypes))
+	for _, dataType := range dataTypes {
+		data := &models.DeviceData{
+			ID:        uuid.New().String(),
+			DeviceID:  deviceID,
+			Timestamp: timestamp,
+			DataType:  dataType,
+			Value:     readings[dataType],
+			Unit:      units[dataType],
+			Metadata:  metadata,
+		}
+		// The message-level dedup key covers all readings, so scope it per data type
+		if req.DedupKey != "" {
+			data.DedupKey = req.DedupKey + ":" + dataType
+		}
+		rows = append(rows, data)
+	}
+
+	inserted, err := h.dataRepo.SaveDataBatch(rows)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to save device data", err)
+		return
+	}
+
+	if err := h.repo.Touch(deviceID, now); err != nil {
+		log.Printf("⚠️ Failed to update device last seen: %v", err)
+	}
+
+	// Readings dropped as duplicates were written before, so only the inserted ones are forwarded
+	if h.writer != nil {
+		for _, data := range inserted {
+			if err := h.writer.WriteDeviceData(c.Request.Context(), data); err != nil {
+				log.Printf("⚠️ Failed to save data to InfluxDB for %s: %v", data.DataType, err)
+			}
+		}
+	}
+
+	skipped := make([]string, 0, len(extras))
+	for dataType := range extras {
+		skipped = append(skipped, dataType)
+	}
+	sort.Strings(skipped)
+
+	c.JSON(http.StatusCreated, models.BulkIngestDataResponse{
+		DeviceID:   deviceID,
+		Data:       inserted,
+		Inserted:   int64(len(inserted)),
+		Duplicates: int64(len(rows) - len(inserted)),
+		Skipped:    skipped,
+	})
+}
+
+// resolveTimestamp applies the timestamp policy to a device timestamp received at now, logging clamps
+func (h *DeviceHandler) resolveTimestamp(deviceID string, deviceTime, now time.Time) time.Time {
+	timestamp, clamped := h.timestamps.Resolve(deviceTime, now)
+	if clamped {
+		log.Printf("⚠️ Clamped timestamp %s from device %s to %s", deviceTime.Format(time.RFC3339), deviceID, timestamp.Format(time.RFC3339))
+	}
+	return timestamp
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestDeviceDataBulk(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockDataRepo := NewMockDataRepository()
+
+	var saved []*models.DeviceData
+	mockDataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		saved = data
+		return data, nil
+	})
+
+	router := setupProvisionTestRouter(mockRepo, mockDataRepo)
+	deviceID, token := provisionTestDevice(t, router)
+
+	body := `{
+		"device_id": "` + deviceID + `",
+		"timestamp": "2024-01-01T00:00:00Z",
+		"data": {"temperature": 21.5, "humidity": 60, "pressure": "1013.25", "door_open": true, "mode": "eco"},
+		"dedup_key": "msg-1"
+	}`
+	req := httptest.NewRequest("POST", "/api/v1/devices/"+deviceID+"/data/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeviceTokenHeader, token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// Numeric values, including numeric strings, are expanded into one reading each
+	require.Len(t, saved, 3)
+	values := make(map[string]float64)
+	for _, data := range saved {
+		values[data.DataType] = data.Value
+		assert.Equal(t, deviceID, data.DeviceID)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), data.Timestamp.UTC())
+		assert.Equal(t, "msg-1:"+data.DataType, data.DedupKey)
+		assert.JSONEq(t, `{"door_open":true,"mode":"eco"}`, data.Metadata)
+	}
+	assert.Equal(t, map[string]float64{"temperature": 21.5, "humidity": 60, "pressure": 1013.25}, values)
+
+	var response models.BulkIngestDataResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, deviceID, response.DeviceID)
+	assert.Equal(t, int64(3), response.Inserted)
+	assert.Equal(t, int64(0), response.Duplicates)
+	assert.Len(t, response.Data, 3)
+	assert.Equal(t, []string{"door_open", "mode"}, response.Skipped)
+
+	touched, err := mockRepo.GetByID(deviceID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), touched.LastSeen, time.Minute)
+}
+
+// recordingSeriesWriter keeps readings written to secondary storage
+type recordingSeriesWriter struct {
+	written []*models.DeviceData
+}
+
+func (w *recordingSeriesWriter) WriteDeviceData(_ context.Context, data *models.DeviceData) error {
+	w.written = append(w.written, data)
+	return nil
+}
+
+func TestIngestDeviceDataBulk_Duplicates(t *testing.T) {
+	// The humidity reading of this message was already stored, so its dedup key conflicts
+	mockDataRepo := NewMockDataRepository()
+	mockDataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		inserted := []*models.DeviceData{}
+		for _, d := range data {
+			if d.DedupKey != "msg-1:humidity" {
+				inserted = append(inserted, d)
+			}
+		}
+		return inserted, nil
+	})
+
+	writer := &recordingSeriesWriter{}
+	handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+	handler.SetSeriesWriter(writer)
+	router := setupTestRouter()
+	router.POST("/devices/:id/data/bulk", handler.IngestDeviceDataBulk)
+
+	body := `{"data":{"temperature":21.5,"humidity":60},"dedup_key":"msg-1"}`
+	req := httptest.NewRequest("POST", "/devices/device-1/data/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.BulkIngestDataResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(1), response.Inserted)
+	assert.Equal(t, int64(1), response.Duplicates)
+	require.Len(t, response.Data, 1)
+	assert.Equal(t, "temperature", response.Data[0].DataType)
+
+	// Only the inserted reading is forwarded to InfluxDB
+	require.Len(t, writer.written, 1)
+	assert.Equal(t, "temperature", writer.written[0].DataType)
+}
+
+func TestIngestDeviceDataBulk_Errors(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		tolerance      string
+		saveErr        error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "invalid JSON",
+			body:           `{"data":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "missing data",
+			body:           `{"timestamp":"2024-01-01T00:00:00Z"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "single value without a data type",
+			body:           `{"value":21.5}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "only non-numeric values",
+			body:           `{"data":{"door_open":true,"mode":"eco","signal":"NaN"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "device_id of another device",
+			body:           `{"device_id":"other-device","data":{"temperature":21.5}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "unparseable timestamp",
+			body:           `{"timestamp":"yesterday","data":{"temperature":21.5}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "Unix timestamp with strict tolerance",
+			body:           `{"timestamp":1704067200,"data":{"temperature":21.5}}`,
+			tolerance:      device.TimestampStrict,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "save failure",
+			body:           `{"data":{"temperature":21.5}}`,
+			saveErr:        assert.AnError,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+				if tt.saveErr == nil {
+					t.Fatal("SaveDataBatch must not be called for an invalid request")
+				}
+				return nil, tt.saveErr
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			handler.SetTimestampPolicy(device.TimestampPolicy{Tolerance: tt.tolerance})
+			router := setupTestRouter()
+			router.POST("/devices/:id/data/bulk", handler.IngestDeviceDataBulk)
+
+			req := httptest.NewRequest("POST", "/devices/device-1/data/bulk", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var apiErr APIError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+			assert.Equal(t, tt.expectedCode, apiErr.Code)
+		})
+	}
+}
+
+func TestIngestDeviceDataBulk_SingleValue(t *testing.T) {
+	var saved []*models.DeviceData
+	mockDataRepo := NewMockDataRepository()
+	mockDataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		saved = data
+		return data, nil
+	})
+
+	handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+	handler.SetReadingDefaults(device.ReadingDefaults{DataType: "value", Unit: "raw"})
+	router := setupTestRouter()
+	router.POST("/devices/:id/data/bulk", handler.IngestDeviceDataBulk)
+
+	// The single value joins the readings in data, its type and unit defaulted
+	body := `{"timestamp":"2024-01-01T00:00:00Z","value":3.3,"data":{"temperature":21.5}}`
+	req := httptest.NewRequest("POST", "/devices/device-1/data/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, saved, 2)
+	byType := make(map[string]*models.DeviceData)
+	for _, data := range saved {
+		byType[data.DataType] = data
+	}
+	require.Contains(t, byType, "value")
+	assert.Equal(t, 3.3, byType["value"].Value)
+	assert.Equal(t, "raw", byType["value"].Unit)
+	assert.Equal(t, "", byType["temperature"].Unit)
+}
+
+func TestIngestDeviceDataBulk_DefaultsToReceiveTime(t *testing.T) {
+	var saved []*models.DeviceData
+	mockDataRepo := NewMockDataRepository()
+	mockDataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		saved = data
+		return data, nil
+	})
+
+	handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+	router := setupTestRouter()
+	router.POST("/devices/:id/data/bulk", handler.IngestDeviceDataBulk)
+
+	req := httptest.NewRequest("POST", "/devices/device-1/data/bulk", strings.NewReader(`{"data":{"temperature":21.5}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, saved, 1)
+	assert.WithinDuration(t, time.Now(), saved[0].Timestamp, time.Minute)
+}
+
+func TestIngestDeviceDataBulk_RequiresDeviceToken(t *testing.T) {
+	mockDataRepo := NewMockDataRepository()
+	mockDataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		t.Fatal("SaveDataBatch must not be called without a valid device token")
+		return nil, nil
+	})
+
+	router := setupProvisionTestRouter(device.NewMockRepository(), mockDataRepo)
+	deviceID, _ := provisionTestDevice(t, router)
+
+	req := httptest.NewRequest("POST", "/api/v1/devices/"+deviceID+"/data/bulk", strings.NewReader(`{"data":{"temperature":21.5}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DataQuery holds the query parameters of the data endpoints.
+// Binding rejects a limit, page or downsample below 1, a negative offset, a non-integer
+// and a start or end that is not RFC3339, so a bad parameter is never silently defaulted.
+type DataQuery struct {
+	Type       string    `form:"type"`
+	Limit      int       `form:"limit" binding:"min=1"`
+	Offset     *int      `form:"offset" binding:"omitempty,min=0"`
+	Page       *int      `form:"page" binding:"omitempty,min=1"` // 1-based page of Limit items, instead of offset
+	Start      time.Time `form:"start"`
+	End        time.Time `form:"end"`
+	Downsample *int      `form:"downsample" binding:"omitempty,min=1"`
+	Metadata   string    `form:"metadata"` // key:value
+}
+
+// bindDataQuery binds the data query parameters, defaulting the limit and clamping it to the maximum.
+// It responds with 400 and returns false when a parameter is invalid.
+func (l Limits) bindDataQuery(c *gin.Context) (DataQuery, bool) {
+	query := DataQuery{Limit: l.Default}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondQueryError(c, err)
+		return DataQuery{}, false
+	}
+
+	if err := query.validate(l); err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return DataQuery{}, false
+	}
+	return query, true
+}
+
+// validate clamps the limit to the maximum and checks the parameters against each other
+func (q *DataQuery) validate(l Limits) error {
+	q.Limit = min(q.Limit, l.Max)
+
+	if q.Page != nil {
+		if q.Offset != nil {
+			return errors.New("use either offset or page, not both")
+		}
+		if *q.Page-1 > math.MaxInt32/q.Limit {
+			return errors.New("page is too large")
+		}
+	}
+
+	if q.Downsample != nil && *q.Downsample > l.Max {
+		return fmt.Errorf("downsample must be an integer between 1 and %d", l.Max)
+	}
+
+	if !q.Start.IsZero() && !q.End.IsZero() && !q.Start.Before(q.End) {
+		return errors.New("start must be before end")
+	}
+	return nil
+}
+
+// offset returns the position of the first item, given either as offset or as a page
+func (q DataQuery) offset() int {
+	switch {
+	case q.Page != nil:
+		return (*q.Page - 1) * q.Limit
+	case q.Offset != nil:
+		return *q.Offset
+	default:
+		return 0
+	}
+}
+
+// timeRange returns the queried range, defaulting end to now and start to span before end.
+// It returns an error when a defaulted bound leaves start not before end.
+func (q DataQuery) timeRange(span time.Duration) (time.Time, time.Time, error) {
+	end := q.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	start := q.Start
+	if start.IsZero() {
+		start = end.Add(-span)
+	}
+
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, errors.New("start must be before end")
+	}
+	return start, end, nil
+}
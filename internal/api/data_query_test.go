@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindDataQuery(t *testing.T) {
+	limits := Limits{Default: 20, Max: 50}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedOK     bool
+		expectedLimit  int
+		expectedOffset int
+		expectedStart  time.Time
+	}{
+		{"defaults", "", true, 20, 0, time.Time{}},
+		{"limit and offset", "?limit=10&offset=30", true, 10, 30, time.Time{}},
+		{"limit above max is clamped", "?limit=500", true, 50, 0, time.Time{}},
+		{"page uses limit as page size", "?limit=10&page=3", true, 10, 20, time.Time{}},
+		{"start", "?start=2024-01-01T00:00:00Z", true, 20, 0, start},
+		{"start with offset", "?start=2024-01-01T09:00:00%2B09:00", true, 20, 0, start},
+		{"not a number limit", "?limit=abc", false, 0, 0, time.Time{}},
+		{"zero limit", "?limit=0", false, 0, 0, time.Time{}},
+		{"negative limit", "?limit=-5", false, 0, 0, time.Time{}},
+		{"negative offset", "?offset=-1", false, 0, 0, time.Time{}},
+		{"zero page", "?page=0", false, 0, 0, time.Time{}},
+		{"page too large", "?page=9999999999", false, 0, 0, time.Time{}},
+		{"page and offset", "?page=2&offset=10", false, 0, 0, time.Time{}},
+		{"zero downsample", "?downsample=0", false, 0, 0, time.Time{}},
+		{"downsample above max", "?downsample=51", false, 0, 0, time.Time{}},
+		{"invalid start", "?start=yesterday", false, 0, 0, time.Time{}},
+		{"invalid end", "?end=2024-01-01", false, 0, 0, time.Time{}},
+		{"start after end", "?start=2024-01-02T00:00:00Z&end=2024-01-01T00:00:00Z", false, 0, 0, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/"+tt.query, nil)
+
+			query, ok := limits.bindDataQuery(c)
+			assert.Equal(t, tt.expectedOK, ok)
+			if !tt.expectedOK {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, ErrCodeInvalidRequest, apiErr.Code)
+				return
+			}
+			assert.Equal(t, tt.expectedLimit, query.Limit)
+			assert.Equal(t, tt.expectedOffset, query.offset())
+			assert.True(t, tt.expectedStart.Equal(query.Start), "start %s", query.Start)
+		})
+	}
+}
+
+func TestBindDataQuery_FieldErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/?limit=0", nil)
+
+	_, ok := DefaultLimits().bindDataQuery(c)
+	require.False(t, ok)
+
+	var body struct {
+		Details []FieldError `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, []FieldError{{Field: "limit", Error: "min=1"}}, body.Details)
+}
+
+func TestDataQueryTimeRange(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(6 * time.Hour)
+
+	s, e, err := DataQuery{Start: start, End: end}.timeRange(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, start, s)
+	assert.Equal(t, end, e)
+
+	s, e, err = DataQuery{End: end}.timeRange(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, end.Add(-time.Hour), s)
+	assert.Equal(t, end, e)
+
+	// A start in the future is not before the defaulted end
+	_, _, err = DataQuery{Start: time.Now().Add(time.Hour)}.timeRange(time.Hour)
+	assert.Error(t, err)
+}
+
+func TestGetDeviceData_QueryParameters(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedType   string
+		expectedLimit  int
+		expectedOffset int
+		expectedStart  time.Time
+		expectedEnd    time.Time
+	}{
+		{
+			name:           "invalid limit",
+			query:          "?limit=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid start",
+			query:          "?start=not-a-time",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid downsample",
+			query:          "?downsample=many",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "defaults",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedLimit:  DefaultLimit,
+		},
+		{
+			name:           "type, range and page",
+			query:          "?type=temperature&limit=10&page=2&start=" + start.Format(time.RFC3339) + "&end=" + end.Format(time.RFC3339),
+			expectedStatus: http.StatusOK,
+			expectedType:   "temperature",
+			expectedLimit:  10,
+			expectedOffset: 10,
+			expectedStart:  start,
+			expectedEnd:    end,
+		},
+		{
+			name:           "open-ended range with offset",
+			query:          "?offset=5&start=" + start.Format(time.RFC3339),
+			expectedStatus: http.StatusOK,
+			expectedLimit:  DefaultLimit,
+			expectedOffset: 5,
+			expectedStart:  start,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			var gotType string
+			var gotLimit, gotOffset int
+			var gotStart, gotEnd time.Time
+			called := false
+
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetGetDeviceDataFunc(func(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				called = true
+				gotStart, gotEnd, gotLimit, gotOffset = start, end, limit, offset
+				return []*models.DeviceData{}, nil
+			})
+			mockDataRepo.SetGetDeviceDataByTypeFunc(func(deviceID, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				called = true
+				gotType = dataType
+				gotStart, gotEnd, gotLimit, gotOffset = start, end, limit, offset
+				return []*models.DeviceData{}, nil
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			// Execute
+			req := httptest.NewRequest("GET", "/devices/test-id/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.False(t, called, "repository should not be queried for invalid parameters")
+
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, ErrCodeInvalidRequest, apiErr.Code)
+				return
+			}
+
+			require.True(t, called)
+			assert.Equal(t, tt.expectedType, gotType)
+			assert.Equal(t, tt.expectedLimit, gotLimit)
+			assert.Equal(t, tt.expectedOffset, gotOffset)
+			assert.True(t, tt.expectedStart.Equal(gotStart), "start %s", gotStart)
+			assert.True(t, tt.expectedEnd.Equal(gotEnd), "end %s", gotEnd)
+		})
+	}
+}
+
+func TestGetDataByType_InvalidQuery(t *testing.T) {
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	router := setupTestRouter()
+	router.GET("/data", handler.GetDataByType)
+
+	for _, query := range []string{"?type=temperature&limit=abc", "?type=temperature&end=tomorrow"} {
+		req := httptest.NewRequest("GET", "/data"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
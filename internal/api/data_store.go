@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Data stores that can serve device data reads
+const (
+	DataStorePostgres = "postgres"
+	DataStoreInfluxDB = "influxdb"
+)
+
+// SetInfluxReader makes GET /devices/:id/data read from InfluxDB; nil reads from PostgreSQL.
+// Downsampled queries are always served by PostgreSQL.
+func (h *DeviceHandler) SetInfluxReader(reader InfluxReader) {
+	h.influx = reader
+}
+
+// getDeviceDataFromInfluxDB responds with device data from InfluxDB in the same shape as the PostgreSQL read,
+// without the total, which InfluxDB does not count. The range defaults to the last 24 hours.
+func (h *DeviceHandler) getDeviceDataFromInfluxDB(c *gin.Context, deviceID string, query DataQuery) {
+	start, end, err := query.timeRange(24 * time.Hour)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	data, err := h.influx.QueryDeviceData(c.Request.Context(), deviceID, query.Type, start, end, query.Limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to get device data")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeviceDataResponse{
+		DeviceID: deviceID,
+		Data:     data,
+		Count:    len(data),
+		Limit:    query.Limit,
+		Source:   DataStoreInfluxDB,
+	})
+}
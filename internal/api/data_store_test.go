@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDeviceData_DataStore(t *testing.T) {
+	reading := &models.DeviceData{ID: "data-1", DeviceID: "test-id", DataType: "temperature", Value: 21.5}
+
+	tests := []struct {
+		name           string
+		store          string
+		expectedSource string
+		expectPostgres bool
+		expectInflux   bool
+	}{
+		{
+			name:           "postgres",
+			store:          DataStorePostgres,
+			expectedSource: DataStorePostgres,
+			expectPostgres: true,
+		},
+		{
+			name:           "influxdb",
+			store:          DataStoreInfluxDB,
+			expectedSource: DataStoreInfluxDB,
+			expectInflux:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postgresCalled := false
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetGetDeviceDataByTypeFunc(func(deviceID, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				postgresCalled = true
+				return []*models.DeviceData{reading}, nil
+			})
+
+			influxCalled := false
+			reader := NewMockInfluxReader()
+			reader.SetQueryDeviceDataFunc(func(ctx context.Context, deviceID, dataType string, start, end time.Time, limit int) ([]*models.DeviceData, error) {
+				influxCalled = true
+				assert.Equal(t, "test-id", deviceID)
+				assert.Equal(t, "temperature", dataType)
+				assert.Equal(t, 5, limit)
+				assert.Equal(t, 24*time.Hour, end.Sub(start))
+				return []*models.DeviceData{reading}, nil
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			if tt.store == DataStoreInfluxDB {
+				handler.SetInfluxReader(reader)
+			}
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			req := httptest.NewRequest("GET", "/devices/test-id/data?type=temperature&limit=5", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectPostgres, postgresCalled)
+			assert.Equal(t, tt.expectInflux, influxCalled)
+
+			var response models.DeviceDataResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "test-id", response.DeviceID)
+			assert.Equal(t, 1, response.Count)
+			assert.Equal(t, 5, response.Limit)
+			assert.Equal(t, tt.expectedSource, response.Source)
+			// InfluxDB does not count matching points or page by offset
+			assert.Equal(t, tt.store != DataStoreInfluxDB, response.Total != nil)
+			assert.Equal(t, tt.store != DataStoreInfluxDB, response.Offset != nil)
+			require.Len(t, response.Data, 1)
+			assert.Equal(t, 21.5, response.Data[0].Value)
+		})
+	}
+}
+
+func TestGetDeviceData_InfluxDBInvalidRange(t *testing.T) {
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	handler.SetInfluxReader(NewMockInfluxReader())
+	router := setupTestRouter()
+	router.GET("/devices/:id/data", handler.GetDeviceData)
+
+	req := httptest.NewRequest("GET", "/devices/test-id/data?start=yesterday", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var apiErr APIError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+	assert.Equal(t, ErrCodeInvalidRequest, apiErr.Code)
+}
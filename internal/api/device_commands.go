@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ping wait limits for POST /api/devices/:id/ping
+const (
+	DefaultPingTimeout = 5 * time.Second
+	MaxPingTimeout     = 30 * time.Second
+)
+
+// CommandSender sends commands to devices over MQTT, waiting up to timeout for the response when it is positive
+type CommandSender interface {
+	Send(ctx context.Context, deviceID, command string, timeout time.Duration) (*models.CommandResult, error)
+}
+
+// SetCommandSender sets what sends commands to devices; nil makes the command endpoints unavailable
+func (h *DeviceHandler) SetCommandSender(commands CommandSender) {
+	h.commands = commands
+}
+
+// PingDevice handles POST /api/devices/:id/ping.
+// It publishes a ping command to the device and waits up to timeout (default 5s) for its response,
+// reporting the round trip latency. With timeout=0 the ping is sent without waiting.
+func (h *DeviceHandler) PingDevice(c *gin.Context) {
+	if h.commands == nil {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeMQTTUnavailable, "MQTT is not configured")
+		return
+	}
+
+	id := c.Param("id")
+	timeout := DefaultPingTimeout
+	if raw := c.Query("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 || parsed > MaxPingTimeout {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest,
+				fmt.Sprintf("timeout must be a duration between 0s and %s", MaxPingTimeout))
+			return
+		}
+		timeout = parsed
+	}
+
+	exists, err := h.repo.Exists(id)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device", err)
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+		return
+	}
+
+	result, err := h.commands.Send(c.Request.Context(), id, models.CommandPing, timeout)
+	if err != nil {
+		respondErrorWithDetails(c, http.StatusServiceUnavailable, ErrCodeMQTTUnavailable, "Failed to ping device", err.Error())
+		return
+	}
+
+	switch {
+	case timeout == 0:
+		c.JSON(http.StatusAccepted, result)
+	case !result.Responded:
+		respondError(c, http.StatusGatewayTimeout, ErrCodeDeviceTimeout,
+			fmt.Sprintf("Device did not respond within %s", timeout))
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
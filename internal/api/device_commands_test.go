@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCommandSender records the commands sent and answers them with sendFunc
+type mockCommandSender struct {
+	sendFunc func(deviceID, command string, timeout time.Duration) (*models.CommandResult, error)
+	timeouts []time.Duration
+}
+
+func (m *mockCommandSender) Send(_ context.Context, deviceID, command string, timeout time.Duration) (*models.CommandResult, error) {
+	m.timeouts = append(m.timeouts, timeout)
+	return m.sendFunc(deviceID, command, timeout)
+}
+
+func TestPingDevice(t *testing.T) {
+	responded := func(deviceID, command string, timeout time.Duration) (*models.CommandResult, error) {
+		return &models.CommandResult{
+			DeviceID:  deviceID,
+			CommandID: "command-1",
+			Command:   command,
+			Responded: timeout > 0,
+			LatencyMS: 12.5,
+			Response:  json.RawMessage(`{"id":"command-1","command":"pong"}`),
+		}, nil
+	}
+	silent := func(deviceID, command string, _ time.Duration) (*models.CommandResult, error) {
+		return &models.CommandResult{DeviceID: deviceID, CommandID: "command-1", Command: command}, nil
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		noSender        bool
+		sendFunc        func(deviceID, command string, timeout time.Duration) (*models.CommandResult, error)
+		expectedStatus  int
+		expectedCode    string
+		expectedTimeout time.Duration // zero when nothing should be sent
+	}{
+		{
+			name:            "device responds",
+			path:            "/devices/device-1/ping",
+			sendFunc:        responded,
+			expectedStatus:  http.StatusOK,
+			expectedTimeout: DefaultPingTimeout,
+		},
+		{
+			name:            "custom timeout",
+			path:            "/devices/device-1/ping?timeout=500ms",
+			sendFunc:        responded,
+			expectedStatus:  http.StatusOK,
+			expectedTimeout: 500 * time.Millisecond,
+		},
+		{
+			name:           "no wait",
+			path:           "/devices/device-1/ping?timeout=0",
+			sendFunc:       responded,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:            "device does not respond",
+			path:            "/devices/device-1/ping",
+			sendFunc:        silent,
+			expectedStatus:  http.StatusGatewayTimeout,
+			expectedCode:    ErrCodeDeviceTimeout,
+			expectedTimeout: DefaultPingTimeout,
+		},
+		{
+			name: "MQTT not connected",
+			path: "/devices/device-1/ping",
+			sendFunc: func(string, string, time.Duration) (*models.CommandResult, error) {
+				return nil, assert.AnError
+			},
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedCode:    ErrCodeMQTTUnavailable,
+			expectedTimeout: DefaultPingTimeout,
+		},
+		{
+			name:           "MQTT not configured",
+			path:           "/devices/device-1/ping",
+			noSender:       true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   ErrCodeMQTTUnavailable,
+		},
+		{
+			name:           "unknown device",
+			path:           "/devices/device-2/ping",
+			sendFunc:       responded,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+		{
+			name:           "invalid timeout",
+			path:           "/devices/device-1/ping?timeout=soon",
+			sendFunc:       responded,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "timeout above the maximum",
+			path:           "/devices/device-1/ping?timeout=1m",
+			sendFunc:       responded,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			mockRepo.AddDevice(&models.Device{ID: "device-1", Name: "Sensor"})
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			sender := &mockCommandSender{sendFunc: tt.sendFunc}
+			if !tt.noSender {
+				handler.SetCommandSender(sender)
+			}
+			router := setupTestRouter()
+			router.POST("/devices/:id/ping", handler.PingDevice)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedTimeout > 0 || tt.expectedStatus == http.StatusAccepted {
+				assert.Equal(t, []time.Duration{tt.expectedTimeout}, sender.timeouts)
+			} else {
+				assert.Empty(t, sender.timeouts)
+			}
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var result models.CommandResult
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+			assert.Equal(t, "device-1", result.DeviceID)
+			assert.Equal(t, models.CommandPing, result.Command)
+			assert.Equal(t, "command-1", result.CommandID)
+			if tt.expectedStatus == http.StatusOK {
+				assert.True(t, result.Responded)
+				assert.Equal(t, 12.5, result.LatencyMS)
+				assert.JSONEq(t, `{"id":"command-1","command":"pong"}`, string(result.Response))
+			}
+		})
+	}
+}
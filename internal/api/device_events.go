@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"iot-platform-go/internal/device"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActorContextKey is the gin context key holding the authenticated caller (the JWT subject).
+// Events recorded for unauthenticated requests have no actor.
+const ActorContextKey = "actor"
+
+// SetEventRepository sets the repository device changes are recorded to; nil disables the audit log
+func (h *DeviceHandler) SetEventRepository(events device.EventRepositoryInterface) {
+	h.events = events
+}
+
+// recordEvent appends an event to the device's audit log.
+// Failures are logged rather than returned so they never fail the change itself.
+func (h *DeviceHandler) recordEvent(c *gin.Context, deviceID, eventType string, details interface{}) {
+	if h.events == nil {
+		return
+	}
+
+	event, err := device.NewEvent(deviceID, eventType, actorFromContext(c), details)
+	if err == nil {
+		err = h.events.Record(event)
+	}
+	if err != nil {
+		log.Printf("Failed to record %s event for device %s: %v", eventType, deviceID, err)
+	}
+}
+
+// actorFromContext returns the authenticated caller, or "" when the request is unauthenticated
+func actorFromContext(c *gin.Context) string {
+	return c.GetString(ActorContextKey)
+}
+
+// GetDeviceEvents handles GET /api/devices/:id/events.
+// Events are returned newest first and paginated with limit and offset.
+func (h *DeviceHandler) GetDeviceEvents(c *gin.Context) {
+	id := c.Param("id")
+
+	if h.events == nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Device event log is not configured")
+		return
+	}
+
+	limit, offset, ok := h.limits.parsePagination(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.events.GetByDevice(id, limit, offset)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device events", err)
+		return
+	}
+
+	total, err := h.events.CountByDevice(id)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to count device events", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": id,
+		"events":    events,
+		"count":     len(events),
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
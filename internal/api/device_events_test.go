@@ -0,0 +1,245 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupEventTestRouter(handler *DeviceHandler, actor string) *gin.Engine {
+	router := setupTestRouter()
+	if actor != "" {
+		router.Use(func(c *gin.Context) {
+			c.Set(ActorContextKey, actor)
+		})
+	}
+	router.POST("/devices", handler.CreateDevice)
+	router.PUT("/devices/:id", handler.UpdateDevice)
+	router.DELETE("/devices/:id", handler.DeleteDevice)
+	router.GET("/devices/:id/events", handler.GetDeviceEvents)
+	return router
+}
+
+func TestCreateDevice_RecordsEvent(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	events := device.NewMockEventRepository()
+
+	handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+	handler.SetEventRepository(events)
+	router := setupEventTestRouter(handler, "alice")
+
+	req := httptest.NewRequest("POST", "/devices", strings.NewReader(`{"name":"Sensor","type":"temperature"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	recorded := events.Events()
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "mock-device-id", recorded[0].DeviceID)
+	assert.Equal(t, models.EventDeviceCreated, recorded[0].EventType)
+	assert.Equal(t, "alice", recorded[0].Actor)
+	assert.JSONEq(t, `{"name":"Sensor","type":"temperature","location":""}`, string(recorded[0].Details))
+}
+
+func TestUpdateDevice_RecordsEvent(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	testDevice := createTestDevice()
+	mockRepo.AddDevice(testDevice)
+	events := device.NewMockEventRepository()
+
+	handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+	handler.SetEventRepository(events)
+	router := setupEventTestRouter(handler, "")
+
+	req := httptest.NewRequest("PUT", "/devices/"+testDevice.ID, strings.NewReader(`{"location":"Lab"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	recorded := events.Events()
+	require.Len(t, recorded, 1)
+	assert.Equal(t, testDevice.ID, recorded[0].DeviceID)
+	assert.Equal(t, models.EventDeviceUpdated, recorded[0].EventType)
+	assert.Empty(t, recorded[0].Actor, "unauthenticated requests have no actor")
+	assert.JSONEq(t, `{"location":"Lab"}`, string(recorded[0].Details))
+}
+
+func TestRegisterRoutes_RecordsActorFromBearerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		expectedActor string
+	}{
+		{name: "valid token", token: testToken(testJWTSecret, "alice", time.Now().Add(time.Hour)), expectedActor: "alice"},
+		{name: "anonymous", token: ""},
+		{name: "invalid token is ignored", token: testToken("other-secret", "mallory", time.Now().Add(time.Hour))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := device.NewMockEventRepository()
+			handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+			handler.SetEventRepository(events)
+
+			router := setupTestRouter()
+			RegisterRoutes(router, Handlers{Devices: handler, Identify: OptionalJWTMiddleware(testJWTSecret)})
+
+			req := httptest.NewRequest("POST", "/api/v1/devices", strings.NewReader(`{"name":"Sensor","type":"temperature"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusCreated, w.Code)
+
+			recorded := events.Events()
+			require.Len(t, recorded, 1)
+			assert.Equal(t, tt.expectedActor, recorded[0].Actor)
+		})
+	}
+}
+
+func TestUpdateDevice_FailureRecordsNoEvent(t *testing.T) {
+	events := device.NewMockEventRepository()
+
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	handler.SetEventRepository(events)
+	router := setupEventTestRouter(handler, "")
+
+	req := httptest.NewRequest("PUT", "/devices/missing", strings.NewReader(`{"location":"Lab"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.Empty(t, events.Events())
+}
+
+func TestCreateDevice_EventFailureDoesNotFailRequest(t *testing.T) {
+	events := device.NewMockEventRepository()
+	events.SetRecordFunc(func(event *models.DeviceEvent) error {
+		return assert.AnError
+	})
+
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	handler.SetEventRepository(events)
+	router := setupEventTestRouter(handler, "")
+
+	req := httptest.NewRequest("POST", "/devices", strings.NewReader(`{"name":"Sensor","type":"temperature"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestGetDeviceEvents(t *testing.T) {
+	events := device.NewMockEventRepository()
+	for i := 0; i < 5; i++ {
+		event, err := device.NewEvent("device-1", models.EventDeviceUpdated, "", map[string]int{"seq": i})
+		require.NoError(t, err)
+		require.NoError(t, events.Record(event))
+	}
+	other, err := device.NewEvent("device-2", models.EventDeviceCreated, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, events.Record(other))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedSeqs   []int
+		expectedCode   string
+	}{
+		{
+			name:           "newest first",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedSeqs:   []int{4, 3, 2, 1, 0},
+		},
+		{
+			name:           "limit and offset",
+			query:          "?limit=2&offset=1",
+			expectedStatus: http.StatusOK,
+			expectedSeqs:   []int{3, 2},
+		},
+		{
+			name:           "offset past the end",
+			query:          "?offset=10",
+			expectedStatus: http.StatusOK,
+			expectedSeqs:   []int{},
+		},
+		{
+			name:           "negative offset",
+			query:          "?offset=-1",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "non-numeric offset",
+			query:          "?offset=abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+			handler.SetEventRepository(events)
+			router := setupEventTestRouter(handler, "")
+
+			req := httptest.NewRequest("GET", "/devices/device-1/events"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var response APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedCode, response.Code)
+				return
+			}
+
+			var response struct {
+				Events []*models.DeviceEvent `json:"events"`
+				Count  int                   `json:"count"`
+				Total  int                   `json:"total"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, len(tt.expectedSeqs), response.Count)
+			assert.Equal(t, 5, response.Total)
+
+			require.Len(t, response.Events, len(tt.expectedSeqs))
+			for i, seq := range tt.expectedSeqs {
+				assert.JSONEq(t, fmt.Sprintf(`{"seq":%d}`, seq), string(response.Events[i].Details))
+			}
+		})
+	}
+}
+
+func TestGetDeviceEvents_NotConfigured(t *testing.T) {
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	router := setupEventTestRouter(handler, "")
+
+	req := httptest.NewRequest("GET", "/devices/device-1/events", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
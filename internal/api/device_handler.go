@@ -1,8 +1,14 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"iot-platform-go/internal/device"
 	"iot-platform-go/pkg/models"
@@ -12,17 +18,43 @@ import (
 
 const (
 	// Error messages
-	ErrDeviceNotFound = "device not found"
+	ErrDeviceNotFound      = "device not found"
+	ErrDeviceNameNotUnique = "device name is not unique"
 
-	// API limits
+	// Default API limits, used unless overridden with SetLimits
 	DefaultLimit = 100
 	MaxLimit     = 1000
+
+	// MaxStatusIDs is the maximum number of device IDs in one bulk status request
+	MaxStatusIDs = 100
+
+	// DefaultStaleMinutes is how long a device must have gone unseen to be listed as stale
+	DefaultStaleMinutes = 30
+
+	// MaxFleetDataLimit caps the number of readings returned by a query across all devices
+	MaxFleetDataLimit = 500
+
+	// Number of latest readings in a device export, and the most a limit can ask for
+	DefaultExportReadings = 100
+	MaxExportReadings     = 1000
 )
 
 // DeviceHandler handles HTTP requests for devices
 type DeviceHandler struct {
 	repo     device.RepositoryInterface
 	dataRepo device.DataRepositoryInterface
+	events   device.EventRepositoryInterface
+	purger   SeriesPurger
+	influx   InfluxReader // serves device data reads when set
+	writer   SeriesWriter
+	commands CommandSender // nil when MQTT is not configured
+	limits   Limits
+
+	settingsDefaults  map[string]json.RawMessage // setting values for keys a device has not set
+	settingsPublisher SettingsPublisher          // nil when setting changes are not published
+
+	timestamps device.TimestampPolicy // applied to timestamps sent with ingested readings
+	defaults   device.ReadingDefaults // applied to ingested readings without a data type or unit
 }
 
 // NewDeviceHandler creates a new device handler
@@ -30,41 +62,110 @@ func NewDeviceHandler(repo device.RepositoryInterface, dataRepo device.DataRepos
 	return &DeviceHandler{
 		repo:     repo,
 		dataRepo: dataRepo,
+		limits:   DefaultLimits(),
 	}
 }
 
+// SetLimits sets the default and maximum number of items returned by list queries
+func (h *DeviceHandler) SetLimits(limits Limits) {
+	h.limits = limits
+}
+
 // CreateDevice handles POST /api/devices
 func (h *DeviceHandler) CreateDevice(c *gin.Context) {
 	var req models.CreateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	device, err := h.repo.Create(&req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create device: " + err.Error()})
+		if respondDeviceNameTaken(c, err) {
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to create device", err)
 		return
 	}
 
+	h.recordEvent(c, device.ID, models.EventDeviceCreated, req)
+
 	c.JSON(http.StatusCreated, device)
 }
 
+// respondDeviceNameTaken writes a 409 and returns true when err reports that the device name is already in use
+func respondDeviceNameTaken(c *gin.Context, err error) bool {
+	if !errors.Is(err, device.ErrDeviceNameTaken) {
+		return false
+	}
+	respondError(c, http.StatusConflict, ErrCodeDuplicateDeviceName, "A device with this name already exists")
+	return true
+}
+
+// BulkCreateDevices handles POST /api/devices/bulk.
+// The devices are created in one transaction, so either all of them are created or none.
+func (h *DeviceHandler) BulkCreateDevices(c *gin.Context) {
+	var req models.BulkCreateDevicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	devices, err := h.repo.CreateBatch(req.Devices)
+	if err != nil {
+		if respondDeviceNameTaken(c, err) {
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to create devices", err)
+		return
+	}
+
+	for i, device := range devices {
+		h.recordEvent(c, device.ID, models.EventDeviceCreated, req.Devices[i])
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"devices": devices,
+		"count":   len(devices),
+	})
+}
+
 // GetDevice handles GET /api/devices/:id.
 func (h *DeviceHandler) GetDevice(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Device ID is required"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Device ID is required")
 		return
 	}
 
 	device, err := h.repo.GetByID(id)
 	if err != nil {
 		if err.Error() == ErrDeviceNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrDeviceNotFound})
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get device"})
+		respondDatabaseError(c, "Failed to get device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// GetDeviceByName handles GET /api/devices/by-name/:name.
+// Names are not unique; a name shared by several devices is a conflict.
+func (h *DeviceHandler) GetDeviceByName(c *gin.Context) {
+	name := c.Param("name")
+
+	device, err := h.repo.GetByName(name)
+	if err != nil {
+		switch err.Error() {
+		case ErrDeviceNotFound:
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+		case ErrDeviceNameNotUnique:
+			respondError(c, http.StatusConflict, ErrCodeAmbiguousDeviceName, "Device name matches more than one device; look it up by ID")
+		default:
+			respondDatabaseErrorWithDetails(c, "Failed to get device", err)
+		}
 		return
 	}
 
@@ -75,13 +176,16 @@ func (h *DeviceHandler) GetDevice(c *gin.Context) {
 func (h *DeviceHandler) GetAllDevices(c *gin.Context) {
 	devices, err := h.repo.GetAll()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get devices: " + err.Error()})
+		respondDatabaseErrorWithDetails(c, "Failed to get devices", err)
 		return
 	}
+	if devices == nil {
+		devices = []*models.Device{}
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"devices": devices,
-		"count":   len(devices),
+	c.JSON(http.StatusOK, models.DeviceListResponse{
+		Devices: devices,
+		Count:   len(devices),
 	})
 }
 
@@ -89,47 +193,91 @@ func (h *DeviceHandler) GetAllDevices(c *gin.Context) {
 func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Device ID is required"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Device ID is required")
 		return
 	}
 
 	var req models.UpdateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	device, err := h.repo.Update(id, &req)
 	if err != nil {
 		if err.Error() == ErrDeviceNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrDeviceNotFound})
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update device: " + err.Error()})
+		if respondDeviceNameTaken(c, err) {
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to update device", err)
 		return
 	}
 
+	h.recordEvent(c, device.ID, models.EventDeviceUpdated, req)
+
 	c.JSON(http.StatusOK, device)
 }
 
+// MergeDeviceMetadata handles PATCH /api/devices/:id/metadata.
+// The body is a JSON object shallow-merged into the existing metadata; a null value removes the key.
+func (h *DeviceHandler) MergeDeviceMetadata(c *gin.Context) {
+	id := c.Param("id")
+
+	var patch map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if patch == nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Metadata must be a JSON object")
+		return
+	}
+
+	merged, err := h.repo.MergeMetadata(id, patch)
+	if err != nil {
+		switch {
+		case err.Error() == ErrDeviceNotFound:
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+		case errors.Is(err, device.ErrMetadataNotObject):
+			respondError(c, http.StatusConflict, ErrCodeInvalidRequest, "Existing metadata is not a JSON object; replace it with PUT /api/devices/:id")
+		default:
+			respondDatabaseErrorWithDetails(c, "Failed to merge device metadata", err)
+		}
+		return
+	}
+
+	h.recordEvent(c, id, models.EventDeviceUpdated, gin.H{"metadata": patch})
+
+	c.JSON(http.StatusOK, models.DeviceMetadataResponse{
+		DeviceID: id,
+		Metadata: json.RawMessage(merged),
+	})
+}
+
 // DeleteDevice handles DELETE /api/devices/:id.
 func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Device ID is required"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Device ID is required")
 		return
 	}
 
 	err := h.repo.Delete(id)
 	if err != nil {
 		if err.Error() == ErrDeviceNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrDeviceNotFound})
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete device: " + err.Error()})
+		respondDatabaseErrorWithDetails(c, "Failed to delete device", err)
 		return
 	}
 
+	h.recordEvent(c, id, models.EventDeviceDeleted, nil)
+	h.purgeSeries(c.Request.Context(), id)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
 }
 
@@ -138,53 +286,339 @@ func (h *DeviceHandler) GetDeviceStatus(c *gin.Context) {
 	id := c.Param("id")
 	device, err := h.repo.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, "Device not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeviceStatusResponse{
+		DeviceID: device.ID,
+		Status:   device.Status,
+		LastSeen: device.LastSeen,
+	})
+}
+
+// GetDeviceStatusHistory handles GET /api/devices/:id/status/history.
+// Status changes are returned newest first and paginated with limit and offset (or page).
+func (h *DeviceHandler) GetDeviceStatusHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	limit, offset, ok := h.limits.parsePagination(c)
+	if !ok {
+		return
+	}
+
+	exists, err := h.repo.Exists(id)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device", err)
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+		return
+	}
+
+	history, err := h.repo.GetStatusHistory(id, limit, offset)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device status history", err)
+		return
+	}
+
+	total, err := h.repo.CountStatusHistory(id)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to count device status history", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.StatusHistoryResponse{
+		DeviceID: id,
+		History:  history,
+		Count:    len(history),
+		Total:    total,
+		Limit:    limit,
+		Offset:   offset,
+	})
+}
+
+// GetDeviceStatuses handles GET /api/devices/status?ids=a,b,c.
+// Devices that do not exist are listed under not_found.
+func (h *DeviceHandler) GetDeviceStatuses(c *gin.Context) {
+	ids := parseIDList(c.Query("ids"))
+	if len(ids) == 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "ids query parameter is required")
+		return
+	}
+	if len(ids) > MaxStatusIDs {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest,
+			fmt.Sprintf("At most %d device IDs can be requested at once", MaxStatusIDs))
+		return
+	}
+
+	statuses, err := h.repo.GetStatuses(ids)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device statuses", err)
+		return
+	}
+
+	notFound := []string{}
+	for _, id := range ids {
+		if _, ok := statuses[id]; !ok {
+			notFound = append(notFound, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"statuses":  statuses,
+		"not_found": notFound,
+		"count":     len(statuses),
+	})
+}
+
+// GetDeviceFacets handles GET /api/devices/facets.
+// It lists the distinct device types and statuses in the fleet with their device counts.
+func (h *DeviceHandler) GetDeviceFacets(c *gin.Context) {
+	types, statuses, err := h.repo.GetFacets()
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device facets", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"types":    types,
+		"statuses": statuses,
+	})
+}
+
+// GetStaleDevices handles GET /api/devices/stale.
+// It lists the devices not seen in the last minutes (default DefaultStaleMinutes), the stalest first.
+func (h *DeviceHandler) GetStaleDevices(c *gin.Context) {
+	query := struct {
+		Minutes int `form:"minutes" binding:"min=1"`
+	}{Minutes: DefaultStaleMinutes}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	// last_seen is written from time.Now() into a column without time zone, so it holds local wall-clock time;
+	// the cutoff must use the same clock or every device shifts by the UTC offset
+	cutoff := time.Now().Add(-time.Duration(query.Minutes) * time.Minute)
+	devices, err := h.repo.GetDevicesNotSeenSince(cutoff)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get stale devices", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"devices": devices,
+		"count":   len(devices),
+		"cutoff":  cutoff,
+	})
+}
+
+// parseIDList splits a comma-separated ID list, dropping blanks and duplicates
+func parseIDList(raw string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range strings.Split(raw, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// GetDeviceRetention handles GET /api/devices/:id/retention.
+// A retention_days of 0 means the global default applies.
+func (h *DeviceHandler) GetDeviceRetention(c *gin.Context) {
+	id := c.Param("id")
+
+	days, err := h.repo.GetRetentionDays(id)
+	if err != nil {
+		if err.Error() == ErrDeviceNotFound {
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to get device retention", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id":      id,
+		"retention_days": days,
+	})
+}
+
+// SetDeviceRetention handles PUT /api/devices/:id/retention.
+func (h *DeviceHandler) SetDeviceRetention(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.SetRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.repo.SetRetentionDays(id, *req.RetentionDays); err != nil {
+		if err.Error() == ErrDeviceNotFound {
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to set device retention", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"device_id": device.ID,
-		"status":    device.Status,
-		"last_seen": device.LastSeen,
+		"device_id":      id,
+		"retention_days": *req.RetentionDays,
 	})
 }
 
-// GetDeviceData gets the data for a device
+// GetDeviceData gets the data for a device, newest first.
+// It pages with limit and offset and can be narrowed to a type and a start/end range.
 func (h *DeviceHandler) GetDeviceData(c *gin.Context) {
 	deviceID := c.Param("id")
 
-	// Get limit from query parameter (default: 100)
-	limitStr := c.DefaultQuery("limit", "100")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = DefaultLimit
+	query, ok := h.limits.bindDataQuery(c)
+	if !ok {
+		return
 	}
-	if limit > MaxLimit {
-		limit = MaxLimit // Maximum limit
+
+	if query.Downsample != nil {
+		h.getDownsampledDeviceData(c, deviceID, query)
+		return
 	}
 
-	// Get data type filter from query parameter
-	dataType := c.Query("type")
+	if query.Metadata != "" {
+		h.getDeviceDataByMetadata(c, deviceID, query)
+		return
+	}
+
+	if h.influx != nil {
+		h.getDeviceDataFromInfluxDB(c, deviceID, query)
+		return
+	}
 
 	var data []*models.DeviceData
 	var dataErr error
 
-	if dataType != "" {
-		data, dataErr = h.dataRepo.GetDeviceDataByType(deviceID, dataType, limit)
+	offset := query.offset()
+	if query.Type != "" {
+		data, dataErr = h.dataRepo.GetDeviceDataByType(deviceID, query.Type, query.Start, query.End, query.Limit, offset)
 	} else {
-		data, dataErr = h.dataRepo.GetDeviceData(deviceID, limit)
+		data, dataErr = h.dataRepo.GetDeviceData(deviceID, query.Start, query.End, query.Limit, offset)
 	}
 
 	if dataErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get device data"})
+		respondDatabaseError(c, "Failed to get device data", dataErr)
+		return
+	}
+
+	total, err := h.dataRepo.GetDataCount(deviceID, query.Type, query.Start, query.End)
+	if err != nil {
+		respondDatabaseError(c, "Failed to count device data", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeviceDataResponse{
+		DeviceID: deviceID,
+		Data:     data,
+		Count:    len(data),
+		Total:    &total,
+		Limit:    query.Limit,
+		Offset:   &offset,
+		Source:   DataStorePostgres,
+	})
+}
+
+// getDownsampledDeviceData responds with device data averaged into at most downsample points per data type.
+// The range defaults to the last 24 hours.
+func (h *DeviceHandler) getDownsampledDeviceData(c *gin.Context, deviceID string, query DataQuery) {
+	start, end, err := query.timeRange(24 * time.Hour)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	buckets := *query.Downsample
+	points, err := h.dataRepo.GetDownsampled(deviceID, query.Type, start, end, buckets)
+	if err != nil {
+		respondDatabaseError(c, "Failed to get downsampled device data", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"device_id": deviceID,
+		"device_id":  deviceID,
+		"data":       points,
+		"count":      len(points),
+		"downsample": buckets,
+		"start":      start.Format(time.RFC3339),
+		"end":        end.Format(time.RFC3339),
+	})
+}
+
+// getDeviceDataByMetadata responds with the newest readings whose metadata has key set to value,
+// given as metadata=key:value. A value such as true or 42 also matches the JSON boolean or number.
+func (h *DeviceHandler) getDeviceDataByMetadata(c *gin.Context, deviceID string, query DataQuery) {
+	key, value, found := strings.Cut(query.Metadata, ":")
+	if !found || key == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "metadata must be in key:value format")
+		return
+	}
+
+	data, err := h.dataRepo.GetDataByMetadata(deviceID, key, value, query.Limit)
+	if err != nil {
+		respondDatabaseError(c, "Failed to get device data", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeviceDataResponse{
+		DeviceID: deviceID,
+		Data:     data,
+		Count:    len(data),
+		Limit:    query.Limit,
+		Source:   DataStorePostgres,
+	})
+}
+
+// GetDataByType handles GET /api/data?type=temperature&start=&end=.
+// It returns readings of one data type across all devices, newest first, defaulting to the last hour.
+func (h *DeviceHandler) GetDataByType(c *gin.Context) {
+	query, ok := h.limits.bindDataQuery(c)
+	if !ok {
+		return
+	}
+
+	dataType := query.Type
+	if dataType == "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "type query parameter is required")
+		return
+	}
+
+	start, end, err := query.timeRange(time.Hour)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Fleet-wide queries can be large, so the limit is capped regardless of the configured maximum
+	limit := min(query.Limit, MaxFleetDataLimit)
+
+	data, err := h.dataRepo.GetDataByTypeAllDevices(dataType, start, end, limit)
+	if err != nil {
+		respondDatabaseError(c, "Failed to get data", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data_type": dataType,
 		"data":      data,
 		"count":     len(data),
 		"limit":     limit,
+		"start":     start.Format(time.RFC3339),
+		"end":       end.Format(time.RFC3339),
 	})
 }
 
@@ -194,7 +628,11 @@ func (h *DeviceHandler) GetLatestDeviceData(c *gin.Context) {
 
 	data, err := h.dataRepo.GetLatestData(deviceID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No data found for device"})
+		if errors.Is(err, device.ErrNoData) {
+			respondError(c, http.StatusNotFound, ErrCodeDataNotFound, "No data found for device")
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to get latest device data", err)
 		return
 	}
 
@@ -203,3 +641,242 @@ func (h *DeviceHandler) GetLatestDeviceData(c *gin.Context) {
 		"latest_data": data,
 	})
 }
+
+// GetDeviceDataBounds handles GET /api/devices/:id/data/bounds.
+// It returns the timestamps of the device's first and last readings so clients can bound range pickers.
+func (h *DeviceHandler) GetDeviceDataBounds(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	first, last, err := h.dataRepo.GetDataBounds(deviceID)
+	if err != nil {
+		if errors.Is(err, device.ErrNoData) {
+			respondError(c, http.StatusNotFound, ErrCodeDataNotFound, "No data found for device")
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to get device data bounds", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"first":     first,
+		"last":      last,
+	})
+}
+
+// GetDeviceDataTypes handles GET /api/devices/:id/data/types
+func (h *DeviceHandler) GetDeviceDataTypes(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	exists, err := h.repo.Exists(deviceID)
+	if err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get device", err)
+		return
+	}
+	if !exists {
+		respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+		return
+	}
+
+	dataTypes, err := h.dataRepo.GetDataTypes(deviceID)
+	if err != nil {
+		respondDatabaseError(c, "Failed to get device data types", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id":  deviceID,
+		"data_types": dataTypes,
+		"count":      len(dataTypes),
+	})
+}
+
+// GetDeviceSummary handles GET /api/devices/:id/summary.
+// It composes the device, its status, the latest reading per data type and the total data point count.
+func (h *DeviceHandler) GetDeviceSummary(c *gin.Context) {
+	id := c.Param("id")
+
+	device, err := h.repo.GetByID(id)
+	if err != nil {
+		if err.Error() == ErrDeviceNotFound {
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+			return
+		}
+		respondDatabaseError(c, "Failed to get device", err)
+		return
+	}
+
+	var (
+		wg        sync.WaitGroup
+		latest    map[string]*models.DeviceData
+		dataTypes []string
+		count     int
+		latestErr error
+		countErr  error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		dataTypes, latest, latestErr = h.latestDataByType(id)
+	}()
+	go func() {
+		defer wg.Done()
+		count, countErr = h.dataRepo.GetDataCount(id, "", time.Time{}, time.Time{})
+	}()
+	wg.Wait()
+
+	if latestErr != nil || countErr != nil {
+		respondDatabaseError(c, "Failed to get device summary", errors.Join(latestErr, countErr))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device": device,
+		"status": models.DeviceStatus{
+			DeviceID: device.ID,
+			Status:   device.Status,
+			LastSeen: device.LastSeen,
+		},
+		"data_types":  dataTypes,
+		"latest_data": latest,
+		"data_count":  count,
+	})
+}
+
+// ExportDevice handles GET /api/devices/:id/export.
+// It returns the device record, its latest readings (limit, capped at MaxExportReadings) and its data bounds
+// as one JSON attachment for support tickets.
+func (h *DeviceHandler) ExportDevice(c *gin.Context) {
+	id := c.Param("id")
+
+	query := struct {
+		Limit int `form:"limit" binding:"min=1"`
+	}{Limit: DefaultExportReadings}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	limit := min(query.Limit, MaxExportReadings)
+
+	found, err := h.repo.GetByID(id)
+	if err != nil {
+		if err.Error() == ErrDeviceNotFound {
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+			return
+		}
+		respondDatabaseError(c, "Failed to get device", err)
+		return
+	}
+
+	var (
+		wg          sync.WaitGroup
+		readings    []*models.DeviceData
+		first, last time.Time
+		readingsErr error
+		boundsErr   error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		readings, readingsErr = h.dataRepo.GetDeviceData(id, time.Time{}, time.Time{}, limit, 0)
+	}()
+	go func() {
+		defer wg.Done()
+		first, last, boundsErr = h.dataRepo.GetDataBounds(id)
+	}()
+	wg.Wait()
+
+	if readingsErr != nil || (boundsErr != nil && !errors.Is(boundsErr, device.ErrNoData)) {
+		respondDatabaseError(c, "Failed to export device", errors.Join(readingsErr, boundsErr))
+		return
+	}
+
+	export := models.DeviceExport{
+		Device:     found,
+		Readings:   readings,
+		ExportedAt: time.Now().UTC(),
+	}
+	if boundsErr == nil {
+		export.DataBounds = &models.DataBounds{First: first, Last: last}
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="device-%s-export.json"`, id))
+	c.JSON(http.StatusOK, export)
+}
+
+// fleetActiveWindow is how recently a device must have been seen to count as active in the fleet stats
+const fleetActiveWindow = time.Hour
+
+// GetFleetStats handles GET /api/stats.
+// It composes the device count per status, the readings timestamped since local midnight and the devices active in the last hour.
+func (h *DeviceHandler) GetFleetStats(c *gin.Context) {
+	// Like GetStaleDevices, compare against the local clock last_seen and timestamps are stored in
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var (
+		wg         sync.WaitGroup
+		byStatus   map[string]int
+		dataPoints int
+		active     int
+		statusErr  error
+		dataErr    error
+		activeErr  error
+	)
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		byStatus, statusErr = h.repo.CountByStatus()
+	}()
+	go func() {
+		defer wg.Done()
+		dataPoints, dataErr = h.dataRepo.GetDataCount("", "", today, time.Time{})
+	}()
+	go func() {
+		defer wg.Done()
+		active, activeErr = h.repo.CountActiveSince(now.Add(-fleetActiveWindow))
+	}()
+	wg.Wait()
+
+	if err := errors.Join(statusErr, dataErr, activeErr); err != nil {
+		respondDatabaseErrorWithDetails(c, "Failed to get fleet stats", err)
+		return
+	}
+
+	total := 0
+	for _, count := range byStatus {
+		total += count
+	}
+
+	c.JSON(http.StatusOK, models.FleetStatsResponse{
+		TotalDevices:    total,
+		DevicesByStatus: byStatus,
+		DataPointsToday: dataPoints,
+		ActiveLastHour:  active,
+		GeneratedAt:     now,
+	})
+}
+
+// latestDataByType returns the data types of a device, sorted, and the most recent reading of each
+func (h *DeviceHandler) latestDataByType(deviceID string) ([]string, map[string]*models.DeviceData, error) {
+	recent, err := h.dataRepo.GetRecentByTypes(deviceID, nil, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataTypes := make([]string, 0, len(recent))
+	latest := make(map[string]*models.DeviceData, len(recent))
+	for dataType, data := range recent {
+		if len(data) == 0 {
+			continue
+		}
+		dataTypes = append(dataTypes, dataType)
+		latest[dataType] = data[0]
+	}
+	sort.Strings(dataTypes)
+
+	return dataTypes, latest, nil
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -13,16 +16,27 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // MockDataRepository is a mock implementation of DataRepositoryInterface
 type MockDataRepository struct {
-	saveDataFunc            func(*models.DeviceData) error
-	getDeviceDataFunc       func(string, int) ([]*models.DeviceData, error)
-	getDeviceDataByTypeFunc func(string, string, int) ([]*models.DeviceData, error)
+	saveDataFunc            func(*models.DeviceData) (bool, error)
+	saveDataBatchFunc       func([]*models.DeviceData) ([]*models.DeviceData, error)
+	getDeviceDataFunc       func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)
+	getDeviceDataByTypeFunc func(string, string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)
+	getRecentByTypesFunc    func(string, []string, int) (map[string][]*models.DeviceData, error)
+	getDataByTypeAllFunc    func(string, time.Time, time.Time, int) ([]*models.DeviceData, error)
+	getDataByMetadataFunc   func(string, string, string, int) ([]*models.DeviceData, error)
 	getLatestDataFunc       func(string) (*models.DeviceData, error)
-	deleteOldDataFunc       func(string, time.Time) error
+	getDataBoundsFunc       func(string) (time.Time, time.Time, error)
+	getDataTypesFunc        func(string) ([]string, error)
+	getDataCountFunc        func(string, string, time.Time, time.Time) (int, error)
+	getDownsampledFunc      func(string, string, time.Time, time.Time, int) ([]*models.DataPoint, error)
+	deleteOldDataFunc       func(string, time.Time) (int64, error)
+	deleteExpiredDataFunc   func(int, time.Time) (int64, error)
 }
 
 // NewMockDataRepository creates a new mock data repository
@@ -31,50 +45,127 @@ func NewMockDataRepository() *MockDataRepository {
 }
 
 // SetSaveDataFunc sets the mock function for SaveData
-func (m *MockDataRepository) SetSaveDataFunc(fn func(*models.DeviceData) error) {
+func (m *MockDataRepository) SetSaveDataFunc(fn func(*models.DeviceData) (bool, error)) {
 	m.saveDataFunc = fn
 }
 
+// SetSaveDataBatchFunc sets the mock function for SaveDataBatch
+func (m *MockDataRepository) SetSaveDataBatchFunc(fn func([]*models.DeviceData) ([]*models.DeviceData, error)) {
+	m.saveDataBatchFunc = fn
+}
+
 // SetGetDeviceDataFunc sets the mock function for GetDeviceData
-func (m *MockDataRepository) SetGetDeviceDataFunc(fn func(string, int) ([]*models.DeviceData, error)) {
+func (m *MockDataRepository) SetGetDeviceDataFunc(fn func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)) {
 	m.getDeviceDataFunc = fn
 }
 
 // SetGetDeviceDataByTypeFunc sets the mock function for GetDeviceDataByType
-func (m *MockDataRepository) SetGetDeviceDataByTypeFunc(fn func(string, string, int) ([]*models.DeviceData, error)) {
+func (m *MockDataRepository) SetGetDeviceDataByTypeFunc(fn func(string, string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)) {
 	m.getDeviceDataByTypeFunc = fn
 }
 
+// SetGetRecentByTypesFunc sets the mock function for GetRecentByTypes
+func (m *MockDataRepository) SetGetRecentByTypesFunc(fn func(string, []string, int) (map[string][]*models.DeviceData, error)) {
+	m.getRecentByTypesFunc = fn
+}
+
+// SetGetDataByTypeAllDevicesFunc sets the mock function for GetDataByTypeAllDevices
+func (m *MockDataRepository) SetGetDataByTypeAllDevicesFunc(fn func(string, time.Time, time.Time, int) ([]*models.DeviceData, error)) {
+	m.getDataByTypeAllFunc = fn
+}
+
+// SetGetDataByMetadataFunc sets the mock function for GetDataByMetadata
+func (m *MockDataRepository) SetGetDataByMetadataFunc(fn func(string, string, string, int) ([]*models.DeviceData, error)) {
+	m.getDataByMetadataFunc = fn
+}
+
 // SetGetLatestDataFunc sets the mock function for GetLatestData
 func (m *MockDataRepository) SetGetLatestDataFunc(fn func(string) (*models.DeviceData, error)) {
 	m.getLatestDataFunc = fn
 }
 
+// SetGetDataBoundsFunc sets the mock function for GetDataBounds
+func (m *MockDataRepository) SetGetDataBoundsFunc(fn func(string) (time.Time, time.Time, error)) {
+	m.getDataBoundsFunc = fn
+}
+
+// SetGetDataTypesFunc sets the mock function for GetDataTypes
+func (m *MockDataRepository) SetGetDataTypesFunc(fn func(string) ([]string, error)) {
+	m.getDataTypesFunc = fn
+}
+
+// SetGetDataCountFunc sets the mock function for GetDataCount
+func (m *MockDataRepository) SetGetDataCountFunc(fn func(string, string, time.Time, time.Time) (int, error)) {
+	m.getDataCountFunc = fn
+}
+
+// SetGetDownsampledFunc sets the mock function for GetDownsampled
+func (m *MockDataRepository) SetGetDownsampledFunc(fn func(string, string, time.Time, time.Time, int) ([]*models.DataPoint, error)) {
+	m.getDownsampledFunc = fn
+}
+
 // SetDeleteOldDataFunc sets the mock function for DeleteOldData
-func (m *MockDataRepository) SetDeleteOldDataFunc(fn func(string, time.Time) error) {
+func (m *MockDataRepository) SetDeleteOldDataFunc(fn func(string, time.Time) (int64, error)) {
 	m.deleteOldDataFunc = fn
 }
 
+// SetDeleteExpiredDataFunc sets the mock function for DeleteExpiredData
+func (m *MockDataRepository) SetDeleteExpiredDataFunc(fn func(int, time.Time) (int64, error)) {
+	m.deleteExpiredDataFunc = fn
+}
+
 // SaveData implements DataRepositoryInterface
-func (m *MockDataRepository) SaveData(data *models.DeviceData) error {
+func (m *MockDataRepository) SaveData(data *models.DeviceData) (bool, error) {
 	if m.saveDataFunc != nil {
 		return m.saveDataFunc(data)
 	}
-	return nil
+	return true, nil
+}
+
+// SaveDataBatch implements DataRepositoryInterface
+func (m *MockDataRepository) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	if m.saveDataBatchFunc != nil {
+		return m.saveDataBatchFunc(data)
+	}
+	return data, nil
 }
 
 // GetDeviceData implements DataRepositoryInterface
-func (m *MockDataRepository) GetDeviceData(deviceID string, limit int) ([]*models.DeviceData, error) {
+func (m *MockDataRepository) GetDeviceData(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
 	if m.getDeviceDataFunc != nil {
-		return m.getDeviceDataFunc(deviceID, limit)
+		return m.getDeviceDataFunc(deviceID, start, end, limit, offset)
 	}
 	return []*models.DeviceData{}, nil
 }
 
 // GetDeviceDataByType implements DataRepositoryInterface
-func (m *MockDataRepository) GetDeviceDataByType(deviceID string, dataType string, limit int) ([]*models.DeviceData, error) {
+func (m *MockDataRepository) GetDeviceDataByType(deviceID string, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
 	if m.getDeviceDataByTypeFunc != nil {
-		return m.getDeviceDataByTypeFunc(deviceID, dataType, limit)
+		return m.getDeviceDataByTypeFunc(deviceID, dataType, start, end, limit, offset)
+	}
+	return []*models.DeviceData{}, nil
+}
+
+// GetRecentByTypes implements DataRepositoryInterface
+func (m *MockDataRepository) GetRecentByTypes(deviceID string, types []string, perType int) (map[string][]*models.DeviceData, error) {
+	if m.getRecentByTypesFunc != nil {
+		return m.getRecentByTypesFunc(deviceID, types, perType)
+	}
+	return map[string][]*models.DeviceData{}, nil
+}
+
+// GetDataByTypeAllDevices implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataByTypeAllDevices(dataType string, start, end time.Time, limit int) ([]*models.DeviceData, error) {
+	if m.getDataByTypeAllFunc != nil {
+		return m.getDataByTypeAllFunc(dataType, start, end, limit)
+	}
+	return []*models.DeviceData{}, nil
+}
+
+// GetDataByMetadata implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataByMetadata(deviceID, key, value string, limit int) ([]*models.DeviceData, error) {
+	if m.getDataByMetadataFunc != nil {
+		return m.getDataByMetadataFunc(deviceID, key, value, limit)
 	}
 	return []*models.DeviceData{}, nil
 }
@@ -87,12 +178,52 @@ func (m *MockDataRepository) GetLatestData(deviceID string) (*models.DeviceData,
 	return nil, nil
 }
 
+// GetDataBounds implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataBounds(deviceID string) (time.Time, time.Time, error) {
+	if m.getDataBoundsFunc != nil {
+		return m.getDataBoundsFunc(deviceID)
+	}
+	return time.Time{}, time.Time{}, device.ErrNoData
+}
+
+// GetDataTypes implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataTypes(deviceID string) ([]string, error) {
+	if m.getDataTypesFunc != nil {
+		return m.getDataTypesFunc(deviceID)
+	}
+	return []string{}, nil
+}
+
+// GetDataCount implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataCount(deviceID string, dataType string, start, end time.Time) (int, error) {
+	if m.getDataCountFunc != nil {
+		return m.getDataCountFunc(deviceID, dataType, start, end)
+	}
+	return 0, nil
+}
+
+// GetDownsampled implements DataRepositoryInterface
+func (m *MockDataRepository) GetDownsampled(deviceID string, dataType string, start, end time.Time, buckets int) ([]*models.DataPoint, error) {
+	if m.getDownsampledFunc != nil {
+		return m.getDownsampledFunc(deviceID, dataType, start, end, buckets)
+	}
+	return []*models.DataPoint{}, nil
+}
+
 // DeleteOldData implements DataRepositoryInterface
-func (m *MockDataRepository) DeleteOldData(deviceID string, olderThan time.Time) error {
+func (m *MockDataRepository) DeleteOldData(deviceID string, olderThan time.Time) (int64, error) {
 	if m.deleteOldDataFunc != nil {
 		return m.deleteOldDataFunc(deviceID, olderThan)
 	}
-	return nil
+	return 0, nil
+}
+
+// DeleteExpiredData implements DataRepositoryInterface
+func (m *MockDataRepository) DeleteExpiredData(defaultDays int, now time.Time) (int64, error) {
+	if m.deleteExpiredDataFunc != nil {
+		return m.deleteExpiredDataFunc(defaultDays, now)
+	}
+	return 0, nil
 }
 
 func setupTestRouter() *gin.Engine {
@@ -121,6 +252,7 @@ func TestCreateDevice(t *testing.T) {
 		mockSetup      func(*device.MockRepository)
 		expectedStatus int
 		expectedError  string
+		expectedCode   string
 	}{
 		{
 			name:        "successful device creation",
@@ -137,12 +269,14 @@ func TestCreateDevice(t *testing.T) {
 			requestBody:    `{"name":"Test Device","type":"temperature","location":"Test Room"`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Invalid request body",
+			expectedCode:   ErrCodeInvalidRequest,
 		},
 		{
 			name:           "missing required fields",
 			requestBody:    `{"name":"","type":"temperature"}`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Invalid request body",
+			expectedCode:   ErrCodeInvalidRequest,
 		},
 		{
 			name:        "repository error",
@@ -154,6 +288,19 @@ func TestCreateDevice(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  "Failed to create device",
+			expectedCode:   ErrCodeInternal,
+		},
+		{
+			name:        "duplicate device name",
+			requestBody: `{"name":"Test Device","type":"temperature","location":"Test Room"}`,
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetCreateFunc(func(req *models.CreateDeviceRequest) (*models.Device, error) {
+					return nil, fmt.Errorf("failed to create device: %w", device.ErrDeviceNameTaken)
+				})
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "A device with this name already exists",
+			expectedCode:   ErrCodeDuplicateDeviceName,
 		},
 	}
 
@@ -185,7 +332,8 @@ func TestCreateDevice(t *testing.T) {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Contains(t, response["error"], tt.expectedError)
+				assert.Contains(t, response["message"], tt.expectedError)
+				assert.Equal(t, tt.expectedCode, response["code"])
 			} else {
 				var device models.Device
 				err := json.Unmarshal(w.Body.Bytes(), &device)
@@ -196,6 +344,149 @@ func TestCreateDevice(t *testing.T) {
 	}
 }
 
+func TestCreateDeviceValidationErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		requestBody    string
+		expectedFields []FieldError
+	}{
+		{
+			name:           "missing name",
+			path:           "/devices",
+			requestBody:    `{"type":"temperature"}`,
+			expectedFields: []FieldError{{Field: "name", Error: "required"}},
+		},
+		{
+			name:           "missing type",
+			path:           "/devices",
+			requestBody:    `{"name":"Test Device"}`,
+			expectedFields: []FieldError{{Field: "type", Error: "required"}},
+		},
+		{
+			name:        "missing name and type",
+			path:        "/devices",
+			requestBody: `{"location":"Test Room"}`,
+			expectedFields: []FieldError{
+				{Field: "name", Error: "required"},
+				{Field: "type", Error: "required"},
+			},
+		},
+		{
+			name:           "bulk device missing type",
+			path:           "/devices/bulk",
+			requestBody:    `{"devices":[{"name":"A","type":"temperature"},{"name":"B"}]}`,
+			expectedFields: []FieldError{{Field: "devices[1].type", Error: "required"}},
+		},
+		{
+			name:           "bulk without devices",
+			path:           "/devices/bulk",
+			requestBody:    `{"devices":[]}`,
+			expectedFields: []FieldError{{Field: "devices", Error: "min=1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+			router := setupTestRouter()
+			router.POST("/devices", handler.CreateDevice)
+			router.POST("/devices/bulk", handler.BulkCreateDevices)
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response struct {
+				Code    string       `json:"code"`
+				Details []FieldError `json:"details"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, ErrCodeInvalidRequest, response.Code)
+			assert.Equal(t, tt.expectedFields, response.Details)
+		})
+	}
+}
+
+func TestBulkCreateDevices(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		mockSetup      func(*device.MockRepository)
+		expectedStatus int
+		expectedCount  int
+		expectedCode   string
+	}{
+		{
+			name:           "successful bulk creation",
+			requestBody:    `{"devices":[{"name":"Sensor 1","type":"temperature"},{"name":"Sensor 2","type":"humidity"}]}`,
+			expectedStatus: http.StatusCreated,
+			expectedCount:  2,
+		},
+		{
+			name:           "empty device list",
+			requestBody:    `{"devices":[]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "invalid device in list",
+			requestBody:    `{"devices":[{"name":"Sensor 1","type":"temperature"},{"name":"","type":"humidity"}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "too many devices",
+			requestBody:    `{"devices":[` + strings.TrimSuffix(strings.Repeat(`{"name":"Sensor","type":"temperature"},`, 101), ",") + `]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:        "transaction rolled back",
+			requestBody: `{"devices":[{"name":"Sensor 1","type":"temperature"}]}`,
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetCreateBatchFunc(func(reqs []*models.CreateDeviceRequest) ([]*models.Device, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo)
+			}
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.POST("/devices/bulk", handler.BulkCreateDevices)
+
+			req := httptest.NewRequest("POST", "/devices/bulk", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, response["code"])
+				return
+			}
+			assert.Equal(t, float64(tt.expectedCount), response["count"])
+		})
+	}
+}
+
 func TestGetDevice(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -203,6 +494,7 @@ func TestGetDevice(t *testing.T) {
 		mockSetup      func(*device.MockRepository)
 		expectedStatus int
 		expectedError  string
+		expectedCode   string
 	}{
 		{
 			name:     "successful device retrieval",
@@ -230,6 +522,7 @@ func TestGetDevice(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  "Failed to get device",
+			expectedCode:   ErrCodeInternal,
 		},
 	}
 
@@ -265,7 +558,8 @@ func TestGetDevice(t *testing.T) {
 					var response map[string]interface{}
 					err := json.Unmarshal(w.Body.Bytes(), &response)
 					assert.NoError(t, err)
-					assert.Contains(t, response["error"], tt.expectedError)
+					assert.Contains(t, response["message"], tt.expectedError)
+					assert.Equal(t, tt.expectedCode, response["code"])
 				}
 			} else {
 				var device models.Device
@@ -277,6 +571,84 @@ func TestGetDevice(t *testing.T) {
 	}
 }
 
+func TestGetDeviceByName(t *testing.T) {
+	tests := []struct {
+		name           string
+		deviceName     string
+		mockSetup      func(*device.MockRepository)
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:       "found",
+			deviceName: "Boiler Room Sensor",
+			mockSetup: func(mock *device.MockRepository) {
+				d := createTestDevice()
+				d.Name = "Boiler Room Sensor"
+				mock.AddDevice(d)
+				mock.AddDevice(createTestDevice())
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not found",
+			deviceName:     "missing",
+			mockSetup:      func(mock *device.MockRepository) { mock.AddDevice(createTestDevice()) },
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+		{
+			name:       "ambiguous name",
+			deviceName: "Test Device",
+			mockSetup: func(mock *device.MockRepository) {
+				mock.AddDevice(createTestDevice())
+				mock.AddDevice(createTestDevice())
+			},
+			expectedStatus: http.StatusConflict,
+			expectedCode:   ErrCodeAmbiguousDeviceName,
+		},
+		{
+			name:       "repository error",
+			deviceName: "Test Device",
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetGetByNameFunc(func(name string) (*models.Device, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			tt.mockSetup(mockRepo)
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.GET("/devices/by-name/:name", handler.GetDeviceByName)
+
+			req := httptest.NewRequest("GET", "/devices/by-name/"+url.PathEscape(tt.deviceName), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var response APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedCode, response.Code)
+				return
+			}
+
+			var found models.Device
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &found))
+			assert.Equal(t, tt.deviceName, found.Name)
+		})
+	}
+}
+
 func TestGetAllDevices(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -284,6 +656,7 @@ func TestGetAllDevices(t *testing.T) {
 		expectedStatus int
 		expectedCount  int
 		expectedError  string
+		expectedCode   string
 	}{
 		{
 			name: "successful devices retrieval",
@@ -317,6 +690,7 @@ func TestGetAllDevices(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  "Failed to get devices",
+			expectedCode:   ErrCodeInternal,
 		},
 	}
 
@@ -347,13 +721,52 @@ func TestGetAllDevices(t *testing.T) {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Contains(t, response["error"], tt.expectedError)
+				assert.Contains(t, response["message"], tt.expectedError)
+				assert.Equal(t, tt.expectedCode, response["code"])
 			} else {
-				var response map[string]interface{}
+				var response models.DeviceListResponse
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Equal(t, float64(tt.expectedCount), response["count"])
+				assert.Equal(t, tt.expectedCount, response.Count)
+				assert.Len(t, response.Devices, tt.expectedCount)
+			}
+		})
+	}
+}
+
+func TestGetAllDevices_EmptyRendersArray(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(*device.MockRepository)
+	}{
+		{name: "no devices"},
+		{
+			name: "repository returns nil",
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetGetAllFunc(func() ([]*models.Device, error) {
+					return nil, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo)
 			}
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.GET("/devices", handler.GetAllDevices)
+
+			req := httptest.NewRequest("GET", "/devices", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"devices":[],"count":0}`, w.Body.String())
 		})
 	}
 }
@@ -366,6 +779,7 @@ func TestUpdateDevice(t *testing.T) {
 		mockSetup      func(*device.MockRepository)
 		expectedStatus int
 		expectedError  string
+		expectedCode   string
 	}{
 		{
 			name:        "successful device update",
@@ -395,6 +809,7 @@ func TestUpdateDevice(t *testing.T) {
 			requestBody:    `{"name":"Updated Device"`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  "Invalid request body",
+			expectedCode:   ErrCodeInvalidRequest,
 		},
 		{
 			name:        "device not found",
@@ -407,6 +822,20 @@ func TestUpdateDevice(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedError:  "Failed to update device",
+			expectedCode:   ErrCodeInternal,
+		},
+		{
+			name:        "duplicate device name",
+			deviceID:    "test-id",
+			requestBody: `{"name":"Taken Name"}`,
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetUpdateFunc(func(id string, req *models.UpdateDeviceRequest) (*models.Device, error) {
+					return nil, fmt.Errorf("failed to update device: %w", device.ErrDeviceNameTaken)
+				})
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "A device with this name already exists",
+			expectedCode:   ErrCodeDuplicateDeviceName,
 		},
 	}
 
@@ -443,7 +872,8 @@ func TestUpdateDevice(t *testing.T) {
 					var response map[string]interface{}
 					err := json.Unmarshal(w.Body.Bytes(), &response)
 					assert.NoError(t, err)
-					assert.Contains(t, response["error"], tt.expectedError)
+					assert.Contains(t, response["message"], tt.expectedError)
+					assert.Equal(t, tt.expectedCode, response["code"])
 				}
 			} else {
 				var device models.Device
@@ -455,40 +885,155 @@ func TestUpdateDevice(t *testing.T) {
 	}
 }
 
-func TestDeleteDevice(t *testing.T) {
+func TestMergeDeviceMetadata(t *testing.T) {
 	tests := []struct {
-		name           string
-		deviceID       string
-		mockSetup      func(*device.MockRepository)
-		expectedStatus int
-		expectedError  string
+		name             string
+		deviceID         string
+		metadata         string
+		requestBody      string
+		expectedStatus   int
+		expectedCode     string
+		expectedMetadata string
 	}{
 		{
-			name:     "successful device deletion",
-			deviceID: "test-id",
-			mockSetup: func(mock *device.MockRepository) {
-				mock.SetDeleteFunc(func(id string) error {
-					return nil
-				})
-			},
-			expectedStatus: http.StatusOK, // 実装では200を返している
+			name:             "merge new key",
+			deviceID:         "mock-device-id",
+			metadata:         `{"floor":3}`,
+			requestBody:      `{"room":"lab"}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: `{"floor":3,"room":"lab"}`,
 		},
 		{
-			name:           "missing device ID",
-			deviceID:       "",
-			expectedStatus: http.StatusNotFound, // Ginのルーティングにより404になる
-			expectedError:  "404 page not found",
+			name:             "overwrite existing key",
+			deviceID:         "mock-device-id",
+			metadata:         `{"floor":3,"room":"lab"}`,
+			requestBody:      `{"floor":4}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: `{"floor":4,"room":"lab"}`,
 		},
 		{
-			name:     "device not found",
-			deviceID: "non-existent-id",
-			mockSetup: func(mock *device.MockRepository) {
-				mock.SetDeleteFunc(func(id string) error {
-					return assert.AnError
-				})
-			},
-			expectedStatus: http.StatusInternalServerError,
-			expectedError:  "Failed to delete device",
+			name:             "null removes key",
+			deviceID:         "mock-device-id",
+			metadata:         `{"floor":3,"room":"lab"}`,
+			requestBody:      `{"room":null}`,
+			expectedStatus:   http.StatusOK,
+			expectedMetadata: `{"floor":3}`,
+		},
+		{
+			name:           "invalid JSON",
+			deviceID:       "mock-device-id",
+			requestBody:    `{"room":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "body not an object",
+			deviceID:       "mock-device-id",
+			requestBody:    `["room"]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "null body",
+			deviceID:       "mock-device-id",
+			requestBody:    `null`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "existing metadata not an object",
+			deviceID:       "mock-device-id",
+			metadata:       `basement`,
+			requestBody:    `{"floor":3}`,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "device not found",
+			deviceID:       "non-existent-id",
+			requestBody:    `{"floor":3}`,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			_, err := mockRepo.Create(&models.CreateDeviceRequest{Name: "Test Device", Type: "sensor", Metadata: tt.metadata})
+			require.NoError(t, err)
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.PATCH("/devices/:id/metadata", handler.MergeDeviceMetadata)
+
+			req := httptest.NewRequest("PATCH", "/devices/"+tt.deviceID+"/metadata", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response models.DeviceMetadataResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.deviceID, response.DeviceID)
+			assert.JSONEq(t, tt.expectedMetadata, string(response.Metadata))
+
+			// The merged metadata is stored on the device
+			stored, err := mockRepo.GetByID(tt.deviceID)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expectedMetadata, stored.Metadata)
+		})
+	}
+}
+
+func TestDeleteDevice(t *testing.T) {
+	tests := []struct {
+		name           string
+		deviceID       string
+		mockSetup      func(*device.MockRepository)
+		expectedStatus int
+		expectedError  string
+		expectedCode   string
+	}{
+		{
+			name:     "successful device deletion",
+			deviceID: "test-id",
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetDeleteFunc(func(id string) error {
+					return nil
+				})
+			},
+			expectedStatus: http.StatusOK, // 実装では200を返している
+		},
+		{
+			name:           "missing device ID",
+			deviceID:       "",
+			expectedStatus: http.StatusNotFound, // Ginのルーティングにより404になる
+			expectedError:  "404 page not found",
+		},
+		{
+			name:     "device not found",
+			deviceID: "non-existent-id",
+			mockSetup: func(mock *device.MockRepository) {
+				mock.SetDeleteFunc(func(id string) error {
+					return assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "Failed to delete device",
+			expectedCode:   ErrCodeInternal,
 		},
 	}
 
@@ -524,13 +1069,87 @@ func TestDeleteDevice(t *testing.T) {
 					var response map[string]interface{}
 					err := json.Unmarshal(w.Body.Bytes(), &response)
 					assert.NoError(t, err)
-					assert.Contains(t, response["error"], tt.expectedError)
+					assert.Contains(t, response["message"], tt.expectedError)
+					assert.Equal(t, tt.expectedCode, response["code"])
 				}
 			}
 		})
 	}
 }
 
+func TestGetDeviceStatusHistory(t *testing.T) {
+	testDevice := createTestDevice()
+	testDevice.Status = "offline"
+
+	mockRepo := device.NewMockRepository()
+	mockRepo.AddDevice(testDevice)
+
+	// Only actual transitions are recorded: offline→online, online→maintenance, maintenance→offline
+	for _, status := range []string{"offline", "online", "online", "maintenance", "maintenance", "offline"} {
+		require.NoError(t, mockRepo.UpdateStatus(testDevice.ID, status))
+	}
+
+	handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+	router := setupTestRouter()
+	router.GET("/devices/:id/status/history", handler.GetDeviceStatusHistory)
+
+	get := func(path string) (*httptest.ResponseRecorder, models.StatusHistoryResponse) {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response models.StatusHistoryResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w, response
+	}
+
+	t.Run("transitions newest first", func(t *testing.T) {
+		w, response := get("/devices/" + testDevice.ID + "/status/history")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, testDevice.ID, response.DeviceID)
+		assert.Equal(t, 3, response.Total)
+		require.Len(t, response.History, 3)
+
+		transitions := make([]string, len(response.History))
+		for i, change := range response.History {
+			transitions[i] = change.FromStatus + "->" + change.ToStatus
+		}
+		assert.Equal(t, []string{"maintenance->offline", "online->maintenance", "offline->online"}, transitions)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		w, response := get("/devices/" + testDevice.ID + "/status/history?limit=1&page=2")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, response.Limit)
+		assert.Equal(t, 1, response.Offset)
+		assert.Equal(t, 3, response.Total)
+		require.Len(t, response.History, 1)
+		assert.Equal(t, "maintenance", response.History[0].ToStatus)
+	})
+
+	t.Run("invalid offset", func(t *testing.T) {
+		w, _ := get("/devices/" + testDevice.ID + "/status/history?offset=-1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("device not found", func(t *testing.T) {
+		w, _ := get("/devices/missing/status/history")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		mockRepo.SetGetStatusHistoryFunc(func(id string, limit, offset int) ([]*models.StatusChange, error) {
+			return nil, assert.AnError
+		})
+		defer mockRepo.SetGetStatusHistoryFunc(nil)
+
+		w, _ := get("/devices/" + testDevice.ID + "/status/history")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
 func TestGetDeviceStatus(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -538,6 +1157,7 @@ func TestGetDeviceStatus(t *testing.T) {
 		mockSetup      func(*device.MockRepository)
 		expectedStatus int
 		expectedError  string
+		expectedCode   string
 	}{
 		{
 			name:     "successful status retrieval",
@@ -557,6 +1177,7 @@ func TestGetDeviceStatus(t *testing.T) {
 			deviceID:       "",
 			expectedStatus: http.StatusNotFound, // 実装では404を返す
 			expectedError:  "Device not found",
+			expectedCode:   ErrCodeDeviceNotFound,
 		},
 		{
 			name:     "device not found",
@@ -568,6 +1189,7 @@ func TestGetDeviceStatus(t *testing.T) {
 			},
 			expectedStatus: http.StatusNotFound, // 実装では404を返す
 			expectedError:  "Device not found",
+			expectedCode:   ErrCodeDeviceNotFound,
 		},
 	}
 
@@ -599,15 +1221,1690 @@ func TestGetDeviceStatus(t *testing.T) {
 				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Contains(t, response["error"], tt.expectedError)
+				assert.Contains(t, response["message"], tt.expectedError)
+				assert.Equal(t, tt.expectedCode, response["code"])
 			} else {
-				var response map[string]interface{}
+				var response models.DeviceStatusResponse
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Contains(t, response, "device_id")
-				assert.Contains(t, response, "status")
-				assert.Contains(t, response, "last_seen")
+				assert.Equal(t, tt.deviceID, response.DeviceID)
+				assert.Equal(t, "online", response.Status)
+			}
+		})
+	}
+}
+
+func TestGetDeviceDataTypes(t *testing.T) {
+	testDevice := createTestDevice()
+
+	tests := []struct {
+		name           string
+		mockSetup      func(*device.MockRepository, *MockDataRepository)
+		expectedStatus int
+		expectedTypes  []interface{}
+		expectedCode   string
+	}{
+		{
+			name: "device with mixed readings",
+			mockSetup: func(repo *device.MockRepository, mock *MockDataRepository) {
+				repo.AddDevice(testDevice)
+				mock.SetGetDataTypesFunc(func(deviceID string) ([]string, error) {
+					return []string{"humidity", "temperature"}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expectedTypes:  []interface{}{"humidity", "temperature"},
+		},
+		{
+			name: "device without readings",
+			mockSetup: func(repo *device.MockRepository, mock *MockDataRepository) {
+				repo.AddDevice(testDevice)
+			},
+			expectedStatus: http.StatusOK,
+			expectedTypes:  []interface{}{},
+		},
+		{
+			name:           "device not found",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+		{
+			name: "exists check error",
+			mockSetup: func(repo *device.MockRepository, mock *MockDataRepository) {
+				repo.SetExistsFunc(func(id string) (bool, error) {
+					return false, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+		{
+			name: "repository error",
+			mockSetup: func(repo *device.MockRepository, mock *MockDataRepository) {
+				repo.AddDevice(testDevice)
+				mock.SetGetDataTypesFunc(func(deviceID string) ([]string, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo, mockDataRepo)
+			}
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data/types", handler.GetDeviceDataTypes)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/"+testDevice.ID+"/data/types", nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, response["code"])
+			} else {
+				assert.Equal(t, testDevice.ID, response["device_id"])
+				assert.Equal(t, tt.expectedTypes, response["data_types"])
+				assert.Equal(t, float64(len(tt.expectedTypes)), response["count"])
+			}
+		})
+	}
+}
+
+func TestGetDeviceSummary(t *testing.T) {
+	testDevice := createTestDevice()
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		mockSetup      func(*device.MockRepository, *MockDataRepository)
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "successful summary",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.AddDevice(testDevice)
+				dataRepo.SetGetRecentByTypesFunc(func(deviceID string, types []string, perType int) (map[string][]*models.DeviceData, error) {
+					assert.Empty(t, types)
+					assert.Equal(t, 1, perType)
+					recent := make(map[string][]*models.DeviceData)
+					for _, dataType := range []string{"temperature", "humidity"} {
+						recent[dataType] = []*models.DeviceData{{
+							ID:        uuid.New().String(),
+							DeviceID:  deviceID,
+							Timestamp: now,
+							DataType:  dataType,
+							Value:     42,
+						}}
+					}
+					return recent, nil
+				})
+				dataRepo.SetGetDeviceDataByTypeFunc(func(deviceID, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+					t.Error("summary must not query each data type separately")
+					return nil, nil
+				})
+				dataRepo.SetGetDataCountFunc(func(deviceID, dataType string, start, end time.Time) (int, error) {
+					return 128, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "device not found",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+		{
+			name: "latest data error",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.AddDevice(testDevice)
+				dataRepo.SetGetRecentByTypesFunc(func(deviceID string, types []string, perType int) (map[string][]*models.DeviceData, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+		{
+			name: "data count error",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.AddDevice(testDevice)
+				dataRepo.SetGetDataCountFunc(func(deviceID, dataType string, start, end time.Time) (int, error) {
+					return 0, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo, mockDataRepo)
+			}
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/summary", handler.GetDeviceSummary)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/"+testDevice.ID+"/summary", nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var response APIError
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedCode, response.Code)
+				return
+			}
+
+			var response struct {
+				Device     models.Device                 `json:"device"`
+				Status     models.DeviceStatus           `json:"status"`
+				DataTypes  []string                      `json:"data_types"`
+				LatestData map[string]*models.DeviceData `json:"latest_data"`
+				DataCount  int                           `json:"data_count"`
 			}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, testDevice.ID, response.Device.ID)
+			assert.Equal(t, testDevice.Name, response.Device.Name)
+			assert.Equal(t, testDevice.ID, response.Status.DeviceID)
+			assert.Equal(t, testDevice.Status, response.Status.Status)
+			assert.Equal(t, []string{"humidity", "temperature"}, response.DataTypes)
+			assert.Len(t, response.LatestData, 2)
+			assert.Equal(t, "temperature", response.LatestData["temperature"].DataType)
+			assert.Equal(t, "humidity", response.LatestData["humidity"].DataType)
+			assert.Equal(t, 128, response.DataCount)
+		})
+	}
+}
+
+func TestDatabaseConnectionLoss(t *testing.T) {
+	testDevice := createTestDevice()
+	// What an in-flight query returns when PostgreSQL restarts, wrapped as the repositories do
+	connErr := fmt.Errorf("failed to get device: %w", driver.ErrBadConn)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		handler   func(*DeviceHandler) gin.HandlerFunc
+		mockSetup func(*device.MockRepository, *MockDataRepository)
+	}{
+		{
+			name:    "get device",
+			method:  "GET",
+			path:    "/devices/:id",
+			handler: func(h *DeviceHandler) gin.HandlerFunc { return h.GetDevice },
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.SetGetByIDFunc(func(string) (*models.Device, error) { return nil, connErr })
+			},
+		},
+		{
+			name:    "list devices",
+			method:  "GET",
+			path:    "/devices",
+			handler: func(h *DeviceHandler) gin.HandlerFunc { return h.GetAllDevices },
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.SetGetAllFunc(func() ([]*models.Device, error) { return nil, connErr })
+			},
+		},
+		{
+			name:    "device data",
+			method:  "GET",
+			path:    "/devices/:id/data",
+			handler: func(h *DeviceHandler) gin.HandlerFunc { return h.GetDeviceData },
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				dataRepo.SetGetDeviceDataFunc(func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error) {
+					return nil, &pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"}
+				})
+			},
+		},
+		{
+			name:    "summary with one failed sub-query",
+			method:  "GET",
+			path:    "/devices/:id/summary",
+			handler: func(h *DeviceHandler) gin.HandlerFunc { return h.GetDeviceSummary },
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.AddDevice(testDevice)
+				dataRepo.SetGetDataCountFunc(func(string, string, time.Time, time.Time) (int, error) { return 0, connErr })
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			tt.mockSetup(mockRepo, mockDataRepo)
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.Handle(tt.method, tt.path, tt.handler(handler))
+
+			// Execute
+			path := strings.Replace(tt.path, ":id", testDevice.ID, 1)
+			req := httptest.NewRequest(tt.method, path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+			var response APIError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, ErrCodeDatabaseUnavailable, response.Code)
+			assert.Equal(t, "Database temporarily unavailable", response.Message)
+			assert.Nil(t, response.Details, "driver errors must not reach the client")
+			assert.NotContains(t, w.Body.String(), "bad connection")
+			assert.NotContains(t, w.Body.String(), "administrator command")
 		})
 	}
 }
+
+func TestDatabaseQueryErrorStaysInternal(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockRepo.SetGetAllFunc(func() ([]*models.Device, error) {
+		return nil, fmt.Errorf("failed to get devices: %w", &pq.Error{Code: "42P01", Message: "relation does not exist"})
+	})
+
+	handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+	router := setupTestRouter()
+	router.GET("/devices", handler.GetAllDevices)
+
+	req := httptest.NewRequest("GET", "/devices", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response APIError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, ErrCodeInternal, response.Code)
+}
+
+func TestExportDevice(t *testing.T) {
+	testDevice := createTestDevice()
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := first.Add(48 * time.Hour)
+
+	// readingsUpTo returns limit readings, newest first, recording the requested limit
+	readingsUpTo := func(requested *int) func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error) {
+		return func(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+			*requested = limit
+			assert.True(t, start.IsZero() && end.IsZero(), "export reads the latest readings without a range")
+			assert.Equal(t, 0, offset)
+
+			data := make([]*models.DeviceData, 0, 3)
+			for i := 0; i < min(limit, 3); i++ {
+				data = append(data, &models.DeviceData{
+					ID:        uuid.New().String(),
+					DeviceID:  deviceID,
+					Timestamp: last.Add(-time.Duration(i) * time.Hour),
+					DataType:  "temperature",
+					Value:     20 + float64(i),
+				})
+			}
+			return data, nil
+		}
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		noData           bool
+		boundsErr        error
+		readingsErr      error
+		missingDevice    bool
+		expectedStatus   int
+		expectedCode     string
+		expectedLimit    int
+		expectedReadings int
+	}{
+		{name: "default limit", expectedStatus: http.StatusOK, expectedLimit: DefaultExportReadings, expectedReadings: 3},
+		{name: "custom limit", query: "?limit=2", expectedStatus: http.StatusOK, expectedLimit: 2, expectedReadings: 2},
+		{name: "limit capped", query: "?limit=50000", expectedStatus: http.StatusOK, expectedLimit: MaxExportReadings, expectedReadings: 3},
+		{name: "device without data", noData: true, expectedStatus: http.StatusOK, expectedLimit: DefaultExportReadings},
+		{name: "invalid limit", query: "?limit=all", expectedStatus: http.StatusBadRequest, expectedCode: ErrCodeInvalidRequest},
+		{name: "zero limit", query: "?limit=0", expectedStatus: http.StatusBadRequest, expectedCode: ErrCodeInvalidRequest},
+		{name: "device not found", missingDevice: true, expectedStatus: http.StatusNotFound, expectedCode: ErrCodeDeviceNotFound},
+		{name: "readings error", readingsErr: assert.AnError, expectedStatus: http.StatusInternalServerError, expectedCode: ErrCodeInternal},
+		{name: "bounds error", boundsErr: assert.AnError, expectedStatus: http.StatusInternalServerError, expectedCode: ErrCodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			if !tt.missingDevice {
+				mockRepo.AddDevice(testDevice)
+			}
+
+			var requestedLimit int
+			mockDataRepo := NewMockDataRepository()
+			switch {
+			case tt.readingsErr != nil:
+				mockDataRepo.SetGetDeviceDataFunc(func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error) {
+					return nil, tt.readingsErr
+				})
+			case tt.noData:
+				mockDataRepo.SetGetDeviceDataFunc(func(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+					requestedLimit = limit
+					return []*models.DeviceData{}, nil
+				})
+			default:
+				mockDataRepo.SetGetDeviceDataFunc(readingsUpTo(&requestedLimit))
+			}
+			switch {
+			case tt.boundsErr != nil:
+				mockDataRepo.SetGetDataBoundsFunc(func(string) (time.Time, time.Time, error) {
+					return time.Time{}, time.Time{}, tt.boundsErr
+				})
+			case !tt.noData:
+				mockDataRepo.SetGetDataBoundsFunc(func(string) (time.Time, time.Time, error) {
+					return first, last, nil
+				})
+			}
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/export", handler.ExportDevice)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/"+testDevice.ID+"/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var response APIError
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedCode, response.Code)
+				return
+			}
+
+			assert.Equal(t, `attachment; filename="device-`+testDevice.ID+`-export.json"`, w.Header().Get("Content-Disposition"))
+			assert.Equal(t, tt.expectedLimit, requestedLimit)
+
+			var export models.DeviceExport
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+			require.NotNil(t, export.Device)
+			assert.Equal(t, testDevice.ID, export.Device.ID)
+			assert.Equal(t, testDevice.Name, export.Device.Name)
+			assert.Len(t, export.Readings, tt.expectedReadings)
+			assert.False(t, export.ExportedAt.IsZero())
+
+			if tt.noData {
+				assert.Nil(t, export.DataBounds)
+				assert.Contains(t, w.Body.String(), `"data_bounds":null`)
+				return
+			}
+			require.NotNil(t, export.DataBounds)
+			assert.True(t, first.Equal(export.DataBounds.First))
+			assert.True(t, last.Equal(export.DataBounds.Last))
+			assert.True(t, last.Equal(export.Readings[0].Timestamp), "readings are newest first")
+		})
+	}
+}
+
+func TestGetFleetStats(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockSetup      func(*device.MockRepository, *MockDataRepository)
+		expectedStatus int
+	}{
+		{
+			name: "composed counts",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.SetCountByStatusFunc(func() (map[string]int, error) {
+					return map[string]int{"online": 7, "offline": 3, "maintenance": 2}, nil
+				})
+				dataRepo.SetGetDataCountFunc(func(deviceID, dataType string, start, end time.Time) (int, error) {
+					// Every device, every type, since local midnight
+					assert.Empty(t, deviceID)
+					assert.Empty(t, dataType)
+					assert.Equal(t, time.Local, start.Location())
+					assert.Equal(t, 0, start.Hour()+start.Minute()+start.Second()+start.Nanosecond())
+					assert.WithinDuration(t, time.Now(), start, 24*time.Hour)
+					assert.True(t, end.IsZero())
+					return 4200, nil
+				})
+				repo.SetCountActiveSinceFunc(func(since time.Time) (int, error) {
+					assert.WithinDuration(t, time.Now().Add(-time.Hour), since, time.Minute)
+					return 5, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "status count error",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.SetCountByStatusFunc(func() (map[string]int, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "data count error",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				dataRepo.SetGetDataCountFunc(func(deviceID, dataType string, start, end time.Time) (int, error) {
+					return 0, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "active count error",
+			mockSetup: func(repo *device.MockRepository, dataRepo *MockDataRepository) {
+				repo.SetCountActiveSinceFunc(func(since time.Time) (int, error) {
+					return 0, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			tt.mockSetup(mockRepo, mockDataRepo)
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/stats", handler.GetFleetStats)
+
+			req := httptest.NewRequest("GET", "/stats", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus != http.StatusOK {
+				var response APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, ErrCodeInternal, response.Code)
+				return
+			}
+
+			var response models.FleetStatsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, 12, response.TotalDevices)
+			assert.Equal(t, map[string]int{"online": 7, "offline": 3, "maintenance": 2}, response.DevicesByStatus)
+			assert.Equal(t, 4200, response.DataPointsToday)
+			assert.Equal(t, 5, response.ActiveLastHour)
+			assert.WithinDuration(t, time.Now(), response.GeneratedAt, time.Minute)
+		})
+	}
+}
+
+func TestGetFleetStats_LocalClock(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("UTC+9", 9*60*60)
+
+	var start, since time.Time
+	mockRepo := device.NewMockRepository()
+	mockRepo.SetCountActiveSinceFunc(func(t time.Time) (int, error) {
+		since = t
+		return 0, nil
+	})
+	mockDataRepo := NewMockDataRepository()
+	mockDataRepo.SetGetDataCountFunc(func(deviceID, dataType string, s, e time.Time) (int, error) {
+		start = s
+		return 0, nil
+	})
+
+	handler := NewDeviceHandler(mockRepo, mockDataRepo)
+	router := setupTestRouter()
+	router.GET("/stats", handler.GetFleetStats)
+
+	req := httptest.NewRequest("GET", "/stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// last_seen and timestamps are stored as local wall-clock time, so the bounds use the same clock
+	now := time.Now()
+	assert.Equal(t, wallClock(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)), wallClock(start))
+	assert.WithinDuration(t, wallClock(now.Add(-time.Hour)), wallClock(since), time.Minute)
+}
+
+func TestGetDeviceDataTotal(t *testing.T) {
+	tests := []struct {
+		name             string
+		query            string
+		countErr         error
+		expectedStatus   int
+		expectedDataType string
+		expectedCode     string
+	}{
+		{
+			name:           "total across all types",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:             "total filtered by type",
+			query:            "?type=temperature",
+			expectedStatus:   http.StatusOK,
+			expectedDataType: "temperature",
+		},
+		{
+			name:           "count error",
+			countErr:       assert.AnError,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetGetDataCountFunc(func(deviceID, dataType string, start, end time.Time) (int, error) {
+				assert.Equal(t, "test-id", deviceID)
+				assert.Equal(t, tt.expectedDataType, dataType)
+				assert.True(t, start.IsZero())
+				assert.True(t, end.IsZero())
+				return 250, tt.countErr
+			})
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/test-id/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response models.DeviceDataResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.NotNil(t, response.Total)
+			assert.Equal(t, 250, *response.Total)
+			assert.Equal(t, 0, response.Count)
+		})
+	}
+}
+
+func TestGetDeviceDataDownsampled(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(30 * 24 * time.Hour)
+	rangeQuery := "&start=" + start.Format(time.RFC3339) + "&end=" + end.Format(time.RFC3339)
+
+	tests := []struct {
+		name           string
+		query          string
+		mockSetup      func(*MockDataRepository)
+		expectedStatus int
+		expectedCount  int
+		expectedCode   string
+	}{
+		{
+			name:  "downsampled range",
+			query: "?downsample=2&type=temperature" + rangeQuery,
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDownsampledFunc(func(deviceID, dataType string, s, e time.Time, buckets int) ([]*models.DataPoint, error) {
+					assert.Equal(t, "test-id", deviceID)
+					assert.Equal(t, "temperature", dataType)
+					assert.True(t, start.Equal(s))
+					assert.True(t, end.Equal(e))
+					assert.Equal(t, 2, buckets)
+					return []*models.DataPoint{
+						{Timestamp: start, DataType: dataType, Value: 20, Min: 18, Max: 22, Count: 500},
+						{Timestamp: start.Add(15 * 24 * time.Hour), DataType: dataType, Value: 21, Min: 19, Max: 23, Count: 500},
+					}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  2,
+		},
+		{
+			name:  "default range without type",
+			query: "?downsample=10",
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDownsampledFunc(func(deviceID, dataType string, s, e time.Time, buckets int) ([]*models.DataPoint, error) {
+					assert.Empty(t, dataType)
+					assert.Equal(t, 24*time.Hour, e.Sub(s))
+					return []*models.DataPoint{}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid bucket count",
+			query:          "?downsample=0",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "bucket count above limit",
+			query:          "?downsample=5000",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "invalid start",
+			query:          "?downsample=10&start=yesterday",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "start after end",
+			query:          "?downsample=10&start=" + end.Format(time.RFC3339) + "&end=" + start.Format(time.RFC3339),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:  "repository error",
+			query: "?downsample=10" + rangeQuery,
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDownsampledFunc(func(deviceID, dataType string, s, e time.Time, buckets int) ([]*models.DataPoint, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockDataRepo)
+			}
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/test-id/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, response["code"])
+			} else {
+				assert.Equal(t, float64(tt.expectedCount), response["count"])
+				assert.Len(t, response["data"], tt.expectedCount)
+				assert.NotEmpty(t, response["start"])
+				assert.NotEmpty(t, response["end"])
+			}
+		})
+	}
+}
+
+func TestGetDeviceDataByMetadata(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		mockSetup      func(*MockDataRepository)
+		expectedStatus int
+		expectedCount  int
+		expectedCode   string
+	}{
+		{
+			name:  "matching readings",
+			query: "?metadata=quality:good&limit=5",
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByMetadataFunc(func(deviceID, key, value string, limit int) ([]*models.DeviceData, error) {
+					assert.Equal(t, "test-id", deviceID)
+					assert.Equal(t, "quality", key)
+					assert.Equal(t, "good", value)
+					assert.Equal(t, 5, limit)
+					return []*models.DeviceData{
+						{ID: "1", DeviceID: deviceID, DataType: "temperature", Value: 21.5, Metadata: `{"quality": "good"}`},
+						{ID: "2", DeviceID: deviceID, DataType: "temperature", Value: 21.0, Metadata: `{"quality": "good", "sensor": "a"}`},
+					}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  2,
+		},
+		{
+			name:  "value containing a colon",
+			query: "?metadata=firmware:v1:2",
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByMetadataFunc(func(deviceID, key, value string, limit int) ([]*models.DeviceData, error) {
+					assert.Equal(t, "firmware", key)
+					assert.Equal(t, "v1:2", value)
+					return []*models.DeviceData{}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing value separator",
+			query:          "?metadata=quality",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "empty key",
+			query:          "?metadata=:good",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:  "repository error",
+			query: "?metadata=quality:good",
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByMetadataFunc(func(deviceID, key, value string, limit int) ([]*models.DeviceData, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockDataRepo := NewMockDataRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockDataRepo)
+			}
+
+			handler := NewDeviceHandler(mockRepo, mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/test-id/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response models.DeviceDataResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedCount, response.Count)
+			assert.Len(t, response.Data, tt.expectedCount)
+			assert.Equal(t, DataStorePostgres, response.Source)
+		})
+	}
+}
+
+func TestSetDeviceRetention(t *testing.T) {
+	testDevice := createTestDevice()
+
+	tests := []struct {
+		name           string
+		deviceID       string
+		body           string
+		expectedStatus int
+		expectedDays   int
+		expectedCode   string
+	}{
+		{
+			name:           "custom retention",
+			deviceID:       testDevice.ID,
+			body:           `{"retention_days": 7}`,
+			expectedStatus: http.StatusOK,
+			expectedDays:   7,
+		},
+		{
+			name:           "reset to default",
+			deviceID:       testDevice.ID,
+			body:           `{"retention_days": 0}`,
+			expectedStatus: http.StatusOK,
+			expectedDays:   0,
+		},
+		{
+			name:           "missing retention",
+			deviceID:       testDevice.ID,
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "negative retention",
+			deviceID:       testDevice.ID,
+			body:           `{"retention_days": -1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "device not found",
+			deviceID:       "non-existent-id",
+			body:           `{"retention_days": 7}`,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockRepo.AddDevice(testDevice)
+			require.NoError(t, mockRepo.SetRetentionDays(testDevice.ID, 30))
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.PUT("/devices/:id/retention", handler.SetDeviceRetention)
+			router.GET("/devices/:id/retention", handler.GetDeviceRetention)
+
+			// Create request
+			req := httptest.NewRequest("PUT", "/devices/"+tt.deviceID+"/retention", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, response["code"])
+				return
+			}
+			assert.Equal(t, float64(tt.expectedDays), response["retention_days"])
+
+			// The stored value is returned by GET
+			req = httptest.NewRequest("GET", "/devices/"+tt.deviceID+"/retention", nil)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, float64(tt.expectedDays), response["retention_days"])
+		})
+	}
+}
+
+func TestGetDeviceRetention_NotFound(t *testing.T) {
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	router := setupTestRouter()
+	router.GET("/devices/:id/retention", handler.GetDeviceRetention)
+
+	req := httptest.NewRequest("GET", "/devices/non-existent-id/retention", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetDeviceStatuses(t *testing.T) {
+	online := createTestDevice()
+	offline := createTestDevice()
+	offline.Status = "offline"
+
+	manyIDs := make([]string, MaxStatusIDs+1)
+	for i := range manyIDs {
+		manyIDs[i] = uuid.New().String()
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		mockSetup        func(*device.MockRepository)
+		expectedStatus   int
+		expectedStatuses map[string]string
+		expectedNotFound []interface{}
+		expectedCode     string
+	}{
+		{
+			name:             "all found",
+			query:            "?ids=" + online.ID + "," + offline.ID,
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: map[string]string{online.ID: "online", offline.ID: "offline"},
+			expectedNotFound: []interface{}{},
+		},
+		{
+			name:             "some missing",
+			query:            "?ids=" + online.ID + ",missing-id",
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: map[string]string{online.ID: "online"},
+			expectedNotFound: []interface{}{"missing-id"},
+		},
+		{
+			name:             "duplicates and blanks are ignored",
+			query:            "?ids=" + online.ID + ",," + online.ID + ",%20",
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: map[string]string{online.ID: "online"},
+			expectedNotFound: []interface{}{},
+		},
+		{
+			name:           "missing ids",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "too many ids",
+			query:          "?ids=" + strings.Join(manyIDs, ","),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:  "repository error",
+			query: "?ids=" + online.ID,
+			mockSetup: func(repo *device.MockRepository) {
+				repo.SetGetStatusesFunc(func(ids []string) (map[string]*models.DeviceStatus, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockRepo := device.NewMockRepository()
+			mockRepo.AddDevice(online)
+			mockRepo.AddDevice(offline)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo)
+			}
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.GET("/devices/status", handler.GetDeviceStatuses)
+
+			// Create request
+			req := httptest.NewRequest("GET", "/devices/status"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			// Execute
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var response APIError
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedCode, response.Code)
+				return
+			}
+
+			var response struct {
+				Statuses map[string]models.DeviceStatus `json:"statuses"`
+				NotFound []interface{}                  `json:"not_found"`
+				Count    int                            `json:"count"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, len(tt.expectedStatuses), response.Count)
+			assert.Equal(t, tt.expectedNotFound, response.NotFound)
+			for id, status := range tt.expectedStatuses {
+				assert.Equal(t, status, response.Statuses[id].Status)
+				assert.Equal(t, id, response.Statuses[id].DeviceID)
+			}
+		})
+	}
+}
+
+func TestGetDataByType(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	rangeQuery := "&start=" + start.Format(time.RFC3339) + "&end=" + end.Format(time.RFC3339)
+
+	tests := []struct {
+		name           string
+		query          string
+		mockSetup      func(*MockDataRepository)
+		expectedStatus int
+		expectedCount  int
+		expectedLimit  int
+		expectedCode   string
+	}{
+		{
+			name:  "readings across devices",
+			query: "?type=temperature" + rangeQuery,
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByTypeAllDevicesFunc(func(dataType string, s, e time.Time, limit int) ([]*models.DeviceData, error) {
+					assert.Equal(t, "temperature", dataType)
+					assert.True(t, start.Equal(s))
+					assert.True(t, end.Equal(e))
+					return []*models.DeviceData{
+						{DeviceID: "device-2", DataType: dataType, Timestamp: start.Add(2 * time.Minute), Value: 21},
+						{DeviceID: "device-1", DataType: dataType, Timestamp: start.Add(time.Minute), Value: 20},
+					}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  2,
+			expectedLimit:  DefaultLimit,
+		},
+		{
+			name:  "defaults to the last hour",
+			query: "?type=temperature",
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByTypeAllDevicesFunc(func(dataType string, s, e time.Time, limit int) ([]*models.DeviceData, error) {
+					assert.Equal(t, time.Hour, e.Sub(s))
+					return []*models.DeviceData{}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expectedLimit:  DefaultLimit,
+		},
+		{
+			name:  "limit is capped",
+			query: "?type=temperature&limit=1000" + rangeQuery,
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByTypeAllDevicesFunc(func(dataType string, s, e time.Time, limit int) ([]*models.DeviceData, error) {
+					assert.Equal(t, MaxFleetDataLimit, limit)
+					return []*models.DeviceData{}, nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+			expectedLimit:  MaxFleetDataLimit,
+		},
+		{
+			name:           "missing type",
+			query:          "?start=" + start.Format(time.RFC3339),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "invalid start",
+			query:          "?type=temperature&start=yesterday",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:           "start after end",
+			query:          "?type=temperature&start=" + end.Format(time.RFC3339) + "&end=" + start.Format(time.RFC3339),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:  "repository error",
+			query: "?type=temperature" + rangeQuery,
+			mockSetup: func(mock *MockDataRepository) {
+				mock.SetGetDataByTypeAllDevicesFunc(func(dataType string, s, e time.Time, limit int) ([]*models.DeviceData, error) {
+					return nil, assert.AnError
+				})
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDataRepo := NewMockDataRepository()
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockDataRepo)
+			}
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/data", handler.GetDataByType)
+
+			req := httptest.NewRequest("GET", "/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, response["code"])
+				return
+			}
+			assert.Equal(t, float64(tt.expectedCount), response["count"])
+			assert.Equal(t, float64(tt.expectedLimit), response["limit"])
+		})
+	}
+}
+
+func TestGetDeviceDataPaginationAndRange(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedByType bool
+		expectedType   string
+		expectedStart  time.Time
+		expectedEnd    time.Time
+		expectedLimit  int
+		expectedOffset int
+		expectedStatus int
+	}{
+		{
+			name:           "type with range and offset",
+			query:          "?type=temperature&start=2024-01-01T00:00:00Z&end=2024-01-02T00:00:00Z&limit=10&offset=20",
+			expectedByType: true,
+			expectedType:   "temperature",
+			expectedStart:  start,
+			expectedEnd:    end,
+			expectedLimit:  10,
+			expectedOffset: 20,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "type with offset only",
+			query:          "?type=temperature&offset=5",
+			expectedByType: true,
+			expectedType:   "temperature",
+			expectedLimit:  DefaultLimit,
+			expectedOffset: 5,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "type with open-ended range",
+			query:          "?type=humidity&start=2024-01-01T00:00:00Z",
+			expectedByType: true,
+			expectedType:   "humidity",
+			expectedStart:  start,
+			expectedLimit:  DefaultLimit,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "range and offset without type",
+			query:          "?end=2024-01-02T00:00:00Z&offset=3",
+			expectedEnd:    end,
+			expectedLimit:  DefaultLimit,
+			expectedOffset: 3,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "page without type",
+			query:          "?limit=25&page=3",
+			expectedLimit:  25,
+			expectedOffset: 50,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "negative offset",
+			query:          "?type=temperature&offset=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "page and offset",
+			query:          "?page=2&offset=10",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid start",
+			query:          "?type=temperature&start=yesterday",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "start after end",
+			query:          "?start=2024-01-02T00:00:00Z&end=2024-01-01T00:00:00Z",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type call struct {
+				byType        bool
+				dataType      string
+				start, end    time.Time
+				limit, offset int
+			}
+			var got *call
+			var countStart, countEnd time.Time
+
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetGetDeviceDataByTypeFunc(func(deviceID, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				got = &call{byType: true, dataType: dataType, start: start, end: end, limit: limit, offset: offset}
+				return []*models.DeviceData{}, nil
+			})
+			mockDataRepo.SetGetDeviceDataFunc(func(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				got = &call{start: start, end: end, limit: limit, offset: offset}
+				return []*models.DeviceData{}, nil
+			})
+			mockDataRepo.SetGetDataCountFunc(func(deviceID, dataType string, start, end time.Time) (int, error) {
+				countStart, countEnd = start, end
+				return 42, nil
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			req := httptest.NewRequest("GET", "/devices/test-id/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+			if tt.expectedStatus != http.StatusOK {
+				assert.Nil(t, got)
+				assert.Equal(t, ErrCodeInvalidRequest, response["code"])
+				return
+			}
+
+			require.NotNil(t, got)
+			assert.Equal(t, tt.expectedByType, got.byType)
+			assert.Equal(t, tt.expectedType, got.dataType)
+			assert.True(t, tt.expectedStart.Equal(got.start))
+			assert.True(t, tt.expectedEnd.Equal(got.end))
+			assert.Equal(t, tt.expectedLimit, got.limit)
+			assert.Equal(t, tt.expectedOffset, got.offset)
+
+			// The total covers the same range
+			assert.True(t, tt.expectedStart.Equal(countStart))
+			assert.True(t, tt.expectedEnd.Equal(countEnd))
+			assert.Equal(t, float64(42), response["total"])
+			assert.Equal(t, float64(tt.expectedOffset), response["offset"])
+		})
+	}
+}
+
+func TestGetLatestDeviceData(t *testing.T) {
+	latest := &models.DeviceData{ID: "data-1", DeviceID: "test-id", DataType: "temperature", Value: 21.5}
+
+	tests := []struct {
+		name           string
+		data           *models.DeviceData
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "latest data",
+			data:           latest,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no data",
+			err:            device.ErrNoData,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDataNotFound,
+		},
+		{
+			name:           "query error",
+			err:            fmt.Errorf("failed to get latest device data: %w", assert.AnError),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetGetLatestDataFunc(func(deviceID string) (*models.DeviceData, error) {
+				return tt.data, tt.err
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data/latest", handler.GetLatestDeviceData)
+
+			req := httptest.NewRequest("GET", "/devices/test-id/data/latest", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response struct {
+				LatestData *models.DeviceData `json:"latest_data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.NotNil(t, response.LatestData)
+			assert.Equal(t, "data-1", response.LatestData.ID)
+		})
+	}
+}
+
+func TestGetDeviceDataBounds(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 1, 31, 23, 59, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		boundsFunc     func(string) (time.Time, time.Time, error)
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "device with data",
+			boundsFunc: func(string) (time.Time, time.Time, error) {
+				return first, last, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "device without data",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDataNotFound,
+		},
+		{
+			name: "query error",
+			boundsFunc: func(string) (time.Time, time.Time, error) {
+				return time.Time{}, time.Time{}, fmt.Errorf("failed to get device data bounds: %w", assert.AnError)
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDataRepo := NewMockDataRepository()
+			if tt.boundsFunc != nil {
+				mockDataRepo.SetGetDataBoundsFunc(tt.boundsFunc)
+			}
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			router := setupTestRouter()
+			router.GET("/devices/:id/data/bounds", handler.GetDeviceDataBounds)
+
+			req := httptest.NewRequest("GET", "/devices/test-id/data/bounds", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response struct {
+				DeviceID string    `json:"device_id"`
+				First    time.Time `json:"first"`
+				Last     time.Time `json:"last"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "test-id", response.DeviceID)
+			assert.True(t, first.Equal(response.First))
+			assert.True(t, last.Equal(response.Last))
+		})
+	}
+}
+
+func TestGetDeviceFacets(t *testing.T) {
+	t.Run("distinct values with counts", func(t *testing.T) {
+		mockRepo := device.NewMockRepository()
+		for _, d := range []struct{ deviceType, status string }{
+			{"temperature", "online"},
+			{"temperature", "offline"},
+			{"temperature", "online"},
+			{"humidity", "online"},
+		} {
+			testDevice := createTestDevice()
+			testDevice.Type = d.deviceType
+			testDevice.Status = d.status
+			mockRepo.AddDevice(testDevice)
+		}
+
+		router := setupTestRouter()
+		RegisterRoutes(router, Handlers{Devices: NewDeviceHandler(mockRepo, NewMockDataRepository())})
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/facets", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Types    []models.FacetValue `json:"types"`
+			Statuses []models.FacetValue `json:"statuses"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, []models.FacetValue{{Value: "humidity", Count: 1}, {Value: "temperature", Count: 3}}, response.Types)
+		assert.Equal(t, []models.FacetValue{{Value: "offline", Count: 1}, {Value: "online", Count: 3}}, response.Statuses)
+	})
+
+	t.Run("empty fleet", func(t *testing.T) {
+		router := setupTestRouter()
+		RegisterRoutes(router, Handlers{Devices: NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())})
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/facets", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"types":[],"statuses":[]}`, w.Body.String())
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		mockRepo := device.NewMockRepository()
+		mockRepo.SetGetFacetsFunc(func() ([]models.FacetValue, []models.FacetValue, error) {
+			return nil, nil, assert.AnError
+		})
+
+		handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+		router := setupTestRouter()
+		router.GET("/devices/facets", handler.GetDeviceFacets)
+
+		req := httptest.NewRequest("GET", "/devices/facets", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var apiErr APIError
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+		assert.Equal(t, ErrCodeInternal, apiErr.Code)
+	})
+}
+
+// wallClock returns t's wall-clock reading without its zone, as a TIMESTAMP without time zone column stores it
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func TestGetStaleDevices(t *testing.T) {
+	t.Run("devices not seen within the window, stalest first", func(t *testing.T) {
+		mockRepo := device.NewMockRepository()
+		now := time.Now()
+		for _, d := range []struct {
+			id       string
+			lastSeen time.Time
+		}{
+			{"recent", now.Add(-time.Minute)},
+			{"stale", now.Add(-45 * time.Minute)},
+			{"stalest", now.Add(-3 * time.Hour)},
+		} {
+			testDevice := createTestDevice()
+			testDevice.ID = d.id
+			testDevice.LastSeen = d.lastSeen
+			mockRepo.AddDevice(testDevice)
+		}
+
+		router := setupTestRouter()
+		RegisterRoutes(router, Handlers{Devices: NewDeviceHandler(mockRepo, NewMockDataRepository())})
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/stale", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Devices []*models.Device `json:"devices"`
+			Count   int              `json:"count"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 2, response.Count)
+		require.Len(t, response.Devices, 2)
+		assert.Equal(t, "stalest", response.Devices[0].ID)
+		assert.Equal(t, "stale", response.Devices[1].ID)
+	})
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedWindow time.Duration
+	}{
+		{name: "default window", query: "", expectedStatus: http.StatusOK, expectedWindow: DefaultStaleMinutes * time.Minute},
+		{name: "custom window", query: "?minutes=5", expectedStatus: http.StatusOK, expectedWindow: 5 * time.Minute},
+		{name: "zero minutes", query: "?minutes=0", expectedStatus: http.StatusBadRequest},
+		{name: "negative minutes", query: "?minutes=-1", expectedStatus: http.StatusBadRequest},
+		{name: "non-numeric minutes", query: "?minutes=abc", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cutoff time.Time
+			mockRepo := device.NewMockRepository()
+			mockRepo.SetGetDevicesNotSeenSinceFunc(func(t time.Time) ([]*models.Device, error) {
+				cutoff = t
+				return []*models.Device{}, nil
+			})
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			router := setupTestRouter()
+			router.GET("/devices/stale", handler.GetStaleDevices)
+
+			before := time.Now()
+			req := httptest.NewRequest("GET", "/devices/stale"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			after := time.Now()
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, ErrCodeInvalidRequest, apiErr.Code)
+				assert.True(t, cutoff.IsZero())
+				return
+			}
+
+			// The cutoff is the window before the request
+			assert.False(t, cutoff.Before(before.Add(-tt.expectedWindow)))
+			assert.False(t, cutoff.After(after.Add(-tt.expectedWindow)))
+		})
+	}
+
+	t.Run("cutoff uses the local clock last_seen is written with", func(t *testing.T) {
+		defer func(local *time.Location) { time.Local = local }(time.Local)
+		time.Local = time.FixedZone("UTC+9", 9*60*60)
+
+		var cutoff time.Time
+		mockRepo := device.NewMockRepository()
+		mockRepo.SetGetDevicesNotSeenSinceFunc(func(t time.Time) ([]*models.Device, error) {
+			cutoff = t
+			return []*models.Device{}, nil
+		})
+
+		handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+		router := setupTestRouter()
+		router.GET("/devices/stale", handler.GetStaleDevices)
+
+		req := httptest.NewRequest("GET", "/devices/stale?minutes=30", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// lib/pq drops the offset for a TIMESTAMP column, so only the wall clocks are compared
+		lastSeen := wallClock(time.Now().Add(-30 * time.Minute))
+		assert.WithinDuration(t, lastSeen, wallClock(cutoff), time.Minute)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		mockRepo := device.NewMockRepository()
+		mockRepo.SetGetDevicesNotSeenSinceFunc(func(time.Time) ([]*models.Device, error) {
+			return nil, assert.AnError
+		})
+
+		handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+		router := setupTestRouter()
+		router.GET("/devices/stale", handler.GetStaleDevices)
+
+		req := httptest.NewRequest("GET", "/devices/stale", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var apiErr APIError
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+		assert.Equal(t, ErrCodeInternal, apiErr.Code)
+	})
+}
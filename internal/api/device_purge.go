@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"log"
+)
+
+// SeriesPurger deletes a device's time series from secondary storage (InfluxDB)
+type SeriesPurger interface {
+	DeleteDeviceData(ctx context.Context, deviceID string) error
+}
+
+// SetSeriesPurger sets where a deleted device's time series are purged from; nil leaves them in place
+func (h *DeviceHandler) SetSeriesPurger(purger SeriesPurger) {
+	h.purger = purger
+}
+
+// purgeSeries deletes the device's time series.
+// Failures are logged rather than returned so they never fail the device delete itself.
+func (h *DeviceHandler) purgeSeries(ctx context.Context, deviceID string) {
+	if h.purger == nil {
+		return
+	}
+
+	if err := h.purger.DeleteDeviceData(ctx, deviceID); err != nil {
+		log.Printf("⚠️ Failed to purge InfluxDB data for deleted device %s: %v", deviceID, err)
+	}
+}
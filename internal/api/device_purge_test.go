@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"iot-platform-go/internal/device"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSeriesPurger records the devices whose series were purged
+type mockSeriesPurger struct {
+	deviceIDs []string
+	err       error
+}
+
+func (m *mockSeriesPurger) DeleteDeviceData(ctx context.Context, deviceID string) error {
+	m.deviceIDs = append(m.deviceIDs, deviceID)
+	return m.err
+}
+
+func TestDeleteDevice_PurgesSeries(t *testing.T) {
+	tests := []struct {
+		name           string
+		deleteErr      error
+		purgeErr       error
+		expectedStatus int
+		expectedPurged []string
+	}{
+		{
+			name:           "purges the deleted device",
+			expectedStatus: http.StatusOK,
+			expectedPurged: []string{"test-id"},
+		},
+		{
+			name:           "purge failure does not fail the delete",
+			purgeErr:       assert.AnError,
+			expectedStatus: http.StatusOK,
+			expectedPurged: []string{"test-id"},
+		},
+		{
+			name:           "failed delete purges nothing",
+			deleteErr:      assert.AnError,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			mockRepo.SetDeleteFunc(func(id string) error {
+				return tt.deleteErr
+			})
+			purger := &mockSeriesPurger{err: tt.purgeErr}
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			handler.SetSeriesPurger(purger)
+			router := setupTestRouter()
+			router.DELETE("/devices/:id", handler.DeleteDevice)
+
+			req := httptest.NewRequest("DELETE", "/devices/test-id", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedPurged, purger.deviceIDs)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SettingsPublisher publishes a device's effective settings to its config topic
+type SettingsPublisher interface {
+	PublishDeviceSettings(deviceID string, settings map[string]json.RawMessage) error
+}
+
+// SetSettingsDefaults sets the setting values returned for keys a device has not set
+func (h *DeviceHandler) SetSettingsDefaults(defaults map[string]json.RawMessage) {
+	h.settingsDefaults = defaults
+}
+
+// SetSettingsPublisher sets what publishes setting changes to devices; nil disables publishing
+func (h *DeviceHandler) SetSettingsPublisher(publisher SettingsPublisher) {
+	h.settingsPublisher = publisher
+}
+
+// GetDeviceSettings handles GET /api/devices/:id/settings.
+// It returns the device's settings over the configured defaults.
+func (h *DeviceHandler) GetDeviceSettings(c *gin.Context) {
+	id := c.Param("id")
+
+	settings, err := h.repo.GetSettings(id)
+	if err != nil {
+		if err.Error() == ErrDeviceNotFound {
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to get device settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.settingsResponse(id, settings))
+}
+
+// PutDeviceSettings handles PUT /api/devices/:id/settings.
+// The settings replace the device's stored ones and the effective settings are published to the device's config topic.
+func (h *DeviceHandler) PutDeviceSettings(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateDeviceSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	settings, err := device.NormalizeSettings(req.Settings, h.settingsDefaults)
+	if err != nil {
+		respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid device settings", err.Error())
+		return
+	}
+
+	if err := h.repo.SetSettings(id, settings); err != nil {
+		if err.Error() == ErrDeviceNotFound {
+			respondError(c, http.StatusNotFound, ErrCodeDeviceNotFound, ErrDeviceNotFound)
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to update device settings", err)
+		return
+	}
+
+	h.recordEvent(c, id, models.EventDeviceUpdated, gin.H{"settings": settings})
+
+	response := h.settingsResponse(id, settings)
+	if h.settingsPublisher != nil {
+		// The settings are saved; a device that misses the update gets the retained message when it reconnects
+		if err := h.settingsPublisher.PublishDeviceSettings(id, response.Settings); err != nil {
+			log.Printf("Failed to publish settings for device %s: %v", id, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// settingsResponse overlays a device's settings on the configured defaults
+func (h *DeviceHandler) settingsResponse(id string, settings map[string]json.RawMessage) *models.DeviceSettingsResponse {
+	effective, defaulted := device.EffectiveSettings(settings, h.settingsDefaults)
+	return &models.DeviceSettingsResponse{DeviceID: id, Settings: effective, Defaulted: defaulted}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSettingsPublisher records the settings published per device
+type mockSettingsPublisher struct {
+	published map[string]map[string]json.RawMessage
+	err       error
+}
+
+func (m *mockSettingsPublisher) PublishDeviceSettings(deviceID string, settings map[string]json.RawMessage) error {
+	if m.published == nil {
+		m.published = make(map[string]map[string]json.RawMessage)
+	}
+	m.published[deviceID] = settings
+	return m.err
+}
+
+func testSettingsDefaults() map[string]json.RawMessage {
+	return device.ParseSettingsDefaults(map[string]string{"interval": "30", "mode": "eco"})
+}
+
+func TestGetDeviceSettings(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockRepo.AddDevice(&models.Device{ID: "device-1", Name: "Sensor"})
+	require.NoError(t, mockRepo.SetSettings("device-1", map[string]json.RawMessage{
+		"interval":    json.RawMessage(`60`),
+		"calibration": json.RawMessage(`{"offset":0.5}`),
+	}))
+	mockRepo.AddDevice(&models.Device{ID: "device-2", Name: "New sensor"})
+
+	handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+	handler.SetSettingsDefaults(testSettingsDefaults())
+	router := setupTestRouter()
+	router.GET("/devices/:id/settings", handler.GetDeviceSettings)
+
+	tests := []struct {
+		name              string
+		deviceID          string
+		expectedStatus    int
+		expectedSettings  string
+		expectedDefaulted []string
+	}{
+		{
+			name:              "device settings over the defaults",
+			deviceID:          "device-1",
+			expectedStatus:    http.StatusOK,
+			expectedSettings:  `{"interval":60,"mode":"eco","calibration":{"offset":0.5}}`,
+			expectedDefaulted: []string{"mode"},
+		},
+		{
+			name:              "device without settings reads the defaults",
+			deviceID:          "device-2",
+			expectedStatus:    http.StatusOK,
+			expectedSettings:  `{"interval":30,"mode":"eco"}`,
+			expectedDefaulted: []string{"interval", "mode"},
+		},
+		{
+			name:           "unknown device",
+			deviceID:       "device-3",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/devices/"+tt.deviceID+"/settings", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, ErrCodeDeviceNotFound, apiErr.Code)
+				return
+			}
+
+			var response models.DeviceSettingsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.deviceID, response.DeviceID)
+			settings, err := json.Marshal(response.Settings)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expectedSettings, string(settings))
+			assert.Equal(t, tt.expectedDefaulted, response.Defaulted)
+		})
+	}
+}
+
+func TestPutDeviceSettings(t *testing.T) {
+	tests := []struct {
+		name             string
+		deviceID         string
+		body             string
+		publishErr       error
+		expectedStatus   int
+		expectedCode     string
+		expectedSettings string // effective settings returned and published
+		expectedStored   string
+	}{
+		{
+			name:             "replace settings",
+			deviceID:         "device-1",
+			body:             `{"settings":{"interval":10,"calibration":{"offset":0.5}}}`,
+			expectedStatus:   http.StatusOK,
+			expectedSettings: `{"interval":10,"mode":"eco","calibration":{"offset":0.5}}`,
+			expectedStored:   `{"interval":10,"calibration":{"offset":0.5}}`,
+		},
+		{
+			name:             "null reverts to the default",
+			deviceID:         "device-1",
+			body:             `{"settings":{"interval":null,"mode":"boost"}}`,
+			expectedStatus:   http.StatusOK,
+			expectedSettings: `{"interval":30,"mode":"boost"}`,
+			expectedStored:   `{"mode":"boost"}`,
+		},
+		{
+			name:             "empty settings clear the device's own",
+			deviceID:         "device-1",
+			body:             `{"settings":{}}`,
+			expectedStatus:   http.StatusOK,
+			expectedSettings: `{"interval":30,"mode":"eco"}`,
+			expectedStored:   `{}`,
+		},
+		{
+			name:             "publish failure still saves",
+			deviceID:         "device-1",
+			body:             `{"settings":{"interval":10}}`,
+			publishErr:       assert.AnError,
+			expectedStatus:   http.StatusOK,
+			expectedSettings: `{"interval":10,"mode":"eco"}`,
+			expectedStored:   `{"interval":10}`,
+		},
+		{
+			name:           "type differs from the default",
+			deviceID:       "device-1",
+			body:           `{"settings":{"interval":"fast"}}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+			expectedStored: `{"interval":60}`,
+		},
+		{
+			name:           "missing settings",
+			deviceID:       "device-1",
+			body:           `{"interval":10}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   ErrCodeInvalidRequest,
+			expectedStored: `{"interval":60}`,
+		},
+		{
+			name:           "unknown device",
+			deviceID:       "device-2",
+			body:           `{"settings":{"interval":10}}`,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDeviceNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := device.NewMockRepository()
+			mockRepo.AddDevice(&models.Device{ID: "device-1", Name: "Sensor"})
+			require.NoError(t, mockRepo.SetSettings("device-1", map[string]json.RawMessage{"interval": json.RawMessage(`60`)}))
+			events := device.NewMockEventRepository()
+
+			handler := NewDeviceHandler(mockRepo, NewMockDataRepository())
+			handler.SetSettingsDefaults(testSettingsDefaults())
+			handler.SetEventRepository(events)
+			publisher := &mockSettingsPublisher{err: tt.publishErr}
+			handler.SetSettingsPublisher(publisher)
+			router := setupTestRouter()
+			router.PUT("/devices/:id/settings", handler.PutDeviceSettings)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("PUT", "/devices/"+tt.deviceID+"/settings", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStored != "" {
+				stored, err := mockRepo.GetSettings("device-1")
+				require.NoError(t, err)
+				encoded, err := json.Marshal(stored)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.expectedStored, string(encoded))
+			}
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				assert.Empty(t, publisher.published)
+				return
+			}
+
+			var response models.DeviceSettingsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			settings, err := json.Marshal(response.Settings)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expectedSettings, string(settings))
+
+			// The effective settings are published to the device
+			published, err := json.Marshal(publisher.published[tt.deviceID])
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expectedSettings, string(published))
+
+			recorded := events.Events()
+			require.Len(t, recorded, 1)
+			assert.Equal(t, models.EventDeviceUpdated, recorded[0].EventType)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"iot-platform-go/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned in APIError.Code
+const (
+	ErrCodeInvalidRequest       = "INVALID_REQUEST"
+	ErrCodeDeviceNotFound       = "DEVICE_NOT_FOUND"
+	ErrCodeAmbiguousDeviceName  = "AMBIGUOUS_DEVICE_NAME"
+	ErrCodeDuplicateDeviceName  = "DUPLICATE_DEVICE_NAME"
+	ErrCodeDataNotFound         = "DATA_NOT_FOUND"
+	ErrCodeInternal             = "INTERNAL_ERROR"
+	ErrCodeInfluxDBUnavailable  = "INFLUXDB_UNAVAILABLE"
+	ErrCodeDatabaseUnavailable  = "DATABASE_UNAVAILABLE"
+	ErrCodeMQTTUnavailable      = "MQTT_UNAVAILABLE"
+	ErrCodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	ErrCodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	ErrCodeUnauthorized         = "UNAUTHORIZED"
+	ErrCodeDeviceTimeout        = "DEVICE_TIMEOUT"
+)
+
+// databaseUnavailableMessage is returned instead of driver errors when the database connection is lost
+const databaseUnavailableMessage = "Database temporarily unavailable"
+
+// APIError is the standard error response body
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	// RequestID identifies the request in the server logs; set for unexpected failures such as panics
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// respondError writes a standard error response
+func respondError(c *gin.Context, status int, code, msg string) {
+	c.JSON(status, APIError{Code: code, Message: msg})
+}
+
+// respondErrorWithDetails writes a standard error response with additional details
+func respondErrorWithDetails(c *gin.Context, status int, code, msg string, details interface{}) {
+	c.JSON(status, APIError{Code: code, Message: msg, Details: details})
+}
+
+// respondDatabaseError writes a 500 for a failed repository call, or a 503 when err means
+// the database connection was lost so clients retry instead of seeing driver errors
+func respondDatabaseError(c *gin.Context, msg string, err error) {
+	if database.IsConnectionError(err) {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeDatabaseUnavailable, databaseUnavailableMessage)
+		return
+	}
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, msg)
+}
+
+// respondDatabaseErrorWithDetails is respondDatabaseError with err's text included in the 500
+func respondDatabaseErrorWithDetails(c *gin.Context, msg string, err error) {
+	if database.IsConnectionError(err) {
+		respondError(c, http.StatusServiceUnavailable, ErrCodeDatabaseUnavailable, databaseUnavailableMessage)
+		return
+	}
+	respondErrorWithDetails(c, http.StatusInternalServerError, ErrCodeInternal, msg, err.Error())
+}
+
+// respondBindError writes the error response for a request body that failed to bind.
+// Validation failures are reported per field instead of as the raw validator message.
+func respondBindError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large")
+		return
+	}
+
+	if fields, ok := validationFieldErrors(err); ok {
+		respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", fields)
+		return
+	}
+
+	respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err.Error())
+}
+
+// respondQueryError writes the error response for query parameters that failed to bind.
+// Validation failures are reported per field, like respondBindError does for bodies.
+func respondQueryError(c *gin.Context, err error) {
+	if fields, ok := validationFieldErrors(err); ok {
+		respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid query parameters", fields)
+		return
+	}
+
+	respondErrorWithDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid query parameters", err.Error())
+}
+
+// abortWithError writes a standard error response and stops the handler chain
+func abortWithError(c *gin.Context, status int, code, msg string) {
+	c.AbortWithStatusJSON(status, APIError{Code: code, Message: msg})
+}
@@ -1,81 +1,69 @@
 package api
 
 import (
+	"context"
 	"net/http"
-	"strconv"
 	"time"
 
-	"iot-platform-go/internal/influxdb"
+	"iot-platform-go/pkg/models"
 
 	"github.com/gin-gonic/gin"
 )
 
-const (
-	// InfluxDB API limits
-	InfluxDBDefaultLimit = 100
-	InfluxDBMaxLimit     = 1000
-)
+// InfluxReader defines the InfluxDB queries used by InfluxDBHandler
+type InfluxReader interface {
+	QueryDeviceData(ctx context.Context, deviceID string, dataType string, start time.Time, end time.Time, limit int) ([]*models.DeviceData, error)
+	GetLatestDeviceData(ctx context.Context, deviceID string, dataType string) (*models.DeviceData, error)
+}
 
 // InfluxDBHandler handles InfluxDB-related API endpoints
 type InfluxDBHandler struct {
-	influxClient *influxdb.Client
+	influxClient InfluxReader
+	limits       Limits
 }
 
 // NewInfluxDBHandler creates a new InfluxDB handler
-func NewInfluxDBHandler(influxClient *influxdb.Client) *InfluxDBHandler {
+func NewInfluxDBHandler(influxClient InfluxReader) *InfluxDBHandler {
 	return &InfluxDBHandler{
 		influxClient: influxClient,
+		limits:       DefaultLimits(),
 	}
 }
 
+// SetLimits sets the default and maximum number of data points returned by queries
+func (h *InfluxDBHandler) SetLimits(limits Limits) {
+	h.limits = limits
+}
+
 // GetDeviceDataFromInfluxDB gets device data from InfluxDB
 func (h *InfluxDBHandler) GetDeviceDataFromInfluxDB(c *gin.Context) {
 	if h.influxClient == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "InfluxDB not available"})
+		respondError(c, http.StatusServiceUnavailable, ErrCodeInfluxDBUnavailable, "InfluxDB not available")
 		return
 	}
 
 	deviceID := c.Param("id")
 	if deviceID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Device ID is required"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Device ID is required")
 		return
 	}
 
-	// Get query parameters
-	dataType := c.Query("type")
-	limitStr := c.DefaultQuery("limit", strconv.Itoa(InfluxDBDefaultLimit))
-	startStr := c.Query("start")
-	endStr := c.Query("end")
-
-	// Parse limit
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = InfluxDBDefaultLimit
-	}
-	if limit > InfluxDBMaxLimit {
-		limit = InfluxDBMaxLimit
-	}
-
-	// Parse time range
-	end := time.Now()
-	start := end.Add(-24 * time.Hour) // Default to last 24 hours
-
-	if startStr != "" {
-		if parsed, err := time.Parse(time.RFC3339, startStr); err == nil {
-			start = parsed
-		}
+	query, ok := h.limits.bindDataQuery(c)
+	if !ok {
+		return
 	}
 
-	if endStr != "" {
-		if parsed, err := time.Parse(time.RFC3339, endStr); err == nil {
-			end = parsed
-		}
+	// Default to the last 24 hours
+	start, end, err := query.timeRange(24 * time.Hour)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
 	}
 
 	// Query data from InfluxDB
-	data, err := h.influxClient.QueryDeviceData(deviceID, dataType, start, end, limit)
+	data, err := h.influxClient.QueryDeviceData(c.Request.Context(), deviceID, query.Type, start, end, query.Limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query data from InfluxDB"})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to query data from InfluxDB")
 		return
 	}
 
@@ -83,7 +71,7 @@ func (h *InfluxDBHandler) GetDeviceDataFromInfluxDB(c *gin.Context) {
 		"device_id": deviceID,
 		"data":      data,
 		"count":     len(data),
-		"limit":     limit,
+		"limit":     query.Limit,
 		"start":     start.Format(time.RFC3339),
 		"end":       end.Format(time.RFC3339),
 		"source":    "influxdb",
@@ -93,22 +81,22 @@ func (h *InfluxDBHandler) GetDeviceDataFromInfluxDB(c *gin.Context) {
 // GetLatestDeviceDataFromInfluxDB gets the latest data point for a device from InfluxDB
 func (h *InfluxDBHandler) GetLatestDeviceDataFromInfluxDB(c *gin.Context) {
 	if h.influxClient == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "InfluxDB not available"})
+		respondError(c, http.StatusServiceUnavailable, ErrCodeInfluxDBUnavailable, "InfluxDB not available")
 		return
 	}
 
 	deviceID := c.Param("id")
 	if deviceID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Device ID is required"})
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Device ID is required")
 		return
 	}
 
 	dataType := c.Query("type")
 
 	// Query latest data from InfluxDB
-	data, err := h.influxClient.GetLatestDeviceData(deviceID, dataType)
+	data, err := h.influxClient.GetLatestDeviceData(c.Request.Context(), deviceID, dataType)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No data found for device"})
+		respondError(c, http.StatusNotFound, ErrCodeDataNotFound, "No data found for device")
 		return
 	}
 
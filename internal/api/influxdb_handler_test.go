@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockInfluxReader is a mock implementation of InfluxReader
+type MockInfluxReader struct {
+	queryDeviceDataFunc     func(context.Context, string, string, time.Time, time.Time, int) ([]*models.DeviceData, error)
+	getLatestDeviceDataFunc func(context.Context, string, string) (*models.DeviceData, error)
+}
+
+// NewMockInfluxReader creates a new mock InfluxDB reader
+func NewMockInfluxReader() *MockInfluxReader {
+	return &MockInfluxReader{}
+}
+
+// SetQueryDeviceDataFunc sets the mock function for QueryDeviceData
+func (m *MockInfluxReader) SetQueryDeviceDataFunc(fn func(context.Context, string, string, time.Time, time.Time, int) ([]*models.DeviceData, error)) {
+	m.queryDeviceDataFunc = fn
+}
+
+// SetGetLatestDeviceDataFunc sets the mock function for GetLatestDeviceData
+func (m *MockInfluxReader) SetGetLatestDeviceDataFunc(fn func(context.Context, string, string) (*models.DeviceData, error)) {
+	m.getLatestDeviceDataFunc = fn
+}
+
+// QueryDeviceData implements InfluxReader
+func (m *MockInfluxReader) QueryDeviceData(ctx context.Context, deviceID string, dataType string, start time.Time, end time.Time, limit int) ([]*models.DeviceData, error) {
+	if m.queryDeviceDataFunc != nil {
+		return m.queryDeviceDataFunc(ctx, deviceID, dataType, start, end, limit)
+	}
+	return []*models.DeviceData{}, nil
+}
+
+// GetLatestDeviceData implements InfluxReader
+func (m *MockInfluxReader) GetLatestDeviceData(ctx context.Context, deviceID string, dataType string) (*models.DeviceData, error) {
+	if m.getLatestDeviceDataFunc != nil {
+		return m.getLatestDeviceDataFunc(ctx, deviceID, dataType)
+	}
+	return nil, errors.New("no data found for device " + deviceID)
+}
+
+func setupInfluxTestRouter(handler *InfluxDBHandler) *gin.Engine {
+	router := setupTestRouter()
+	router.GET("/influxdb/devices/:id/data", handler.GetDeviceDataFromInfluxDB)
+	router.GET("/influxdb/devices/:id/data/latest", handler.GetLatestDeviceDataFromInfluxDB)
+	return router
+}
+
+func TestGetDeviceDataFromInfluxDB(t *testing.T) {
+	reading := &models.DeviceData{ID: "data-1", DeviceID: "device-1", DataType: "temperature", Value: 21.5, Unit: "celsius"}
+
+	tests := []struct {
+		name           string
+		url            string
+		queryErr       error
+		expectedStatus int
+		expectedCode   string
+		expectedType   string
+		expectedLimit  int
+	}{
+		{
+			name:           "success",
+			url:            "/influxdb/devices/device-1/data?type=temperature&limit=10&start=2024-01-01T00:00:00Z&end=2024-01-02T00:00:00Z",
+			expectedStatus: http.StatusOK,
+			expectedType:   "temperature",
+			expectedLimit:  10,
+		},
+		{
+			name:           "query failure",
+			url:            "/influxdb/devices/device-1/data",
+			queryErr:       errors.New("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrCodeInternal,
+			expectedLimit:  DefaultLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotType string
+			var gotLimit int
+			reader := NewMockInfluxReader()
+			reader.SetQueryDeviceDataFunc(func(ctx context.Context, deviceID, dataType string, start, end time.Time, limit int) ([]*models.DeviceData, error) {
+				assert.Equal(t, "device-1", deviceID)
+				gotType = dataType
+				gotLimit = limit
+				if tt.queryErr != nil {
+					return nil, tt.queryErr
+				}
+				return []*models.DeviceData{reading}, nil
+			})
+			router := setupInfluxTestRouter(NewInfluxDBHandler(reader))
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedType, gotType)
+			assert.Equal(t, tt.expectedLimit, gotLimit)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, float64(1), response["count"])
+			assert.Equal(t, "influxdb", response["source"])
+			assert.Equal(t, "2024-01-01T00:00:00Z", response["start"])
+			assert.Equal(t, "2024-01-02T00:00:00Z", response["end"])
+		})
+	}
+}
+
+func TestGetLatestDeviceDataFromInfluxDB(t *testing.T) {
+	tests := []struct {
+		name           string
+		latest         *models.DeviceData
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "success",
+			latest:         &models.DeviceData{ID: "data-1", DeviceID: "device-1", DataType: "temperature", Value: 21.5},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not found",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrCodeDataNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewMockInfluxReader()
+			if tt.latest != nil {
+				reader.SetGetLatestDeviceDataFunc(func(ctx context.Context, deviceID, dataType string) (*models.DeviceData, error) {
+					return tt.latest, nil
+				})
+			}
+			router := setupInfluxTestRouter(NewInfluxDBHandler(reader))
+
+			req := httptest.NewRequest("GET", "/influxdb/devices/device-1/data/latest", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedCode != "" {
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, tt.expectedCode, apiErr.Code)
+				return
+			}
+
+			var response struct {
+				DeviceID   string             `json:"device_id"`
+				LatestData *models.DeviceData `json:"latest_data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "device-1", response.DeviceID)
+			require.NotNil(t, response.LatestData)
+			assert.Equal(t, 21.5, response.LatestData.Value)
+		})
+	}
+}
+
+func TestInfluxDBHandler_Unavailable(t *testing.T) {
+	router := setupInfluxTestRouter(NewInfluxDBHandler(nil))
+
+	for _, path := range []string{"/influxdb/devices/device-1/data", "/influxdb/devices/device-1/data/latest"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+			var apiErr APIError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+			assert.Equal(t, ErrCodeInfluxDBUnavailable, apiErr.Code)
+		})
+	}
+}
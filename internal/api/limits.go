@@ -0,0 +1,73 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits bounds the number of items returned by list queries
+type Limits struct {
+	Default int
+	Max     int
+}
+
+// DefaultLimits returns the limits used when none are configured
+func DefaultLimits() Limits {
+	return Limits{Default: DefaultLimit, Max: MaxLimit}
+}
+
+// queryLimit reads the limit query parameter, falling back to the default when
+// it is missing or invalid and clamping it to the maximum
+func (l Limits) queryLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = l.Default
+	}
+	if limit > l.Max {
+		limit = l.Max
+	}
+	return limit
+}
+
+// queryOffset reads the offset query parameter, defaulting to 0.
+// It responds with 400 and returns false when the offset is not a non-negative integer.
+func queryOffset(c *gin.Context) (int, bool) {
+	offsetStr := c.Query("offset")
+	if offsetStr == "" {
+		return 0, true
+	}
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "offset must be a non-negative integer")
+		return 0, false
+	}
+	return offset, true
+}
+
+// parsePagination reads the limit and the position, given either as offset or as a 1-based page of limit items.
+// The limit follows queryLimit. It responds with 400 and returns false when offset or page is invalid or both are given.
+func (l Limits) parsePagination(c *gin.Context) (limit, offset int, ok bool) {
+	limit = l.queryLimit(c)
+
+	pageStr := c.Query("page")
+	if pageStr == "" {
+		offset, ok = queryOffset(c)
+		return limit, offset, ok
+	}
+
+	if c.Query("offset") != "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "use either offset or page, not both")
+		return 0, 0, false
+	}
+
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 || page-1 > math.MaxInt32/max(limit, 1) {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "page must be a positive integer")
+		return 0, 0, false
+	}
+	return limit, (page - 1) * limit, true
+}
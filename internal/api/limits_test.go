@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsQueryLimit(t *testing.T) {
+	limits := Limits{Default: 20, Max: 50}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"missing uses default", "", 20},
+		{"within range", "?limit=30", 30},
+		{"at max", "?limit=50", 50},
+		{"above max is clamped", "?limit=500", 50},
+		{"zero uses default", "?limit=0", 20},
+		{"negative uses default", "?limit=-5", 20},
+		{"not a number uses default", "?limit=abc", 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/"+tt.query, nil)
+
+			assert.Equal(t, tt.expected, limits.queryLimit(c))
+		})
+	}
+}
+
+func TestLimitsParsePagination(t *testing.T) {
+	limits := Limits{Default: 20, Max: 50}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedLimit  int
+		expectedOffset int
+		expectedOK     bool
+	}{
+		{"defaults", "", 20, 0, true},
+		{"limit and offset", "?limit=10&offset=30", 10, 30, true},
+		{"limit above max is clamped", "?limit=500&offset=5", 50, 5, true},
+		{"negative limit uses default", "?limit=-1", 20, 0, true},
+		{"invalid limit uses default", "?limit=ten&page=2", 20, 20, true},
+		{"first page", "?page=1", 20, 0, true},
+		{"page uses limit as page size", "?limit=10&page=3", 10, 20, true},
+		{"page with clamped limit", "?limit=500&page=2", 50, 50, true},
+		{"negative offset", "?offset=-1", 0, 0, false},
+		{"invalid offset", "?offset=abc", 0, 0, false},
+		{"zero page", "?page=0", 0, 0, false},
+		{"negative page", "?page=-2", 0, 0, false},
+		{"invalid page", "?page=last", 0, 0, false},
+		{"page too large", "?page=9999999999", 0, 0, false},
+		{"page and offset", "?page=2&offset=10", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/"+tt.query, nil)
+
+			limit, offset, ok := limits.parsePagination(c)
+			assert.Equal(t, tt.expectedOK, ok)
+			if !tt.expectedOK {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				return
+			}
+			assert.Equal(t, tt.expectedLimit, limit)
+			assert.Equal(t, tt.expectedOffset, offset)
+		})
+	}
+}
+
+func TestLimitsParsePagination_ZeroLimits(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/?page=2", nil)
+
+	limit, offset, ok := Limits{}.parsePagination(c)
+	assert.True(t, ok)
+	assert.Equal(t, 0, limit)
+	assert.Equal(t, 0, offset)
+}
+
+func TestDeviceHandlerConfiguredLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedLimit int
+	}{
+		{"default limit", "", 25},
+		{"clamped to configured max", "?limit=1000", 200},
+		{"clamped by type", "?type=temperature&limit=1000", 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			var requestedLimit int
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetGetDeviceDataFunc(func(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				requestedLimit = limit
+				return []*models.DeviceData{}, nil
+			})
+			mockDataRepo.SetGetDeviceDataByTypeFunc(func(deviceID, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+				requestedLimit = limit
+				return []*models.DeviceData{}, nil
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			handler.SetLimits(Limits{Default: 25, Max: 200})
+			router := setupTestRouter()
+			router.GET("/devices/:id/data", handler.GetDeviceData)
+
+			// Execute
+			req := httptest.NewRequest("GET", "/devices/test-id/data"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedLimit, requestedLimit)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, float64(tt.expectedLimit), response["limit"])
+		})
+	}
+}
+
+func TestDeviceHandlerConfiguredLimits_Downsample(t *testing.T) {
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	handler.SetLimits(Limits{Default: 25, Max: 200})
+	router := setupTestRouter()
+	router.GET("/devices/:id/data", handler.GetDeviceData)
+
+	req := httptest.NewRequest("GET", "/devices/test-id/data?downsample=500", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"iot-platform-go/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler serves a JSON snapshot of the registry's metrics
+func MetricsHandler(registry *metrics.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, registry.Snapshot())
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.TimingVec("db_query_duration").Observe("device.create", 2*time.Millisecond)
+	registry.RegisterGauge("db_pool", func() interface{} {
+		return map[string]int{"open_connections": 3}
+	})
+
+	router := setupTestRouter()
+	router.GET("/metrics", MetricsHandler(registry))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		QueryDuration map[string]metrics.TimingStats `json:"db_query_duration"`
+		Pool          map[string]int                 `json:"db_pool"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(1), response.QueryDuration["device.create"].Count)
+	assert.Equal(t, 3, response.Pool["open_connections"])
+}
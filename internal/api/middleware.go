@@ -0,0 +1,105 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID a panic is logged under, taken from the request or generated
+const RequestIDHeader = "X-Request-ID"
+
+// RecoveryMiddleware turns a panic in a later handler into a 500 with the standard error body.
+// The panic and its stack are logged under a request ID that the response carries too, so clients
+// can report it without the stack ever reaching them.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			requestID := c.GetHeader(RequestIDHeader)
+			if requestID == "" {
+				requestID = uuid.NewString()
+			}
+			log.Printf("❌ Panic serving %s %s (request %s): %v\n%s",
+				c.Request.Method, c.Request.URL.Path, requestID, recovered, debug.Stack())
+
+			// A handler that already started its response cannot be given an error body
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.Header(RequestIDHeader, requestID)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, APIError{
+				Code:      ErrCodeInternal,
+				Message:   "Internal server error",
+				RequestID: requestID,
+			})
+		}()
+
+		c.Next()
+	}
+}
+
+// BodyLimitMiddleware rejects request bodies larger than maxBytes with 413.
+// Bodies without a declared length are capped with http.MaxBytesReader and fail while being bound.
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			abortWithError(c, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large")
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// RequireJSONMiddleware rejects write requests whose body is not application/json with 415
+func RequireJSONMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+
+		// Requests without a body have nothing to decode
+		if c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+
+		if c.ContentType() != gin.MIMEJSON {
+			abortWithError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType,
+				"Content-Type must be application/json")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireDatabaseMiddleware rejects requests with 503 until ready reports the database is available
+func RequireDatabaseMiddleware(ready func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ready() {
+			abortWithError(c, http.StatusServiceUnavailable, ErrCodeDatabaseUnavailable, "Database is unavailable")
+			return
+		}
+
+		c.Next()
+	}
+}
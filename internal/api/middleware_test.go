@@ -0,0 +1,211 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"iot-platform-go/internal/device"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMiddlewareTestRouter(maxBytes int64) *gin.Engine {
+	handler := NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository())
+	router := setupTestRouter()
+	router.Use(BodyLimitMiddleware(maxBytes), RequireJSONMiddleware())
+	router.POST("/devices", handler.CreateDevice)
+	router.GET("/devices", handler.GetAllDevices)
+	return router
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	oversized := `{"name":"` + strings.Repeat("a", 1024) + `","type":"temperature"}`
+
+	tests := []struct {
+		name           string
+		body           io.Reader
+		contentLength  int64
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "body within limit",
+			body:           strings.NewReader(`{"name":"Test Device","type":"temperature"}`),
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "oversized body with content length",
+			body:           strings.NewReader(oversized),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   ErrCodePayloadTooLarge,
+		},
+		{
+			name:           "oversized body without content length",
+			body:           io.MultiReader(strings.NewReader(oversized)),
+			contentLength:  -1,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   ErrCodePayloadTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupMiddlewareTestRouter(512)
+
+			req := httptest.NewRequest("POST", "/devices", tt.body)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.contentLength != 0 {
+				req.ContentLength = tt.contentLength
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedCode != "" {
+				var response APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
+
+func TestRequireJSONMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "json content type",
+			method:         "POST",
+			contentType:    "application/json",
+			body:           `{"name":"Test Device","type":"temperature"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "json content type with charset",
+			method:         "POST",
+			contentType:    "application/json; charset=utf-8",
+			body:           `{"name":"Test Device","type":"temperature"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "wrong content type",
+			method:         "POST",
+			contentType:    "text/plain",
+			body:           `{"name":"Test Device","type":"temperature"}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "missing content type",
+			method:         "POST",
+			body:           `{"name":"Test Device","type":"temperature"}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "read request is not checked",
+			method:         "GET",
+			contentType:    "text/plain",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupMiddlewareTestRouter(1 << 20)
+
+			req := httptest.NewRequest(tt.method, "/devices", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusUnsupportedMediaType {
+				var response APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, ErrCodeUnsupportedMediaType, response.Code)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(output) })
+
+	router := setupTestRouter()
+	router.Use(RecoveryMiddleware())
+	router.GET("/panic", func(c *gin.Context) {
+		panic("secret connection string")
+	})
+	router.GET("/partial", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("after writing")
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+	}{
+		{"generated request ID", ""},
+		{"request ID from the client", "client-request-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest("GET", "/panic", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			var response APIError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, ErrCodeInternal, response.Code)
+			assert.Equal(t, "Internal server error", response.Message)
+			assert.NotEmpty(t, response.RequestID)
+			if tt.requestID != "" {
+				assert.Equal(t, tt.requestID, response.RequestID)
+			}
+			assert.Equal(t, response.RequestID, w.Header().Get(RequestIDHeader))
+
+			// Neither the panic nor the stack reaches the client
+			assert.NotContains(t, w.Body.String(), "secret")
+			assert.NotContains(t, w.Body.String(), "goroutine")
+
+			// Both are logged under the request ID
+			assert.Contains(t, logs.String(), "request "+response.RequestID+"): secret connection string")
+			assert.Contains(t, logs.String(), "runtime/debug.Stack")
+		})
+	}
+
+	t.Run("response already started", func(t *testing.T) {
+		logs.Reset()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/partial", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "partial", w.Body.String())
+		assert.Contains(t, logs.String(), "after writing")
+	})
+}
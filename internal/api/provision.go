@@ -0,0 +1,84 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceTokenHeader carries the device token for clients that cannot set an Authorization header
+const DeviceTokenHeader = "X-Device-Token"
+
+// ProvisionDevice handles POST /api/provision.
+// It creates a device and issues its token, which is only returned in this response.
+func (h *DeviceHandler) ProvisionDevice(c *gin.Context) {
+	var req models.CreateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	token, hash, err := device.GenerateToken()
+	if err != nil {
+		respondErrorWithDetails(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate device token", err.Error())
+		return
+	}
+
+	created, err := h.repo.Create(&req)
+	if err != nil {
+		if respondDeviceNameTaken(c, err) {
+			return
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to create device", err)
+		return
+	}
+
+	if err := h.repo.SetTokenHash(created.ID, hash); err != nil {
+		// A device nobody can authenticate as is useless, so remove it
+		if delErr := h.repo.Delete(created.ID); delErr != nil {
+			log.Printf("Failed to remove device %s after its token could not be stored: %v", created.ID, delErr)
+		}
+		respondDatabaseErrorWithDetails(c, "Failed to store device token", err)
+		return
+	}
+
+	h.recordEvent(c, created.ID, models.EventDeviceCreated, req)
+
+	c.JSON(http.StatusCreated, models.ProvisionDeviceResponse{Device: created, Token: token})
+}
+
+// RequireDeviceToken rejects requests for /devices/:id that do not carry that device's token with 401.
+// The token is read from the bearer Authorization header or X-Device-Token.
+func (h *DeviceHandler) RequireDeviceToken(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	token := c.GetHeader(DeviceTokenHeader)
+	if token == "" {
+		token, _ = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "Missing device token")
+		return
+	}
+
+	hash, err := h.repo.GetTokenHash(deviceID)
+	if err != nil && err.Error() != ErrDeviceNotFound {
+		respondDatabaseError(c, "Failed to verify device token", err)
+		c.Abort()
+		return
+	}
+
+	// Unknown devices get the same response as bad tokens so IDs cannot be probed
+	if !device.VerifyToken(token, hash) {
+		abortWithError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "Invalid device token")
+		return
+	}
+
+	c.Set(ActorContextKey, "device:"+deviceID)
+	c.Next()
+}
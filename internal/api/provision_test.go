@@ -0,0 +1,363 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupProvisionTestRouter(mockRepo *device.MockRepository, mockDataRepo *MockDataRepository) *gin.Engine {
+	router := setupTestRouter()
+	RegisterRoutes(router, Handlers{
+		Devices: NewDeviceHandler(mockRepo, mockDataRepo),
+		Auth:    JWTAuthMiddleware(testJWTSecret),
+	})
+	return router
+}
+
+// provisionTestDevice provisions a device through the API and returns its ID and token
+func provisionTestDevice(t *testing.T, router *gin.Engine) (string, string) {
+	req := httptest.NewRequest("POST", "/api/v1/provision", strings.NewReader(`{"name":"Sensor","type":"temperature"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testToken(testJWTSecret, "admin", time.Now().Add(time.Hour)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.ProvisionDeviceResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.Device)
+	return response.Device.ID, response.Token
+}
+
+func TestProvisionDevice(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	router := setupProvisionTestRouter(mockRepo, NewMockDataRepository())
+
+	deviceID, token := provisionTestDevice(t, router)
+
+	assert.Equal(t, "mock-device-id", deviceID)
+	assert.Len(t, token, 64)
+
+	// Only the hash is stored
+	hash, err := mockRepo.GetTokenHash(deviceID)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, hash)
+	assert.True(t, device.VerifyToken(token, hash))
+}
+
+func TestProvisionDevice_Errors(t *testing.T) {
+	t.Run("requires authentication", func(t *testing.T) {
+		router := setupProvisionTestRouter(device.NewMockRepository(), NewMockDataRepository())
+
+		req := httptest.NewRequest("POST", "/api/v1/provision", strings.NewReader(`{"name":"Sensor","type":"temperature"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("token storage failure removes the device", func(t *testing.T) {
+		mockRepo := device.NewMockRepository()
+		mockRepo.SetSetTokenHashFunc(func(id, hash string) error {
+			return assert.AnError
+		})
+		router := setupProvisionTestRouter(mockRepo, NewMockDataRepository())
+
+		req := httptest.NewRequest("POST", "/api/v1/provision", strings.NewReader(`{"name":"Sensor","type":"temperature"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testToken(testJWTSecret, "admin", time.Now().Add(time.Hour)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		_, err := mockRepo.GetByID("mock-device-id")
+		assert.Error(t, err)
+	})
+}
+
+func TestIngestDeviceData_ValidToken(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockDataRepo := NewMockDataRepository()
+
+	var saved *models.DeviceData
+	mockDataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		saved = data
+		return true, nil
+	})
+
+	router := setupProvisionTestRouter(mockRepo, mockDataRepo)
+	deviceID, token := provisionTestDevice(t, router)
+
+	headers := map[string]string{
+		"Authorization":   "Bearer " + token,
+		DeviceTokenHeader: token,
+	}
+	for header, value := range headers {
+		t.Run(header, func(t *testing.T) {
+			saved = nil
+			req := httptest.NewRequest("POST", "/api/v1/devices/"+deviceID+"/data",
+				strings.NewReader(`{"data_type":"temperature","value":21.5,"unit":"°C","timestamp":"2024-01-01T00:00:00Z"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(header, value)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			require.NotNil(t, saved)
+			assert.Equal(t, deviceID, saved.DeviceID)
+			assert.Equal(t, "temperature", saved.DataType)
+			assert.Equal(t, 21.5, saved.Value)
+			assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), saved.Timestamp.UTC())
+
+			touched, err := mockRepo.GetByID(deviceID)
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now(), touched.LastSeen, time.Minute)
+		})
+	}
+}
+
+func TestIngestDeviceData_RejectsBadTokens(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockDataRepo := NewMockDataRepository()
+	mockDataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		t.Fatal("SaveData must not be called without a valid device token")
+		return false, nil
+	})
+
+	router := setupProvisionTestRouter(mockRepo, mockDataRepo)
+	deviceID, token := provisionTestDevice(t, router)
+
+	// A device created without provisioning has no token
+	unprovisioned := createTestDevice()
+	mockRepo.AddDevice(unprovisioned)
+
+	tests := []struct {
+		name     string
+		deviceID string
+		token    string
+	}{
+		{name: "missing token", deviceID: deviceID},
+		{name: "wrong token", deviceID: deviceID, token: strings.Repeat("0", 64)},
+		{name: "token of another device", deviceID: unprovisioned.ID, token: token},
+		{name: "unknown device", deviceID: "unknown-device", token: token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/devices/"+tt.deviceID+"/data",
+				strings.NewReader(`{"data_type":"temperature","value":21.5}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set(DeviceTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+			var apiErr APIError
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+			assert.Equal(t, ErrCodeUnauthorized, apiErr.Code)
+		})
+	}
+}
+
+func TestIngestDeviceData_InvalidBody(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	router := setupProvisionTestRouter(mockRepo, NewMockDataRepository())
+	deviceID, token := provisionTestDevice(t, router)
+
+	req := httptest.NewRequest("POST", "/api/v1/devices/"+deviceID+"/data", strings.NewReader(`{"data_type":"temperature"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeviceTokenHeader, token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIngestDeviceData_InvalidMetadata(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	router := setupProvisionTestRouter(mockRepo, NewMockDataRepository())
+	deviceID, token := provisionTestDevice(t, router)
+
+	body := `{"data_type":"temperature","value":21.5,"metadata":"not json"}`
+	req := httptest.NewRequest("POST", "/api/v1/devices/"+deviceID+"/data", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeviceTokenHeader, token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var apiErr APIError
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+	assert.Equal(t, ErrCodeInvalidRequest, apiErr.Code)
+}
+
+func TestIngestDeviceData_TimestampPolicy(t *testing.T) {
+	inWindow := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	future := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		policy    device.TimestampPolicy
+		timestamp time.Time
+		// expected returns the stored timestamp given the request time
+		expected func(received time.Time) time.Time
+	}{
+		{
+			name:      "device keeps future timestamp",
+			policy:    device.TimestampPolicy{Source: device.TimestampSourceDevice},
+			timestamp: future,
+			expected:  func(time.Time) time.Time { return future },
+		},
+		{
+			name:      "server ignores device timestamp",
+			policy:    device.TimestampPolicy{Source: device.TimestampSourceServer},
+			timestamp: inWindow,
+			expected:  func(received time.Time) time.Time { return received },
+		},
+		{
+			name:      "clamp keeps timestamp in window",
+			policy:    device.TimestampPolicy{Source: device.TimestampSourceClamp, MaxSkew: 5 * time.Minute},
+			timestamp: inWindow,
+			expected:  func(time.Time) time.Time { return inWindow },
+		},
+		{
+			name:      "clamp limits future timestamp",
+			policy:    device.TimestampPolicy{Source: device.TimestampSourceClamp, MaxSkew: 5 * time.Minute},
+			timestamp: future,
+			expected:  func(received time.Time) time.Time { return received.Add(5 * time.Minute) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved *models.DeviceData
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+				saved = data
+				return true, nil
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			handler.SetTimestampPolicy(tt.policy)
+			router := setupTestRouter()
+			router.POST("/devices/:id/data", handler.IngestDeviceData)
+
+			body := fmt.Sprintf(`{"data_type":"temperature","value":21.5,"timestamp":%q}`, tt.timestamp.Format(time.RFC3339))
+			req := httptest.NewRequest("POST", "/devices/device-1/data", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			received := time.Now()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			require.NotNil(t, saved)
+			assert.WithinDuration(t, tt.expected(received), saved.Timestamp, time.Second)
+		})
+	}
+}
+
+func TestIngestDeviceData_ReadingDefaults(t *testing.T) {
+	tests := []struct {
+		name             string
+		defaults         device.ReadingDefaults
+		body             string
+		expectedStatus   int
+		expectedDataType string
+		expectedUnit     string
+	}{
+		{
+			name:             "sent type and unit are kept",
+			defaults:         device.ReadingDefaults{DataType: "value", Unit: "raw"},
+			body:             `{"data_type":"temperature","value":21.5,"unit":"°C"}`,
+			expectedStatus:   http.StatusCreated,
+			expectedDataType: "temperature",
+			expectedUnit:     "°C",
+		},
+		{
+			name:             "missing type and unit are defaulted",
+			defaults:         device.ReadingDefaults{DataType: "value", Unit: "raw"},
+			body:             `{"value":21.5}`,
+			expectedStatus:   http.StatusCreated,
+			expectedDataType: "value",
+			expectedUnit:     "raw",
+		},
+		{
+			name:             "missing unit is defaulted alone",
+			defaults:         device.ReadingDefaults{DataType: "value", Unit: "raw"},
+			body:             `{"data_type":"temperature","value":21.5}`,
+			expectedStatus:   http.StatusCreated,
+			expectedDataType: "temperature",
+			expectedUnit:     "raw",
+		},
+		{
+			name:           "missing type without a default",
+			body:           `{"value":21.5}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing type rejected despite a default",
+			defaults:       device.ReadingDefaults{DataType: "value", Unit: "raw", Reject: true},
+			body:           `{"value":21.5}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "reject mode keeps a missing unit empty",
+			defaults:         device.ReadingDefaults{DataType: "value", Unit: "raw", Reject: true},
+			body:             `{"data_type":"temperature","value":21.5}`,
+			expectedStatus:   http.StatusCreated,
+			expectedDataType: "temperature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved *models.DeviceData
+			mockDataRepo := NewMockDataRepository()
+			mockDataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+				saved = data
+				return true, nil
+			})
+
+			handler := NewDeviceHandler(device.NewMockRepository(), mockDataRepo)
+			handler.SetReadingDefaults(tt.defaults)
+			router := setupTestRouter()
+			router.POST("/devices/:id/data", handler.IngestDeviceData)
+
+			req := httptest.NewRequest("POST", "/devices/device-1/data", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				assert.Nil(t, saved)
+
+				var apiErr APIError
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+				assert.Equal(t, ErrCodeInvalidRequest, apiErr.Code)
+				return
+			}
+			require.NotNil(t, saved)
+			assert.Equal(t, tt.expectedDataType, saved.DataType)
+			assert.Equal(t, tt.expectedUnit, saved.Unit)
+			assert.Equal(t, 21.5, saved.Value)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter creates a gin engine with a single access logger writing to logOutput and panic recovery
+// answering with the standard error body.
+// Additional middleware is installed after them.
+func NewRouter(logOutput io.Writer, middleware ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.LoggerWithWriter(logOutput), RecoveryMiddleware())
+	router.Use(middleware...)
+	return router
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("single access log line per request", func(t *testing.T) {
+		var logOutput bytes.Buffer
+		router := NewRouter(&logOutput)
+		router.GET("/ping", func(c *gin.Context) {
+			c.String(http.StatusOK, "pong")
+		})
+
+		req := httptest.NewRequest("GET", "/ping", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		lines := strings.Split(strings.TrimSpace(logOutput.String()), "\n")
+		assert.Len(t, lines, 1)
+		assert.Contains(t, lines[0], "/ping")
+	})
+
+	t.Run("recovers from panics", func(t *testing.T) {
+		var logOutput bytes.Buffer
+		router := NewRouter(&logOutput)
+		router.GET("/panic", func(c *gin.Context) {
+			panic("boom")
+		})
+
+		req := httptest.NewRequest("GET", "/panic", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var response APIError
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, ErrCodeInternal, response.Code)
+	})
+
+	t.Run("installs additional middleware", func(t *testing.T) {
+		var logOutput bytes.Buffer
+		router := NewRouter(&logOutput, func(c *gin.Context) {
+			c.Header("X-Test", "ok")
+			c.Next()
+		})
+		router.GET("/ping", func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+
+		req := httptest.NewRequest("GET", "/ping", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "ok", w.Header().Get("X-Test"))
+	})
+}
+
+func TestNewRouter_TrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		expectedIP string
+	}{
+		{"trusted loopback proxy", []string{"127.0.0.1", "::1"}, "127.0.0.1:12345", "203.0.113.7"},
+		{"trusted proxy range", []string{"10.0.0.0/8"}, "10.1.2.3:12345", "203.0.113.7"},
+		{"untrusted proxy", []string{"127.0.0.1", "::1"}, "198.51.100.2:12345", "198.51.100.2"},
+		{"no trusted proxies", nil, "127.0.0.1:12345", "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter(io.Discard)
+			assert.NoError(t, router.SetTrustedProxies(tt.proxies))
+			router.GET("/ip", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+
+			req := httptest.NewRequest("GET", "/ip", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedIP, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// V1Prefix is the canonical prefix of the v1 API
+	V1Prefix = "/api/v1"
+	// LegacyPrefix is the unversioned prefix, kept as an alias of v1 for one release
+	LegacyPrefix = "/api"
+)
+
+// Handlers holds the handlers served by the API
+type Handlers struct {
+	Devices  *DeviceHandler
+	InfluxDB *InfluxDBHandler // nil when InfluxDB is not available
+	Admin    *AdminHandler
+	Auth     gin.HandlerFunc // guards provisioning and the admin routes, which are not registered without it
+	Identify gin.HandlerFunc // optional; sets the actor of device changes from a bearer token without requiring one
+	Database gin.HandlerFunc // optional guard for the PostgreSQL-backed routes, see RequireDatabaseMiddleware
+}
+
+// RegisterRoutes registers every API version on the router.
+// The middleware is applied to each version group.
+func RegisterRoutes(router *gin.Engine, handlers Handlers, middleware ...gin.HandlerFunc) {
+	for _, prefix := range []string{V1Prefix, LegacyPrefix} {
+		group := router.Group(prefix)
+		group.Use(middleware...)
+		RegisterV1Routes(group, handlers)
+	}
+}
+
+// RegisterV1Routes registers the v1 routes on the group
+func RegisterV1Routes(group *gin.RouterGroup, handlers Handlers) {
+	// Routes backed by PostgreSQL, guarded while it is unavailable
+	db := group
+	if handlers.Database != nil {
+		db = group.Group("", handlers.Database)
+	}
+
+	// Device routes
+	devices := db.Group("/devices")
+	if handlers.Identify != nil {
+		devices.Use(handlers.Identify)
+	}
+	{
+		devices.POST("", handlers.Devices.CreateDevice)
+		devices.POST("/bulk", handlers.Devices.BulkCreateDevices)
+		devices.GET("", handlers.Devices.GetAllDevices)
+		devices.GET("/status", handlers.Devices.GetDeviceStatuses)
+		devices.GET("/facets", handlers.Devices.GetDeviceFacets)
+		devices.GET("/stale", handlers.Devices.GetStaleDevices)
+		devices.GET("/by-name/:name", handlers.Devices.GetDeviceByName)
+		devices.GET("/:id", handlers.Devices.GetDevice)
+		devices.PUT("/:id", handlers.Devices.UpdateDevice)
+		devices.PATCH("/:id/metadata", handlers.Devices.MergeDeviceMetadata)
+		devices.DELETE("/:id", handlers.Devices.DeleteDevice)
+		devices.GET("/:id/status", handlers.Devices.GetDeviceStatus)
+		devices.GET("/:id/status/history", handlers.Devices.GetDeviceStatusHistory)
+		devices.POST("/:id/ping", handlers.Devices.PingDevice)
+		devices.GET("/:id/summary", handlers.Devices.GetDeviceSummary)
+		devices.GET("/:id/export", handlers.Devices.ExportDevice)
+		devices.GET("/:id/events", handlers.Devices.GetDeviceEvents)
+		devices.GET("/:id/retention", handlers.Devices.GetDeviceRetention)
+		devices.PUT("/:id/retention", handlers.Devices.SetDeviceRetention)
+		devices.GET("/:id/settings", handlers.Devices.GetDeviceSettings)
+		devices.PUT("/:id/settings", handlers.Devices.PutDeviceSettings)
+		devices.GET("/:id/data", handlers.Devices.GetDeviceData)
+		devices.POST("/:id/data", handlers.Devices.RequireDeviceToken, handlers.Devices.IngestDeviceData)
+		devices.POST("/:id/data/bulk", handlers.Devices.RequireDeviceToken, handlers.Devices.IngestDeviceDataBulk)
+		devices.GET("/:id/data/latest", handlers.Devices.GetLatestDeviceData)
+		devices.GET("/:id/data/bounds", handlers.Devices.GetDeviceDataBounds)
+		devices.GET("/:id/data/types", handlers.Devices.GetDeviceDataTypes)
+	}
+
+	// Data routes across all devices
+	db.GET("/data", handlers.Devices.GetDataByType)
+	db.GET("/stats", handlers.Devices.GetFleetStats)
+
+	// Device provisioning (authenticated)
+	if handlers.Auth != nil {
+		db.POST("/provision", handlers.Auth, handlers.Devices.ProvisionDevice)
+	}
+
+	// Admin routes (authenticated)
+	if handlers.Admin != nil && handlers.Auth != nil {
+		admin := db.Group("/admin", handlers.Auth)
+		{
+			admin.POST("/cleanup", handlers.Admin.Cleanup)
+			admin.GET("/mqtt/subscriptions", handlers.Admin.GetMQTTSubscriptions)
+			admin.POST("/mqtt/resubscribe", handlers.Admin.ResubscribeMQTT)
+		}
+
+		// Not backed by PostgreSQL, so a misconfigured database can be diagnosed while it is down
+		group.GET("/admin/config", handlers.Auth, handlers.Admin.GetConfig)
+	}
+
+	// InfluxDB routes (if available)
+	if handlers.InfluxDB != nil {
+		influx := group.Group("/influxdb")
+		{
+			influx.GET("/devices/:id/data", handlers.InfluxDB.GetDeviceDataFromInfluxDB)
+			influx.GET("/devices/:id/data/latest", handlers.InfluxDB.GetLatestDeviceDataFromInfluxDB)
+		}
+	}
+}
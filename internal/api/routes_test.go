@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/database"
+	"iot-platform-go/internal/device"
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterRoutes(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockRepo.SetGetAllFunc(func() ([]*models.Device, error) {
+		return []*models.Device{createTestDevice()}, nil
+	})
+
+	router := setupTestRouter()
+	RegisterRoutes(router, Handlers{Devices: NewDeviceHandler(mockRepo, NewMockDataRepository())})
+
+	for _, path := range []string{"/api/v1/devices", "/api/devices"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, float64(1), response["count"])
+		})
+	}
+
+	t.Run("influxdb routes are not registered without a client", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/influxdb/devices/test-id/data", nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("admin and provisioning routes are not registered without auth", func(t *testing.T) {
+		adminRouter := setupTestRouter()
+		RegisterRoutes(adminRouter, Handlers{
+			Devices: NewDeviceHandler(mockRepo, NewMockDataRepository()),
+			Admin:   NewAdminHandler(NewMockDataRepository()),
+		})
+
+		for _, path := range []string{"/api/v1/admin/cleanup", "/api/v1/provision"} {
+			req := httptest.NewRequest("POST", path, nil)
+			w := httptest.NewRecorder()
+			adminRouter.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Code, path)
+		}
+	})
+
+	t.Run("by-name route does not shadow device routes", func(t *testing.T) {
+		testDevice := createTestDevice()
+		testDevice.Name = "by-name-route"
+		mockRepo.AddDevice(testDevice)
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/by-name/by-name-route", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req = httptest.NewRequest("GET", "/api/v1/devices/"+testDevice.ID, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("bulk status route does not shadow device routes", func(t *testing.T) {
+		testDevice := createTestDevice()
+		mockRepo.AddDevice(testDevice)
+
+		req := httptest.NewRequest("GET", "/api/v1/devices/status?ids="+testDevice.ID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req = httptest.NewRequest("GET", "/api/v1/devices/"+testDevice.ID+"/status", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestRegisterRoutes_DatabaseUnavailable(t *testing.T) {
+	mockRepo := device.NewMockRepository()
+	mockRepo.SetGetAllFunc(func() ([]*models.Device, error) {
+		return []*models.Device{createTestDevice()}, nil
+	})
+
+	// The database refuses connections at boot, so the server starts degraded
+	dbUp := false
+	availability := database.NewAvailability(func() error {
+		if !dbUp {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, time.Second)
+	require.Error(t, availability.TryConnect())
+
+	router := setupTestRouter()
+	RegisterRoutes(router, Handlers{
+		Devices:  NewDeviceHandler(mockRepo, NewMockDataRepository()),
+		InfluxDB: NewInfluxDBHandler(NewMockInfluxReader()),
+		Database: RequireDatabaseMiddleware(availability.Ready),
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	for _, path := range []string{"/api/v1/devices", "/api/devices", "/api/v1/data?type=temperature"} {
+		w := get(path)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+
+		var apiErr APIError
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+		assert.Equal(t, ErrCodeDatabaseUnavailable, apiErr.Code)
+	}
+
+	// InfluxDB routes do not depend on PostgreSQL
+	assert.Equal(t, http.StatusOK, get("/api/v1/influxdb/devices/device-1/data").Code)
+
+	// Once the database comes up the routes are served again
+	dbUp = true
+	require.NoError(t, availability.TryConnect())
+	assert.Equal(t, http.StatusOK, get("/api/v1/devices").Code)
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// swaggerSpec is the OpenAPI (Swagger 2.0) description of the HTTP API.
+// Keep it in sync with RegisterV1Routes; TestSwaggerPathsMatchRoutes compares the two.
+//
+//go:embed swagger.json
+var swaggerSpec []byte
+
+// GetSwaggerJSON handles GET /swagger.json
+func GetSwaggerJSON(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", swaggerSpec)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"iot-platform-go/internal/device"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSwaggerJSON(t *testing.T) {
+	router := setupTestRouter()
+	router.GET("/swagger.json", GetSwaggerJSON)
+
+	req := httptest.NewRequest("GET", "/swagger.json", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+	var spec struct {
+		Swagger     string                            `json:"swagger"`
+		Paths       map[string]map[string]interface{} `json:"paths"`
+		Definitions map[string]interface{}            `json:"definitions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "2.0", spec.Swagger)
+
+	expectedPaths := map[string][]string{
+		"/api/v1/devices":                  {"get", "post"},
+		"/api/v1/devices/{id}":             {"get", "put", "delete"},
+		"/api/v1/devices/{id}/status":      {"get"},
+		"/api/v1/devices/{id}/data":        {"get"},
+		"/api/v1/devices/{id}/data/latest": {"get"},
+	}
+	for path, methods := range expectedPaths {
+		operations, ok := spec.Paths[path]
+		if !assert.True(t, ok, "missing path %s", path) {
+			continue
+		}
+		for _, method := range methods {
+			assert.Contains(t, operations, method, "missing %s %s", method, path)
+		}
+	}
+
+	for _, name := range []string{"Device", "DeviceData", "CreateDeviceRequest", "UpdateDeviceRequest", "APIError"} {
+		assert.Contains(t, spec.Definitions, name)
+	}
+}
+
+func TestSwaggerErrorCodes(t *testing.T) {
+	var spec struct {
+		Definitions struct {
+			APIError struct {
+				Properties struct {
+					Code struct {
+						Enum []string `json:"enum"`
+					} `json:"code"`
+				} `json:"properties"`
+			} `json:"APIError"`
+		} `json:"definitions"`
+	}
+	require.NoError(t, json.Unmarshal(swaggerSpec, &spec))
+
+	codes := []string{
+		ErrCodeInvalidRequest, ErrCodeDeviceNotFound, ErrCodeAmbiguousDeviceName, ErrCodeDuplicateDeviceName,
+		ErrCodeDataNotFound, ErrCodeInternal, ErrCodeInfluxDBUnavailable, ErrCodeDatabaseUnavailable,
+		ErrCodeMQTTUnavailable, ErrCodePayloadTooLarge, ErrCodeUnsupportedMediaType, ErrCodeUnauthorized,
+		ErrCodeDeviceTimeout,
+	}
+	assert.ElementsMatch(t, codes, spec.Definitions.APIError.Properties.Code.Enum)
+
+	// Codes are upper snake case, like DEVICE_NOT_FOUND
+	for _, code := range codes {
+		assert.Regexp(t, `^[A-Z]+(_[A-Z]+)*$`, code)
+	}
+}
+
+func TestSwaggerPathsMatchRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(swaggerSpec, &spec))
+
+	documented := []string{}
+	for path, operations := range spec.Paths {
+		if !strings.HasPrefix(path, V1Prefix+"/") {
+			continue
+		}
+		for method := range operations {
+			if method == "parameters" {
+				continue // shared by the operations of the path
+			}
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	// Register every optional group so the whole API is compared
+	router := setupTestRouter()
+	RegisterRoutes(router, Handlers{
+		Devices:  NewDeviceHandler(device.NewMockRepository(), NewMockDataRepository()),
+		InfluxDB: &InfluxDBHandler{},
+		Admin:    NewAdminHandler(NewMockDataRepository()),
+		Auth:     func(c *gin.Context) {},
+	})
+
+	// gin's :param becomes swagger's {param}
+	param := regexp.MustCompile(`:([A-Za-z]+)`)
+	registered := []string{}
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, V1Prefix+"/") {
+			continue
+		}
+		registered = append(registered, route.Method+" "+param.ReplaceAllString(route.Path, "{$1}"))
+	}
+
+	assert.ElementsMatch(t, registered, documented)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes a single request field that failed validation
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+func init() {
+	// Report fields by their JSON (or query parameter) names rather than the Go struct field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+	}
+}
+
+// jsonFieldName returns the JSON name of a struct field, or "" when it has none.
+// Fields bound from the query string have no JSON name and use their form name.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		name, _, _ = strings.Cut(field.Tag.Get("form"), ",")
+	}
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validationFieldErrors converts validator errors into per-field errors.
+// It returns false when err is not a validation error.
+func validationFieldErrors(err error) ([]FieldError, bool) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil, false
+	}
+
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		rule := fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+		fields = append(fields, FieldError{Field: fieldPath(fe.Namespace()), Error: rule})
+	}
+	return fields, true
+}
+
+// fieldPath strips the request struct name from a validator namespace,
+// so "CreateDeviceRequest.name" becomes "name" and nested fields keep their path
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
+	}
+	return namespace
+}
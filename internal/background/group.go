@@ -0,0 +1,53 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Group runs background loops that share one root context, so they can all be stopped together
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewGroup creates a group whose loops run until Stop is called
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the root context, done once Stop is called, for work outside the group that should end on shutdown
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a goroutine. fn must return once ctx is done.
+func (g *Group) Go(fn func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn(g.ctx)
+	}()
+}
+
+// Stop cancels the root context and waits for every loop to return,
+// giving up with an error once ctx is done
+func (g *Group) Stop(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background loops did not stop: %w", ctx.Err())
+	}
+}
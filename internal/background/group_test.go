@@ -0,0 +1,68 @@
+package background
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup_StopWaitsForLoops(t *testing.T) {
+	group := NewGroup()
+
+	var exited atomic.Bool
+	started := make(chan struct{})
+	group.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		close(started)
+
+		for {
+			select {
+			case <-ctx.Done():
+				exited.Store(true)
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, group.Stop(ctx))
+	assert.True(t, exited.Load(), "loop must have returned before Stop returns")
+}
+
+func TestGroup_ContextDoneOnStop(t *testing.T) {
+	group := NewGroup()
+	require.NoError(t, group.Context().Err())
+
+	require.NoError(t, group.Stop(context.Background()))
+	assert.ErrorIs(t, group.Context().Err(), context.Canceled)
+}
+
+func TestGroup_StopTimesOut(t *testing.T) {
+	group := NewGroup()
+
+	release := make(chan struct{})
+	defer close(release)
+	group.Go(func(ctx context.Context) {
+		// Ignores cancellation until released
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := group.Stop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGroup_StopWithoutLoops(t *testing.T) {
+	assert.NoError(t, NewGroup().Stop(context.Background()))
+}
@@ -1,65 +1,224 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// EnvironmentLocal is the APP_ENV of a developer machine, the only environment where gin defaults to debug mode
+const EnvironmentLocal = "local"
+
 const (
 	defaultKeepAlive      = 60
+	defaultPingTimeout    = 10 * time.Second
 	defaultConnectTimeout = 30
+	defaultMQTTLogMaxMB   = 10
+	defaultMaxBodyBytes   = 1 << 20   // 1MB
+	defaultMQTTMaxPayload = 256 << 10 // 256KB
+	defaultMQTTQoS        = 1
+	maxMQTTQoS            = 2
+	defaultAPILimit       = 100
+	defaultAPIMaxLimit    = 1000
+	defaultRetentionSweep = time.Hour
+	defaultInfluxTimeout  = 10 * time.Second
+	defaultTimestampSkew  = 5 * time.Minute
+	defaultLatestCacheTTL = 10 * time.Second
+	defaultBufferSize     = 100
+	defaultBufferFlush    = time.Second
+	defaultTrustedProxies = "127.0.0.1,::1"
+
+	defaultReconnectInterval    = 5 * time.Second
+	defaultMaxReconnectInterval = time.Minute
+
+	// Matches the quiesce period Disconnect used before it was configurable
+	defaultDisconnectTimeout = 250 * time.Millisecond
+
+	// Received MQTT messages handled at once, each typically a database write
+	defaultHandlerConcurrency = 16
+
+	// Interval of the MQTT liveness heartbeat
+	defaultHeartbeatInterval = 30 * time.Second
+
+	// Wait for the broker to acknowledge the /health publish
+	defaultHealthCheckTimeout = 2 * time.Second
+
+	// Attempts at saving a reading that fails with a transient database error, and the first backoff
+	defaultSaveRetryAttempts = 3
+	defaultSaveRetryBackoff  = 100 * time.Millisecond
+
+	// Age after which raw readings are rolled up, and how often the rollup runs
+	defaultRollupAfterDays = 30
+	defaultRollupInterval  = time.Hour
 )
 
 // Config holds all configuration for the application
 type Config struct {
 	Server   ServerConfig
+	API      APIConfig
 	Database DatabaseConfig
 	MQTT     MQTTConfig
 	InfluxDB InfluxDBConfig
+	Data     DataConfig
+	Devices  DeviceConfig
 	JWT      JWTConfig
 	Logging  LoggingConfig
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Port string
-	Host string
+	Port           string
+	Host           string
+	MaxBodyBytes   int
+	Environment    string   // deployment environment; anything but local defaults Mode to release
+	Mode           string   // gin mode: debug, release or test
+	TrustedProxies []string // proxies whose X-Forwarded-For is used for the client IP
+}
+
+// APIConfig holds HTTP API configuration
+type APIConfig struct {
+	DefaultLimit int
+	MaxLimit     int
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	Name     string
-	User     string
-	Password string
-	SSLMode  string
+	Host              string
+	Port              string
+	Name              string
+	User              string
+	Password          string
+	SSLMode           string
+	Required          bool          // when false the server starts degraded if the database is down
+	UniqueDeviceNames bool          // enforce unique device names with a unique index
+	ReconnectInterval time.Duration // wait between connection attempts while degraded
 }
 
 // MQTTConfig holds MQTT configuration
 type MQTTConfig struct {
 	Broker         string
 	ClientID       string
+	IDStrategy     string // stable (hostname suffix) or random (per-start suffix)
 	Username       string
 	Password       string
 	KeepAlive      int
+	PingTimeout    time.Duration // wait for PINGRESP before the connection is considered lost; below KeepAlive
 	ConnectTimeout int
 	QoS            byte
 	CleanSession   bool
 	AutoReconnect  bool
+	TopicPrefix    string
+	QueueSize      int
+	MaxPayloadSize int // bytes; larger messages are dropped before parsing, 0 disables the limit
+	Reconnect      ReconnectConfig
+
+	// Shutdown: Disconnect publishes an offline status to StatusTopic, then lets in-flight
+	// messages complete for up to DisconnectTimeout before closing the connection
+	DisconnectTimeout time.Duration
+	StatusTopic       string // retained online/offline status, also set as the will; empty disables it
+
+	// HandlerConcurrency caps the received messages handled at once; further messages wait
+	// for a free slot, which delays their acknowledgement to the broker
+	HandlerConcurrency int
+
+	// Heartbeat: every HeartbeatInterval the client publishes to {prefix}/devices/server/heartbeat,
+	// optionally subscribing to confirm the round trip, so a silently lost broker is noticed
+	HeartbeatEnabled   bool
+	HeartbeatInterval  time.Duration
+	HeartbeatRoundTrip bool
+
+	// HealthCheck: /health publishes to {prefix}/devices/server/health and waits up to HealthCheckTimeout
+	// for the broker to acknowledge it, reporting degraded when it does not although the client is connected
+	HealthCheckEnabled bool
+	HealthCheckTimeout time.Duration
+
+	// TLS settings for ssl, tls and wss brokers
+	TLSCAFile             string // PEM CA bundle; empty uses the system roots
+	TLSInsecureSkipVerify bool   // skip broker certificate verification, for local testing only
+
+	// DeadLetterSink receives unparseable messages: none, file or topic
+	DeadLetterSink  string
+	DeadLetterPath  string
+	DeadLetterTopic string // empty uses {prefix}/devices/dead-letter
+}
+
+// ReconnectConfig holds the MQTT connection retry intervals
+type ReconnectConfig struct {
+	Interval    time.Duration // wait between connection attempts
+	MaxInterval time.Duration // cap on the backoff between automatic reconnects
 }
 
 // InfluxDBConfig holds InfluxDB configuration
 type InfluxDBConfig struct {
-	URL      string
-	Token    string
-	Org      string
-	Bucket   string
-	Username string
-	Password string
+	URL          string
+	Token        string
+	Org          string
+	Bucket       string
+	Username     string
+	Password     string
+	QueryTimeout time.Duration
+	BoolAsNumber bool // read boolean field values as 1/0 instead of skipping them
+	// Measurements and Buckets route a data type to its own measurement or bucket;
+	// unmapped types go to the device_data measurement in Bucket
+	Measurements map[string]string
+	Buckets      map[string]string
+
+	// Precision of the timestamps written: ns, us, ms or s; coarser precisions make smaller writes
+	Precision string
+}
+
+// DataConfig holds device data handling configuration
+type DataConfig struct {
+	NormalizeUnits bool
+	ValidateSchema bool
+	BufferWrites   bool   // batch MQTT readings in memory instead of saving each one synchronously
+	Store          string // postgres or influxdb, the store serving device data reads
+	SchemaPath     string // JSON Schema for device data messages; empty uses the built-in schema
+	// TimestampTolerance is strict (RFC3339 only) or flexible (also zoneless RFC3339 and Unix seconds/millis)
+	TimestampTolerance string
+	// TimestampSource is device (trust the payload), server (receive time) or clamp (device time clamped to TimestampMaxSkew)
+	TimestampSource  string
+	TimestampMaxSkew time.Duration
+	// RetentionDays applies to devices without their own retention; 0 keeps data forever
+	RetentionDays          int
+	RetentionSweepInterval time.Duration
+	// LatestCacheEnabled serves the latest reading per device from memory for up to LatestCacheTTL
+	LatestCacheEnabled bool
+	LatestCacheTTL     time.Duration
+	// BufferSize readings are saved per batch; pending readings are flushed every BufferFlushInterval
+	BufferSize          int
+	BufferFlushInterval time.Duration
+	// Single-value readings sent without a data type or unit get DefaultDataType and DefaultUnit,
+	// unless RejectMissingType rejects them instead
+	DefaultDataType   string
+	DefaultUnit       string
+	RejectMissingType bool
+	// An MQTT reading save, or buffered batch save, failing with a transient database error is attempted
+	// SaveRetryAttempts times in all, waiting SaveRetryBackoff before the first retry and twice as long
+	// before each following one
+	SaveRetryAttempts int
+	SaveRetryBackoff  time.Duration
+	// With RollupEnabled, every RollupInterval the raw readings older than RollupAfterDays are averaged
+	// into RollupGranularity (hour or day) buckets in device_data_rollup and deleted
+	RollupEnabled     bool
+	RollupAfterDays   int
+	RollupGranularity string
+	RollupInterval    time.Duration
+}
+
+// DeviceConfig holds device settings configuration
+type DeviceConfig struct {
+	// SettingsDefaults are the setting values of keys a device has not set; values that are not JSON are strings
+	SettingsDefaults map[string]string
+	// PublishSettings publishes a device's settings, retained, to {prefix}/devices/{id}/config when they change
+	PublishSettings bool
 }
 
 // JWTConfig holds JWT configuration
@@ -68,9 +227,20 @@ type JWTConfig struct {
 	Expiration string
 }
 
+// DefaultJWTSecret is the placeholder JWT_SECRET; it is public, so tokens signed with it are not trusted
+const DefaultJWTSecret = "your-secret-key-here"
+
+// SecretConfigured reports whether JWT_SECRET is set to something other than the placeholder
+func (c *JWTConfig) SecretConfigured() bool {
+	return c.Secret != "" && c.Secret != DefaultJWTSecret
+}
+
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
-	Level string
+	Level        string
+	Format       string // emoji (as written), plain (emoji stripped) or json (one record per message)
+	MQTTLogPath  string
+	MQTTLogMaxMB int
 }
 
 // Load loads configuration from environment variables
@@ -80,48 +250,173 @@ func Load() *Config {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	environment := getEnv("APP_ENV", EnvironmentLocal)
+	keepAlive := getEnvAsInt("MQTT_KEEP_ALIVE", defaultKeepAlive)
+
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Host: getEnv("SERVER_HOST", "localhost"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			MaxBodyBytes:   getEnvAsInt("SERVER_MAX_BODY_BYTES", defaultMaxBodyBytes),
+			Environment:    environment,
+			Mode:           getEnvAsGinMode("GIN_MODE", defaultGinMode(environment)),
+			TrustedProxies: getEnvAsList("TRUSTED_PROXIES", defaultTrustedProxies),
 		},
+		API: loadAPIConfig(),
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			Name:     getEnv("DB_NAME", "iot_platform"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "password"),
-			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+			Host:              getEnv("DB_HOST", "localhost"),
+			Port:              getEnv("DB_PORT", "5432"),
+			Name:              getEnv("DB_NAME", "iot_platform"),
+			User:              getEnv("DB_USER", "postgres"),
+			Password:          getEnv("DB_PASSWORD", "password"),
+			SSLMode:           getEnv("DB_SSL_MODE", "disable"),
+			Required:          getEnvAsBool("DB_REQUIRED", true),
+			UniqueDeviceNames: getEnvAsBool("DB_UNIQUE_DEVICE_NAMES", false),
+			ReconnectInterval: getEnvAsDuration("DB_RECONNECT_INTERVAL", defaultReconnectInterval),
 		},
 		MQTT: MQTTConfig{
 			Broker:         getEnv("MQTT_BROKER", "tcp://localhost:1883"),
 			ClientID:       getEnv("MQTT_CLIENT_ID", "iot-platform-server"),
+			IDStrategy:     getEnvAsOneOf("MQTT_CLIENT_ID_STRATEGY", "stable", "stable", "random"),
 			Username:       getEnv("MQTT_USERNAME", ""),
 			Password:       getEnv("MQTT_PASSWORD", ""),
-			KeepAlive:      getEnvAsInt("MQTT_KEEP_ALIVE", defaultKeepAlive),
+			KeepAlive:      keepAlive,
+			PingTimeout:    loadPingTimeout(keepAlive),
 			ConnectTimeout: getEnvAsInt("MQTT_CONNECT_TIMEOUT", defaultConnectTimeout),
-			QoS:            getEnvAsByte("MQTT_QOS", 1),
+			QoS:            getEnvAsQoS("MQTT_QOS", defaultMQTTQoS),
 			CleanSession:   getEnvAsBool("MQTT_CLEAN_SESSION", true),
 			AutoReconnect:  getEnvAsBool("MQTT_AUTO_RECONNECT", true),
+			TopicPrefix:    getEnv("MQTT_TOPIC_PREFIX", ""),
+			QueueSize:      getEnvAsInt("MQTT_PUBLISH_QUEUE_SIZE", 0),
+			MaxPayloadSize: getEnvAsInt("MQTT_MAX_PAYLOAD_BYTES", defaultMQTTMaxPayload),
+			Reconnect:      loadReconnectConfig(),
+
+			DisconnectTimeout: getEnvAsDuration("MQTT_DISCONNECT_TIMEOUT", defaultDisconnectTimeout),
+			StatusTopic:       getEnv("MQTT_STATUS_TOPIC", ""),
+
+			HandlerConcurrency: getEnvAsPositiveInt("MQTT_HANDLER_CONCURRENCY", defaultHandlerConcurrency),
+			HeartbeatEnabled:   getEnvAsBool("MQTT_HEARTBEAT_ENABLED", true),
+			HeartbeatInterval:  getEnvAsDuration("MQTT_HEARTBEAT_INTERVAL", defaultHeartbeatInterval),
+			HeartbeatRoundTrip: getEnvAsBool("MQTT_HEARTBEAT_ROUNDTRIP", false),
+			HealthCheckEnabled: getEnvAsBool("MQTT_HEALTH_CHECK", false),
+			HealthCheckTimeout: getEnvAsDuration("MQTT_HEALTH_CHECK_TIMEOUT", defaultHealthCheckTimeout),
+
+			TLSCAFile:             getEnv("MQTT_TLS_CA_FILE", ""),
+			TLSInsecureSkipVerify: getEnvAsBool("MQTT_TLS_INSECURE_SKIP_VERIFY", false),
+
+			DeadLetterSink:  getEnvAsOneOf("MQTT_DEAD_LETTER_SINK", "file", "none", "file", "topic"),
+			DeadLetterPath:  getEnv("MQTT_DEAD_LETTER_PATH", "cmd/server/mqtt-dead-letter.log"),
+			DeadLetterTopic: getEnv("MQTT_DEAD_LETTER_TOPIC", ""),
 		},
 		InfluxDB: InfluxDBConfig{
-			URL:      getEnv("INFLUXDB_URL", "http://localhost:8086"),
-			Token:    getEnv("INFLUXDB_TOKEN", "iot-platform-token"),
-			Org:      getEnv("INFLUXDB_ORG", "iot-platform"),
-			Bucket:   getEnv("INFLUXDB_BUCKET", "device-data"),
-			Username: getEnv("INFLUXDB_USERNAME", "admin"),
-			Password: getEnv("INFLUXDB_PASSWORD", "adminpassword"),
+			URL:          getEnv("INFLUXDB_URL", "http://localhost:8086"),
+			Token:        getEnv("INFLUXDB_TOKEN", "iot-platform-token"),
+			Org:          getEnv("INFLUXDB_ORG", "iot-platform"),
+			Bucket:       getEnv("INFLUXDB_BUCKET", "device-data"),
+			Username:     getEnv("INFLUXDB_USERNAME", "admin"),
+			Password:     getEnv("INFLUXDB_PASSWORD", "adminpassword"),
+			QueryTimeout: getEnvAsDuration("INFLUXDB_QUERY_TIMEOUT", defaultInfluxTimeout),
+			BoolAsNumber: getEnvAsBool("INFLUXDB_BOOL_AS_NUMBER", false),
+			Measurements: getEnvAsMap("INFLUXDB_MEASUREMENTS"),
+			Buckets:      getEnvAsMap("INFLUXDB_BUCKETS"),
+			Precision:    getEnvAsOneOf("INFLUXDB_PRECISION", "ns", "ns", "us", "ms", "s"),
+		},
+		Data: DataConfig{
+			NormalizeUnits:         getEnvAsBool("DATA_NORMALIZE_UNITS", true),
+			ValidateSchema:         getEnvAsBool("DATA_SCHEMA_VALIDATION", true),
+			BufferWrites:           getEnvAsBool("DATA_BUFFER_ENABLED", false),
+			Store:                  getEnvAsOneOf("DATA_STORE", "postgres", "postgres", "influxdb"),
+			SchemaPath:             getEnv("DATA_SCHEMA_PATH", ""),
+			TimestampTolerance:     getEnvAsOneOf("DATA_TIMESTAMP_TOLERANCE", "flexible", "strict", "flexible"),
+			TimestampSource:        getEnvAsOneOf("DATA_TIMESTAMP", "device", "device", "server", "clamp"),
+			TimestampMaxSkew:       getEnvAsDuration("DATA_TIMESTAMP_MAX_SKEW", defaultTimestampSkew),
+			RetentionDays:          getEnvAsInt("DATA_RETENTION_DAYS", 0),
+			RetentionSweepInterval: getEnvAsDuration("DATA_RETENTION_SWEEP_INTERVAL", defaultRetentionSweep),
+			LatestCacheEnabled:     getEnvAsBool("LATEST_CACHE_ENABLED", true),
+			LatestCacheTTL:         getEnvAsDuration("LATEST_CACHE_TTL", defaultLatestCacheTTL),
+			BufferSize:             getEnvAsPositiveInt("DATA_BUFFER_SIZE", defaultBufferSize),
+			BufferFlushInterval:    getEnvAsDuration("DATA_BUFFER_FLUSH_INTERVAL", defaultBufferFlush),
+
+			DefaultDataType:   getEnv("DEFAULT_DATA_TYPE", ""),
+			DefaultUnit:       getEnv("DEFAULT_UNIT", ""),
+			RejectMissingType: getEnvAsBool("DATA_REJECT_MISSING_TYPE", false),
+
+			SaveRetryAttempts: getEnvAsPositiveInt("DATA_SAVE_RETRY_ATTEMPTS", defaultSaveRetryAttempts),
+			SaveRetryBackoff:  getEnvAsDuration("DATA_SAVE_RETRY_BACKOFF", defaultSaveRetryBackoff),
+
+			RollupEnabled:     getEnvAsBool("DATA_ROLLUP_ENABLED", false),
+			RollupAfterDays:   getEnvAsPositiveInt("DATA_ROLLUP_AFTER_DAYS", defaultRollupAfterDays),
+			RollupGranularity: getEnvAsOneOf("DATA_ROLLUP_GRANULARITY", "hour", "hour", "day"),
+			RollupInterval:    getEnvAsDuration("DATA_ROLLUP_INTERVAL", defaultRollupInterval),
+		},
+		Devices: DeviceConfig{
+			SettingsDefaults: getEnvAsMap("DEVICE_SETTINGS_DEFAULTS"),
+			PublishSettings:  getEnvAsBool("DEVICE_SETTINGS_PUBLISH", true),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-secret-key-here"),
+			Secret:     getEnv("JWT_SECRET", DefaultJWTSecret),
 			Expiration: getEnv("JWT_EXPIRATION", "24h"),
 		},
 		Logging: LoggingConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
+			Level:        getEnv("LOG_LEVEL", "info"),
+			Format:       getEnvAsOneOf("LOG_FORMAT", "emoji", "plain", "emoji", "json"),
+			MQTTLogPath:  getEnv("MQTT_LOG_PATH", "cmd/server/mqtt-received.log"),
+			MQTTLogMaxMB: getEnvAsInt("MQTT_LOG_MAX_MB", defaultMQTTLogMaxMB),
 		},
 	}
 }
 
+// loadAPIConfig loads the API list limits, falling back to the defaults
+// when a limit is not positive or the maximum is below the default
+func loadAPIConfig() APIConfig {
+	cfg := APIConfig{
+		DefaultLimit: getEnvAsInt("API_DEFAULT_LIMIT", defaultAPILimit),
+		MaxLimit:     getEnvAsInt("API_MAX_LIMIT", defaultAPIMaxLimit),
+	}
+
+	if cfg.DefaultLimit <= 0 || cfg.MaxLimit <= 0 || cfg.MaxLimit < cfg.DefaultLimit {
+		log.Printf("Invalid API limits (API_DEFAULT_LIMIT=%d, API_MAX_LIMIT=%d; both must be positive and max >= default), using %d and %d",
+			cfg.DefaultLimit, cfg.MaxLimit, defaultAPILimit, defaultAPIMaxLimit)
+		return APIConfig{DefaultLimit: defaultAPILimit, MaxLimit: defaultAPIMaxLimit}
+	}
+
+	return cfg
+}
+
+// loadReconnectConfig loads the MQTT reconnect intervals, falling back to the defaults
+// when the interval is above the maximum
+// loadPingTimeout reads MQTT_PING_TIMEOUT, which must be shorter than the keep-alive interval (in seconds).
+// An invalid timeout falls back to the default, or half the keep-alive when the default does not fit.
+func loadPingTimeout(keepAlive int) time.Duration {
+	timeout := getEnvAsDuration("MQTT_PING_TIMEOUT", defaultPingTimeout)
+	interval := time.Duration(keepAlive) * time.Second
+	if interval <= 0 || timeout < interval {
+		return timeout
+	}
+
+	fallback := defaultPingTimeout
+	if fallback >= interval {
+		fallback = interval / 2
+	}
+	log.Printf("Invalid MQTT_PING_TIMEOUT %s (must be less than MQTT_KEEP_ALIVE %s), using %s", timeout, interval, fallback)
+	return fallback
+}
+
+func loadReconnectConfig() ReconnectConfig {
+	cfg := ReconnectConfig{
+		Interval:    getEnvAsDuration("MQTT_RECONNECT_INTERVAL", defaultReconnectInterval),
+		MaxInterval: getEnvAsDuration("MQTT_MAX_RECONNECT_INTERVAL", defaultMaxReconnectInterval),
+	}
+
+	if cfg.Interval > cfg.MaxInterval {
+		log.Printf("Invalid MQTT reconnect intervals (MQTT_RECONNECT_INTERVAL=%s, MQTT_MAX_RECONNECT_INTERVAL=%s; interval must not exceed max), using %s and %s",
+			cfg.Interval, cfg.MaxInterval, defaultReconnectInterval, defaultMaxReconnectInterval)
+		return ReconnectConfig{Interval: defaultReconnectInterval, MaxInterval: defaultMaxReconnectInterval}
+	}
+
+	return cfg
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -140,6 +435,22 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsPositiveInt gets an environment variable as a positive integer or returns a default value
+func getEnvAsPositiveInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	intValue, err := strconv.Atoi(value)
+	if err != nil || intValue <= 0 {
+		log.Printf("Invalid %s value %q (must be a positive integer), using %d", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return intValue
+}
+
 // getEnvAsBool gets an environment variable as a boolean or returns a default value
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
@@ -150,16 +461,150 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-// getEnvAsByte gets an environment variable as a byte or returns a default value
-func getEnvAsByte(key string, defaultValue byte) byte {
-	if value := os.Getenv(key); value != "" {
-		if byteValue, err := strconv.ParseUint(value, 10, 8); err == nil {
-			return byte(byteValue)
+// getEnvAsDuration gets an environment variable as a positive duration (e.g. 30m) or returns a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid %s value %q (must be a positive duration such as 30m), using %s", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return duration
+}
+
+// getEnvAsQoS gets an environment variable as an MQTT QoS level (0, 1 or 2) or returns a default value
+func getEnvAsQoS(key string, defaultValue byte) byte {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	qos, err := strconv.Atoi(value)
+	if err != nil || qos < 0 || qos > maxMQTTQoS {
+		log.Printf("Invalid %s value %q (must be 0, 1 or 2), using %d", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return byte(qos)
+}
+
+// getEnvAsList gets a comma-separated environment variable as a list, dropping blank entries
+func getEnvAsList(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvAsMap gets a comma-separated list of key=value pairs as a map, skipping malformed entries
+func getEnvAsMap(key string) map[string]string {
+	m := make(map[string]string)
+	for _, item := range getEnvAsList(key, "") {
+		k, v, ok := strings.Cut(item, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			log.Printf("Invalid %s entry %q (must be key=value), skipping", key, item)
+			continue
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// getEnvAsOneOf gets an environment variable restricted to the allowed values or returns a default value
+func getEnvAsOneOf(key, defaultValue string, allowed ...string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	for _, a := range allowed {
+		if value == a {
+			return value
 		}
 	}
+
+	log.Printf("Invalid %s value %q (must be one of %s), using %s", key, value, strings.Join(allowed, ", "), defaultValue)
 	return defaultValue
 }
 
+// defaultGinMode is debug for local development and release everywhere else
+func defaultGinMode(environment string) string {
+	if environment == EnvironmentLocal {
+		return "debug"
+	}
+	return "release"
+}
+
+// getEnvAsGinMode gets an environment variable as a gin mode (debug, release or test) or returns a default value
+func getEnvAsGinMode(key, defaultValue string) string {
+	value := os.Getenv(key)
+	switch value {
+	case "":
+		return defaultValue
+	case "debug", "release", "test":
+		return value
+	default:
+		log.Printf("Invalid %s value %q (must be debug, release or test), using %s", key, value, defaultValue)
+		return defaultValue
+	}
+}
+
+// SupportedBrokerSchemes are the MQTT broker URL schemes the client can connect with
+var SupportedBrokerSchemes = []string{"tcp", "ssl", "tls", "ws", "wss"}
+
+// Validate reports settings that would otherwise only fail later, e.g. when connecting
+func (c *Config) Validate() error {
+	return c.MQTT.Validate()
+}
+
+// Validate checks that the broker is a URL with a host and a supported scheme
+func (c *MQTTConfig) Validate() error {
+	broker, err := url.Parse(c.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT_BROKER %q: %w", c.Broker, err)
+	}
+	if !slices.Contains(SupportedBrokerSchemes, broker.Scheme) {
+		return fmt.Errorf("invalid MQTT_BROKER %q: unsupported scheme %q (must be one of %s)",
+			c.Broker, broker.Scheme, strings.Join(SupportedBrokerSchemes, ", "))
+	}
+	if broker.Host == "" {
+		return fmt.Errorf("invalid MQTT_BROKER %q: missing host (e.g. tcp://localhost:1883)", c.Broker)
+	}
+	return nil
+}
+
+// RedactedValue replaces set secrets in Redacted
+const RedactedValue = "***"
+
+// Redacted returns a copy of the config with its passwords, tokens and secrets replaced by RedactedValue.
+// Secrets that are not set stay empty, so a missing one can still be told apart.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Database.Password = redact(c.Database.Password)
+	redacted.MQTT.Password = redact(c.MQTT.Password)
+	redacted.InfluxDB.Token = redact(c.InfluxDB.Token)
+	redacted.InfluxDB.Password = redact(c.InfluxDB.Password)
+	redacted.JWT.Secret = redact(c.JWT.Secret)
+	return &redacted
+}
+
+// redact returns RedactedValue for a set secret
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return RedactedValue
+}
+
 // GetDatabaseURL returns the database connection string
 func (c *Config) GetDatabaseURL() string {
 	return "postgres://" + c.Database.User + ":" + c.Database.Password + "@" +
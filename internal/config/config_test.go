@@ -3,8 +3,10 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoad(t *testing.T) {
@@ -215,6 +217,35 @@ func TestConfigValidation(t *testing.T) {
 		assert.NotEmpty(t, cfg.Database.Password)
 	})
 
+	t.Run("supported broker schemes", func(t *testing.T) {
+		for _, broker := range []string{
+			"tcp://localhost:1883",
+			"ssl://broker.example.com:8883",
+			"tls://broker.example.com:8883",
+			"ws://localhost:8083/mqtt",
+			"wss://broker.example.com/mqtt",
+		} {
+			cfg := &Config{MQTT: MQTTConfig{Broker: broker}}
+			assert.NoError(t, cfg.Validate(), broker)
+		}
+	})
+
+	t.Run("rejected broker URLs", func(t *testing.T) {
+		for _, broker := range []string{
+			"http://localhost:1883",
+			"localhost:1883",
+			"tcp://",
+			"",
+		} {
+			cfg := &Config{MQTT: MQTTConfig{Broker: broker}}
+			assert.Error(t, cfg.Validate(), broker)
+		}
+
+		err := (&MQTTConfig{Broker: "http://localhost:1883"}).Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unsupported scheme "http"`)
+	})
+
 	t.Run("database URL generation", func(t *testing.T) {
 		cfg := &Config{
 			Database: DatabaseConfig{
@@ -232,3 +263,602 @@ func TestConfigValidation(t *testing.T) {
 		assert.Contains(t, url, "sslmode=disable")
 	})
 }
+
+func TestLoadMQTTLogSettings(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("MQTT_LOG_PATH", "")
+		t.Setenv("MQTT_LOG_MAX_MB", "")
+
+		cfg := Load()
+		assert.Equal(t, "cmd/server/mqtt-received.log", cfg.Logging.MQTTLogPath)
+		assert.Equal(t, 10, cfg.Logging.MQTTLogMaxMB)
+	})
+
+	t.Run("from environment variables", func(t *testing.T) {
+		t.Setenv("MQTT_LOG_PATH", "/var/log/iot/mqtt.log")
+		t.Setenv("MQTT_LOG_MAX_MB", "5")
+
+		cfg := Load()
+		assert.Equal(t, "/var/log/iot/mqtt.log", cfg.Logging.MQTTLogPath)
+		assert.Equal(t, 5, cfg.Logging.MQTTLogMaxMB)
+	})
+}
+
+func TestLoadLogFormat(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "")
+	assert.Equal(t, "emoji", Load().Logging.Format)
+
+	t.Setenv("LOG_FORMAT", "json")
+	assert.Equal(t, "json", Load().Logging.Format)
+
+	t.Setenv("LOG_FORMAT", "fancy")
+	assert.Equal(t, "emoji", Load().Logging.Format)
+}
+
+func TestLoadMQTTTopicPrefix(t *testing.T) {
+	t.Setenv("MQTT_TOPIC_PREFIX", "")
+	assert.Equal(t, "", Load().MQTT.TopicPrefix)
+
+	t.Setenv("MQTT_TOPIC_PREFIX", "tenant-a")
+	assert.Equal(t, "tenant-a", Load().MQTT.TopicPrefix)
+}
+
+func TestLoadMQTTQueueSize(t *testing.T) {
+	t.Setenv("MQTT_PUBLISH_QUEUE_SIZE", "")
+	assert.Equal(t, 0, Load().MQTT.QueueSize)
+
+	t.Setenv("MQTT_PUBLISH_QUEUE_SIZE", "500")
+	assert.Equal(t, 500, Load().MQTT.QueueSize)
+}
+
+func TestLoadMQTTMaxPayloadSize(t *testing.T) {
+	t.Setenv("MQTT_MAX_PAYLOAD_BYTES", "")
+	assert.Equal(t, 256*1024, Load().MQTT.MaxPayloadSize)
+
+	t.Setenv("MQTT_MAX_PAYLOAD_BYTES", "1024")
+	assert.Equal(t, 1024, Load().MQTT.MaxPayloadSize)
+}
+
+func TestLoadAPILimits(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultLimit    string
+		maxLimit        string
+		expectedDefault int
+		expectedMax     int
+	}{
+		{"defaults", "", "", 100, 1000},
+		{"custom limits", "50", "500", 50, 500},
+		{"max equal to default", "200", "200", 200, 200},
+		{"max below default falls back", "500", "100", 100, 1000},
+		{"non-positive default falls back", "0", "500", 100, 1000},
+		{"non-positive max falls back", "50", "-1", 100, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_DEFAULT_LIMIT", tt.defaultLimit)
+			t.Setenv("API_MAX_LIMIT", tt.maxLimit)
+
+			cfg := Load()
+			assert.Equal(t, tt.expectedDefault, cfg.API.DefaultLimit)
+			assert.Equal(t, tt.expectedMax, cfg.API.MaxLimit)
+		})
+	}
+}
+
+func TestLoadMQTTReconnect(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    string
+		maxInterval string
+		expectedMin time.Duration
+		expectedMax time.Duration
+	}{
+		{"defaults", "", "", 5 * time.Second, time.Minute},
+		{"custom intervals", "2s", "30s", 2 * time.Second, 30 * time.Second},
+		{"interval equal to max", "10s", "10s", 10 * time.Second, 10 * time.Second},
+		{"interval above max falls back", "2m", "30s", 5 * time.Second, time.Minute},
+		{"invalid interval uses its default", "soon", "30s", 5 * time.Second, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MQTT_RECONNECT_INTERVAL", tt.interval)
+			t.Setenv("MQTT_MAX_RECONNECT_INTERVAL", tt.maxInterval)
+
+			cfg := Load()
+			assert.Equal(t, tt.expectedMin, cfg.MQTT.Reconnect.Interval)
+			assert.Equal(t, tt.expectedMax, cfg.MQTT.Reconnect.MaxInterval)
+		})
+	}
+}
+
+func TestLoadMQTTPingTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepAlive string
+		timeout   string
+		expected  time.Duration
+	}{
+		{"default", "", "", 10 * time.Second},
+		{"custom timeout", "60", "30s", 30 * time.Second},
+		{"timeout equal to keep-alive falls back", "60", "1m", 10 * time.Second},
+		{"short keep-alive halves the fallback", "8", "20s", 4 * time.Second},
+		{"disabled keep-alive accepts any timeout", "0", "2m", 2 * time.Minute},
+		{"invalid timeout uses the default", "60", "soon", 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MQTT_KEEP_ALIVE", tt.keepAlive)
+			t.Setenv("MQTT_PING_TIMEOUT", tt.timeout)
+
+			cfg := Load()
+			assert.Equal(t, tt.expected, cfg.MQTT.PingTimeout)
+		})
+	}
+}
+
+func TestLoadMQTTShutdown(t *testing.T) {
+	t.Setenv("MQTT_DISCONNECT_TIMEOUT", "")
+	t.Setenv("MQTT_STATUS_TOPIC", "")
+	cfg := Load()
+	assert.Equal(t, 250*time.Millisecond, cfg.MQTT.DisconnectTimeout)
+	assert.Empty(t, cfg.MQTT.StatusTopic)
+
+	t.Setenv("MQTT_DISCONNECT_TIMEOUT", "2s")
+	t.Setenv("MQTT_STATUS_TOPIC", "iot-platform/server/status")
+	cfg = Load()
+	assert.Equal(t, 2*time.Second, cfg.MQTT.DisconnectTimeout)
+	assert.Equal(t, "iot-platform/server/status", cfg.MQTT.StatusTopic)
+}
+
+func TestLoadMQTTHandlerConcurrency(t *testing.T) {
+	t.Setenv("MQTT_HANDLER_CONCURRENCY", "")
+	assert.Equal(t, 16, Load().MQTT.HandlerConcurrency)
+
+	t.Setenv("MQTT_HANDLER_CONCURRENCY", "64")
+	assert.Equal(t, 64, Load().MQTT.HandlerConcurrency)
+
+	// The limit cannot be disabled
+	for _, value := range []string{"0", "-1", "many"} {
+		t.Setenv("MQTT_HANDLER_CONCURRENCY", value)
+		assert.Equal(t, 16, Load().MQTT.HandlerConcurrency, value)
+	}
+}
+
+func TestLoadMQTTHeartbeat(t *testing.T) {
+	t.Setenv("MQTT_HEARTBEAT_ENABLED", "")
+	t.Setenv("MQTT_HEARTBEAT_INTERVAL", "")
+	t.Setenv("MQTT_HEARTBEAT_ROUNDTRIP", "")
+	cfg := Load()
+	assert.True(t, cfg.MQTT.HeartbeatEnabled)
+	assert.Equal(t, 30*time.Second, cfg.MQTT.HeartbeatInterval)
+	assert.False(t, cfg.MQTT.HeartbeatRoundTrip)
+
+	t.Setenv("MQTT_HEARTBEAT_ENABLED", "false")
+	t.Setenv("MQTT_HEARTBEAT_INTERVAL", "5s")
+	t.Setenv("MQTT_HEARTBEAT_ROUNDTRIP", "true")
+	cfg = Load()
+	assert.False(t, cfg.MQTT.HeartbeatEnabled)
+	assert.Equal(t, 5*time.Second, cfg.MQTT.HeartbeatInterval)
+	assert.True(t, cfg.MQTT.HeartbeatRoundTrip)
+
+	t.Setenv("MQTT_HEARTBEAT_INTERVAL", "0s")
+	assert.Equal(t, 30*time.Second, Load().MQTT.HeartbeatInterval)
+}
+
+func TestLoadMQTTHealthCheck(t *testing.T) {
+	t.Setenv("MQTT_HEALTH_CHECK", "")
+	t.Setenv("MQTT_HEALTH_CHECK_TIMEOUT", "")
+	cfg := Load()
+	assert.False(t, cfg.MQTT.HealthCheckEnabled)
+	assert.Equal(t, 2*time.Second, cfg.MQTT.HealthCheckTimeout)
+
+	t.Setenv("MQTT_HEALTH_CHECK", "true")
+	t.Setenv("MQTT_HEALTH_CHECK_TIMEOUT", "500ms")
+	cfg = Load()
+	assert.True(t, cfg.MQTT.HealthCheckEnabled)
+	assert.Equal(t, 500*time.Millisecond, cfg.MQTT.HealthCheckTimeout)
+}
+
+func TestLoadReadingDefaults(t *testing.T) {
+	t.Setenv("DEFAULT_DATA_TYPE", "")
+	t.Setenv("DEFAULT_UNIT", "")
+	t.Setenv("DATA_REJECT_MISSING_TYPE", "")
+	cfg := Load()
+	assert.Empty(t, cfg.Data.DefaultDataType)
+	assert.Empty(t, cfg.Data.DefaultUnit)
+	assert.False(t, cfg.Data.RejectMissingType)
+
+	t.Setenv("DEFAULT_DATA_TYPE", "value")
+	t.Setenv("DEFAULT_UNIT", "celsius")
+	t.Setenv("DATA_REJECT_MISSING_TYPE", "true")
+	cfg = Load()
+	assert.Equal(t, "value", cfg.Data.DefaultDataType)
+	assert.Equal(t, "celsius", cfg.Data.DefaultUnit)
+	assert.True(t, cfg.Data.RejectMissingType)
+}
+
+func TestLoadSaveRetry(t *testing.T) {
+	t.Setenv("DATA_SAVE_RETRY_ATTEMPTS", "")
+	t.Setenv("DATA_SAVE_RETRY_BACKOFF", "")
+	cfg := Load()
+	assert.Equal(t, 3, cfg.Data.SaveRetryAttempts)
+	assert.Equal(t, 100*time.Millisecond, cfg.Data.SaveRetryBackoff)
+
+	t.Setenv("DATA_SAVE_RETRY_ATTEMPTS", "1")
+	t.Setenv("DATA_SAVE_RETRY_BACKOFF", "1s")
+	cfg = Load()
+	assert.Equal(t, 1, cfg.Data.SaveRetryAttempts)
+	assert.Equal(t, time.Second, cfg.Data.SaveRetryBackoff)
+
+	// Invalid values fall back to the defaults
+	t.Setenv("DATA_SAVE_RETRY_ATTEMPTS", "0")
+	t.Setenv("DATA_SAVE_RETRY_BACKOFF", "-1s")
+	cfg = Load()
+	assert.Equal(t, 3, cfg.Data.SaveRetryAttempts)
+	assert.Equal(t, 100*time.Millisecond, cfg.Data.SaveRetryBackoff)
+}
+
+func TestLoadDataRollup(t *testing.T) {
+	t.Setenv("DATA_ROLLUP_ENABLED", "")
+	t.Setenv("DATA_ROLLUP_AFTER_DAYS", "")
+	t.Setenv("DATA_ROLLUP_GRANULARITY", "")
+	t.Setenv("DATA_ROLLUP_INTERVAL", "")
+	cfg := Load()
+	assert.False(t, cfg.Data.RollupEnabled)
+	assert.Equal(t, 30, cfg.Data.RollupAfterDays)
+	assert.Equal(t, "hour", cfg.Data.RollupGranularity)
+	assert.Equal(t, time.Hour, cfg.Data.RollupInterval)
+
+	t.Setenv("DATA_ROLLUP_ENABLED", "true")
+	t.Setenv("DATA_ROLLUP_AFTER_DAYS", "7")
+	t.Setenv("DATA_ROLLUP_GRANULARITY", "day")
+	t.Setenv("DATA_ROLLUP_INTERVAL", "6h")
+	cfg = Load()
+	assert.True(t, cfg.Data.RollupEnabled)
+	assert.Equal(t, 7, cfg.Data.RollupAfterDays)
+	assert.Equal(t, "day", cfg.Data.RollupGranularity)
+	assert.Equal(t, 6*time.Hour, cfg.Data.RollupInterval)
+
+	// Invalid values fall back to the defaults
+	t.Setenv("DATA_ROLLUP_AFTER_DAYS", "0")
+	t.Setenv("DATA_ROLLUP_GRANULARITY", "minute")
+	cfg = Load()
+	assert.Equal(t, 30, cfg.Data.RollupAfterDays)
+	assert.Equal(t, "hour", cfg.Data.RollupGranularity)
+}
+
+func TestLoadDeviceSettings(t *testing.T) {
+	t.Setenv("DEVICE_SETTINGS_DEFAULTS", "")
+	t.Setenv("DEVICE_SETTINGS_PUBLISH", "")
+	cfg := Load()
+	assert.Empty(t, cfg.Devices.SettingsDefaults)
+	assert.True(t, cfg.Devices.PublishSettings)
+
+	t.Setenv("DEVICE_SETTINGS_DEFAULTS", "interval=30, mode=eco")
+	t.Setenv("DEVICE_SETTINGS_PUBLISH", "false")
+	cfg = Load()
+	assert.Equal(t, map[string]string{"interval": "30", "mode": "eco"}, cfg.Devices.SettingsDefaults)
+	assert.False(t, cfg.Devices.PublishSettings)
+}
+
+func TestLoadDataRetention(t *testing.T) {
+	t.Setenv("DATA_RETENTION_DAYS", "")
+	t.Setenv("DATA_RETENTION_SWEEP_INTERVAL", "")
+	cfg := Load()
+	assert.Equal(t, 0, cfg.Data.RetentionDays)
+	assert.Equal(t, time.Hour, cfg.Data.RetentionSweepInterval)
+
+	t.Setenv("DATA_RETENTION_DAYS", "90")
+	t.Setenv("DATA_RETENTION_SWEEP_INTERVAL", "15m")
+	cfg = Load()
+	assert.Equal(t, 90, cfg.Data.RetentionDays)
+	assert.Equal(t, 15*time.Minute, cfg.Data.RetentionSweepInterval)
+
+	t.Setenv("DATA_RETENTION_SWEEP_INTERVAL", "often")
+	assert.Equal(t, time.Hour, Load().Data.RetentionSweepInterval)
+}
+
+func TestLoadLatestCache(t *testing.T) {
+	t.Setenv("LATEST_CACHE_ENABLED", "")
+	t.Setenv("LATEST_CACHE_TTL", "")
+	cfg := Load()
+	assert.True(t, cfg.Data.LatestCacheEnabled)
+	assert.Equal(t, 10*time.Second, cfg.Data.LatestCacheTTL)
+
+	t.Setenv("LATEST_CACHE_ENABLED", "false")
+	t.Setenv("LATEST_CACHE_TTL", "1m")
+	cfg = Load()
+	assert.False(t, cfg.Data.LatestCacheEnabled)
+	assert.Equal(t, time.Minute, cfg.Data.LatestCacheTTL)
+}
+
+func TestLoadInfluxDBQueryTimeout(t *testing.T) {
+	t.Setenv("INFLUXDB_QUERY_TIMEOUT", "")
+	assert.Equal(t, 10*time.Second, Load().InfluxDB.QueryTimeout)
+
+	t.Setenv("INFLUXDB_QUERY_TIMEOUT", "2s")
+	assert.Equal(t, 2*time.Second, Load().InfluxDB.QueryTimeout)
+}
+
+func TestLoadInfluxDBBoolAsNumber(t *testing.T) {
+	t.Setenv("INFLUXDB_BOOL_AS_NUMBER", "")
+	assert.False(t, Load().InfluxDB.BoolAsNumber)
+
+	t.Setenv("INFLUXDB_BOOL_AS_NUMBER", "true")
+	assert.True(t, Load().InfluxDB.BoolAsNumber)
+}
+
+func TestLoadInfluxDBPrecision(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", "ns"},
+		{"ns", "ns"},
+		{"us", "us"},
+		{"ms", "ms"},
+		{"s", "s"},
+		{"seconds", "ns"},
+		{"1s", "ns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("INFLUXDB_PRECISION", tt.value)
+			assert.Equal(t, tt.expected, Load().InfluxDB.Precision)
+		})
+	}
+}
+
+func TestLoadInfluxDBRouting(t *testing.T) {
+	t.Setenv("INFLUXDB_MEASUREMENTS", "")
+	t.Setenv("INFLUXDB_BUCKETS", "")
+	cfg := Load()
+	assert.Empty(t, cfg.InfluxDB.Measurements)
+	assert.Empty(t, cfg.InfluxDB.Buckets)
+
+	t.Setenv("INFLUXDB_MEASUREMENTS", "vibration=device_data_hf, current = device_data_hf")
+	t.Setenv("INFLUXDB_BUCKETS", "vibration=high-frequency,malformed,=empty-type")
+	cfg = Load()
+	assert.Equal(t, map[string]string{"vibration": "device_data_hf", "current": "device_data_hf"}, cfg.InfluxDB.Measurements)
+	assert.Equal(t, map[string]string{"vibration": "high-frequency"}, cfg.InfluxDB.Buckets)
+}
+
+func TestLoadServerMaxBodyBytes(t *testing.T) {
+	t.Setenv("SERVER_MAX_BODY_BYTES", "")
+	assert.Equal(t, 1<<20, Load().Server.MaxBodyBytes)
+
+	t.Setenv("SERVER_MAX_BODY_BYTES", "4096")
+	assert.Equal(t, 4096, Load().Server.MaxBodyBytes)
+}
+
+func TestLoadMQTTClientIDStrategy(t *testing.T) {
+	t.Setenv("MQTT_CLIENT_ID_STRATEGY", "")
+	assert.Equal(t, "stable", Load().MQTT.IDStrategy)
+
+	t.Setenv("MQTT_CLIENT_ID_STRATEGY", "random")
+	assert.Equal(t, "random", Load().MQTT.IDStrategy)
+
+	t.Setenv("MQTT_CLIENT_ID_STRATEGY", "timestamp")
+	assert.Equal(t, "stable", Load().MQTT.IDStrategy)
+}
+
+func TestLoadMQTTDeadLetter(t *testing.T) {
+	t.Setenv("MQTT_DEAD_LETTER_SINK", "")
+	t.Setenv("MQTT_DEAD_LETTER_PATH", "")
+	t.Setenv("MQTT_DEAD_LETTER_TOPIC", "")
+	cfg := Load()
+	assert.Equal(t, "file", cfg.MQTT.DeadLetterSink)
+	assert.Equal(t, "cmd/server/mqtt-dead-letter.log", cfg.MQTT.DeadLetterPath)
+	assert.Equal(t, "", cfg.MQTT.DeadLetterTopic)
+
+	t.Setenv("MQTT_DEAD_LETTER_SINK", "topic")
+	t.Setenv("MQTT_DEAD_LETTER_TOPIC", "ops/dead-letter")
+	cfg = Load()
+	assert.Equal(t, "topic", cfg.MQTT.DeadLetterSink)
+	assert.Equal(t, "ops/dead-letter", cfg.MQTT.DeadLetterTopic)
+
+	t.Setenv("MQTT_DEAD_LETTER_SINK", "kafka")
+	assert.Equal(t, "file", Load().MQTT.DeadLetterSink)
+}
+
+func TestLoadDataBufferEnabled(t *testing.T) {
+	t.Setenv("DATA_BUFFER_ENABLED", "")
+	assert.False(t, Load().Data.BufferWrites)
+
+	t.Setenv("DATA_BUFFER_ENABLED", "true")
+	assert.True(t, Load().Data.BufferWrites)
+}
+
+func TestLoadDataBufferTuning(t *testing.T) {
+	t.Setenv("DATA_BUFFER_SIZE", "")
+	t.Setenv("DATA_BUFFER_FLUSH_INTERVAL", "")
+	cfg := Load()
+	assert.Equal(t, 100, cfg.Data.BufferSize)
+	assert.Equal(t, time.Second, cfg.Data.BufferFlushInterval)
+
+	t.Setenv("DATA_BUFFER_SIZE", "500")
+	t.Setenv("DATA_BUFFER_FLUSH_INTERVAL", "250ms")
+	cfg = Load()
+	assert.Equal(t, 500, cfg.Data.BufferSize)
+	assert.Equal(t, 250*time.Millisecond, cfg.Data.BufferFlushInterval)
+
+	// Sizes and intervals that are not positive fall back to the defaults
+	for _, invalid := range [][2]string{{"0", "0s"}, {"-10", "-1s"}, {"many", "soon"}} {
+		t.Setenv("DATA_BUFFER_SIZE", invalid[0])
+		t.Setenv("DATA_BUFFER_FLUSH_INTERVAL", invalid[1])
+		cfg = Load()
+		assert.Equal(t, 100, cfg.Data.BufferSize, invalid[0])
+		assert.Equal(t, time.Second, cfg.Data.BufferFlushInterval, invalid[1])
+	}
+}
+
+func TestLoadDataSchema(t *testing.T) {
+	t.Setenv("DATA_SCHEMA_VALIDATION", "")
+	t.Setenv("DATA_SCHEMA_PATH", "")
+	cfg := Load()
+	assert.True(t, cfg.Data.ValidateSchema)
+	assert.Equal(t, "", cfg.Data.SchemaPath)
+
+	t.Setenv("DATA_SCHEMA_VALIDATION", "false")
+	t.Setenv("DATA_SCHEMA_PATH", "/etc/iot/device-data.schema.json")
+	cfg = Load()
+	assert.False(t, cfg.Data.ValidateSchema)
+	assert.Equal(t, "/etc/iot/device-data.schema.json", cfg.Data.SchemaPath)
+}
+
+func TestLoadDataStore(t *testing.T) {
+	t.Setenv("DATA_STORE", "")
+	assert.Equal(t, "postgres", Load().Data.Store)
+
+	t.Setenv("DATA_STORE", "influxdb")
+	assert.Equal(t, "influxdb", Load().Data.Store)
+
+	t.Setenv("DATA_STORE", "mysql")
+	assert.Equal(t, "postgres", Load().Data.Store)
+}
+
+func TestLoadDataTimestampTolerance(t *testing.T) {
+	t.Setenv("DATA_TIMESTAMP_TOLERANCE", "")
+	assert.Equal(t, "flexible", Load().Data.TimestampTolerance)
+
+	t.Setenv("DATA_TIMESTAMP_TOLERANCE", "strict")
+	assert.Equal(t, "strict", Load().Data.TimestampTolerance)
+
+	t.Setenv("DATA_TIMESTAMP_TOLERANCE", "lenient")
+	assert.Equal(t, "flexible", Load().Data.TimestampTolerance)
+}
+
+func TestLoadDataTimestampSource(t *testing.T) {
+	t.Setenv("DATA_TIMESTAMP", "")
+	cfg := Load()
+	assert.Equal(t, "device", cfg.Data.TimestampSource)
+	assert.Equal(t, 5*time.Minute, cfg.Data.TimestampMaxSkew)
+
+	t.Setenv("DATA_TIMESTAMP", "clamp")
+	t.Setenv("DATA_TIMESTAMP_MAX_SKEW", "30s")
+	cfg = Load()
+	assert.Equal(t, "clamp", cfg.Data.TimestampSource)
+	assert.Equal(t, 30*time.Second, cfg.Data.TimestampMaxSkew)
+
+	t.Setenv("DATA_TIMESTAMP", "server")
+	assert.Equal(t, "server", Load().Data.TimestampSource)
+
+	t.Setenv("DATA_TIMESTAMP", "gps")
+	assert.Equal(t, "device", Load().Data.TimestampSource)
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	assert.Equal(t, []string{"127.0.0.1", "::1"}, Load().Server.TrustedProxies)
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.10,")
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.10"}, Load().Server.TrustedProxies)
+}
+
+func TestLoadMQTTQoS(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected byte
+	}{
+		{"default", "", 1},
+		{"qos 0", "0", 0},
+		{"qos 2", "2", 2},
+		{"out of range falls back to 1", "5", 1},
+		{"negative falls back to 1", "-1", 1},
+		{"non-numeric falls back to 1", "high", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MQTT_QOS", tt.value)
+			assert.Equal(t, tt.expected, Load().MQTT.QoS)
+		})
+	}
+}
+
+func TestLoadDataNormalizeUnits(t *testing.T) {
+	t.Setenv("DATA_NORMALIZE_UNITS", "")
+	assert.True(t, Load().Data.NormalizeUnits)
+
+	t.Setenv("DATA_NORMALIZE_UNITS", "false")
+	assert.False(t, Load().Data.NormalizeUnits)
+}
+
+func TestLoadDatabaseRequired(t *testing.T) {
+	cfg := Load()
+	assert.True(t, cfg.Database.Required)
+	assert.Equal(t, 5*time.Second, cfg.Database.ReconnectInterval)
+
+	t.Setenv("DB_REQUIRED", "false")
+	t.Setenv("DB_RECONNECT_INTERVAL", "30s")
+	cfg = Load()
+	assert.False(t, cfg.Database.Required)
+	assert.Equal(t, 30*time.Second, cfg.Database.ReconnectInterval)
+}
+
+func TestLoadGinMode(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", "debug"},
+		{"release", "release"},
+		{"test", "test"},
+		{"production", "debug"},
+	}
+
+	for _, tt := range tests {
+		t.Run("GIN_MODE="+tt.value, func(t *testing.T) {
+			t.Setenv("GIN_MODE", tt.value)
+			assert.Equal(t, tt.expected, Load().Server.Mode)
+		})
+	}
+}
+
+func TestLoadGinModeFromEnvironment(t *testing.T) {
+	tests := []struct {
+		environment string
+		ginMode     string
+		expected    string
+	}{
+		{"", "", "debug"},
+		{"local", "", "debug"},
+		{"production", "", "release"},
+		{"staging", "", "release"},
+		{"production", "debug", "debug"},
+		{"local", "release", "release"},
+	}
+
+	for _, tt := range tests {
+		t.Run("APP_ENV="+tt.environment+",GIN_MODE="+tt.ginMode, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.environment)
+			t.Setenv("GIN_MODE", tt.ginMode)
+			assert.Equal(t, tt.expected, Load().Server.Mode)
+		})
+	}
+}
+
+func TestJWTConfig_SecretConfigured(t *testing.T) {
+	tests := []struct {
+		secret   string
+		expected bool
+	}{
+		{"", false},
+		{DefaultJWTSecret, false},
+		{"a-real-secret", true},
+	}
+
+	for _, tt := range tests {
+		t.Run("JWT_SECRET="+tt.secret, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", tt.secret)
+			cfg := Load()
+			assert.Equal(t, tt.expected, cfg.JWT.SecretConfigured())
+		})
+	}
+}
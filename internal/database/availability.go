@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReconnectInterval is how often an unavailable database is retried
+const DefaultReconnectInterval = 5 * time.Second
+
+// Availability tracks whether the database has been initialized.
+// It lets the server start while the database is down and connect once it comes up.
+type Availability struct {
+	connect  func() error
+	interval time.Duration
+	ready    atomic.Bool
+}
+
+// NewAvailability creates an availability tracker that runs connect until it succeeds
+func NewAvailability(connect func() error, interval time.Duration) *Availability {
+	if interval <= 0 {
+		interval = DefaultReconnectInterval
+	}
+	return &Availability{connect: connect, interval: interval}
+}
+
+// Ready reports whether the database has been initialized
+func (a *Availability) Ready() bool {
+	return a.ready.Load()
+}
+
+// TryConnect runs connect once unless the database is already ready
+func (a *Availability) TryConnect() error {
+	if a.Ready() {
+		return nil
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+	a.ready.Store(true)
+	return nil
+}
+
+// Run retries connect every interval until it succeeds or ctx is cancelled
+func (a *Availability) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		err := a.TryConnect()
+		if err == nil {
+			log.Println("Database connection established")
+			return
+		}
+		log.Printf("Database still unavailable: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
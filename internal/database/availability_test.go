@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailability_ReconnectsAfterFailures(t *testing.T) {
+	attempts := 0
+	availability := NewAvailability(func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, time.Millisecond)
+
+	// The first attempt fails, so the server would boot degraded
+	require.Error(t, availability.TryConnect())
+	assert.False(t, availability.Ready())
+
+	done := make(chan struct{})
+	go func() {
+		availability.Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the database became available")
+	}
+
+	assert.True(t, availability.Ready())
+	assert.Equal(t, 3, attempts)
+
+	// Once ready, connect is not run again
+	require.NoError(t, availability.TryConnect())
+	assert.Equal(t, 3, attempts)
+}
+
+func TestAvailability_RunStopsOnCancel(t *testing.T) {
+	availability := NewAvailability(func() error {
+		return errors.New("connection refused")
+	}, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		availability.Run(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+	assert.False(t, availability.Ready())
+}
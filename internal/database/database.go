@@ -1,43 +1,107 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	"iot-platform-go/internal/config"
 
 	_ "github.com/lib/pq"
 )
 
+// healthCheckTimeout bounds how long HealthCheck waits for the database to answer
+const healthCheckTimeout = 2 * time.Second
+
+// DeviceNameUniqueIndex is the index enforcing unique device names when they are configured to be unique.
+const DeviceNameUniqueIndex = "idx_devices_name_unique"
+
 // Database represents the database connection.
 type Database struct {
 	*sql.DB
+	uniqueDeviceNames bool
 }
 
 // New creates a new database connection.
 func New(cfg *config.Config) (*Database, error) {
+	database, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.Init(); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// Open creates the connection pool without contacting the database.
+// Init must succeed before the database is used.
+func Open(cfg *config.Config) (*Database, error) {
 	dsn := cfg.GetDatabaseURL()
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	return &Database{DB: db, uniqueDeviceNames: cfg.Database.UniqueDeviceNames}, nil
+}
+
+// Init checks the connection and creates any missing tables.
+func (d *Database) Init() error {
 	// Test the connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	if err := d.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	database := &Database{DB: db}
-
 	// Initialize tables
-	if err := database.initTables(); err != nil {
-		return nil, fmt.Errorf("failed to initialize tables: %w", err)
+	if err := d.initTables(); err != nil {
+		return fmt.Errorf("failed to initialize tables: %w", err)
 	}
 
-	return database, nil
+	return nil
 }
 
+// migrateDataMetadataToJSONB converts reading metadata from TEXT to JSONB so it can be queried by key.
+// Empty metadata becomes NULL and text that is not valid JSON is kept as a JSON string.
+// The table is only rewritten while the column is still TEXT.
+const migrateDataMetadataToJSONB = `
+	DO $$
+	BEGIN
+		IF (SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'device_data' AND column_name = 'metadata') = 'text' THEN
+			CREATE OR REPLACE FUNCTION pg_temp.text_to_jsonb(value TEXT) RETURNS JSONB AS $fn$
+			BEGIN
+				RETURN value::jsonb;
+			EXCEPTION WHEN others THEN
+				RETURN to_jsonb(value);
+			END;
+			$fn$ LANGUAGE plpgsql;
+
+			ALTER TABLE device_data ALTER COLUMN metadata TYPE JSONB
+				USING pg_temp.text_to_jsonb(NULLIF(metadata, ''));
+		END IF;
+	END
+	$$
+`
+
+// migrateDataValueToDouble widens reading values from REAL, which lost precision on high-resolution readings.
+// The ALTER locks and may rewrite device_data, so it only runs while the column is not yet double precision.
+const migrateDataValueToDouble = `
+	DO $$
+	BEGIN
+		IF (SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'device_data' AND column_name = 'value') <> 'double precision' THEN
+			ALTER TABLE device_data ALTER COLUMN value TYPE DOUBLE PRECISION;
+		END IF;
+	END
+	$$
+`
+
 // initTables creates the necessary tables if they don't exist.
 func (d *Database) initTables() error {
 	// Create devices table
@@ -51,7 +115,8 @@ func (d *Database) initTables() error {
 			metadata TEXT,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			last_seen TIMESTAMP
+			last_seen TIMESTAMP,
+			retention_days INTEGER
 		)
 	`
 
@@ -67,9 +132,10 @@ func (d *Database) initTables() error {
 			device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
 			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			data_type VARCHAR(100) NOT NULL,
-			value REAL NOT NULL,
+			value DOUBLE PRECISION NOT NULL,
 			unit VARCHAR(50),
-			metadata TEXT
+			metadata JSONB,
+			dedup_key VARCHAR(255)
 		)
 	`
 
@@ -78,6 +144,93 @@ func (d *Database) initTables() error {
 		return fmt.Errorf("failed to create device_data table: %w", err)
 	}
 
+	// Create device_events table.
+	// Events are kept after the device is deleted, so there is no foreign key.
+	createDeviceEventsTable := `
+		CREATE TABLE IF NOT EXISTS device_events (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			device_id UUID NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			actor VARCHAR(255),
+			details JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+
+	_, err = d.Exec(createDeviceEventsTable)
+	if err != nil {
+		return fmt.Errorf("failed to create device_events table: %w", err)
+	}
+
+	// Create device_status_history table
+	createStatusHistoryTable := `
+		CREATE TABLE IF NOT EXISTS device_status_history (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+			from_status VARCHAR(50),
+			to_status VARCHAR(50) NOT NULL,
+			changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+
+	_, err = d.Exec(createStatusHistoryTable)
+	if err != nil {
+		return fmt.Errorf("failed to create device_status_history table: %w", err)
+	}
+
+	// Create device_data_rollup table
+	createRollupTable := `
+		CREATE TABLE IF NOT EXISTS device_data_rollup (
+			device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+			data_type VARCHAR(100) NOT NULL,
+			unit VARCHAR(50) NOT NULL DEFAULT '',
+			granularity VARCHAR(10) NOT NULL,
+			bucket TIMESTAMP NOT NULL,
+			avg_value DOUBLE PRECISION NOT NULL,
+			min_value DOUBLE PRECISION NOT NULL,
+			max_value DOUBLE PRECISION NOT NULL,
+			sample_count INTEGER NOT NULL,
+			PRIMARY KEY (device_id, data_type, unit, granularity, bucket)
+		)
+	`
+
+	_, err = d.Exec(createRollupTable)
+	if err != nil {
+		return fmt.Errorf("failed to create device_data_rollup table: %w", err)
+	}
+
+	// Create device_settings table
+	createSettingsTable := `
+		CREATE TABLE IF NOT EXISTS device_settings (
+			device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+			key VARCHAR(100) NOT NULL,
+			value JSONB NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (device_id, key)
+		)
+	`
+
+	_, err = d.Exec(createSettingsTable)
+	if err != nil {
+		return fmt.Errorf("failed to create device_settings table: %w", err)
+	}
+
+	// Add columns introduced after the initial schema
+	migrations := []string{
+		"ALTER TABLE device_data ADD COLUMN IF NOT EXISTS dedup_key VARCHAR(255)",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS retention_days INTEGER",
+		"ALTER TABLE devices ADD COLUMN IF NOT EXISTS token_hash VARCHAR(64)",
+		migrateDataValueToDouble,
+		migrateDataMetadataToJSONB,
+	}
+
+	for _, migration := range migrations {
+		_, err := d.Exec(migration)
+		if err != nil {
+			return fmt.Errorf("failed to migrate table: %w", err)
+		}
+	}
+
 	// Create indexes
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_devices_status ON devices(status)",
@@ -85,6 +238,10 @@ func (d *Database) initTables() error {
 		"CREATE INDEX IF NOT EXISTS idx_device_data_device_id ON device_data(device_id)",
 		"CREATE INDEX IF NOT EXISTS idx_device_data_timestamp ON device_data(timestamp)",
 		"CREATE INDEX IF NOT EXISTS idx_device_data_type ON device_data(data_type)",
+		"CREATE INDEX IF NOT EXISTS idx_device_data_metadata ON device_data USING GIN (metadata jsonb_path_ops)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_device_data_dedup_key ON device_data(device_id, dedup_key)",
+		"CREATE INDEX IF NOT EXISTS idx_device_events_device_id ON device_events(device_id, created_at)",
+		"CREATE INDEX IF NOT EXISTS idx_device_status_history_device_id ON device_status_history(device_id, changed_at)",
 	}
 
 	for _, index := range indexes {
@@ -94,10 +251,54 @@ func (d *Database) initTables() error {
 		}
 	}
 
+	// Device names are only unique when configured; dropping the index makes the setting reversible
+	if d.uniqueDeviceNames {
+		if _, err := d.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + DeviceNameUniqueIndex + " ON devices(name)"); err != nil {
+			return fmt.Errorf("failed to enforce unique device names, rename duplicate devices first: %w", err)
+		}
+	} else if _, err := d.Exec("DROP INDEX IF EXISTS " + DeviceNameUniqueIndex); err != nil {
+		return fmt.Errorf("failed to drop unique device name index: %w", err)
+	}
+
 	log.Println("Database tables initialized successfully")
 	return nil
 }
 
+// PoolStats is a snapshot of the connection pool counters.
+type PoolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMs     float64 `json:"wait_duration_ms"`
+}
+
+// PoolStats returns the current connection pool statistics.
+func (d *Database) PoolStats() PoolStats {
+	stats := d.Stats()
+	return PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     float64(stats.WaitDuration) / float64(time.Millisecond),
+	}
+}
+
+// HealthCheck verifies the database is reachable.
+func (d *Database) HealthCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	if err := d.PingContext(ctx); err != nil {
+		return fmt.Errorf("database health check failed: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the database connection.
 func (d *Database) Close() error {
 	return d.DB.Close()
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_HealthCheck_Closed(t *testing.T) {
+	// sql.Open does not connect, so no server is needed
+	sqlDB, err := sql.Open("postgres", "host=localhost port=5432 user=postgres dbname=iot_platform_test sslmode=disable")
+	require.NoError(t, err)
+
+	db := &Database{DB: sqlDB}
+	require.NoError(t, db.Close())
+
+	err = db.HealthCheck(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "database health check failed")
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// connectionErrorClass is the PostgreSQL error class for connection exceptions
+const connectionErrorClass = "08"
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// shutdownErrorCodes are sent when the server is stopping or not yet accepting connections:
+// admin_shutdown, crash_shutdown and cannot_connect_now
+var shutdownErrorCodes = map[pq.ErrorCode]bool{
+	"57P01": true,
+	"57P02": true,
+	"57P03": true,
+}
+
+// retryableErrorCodes abort a transaction that succeeds when run again:
+// serialization_failure and deadlock_detected
+var retryableErrorCodes = map[pq.ErrorCode]bool{
+	"40001": true,
+	"40P01": true,
+}
+
+// IsConnectionError reports whether err means the connection to PostgreSQL was lost or refused,
+// as when the server restarts mid-request, rather than a problem with the query itself.
+// database/sql already retries a query once on a connection it finds bad before sending it,
+// so a connection error reaching the caller failed mid-query and is not retried again.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Class() == connectionErrorClass || shutdownErrorCodes[pqErr.Code]
+	}
+
+	// Refused and reset connections; not net.Error, which context deadlines also satisfy
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// IsTransientError reports whether err may not recur when the statement is run again: a lost connection,
+// or a serialization failure or deadlock. Constraint violations and other query errors are permanent.
+func IsTransientError(err error) bool {
+	if IsConnectionError(err) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && retryableErrorCodes[pqErr.Code]
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"wrapped bad connection", fmt.Errorf("failed to get device: %w", driver.ErrBadConn), true},
+		{"connection done", sql.ErrConnDone, true},
+		{"connection closed mid-read", fmt.Errorf("failed to query data: %w", io.ErrUnexpectedEOF), true},
+		{"connection refused", fmt.Errorf("failed to get devices: %w", refused), true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"cannot connect now", &pq.Error{Code: "57P03"}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"joined with a connection error", errors.Join(errors.New("count failed"), driver.ErrBadConn), true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"syntax error", &pq.Error{Code: "42601"}, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"query deadline", fmt.Errorf("failed to get device: %w", context.DeadlineExceeded), false},
+		{"other error", errors.New("device not found"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsConnectionError(tt.err))
+		})
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"bad connection", fmt.Errorf("failed to save device data: %w", driver.ErrBadConn), true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"serialization failure", fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "40001"}), true},
+		{"deadlock", &pq.Error{Code: "40P01"}, true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"foreign key violation", fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23503"}), false},
+		{"query deadline", context.DeadlineExceeded, false},
+		{"other error", errors.New("device not found"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsTransientError(tt.err))
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"unique violation", fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23505"}), true},
+		{"foreign key violation", &pq.Error{Code: "23503"}, false},
+		{"bad connection", driver.ErrBadConn, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsUniqueViolation(tt.err))
+		})
+	}
+}
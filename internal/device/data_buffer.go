@@ -0,0 +1,230 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"iot-platform-go/internal/database"
+	"iot-platform-go/pkg/models"
+)
+
+// Default data buffer settings
+const (
+	DefaultBufferCapacity      = 10000
+	DefaultBufferBatchSize     = 100
+	DefaultBufferFlushInterval = time.Second
+)
+
+// ErrBufferClosed is returned by Enqueue once the buffer has stopped accepting readings
+var ErrBufferClosed = errors.New("data buffer is closed")
+
+// BufferStats describes the state of a data buffer, reported as a metrics gauge
+type BufferStats struct {
+	Depth    int   `json:"depth"`
+	Capacity int   `json:"capacity"`
+	Enqueued int64 `json:"enqueued"`
+	Flushed  int64 `json:"flushed"` // readings handed to the saver, including ignored duplicates
+	Failed   int64 `json:"failed"`  // readings that could not be saved, handed to the reject handler
+	Blocked  int64 `json:"blocked"` // enqueues that waited because the buffer was full
+}
+
+// DataBuffer batches readings in memory and writes them with SaveDataBatch
+// once a batch fills up or the flush interval passes. A full buffer blocks
+// Enqueue, so ingestion slows to the database's pace instead of growing memory.
+// A batch failing with a permanent error is saved one reading at a time, so only
+// the readings that fail on their own are rejected.
+type DataBuffer struct {
+	saver     ReadingSaver
+	queue     chan *models.DeviceData
+	batchSize int
+	interval  time.Duration
+	done      chan struct{}
+	sending   sync.RWMutex // held for reading by Enqueue while it may send, so Run can wait out sends before draining
+	saved     func(data *models.DeviceData)
+	reject    func(data *models.DeviceData, err error)
+
+	enqueued atomic.Int64
+	flushed  atomic.Int64
+	failed   atomic.Int64
+	blocked  atomic.Int64
+}
+
+// NewDataBuffer creates a buffer holding up to capacity readings that flushes
+// batches of batchSize, or whatever is pending every interval
+func NewDataBuffer(saver ReadingSaver, capacity, batchSize int, interval time.Duration) *DataBuffer {
+	return &DataBuffer{
+		saver:     saver,
+		queue:     make(chan *models.DeviceData, capacity),
+		batchSize: batchSize,
+		interval:  interval,
+		done:      make(chan struct{}),
+		saved:     func(*models.DeviceData) {},
+		reject:    func(*models.DeviceData, error) {},
+	}
+}
+
+// SetSaveHandler sets what is done with readings once they are stored, e.g. writing them to InfluxDB.
+// Duplicates dropped by their dedup key are not passed on. It is called from Run, so it must be set before Run starts.
+func (b *DataBuffer) SetSaveHandler(fn func(data *models.DeviceData)) {
+	b.saved = fn
+}
+
+// SetRejectHandler sets what is done with readings that could not be saved, e.g. dead-lettering them.
+// It is called from Run, so it must be set before Run starts.
+func (b *DataBuffer) SetRejectHandler(fn func(data *models.DeviceData, err error)) {
+	b.reject = fn
+}
+
+// Enqueue adds a reading, waiting while the buffer is full.
+// It fails once the buffer has stopped or when ctx is done.
+func (b *DataBuffer) Enqueue(ctx context.Context, data *models.DeviceData) error {
+	b.sending.RLock()
+	defer b.sending.RUnlock()
+
+	select {
+	case <-b.done:
+		return ErrBufferClosed
+	default:
+	}
+
+	select {
+	case b.queue <- data:
+		b.enqueued.Add(1)
+		return nil
+	default:
+	}
+
+	b.blocked.Add(1)
+	select {
+	case b.queue <- data:
+		b.enqueued.Add(1)
+		return nil
+	case <-b.done:
+		return ErrBufferClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run flushes batches until ctx is cancelled, then flushes everything still buffered and returns
+func (b *DataBuffer) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]*models.DeviceData, 0, b.batchSize)
+	for {
+		select {
+		case data := <-b.queue:
+			batch = append(batch, data)
+			if len(batch) >= b.batchSize {
+				batch = b.flush(batch)
+			}
+		case <-ticker.C:
+			batch = b.flush(batch)
+		case <-ctx.Done():
+			close(b.done)
+			// Wait for enqueues that got past the done check; any that sent are drained below
+			b.sending.Lock()
+			b.sending.Unlock()
+			b.drain(batch)
+			return
+		}
+	}
+}
+
+// drain flushes the pending batch and every reading left in the queue
+func (b *DataBuffer) drain(batch []*models.DeviceData) {
+	for {
+		select {
+		case data := <-b.queue:
+			batch = append(batch, data)
+			if len(batch) >= b.batchSize {
+				batch = b.flush(batch)
+			}
+		default:
+			b.flush(batch)
+			return
+		}
+	}
+}
+
+// flush saves the batch and returns a new empty batch; the saver may keep the old one
+func (b *DataBuffer) flush(batch []*models.DeviceData) []*models.DeviceData {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	inserted, err := b.saver.SaveDataBatch(batch)
+	for _, data := range inserted {
+		b.saved(data)
+	}
+	if err == nil {
+		b.flushed.Add(int64(len(batch)))
+		return make([]*models.DeviceData, 0, b.batchSize)
+	}
+
+	// A batch is not all-or-nothing, so the readings it inserted before failing count as saved
+	b.flushed.Add(int64(len(inserted)))
+	stored := make(map[*models.DeviceData]bool, len(inserted))
+	for _, data := range inserted {
+		stored[data] = true
+	}
+	pending := make([]*models.DeviceData, 0, len(batch)-len(inserted))
+	for _, data := range batch {
+		if !stored[data] {
+			pending = append(pending, data)
+		}
+	}
+
+	if database.IsTransientError(err) {
+		// The saver's retries ran out, so saving the readings one by one would fail the same way
+		log.Printf("❌ Failed to save %d buffered data points: %v", len(pending), err)
+		for _, data := range pending {
+			b.rejectData(data, err)
+		}
+	} else {
+		log.Printf("⚠️ Failed to save %d buffered data points, saving them one by one: %v", len(pending), err)
+		b.saveEach(pending)
+	}
+
+	return make([]*models.DeviceData, 0, b.batchSize)
+}
+
+// saveEach saves the readings of a failed batch one at a time, rejecting those that fail.
+// A reading an earlier attempt stored before failing fails on its primary key and is counted as saved.
+func (b *DataBuffer) saveEach(batch []*models.DeviceData) {
+	for _, data := range batch {
+		inserted, err := b.saver.SaveData(data)
+		if err != nil && !database.IsUniqueViolation(err) {
+			log.Printf("❌ Failed to save buffered %s for device %s: %v", data.DataType, data.DeviceID, err)
+			b.rejectData(data, err)
+			continue
+		}
+		if inserted || err != nil {
+			b.saved(data)
+		}
+		b.flushed.Add(1)
+	}
+}
+
+// rejectData counts a reading that could not be saved and hands it to the reject handler
+func (b *DataBuffer) rejectData(data *models.DeviceData, err error) {
+	b.failed.Add(1)
+	b.reject(data, err)
+}
+
+// Stats returns the current buffer state
+func (b *DataBuffer) Stats() BufferStats {
+	return BufferStats{
+		Depth:    len(b.queue),
+		Capacity: cap(b.queue),
+		Enqueued: b.enqueued.Load(),
+		Flushed:  b.flushed.Load(),
+		Failed:   b.failed.Load(),
+		Blocked:  b.blocked.Load(),
+	}
+}
@@ -0,0 +1,323 @@
+package device
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/background"
+	"iot-platform-go/pkg/models"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSaver keeps every saved reading and the size of each batch
+type recordingSaver struct {
+	mu      sync.Mutex
+	saved   map[string]bool
+	batches []int
+}
+
+func newRecordingSaver() *recordingSaver {
+	return &recordingSaver{saved: make(map[string]bool)}
+}
+
+func (s *recordingSaver) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range data {
+		s.saved[d.ID] = true
+	}
+	s.batches = append(s.batches, len(data))
+	return data, nil
+}
+
+func (s *recordingSaver) SaveData(data *models.DeviceData) (bool, error) {
+	inserted, err := s.SaveDataBatch([]*models.DeviceData{data})
+	return len(inserted) > 0, err
+}
+
+func (s *recordingSaver) savedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.saved)
+}
+
+func testReading(i int) *models.DeviceData {
+	return &models.DeviceData{ID: fmt.Sprintf("data-%d", i), DeviceID: "device-1", DataType: "temperature", Value: float64(i)}
+}
+
+func TestDataBuffer_BurstPersists(t *testing.T) {
+	saver := newRecordingSaver()
+	buffer := NewDataBuffer(saver, 10, 5, time.Hour)
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+
+	// The burst is larger than the capacity, so some enqueues wait for a flush
+	const burst = 50
+	for i := 0; i < burst; i++ {
+		require.NoError(t, buffer.Enqueue(context.Background(), testReading(i)))
+	}
+
+	// Full batches flush without waiting for the interval
+	assert.Eventually(t, func() bool { return saver.savedCount() == burst }, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, group.Stop(context.Background()))
+
+	stats := buffer.Stats()
+	assert.Equal(t, int64(burst), stats.Enqueued)
+	assert.Equal(t, int64(burst), stats.Flushed)
+	assert.Equal(t, 0, stats.Depth)
+	assert.Equal(t, 10, stats.Capacity)
+	for _, size := range saver.batches {
+		assert.LessOrEqual(t, size, 5)
+	}
+}
+
+func TestDataBuffer_DrainsOnStop(t *testing.T) {
+	saver := newRecordingSaver()
+	buffer := NewDataBuffer(saver, 100, 50, time.Hour)
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+
+	// Fewer readings than a batch, and the interval never passes
+	for i := 0; i < 7; i++ {
+		require.NoError(t, buffer.Enqueue(context.Background(), testReading(i)))
+	}
+
+	require.NoError(t, group.Stop(context.Background()))
+	assert.Equal(t, 7, saver.savedCount())
+	assert.Equal(t, 0, buffer.Stats().Depth)
+
+	assert.ErrorIs(t, buffer.Enqueue(context.Background(), testReading(99)), ErrBufferClosed)
+}
+
+func TestDataBuffer_FlushesOnInterval(t *testing.T) {
+	saver := newRecordingSaver()
+	buffer := NewDataBuffer(saver, 100, 50, 20*time.Millisecond)
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+	defer func() { _ = group.Stop(context.Background()) }()
+
+	require.NoError(t, buffer.Enqueue(context.Background(), testReading(1)))
+	assert.Eventually(t, func() bool { return saver.savedCount() == 1 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestDataBuffer_FullBufferBlocks(t *testing.T) {
+	buffer := NewDataBuffer(newRecordingSaver(), 1, 1, time.Hour)
+
+	// Without Run nothing drains the queue
+	require.NoError(t, buffer.Enqueue(context.Background(), testReading(1)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, buffer.Enqueue(ctx, testReading(2)), context.DeadlineExceeded)
+	assert.Equal(t, int64(1), buffer.Stats().Blocked)
+}
+
+func TestDataBuffer_SaveFailure(t *testing.T) {
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		return nil, assert.AnError
+	})
+	dataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		return false, assert.AnError
+	})
+	buffer := NewDataBuffer(dataRepo, 10, 2, time.Hour)
+	var rejected []string
+	buffer.SetRejectHandler(func(data *models.DeviceData, err error) {
+		rejected = append(rejected, data.ID)
+	})
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, buffer.Enqueue(context.Background(), testReading(i)))
+	}
+	require.NoError(t, group.Stop(context.Background()))
+
+	stats := buffer.Stats()
+	assert.Equal(t, int64(3), stats.Failed)
+	assert.Equal(t, int64(0), stats.Flushed)
+	assert.ElementsMatch(t, []string{"data-0", "data-1", "data-2"}, rejected)
+}
+
+func TestDataBuffer_BadRowDoesNotLoseBatch(t *testing.T) {
+	foreignKey := fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23503"})
+
+	// The batch fails on the reading of a deleted device; the others save on their own
+	saver := newRecordingSaver()
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		return nil, foreignKey
+	})
+	dataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		if data.DeviceID == "deleted-device" {
+			return false, foreignKey
+		}
+		return saver.SaveData(data)
+	})
+
+	buffer := NewDataBuffer(dataRepo, 10, 5, time.Hour)
+	var rejected []*models.DeviceData
+	buffer.SetRejectHandler(func(data *models.DeviceData, err error) {
+		assert.ErrorIs(t, err, foreignKey)
+		rejected = append(rejected, data)
+	})
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+	bad := testReading(2)
+	bad.DeviceID = "deleted-device"
+	for _, data := range []*models.DeviceData{testReading(0), testReading(1), bad, testReading(3), testReading(4)} {
+		require.NoError(t, buffer.Enqueue(context.Background(), data))
+	}
+	require.NoError(t, group.Stop(context.Background()))
+
+	assert.Equal(t, 4, saver.savedCount())
+	assert.Equal(t, []*models.DeviceData{bad}, rejected)
+
+	stats := buffer.Stats()
+	assert.Equal(t, int64(4), stats.Flushed)
+	assert.Equal(t, int64(1), stats.Failed)
+}
+
+func TestDataBuffer_TransientFailureRejectsBatch(t *testing.T) {
+	lost := fmt.Errorf("failed to save device data: %w", driver.ErrBadConn)
+
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		return nil, lost
+	})
+	dataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		t.Fatal("readings must not be saved one by one while the database is unreachable")
+		return false, nil
+	})
+
+	buffer := NewDataBuffer(dataRepo, 10, 5, time.Hour)
+	rejected := 0
+	buffer.SetRejectHandler(func(*models.DeviceData, error) { rejected++ })
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, buffer.Enqueue(context.Background(), testReading(i)))
+	}
+	require.NoError(t, group.Stop(context.Background()))
+
+	assert.Equal(t, 3, rejected)
+	assert.Equal(t, int64(3), buffer.Stats().Failed)
+}
+
+func TestDataBuffer_StoredRowsOfFailedBatchCountAsSaved(t *testing.T) {
+	unique := fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23505"})
+	foreignKey := fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23503"})
+
+	// The batch stored its first reading before failing; an earlier attempt had already stored the second,
+	// so saving it again hits the primary key
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		return data[:1], foreignKey
+	})
+	dataRepo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		if data.ID == "data-0" {
+			t.Error("a reading the batch stored must not be saved again")
+		}
+		return false, unique
+	})
+
+	buffer := NewDataBuffer(dataRepo, 10, 2, time.Hour)
+	var saved []string
+	buffer.SetSaveHandler(func(data *models.DeviceData) {
+		saved = append(saved, data.ID)
+	})
+	buffer.SetRejectHandler(func(data *models.DeviceData, err error) {
+		t.Errorf("reading %s must not be rejected: %v", data.ID, err)
+	})
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, buffer.Enqueue(context.Background(), testReading(i)))
+	}
+	require.NoError(t, group.Stop(context.Background()))
+
+	assert.Equal(t, int64(2), buffer.Stats().Flushed)
+	assert.Equal(t, []string{"data-0", "data-1"}, saved)
+}
+
+func TestDataBuffer_SaveHandlerSkipsDuplicates(t *testing.T) {
+	// Readings whose dedup key was already stored are dropped by the batch insert
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetSaveDataBatchFunc(func(data []*models.DeviceData) ([]*models.DeviceData, error) {
+		inserted := []*models.DeviceData{}
+		for _, d := range data {
+			if d.DedupKey != "seen" {
+				inserted = append(inserted, d)
+			}
+		}
+		return inserted, nil
+	})
+
+	buffer := NewDataBuffer(dataRepo, 10, 3, time.Hour)
+	var saved []string
+	buffer.SetSaveHandler(func(data *models.DeviceData) {
+		saved = append(saved, data.ID)
+	})
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+	duplicate := testReading(1)
+	duplicate.DedupKey = "seen"
+	for _, data := range []*models.DeviceData{testReading(0), duplicate, testReading(2)} {
+		require.NoError(t, buffer.Enqueue(context.Background(), data))
+	}
+	require.NoError(t, group.Stop(context.Background()))
+
+	assert.Equal(t, []string{"data-0", "data-2"}, saved)
+	assert.Equal(t, int64(3), buffer.Stats().Flushed)
+}
+
+func TestDataBuffer_EnqueueDuringShutdownIsNotLost(t *testing.T) {
+	saver := newRecordingSaver()
+	buffer := NewDataBuffer(saver, 4, 2, time.Hour)
+
+	group := background.NewGroup()
+	group.Go(buffer.Run)
+
+	// Enqueue from several goroutines while the buffer stops; every accepted reading must be saved
+	var accepted atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				data := testReading(g*100000 + i)
+				if err := buffer.Enqueue(context.Background(), data); err != nil {
+					assert.ErrorIs(t, err, ErrBufferClosed)
+					return
+				}
+				accepted.Add(1)
+			}
+		}(g)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, group.Stop(context.Background()))
+	wg.Wait()
+
+	assert.Positive(t, accepted.Load())
+	assert.Equal(t, int(accepted.Load()), saver.savedCount())
+	assert.Equal(t, 0, buffer.Stats().Depth)
+}
@@ -2,61 +2,212 @@ package device
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"iot-platform-go/internal/database"
 	"iot-platform-go/pkg/models"
+
+	"github.com/lib/pq"
 )
 
 // DataRepositoryInterface defines the interface for device data repository operations
 type DataRepositoryInterface interface {
-	SaveData(data *models.DeviceData) error
-	GetDeviceData(deviceID string, limit int) ([]*models.DeviceData, error)
-	GetDeviceDataByType(deviceID string, dataType string, limit int) ([]*models.DeviceData, error)
+	SaveData(data *models.DeviceData) (bool, error)
+	SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error)
+	GetDeviceData(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error)
+	GetDeviceDataByType(deviceID string, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error)
+	GetRecentByTypes(deviceID string, types []string, perType int) (map[string][]*models.DeviceData, error)
+	GetDataByTypeAllDevices(dataType string, start, end time.Time, limit int) ([]*models.DeviceData, error)
+	GetDataByMetadata(deviceID, key, value string, limit int) ([]*models.DeviceData, error)
 	GetLatestData(deviceID string) (*models.DeviceData, error)
-	DeleteOldData(deviceID string, olderThan time.Time) error
+	GetDataBounds(deviceID string) (first, last time.Time, err error)
+	GetDataTypes(deviceID string) ([]string, error)
+	GetDataCount(deviceID string, dataType string, start, end time.Time) (int, error)
+	GetDownsampled(deviceID string, dataType string, start, end time.Time, buckets int) ([]*models.DataPoint, error)
+	DeleteOldData(deviceID string, olderThan time.Time) (int64, error)
+	DeleteExpiredData(defaultDays int, now time.Time) (int64, error)
 }
 
+// ErrNoData is returned when a device has no data to return
+var ErrNoData = errors.New("no data found for device")
+
+// maxBatchRows caps the rows per INSERT in SaveDataBatch, keeping it well under
+// PostgreSQL's limit of 65535 bind parameters
+const maxBatchRows = 1000
+
 // DataRepository handles database operations for device data
 type DataRepository struct {
-	db *database.Database
+	db    database.Querier
+	conn  *database.Database // nil when bound to a transaction
+	units *UnitNormalizer
 }
 
 // NewDataRepository creates a new device data repository
 func NewDataRepository(db *database.Database) *DataRepository {
-	return &DataRepository{db: db}
+	return &DataRepository{db: db, conn: db}
+}
+
+// WithTx returns a repository that runs its queries in tx
+func (r *DataRepository) WithTx(tx *sql.Tx) *DataRepository {
+	return &DataRepository{db: tx, units: r.units}
+}
+
+// SetUnitNormalizer sets the normalizer applied to units before saving; nil disables normalization
+func (r *DataRepository) SetUnitNormalizer(units *UnitNormalizer) {
+	r.units = units
 }
 
-// SaveData saves device data to the database
-func (r *DataRepository) SaveData(data *models.DeviceData) error {
+// SaveData saves device data to the database.
+// Readings carrying a dedup key that was already stored for the device are ignored,
+// so redelivered messages do not create duplicates. The returned flag reports whether a new row was inserted.
+func (r *DataRepository) SaveData(data *models.DeviceData) (bool, error) {
+	defer startQueryTimer("data.save").observe()
+
+	if r.units != nil {
+		data.Unit = r.units.Normalize(data.DataType, data.Unit)
+	}
+
 	query := `
-		INSERT INTO device_data (id, device_id, timestamp, data_type, value, unit, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO device_data (id, device_id, timestamp, data_type, value, unit, metadata, dedup_key)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::jsonb, NULLIF($8, ''))
+		ON CONFLICT (device_id, dedup_key) DO NOTHING
 	`
 
-	_, err := r.db.Exec(query, data.ID, data.DeviceID, data.Timestamp, data.DataType, data.Value, data.Unit, data.Metadata)
+	result, err := r.db.Exec(query, data.ID, data.DeviceID, data.Timestamp, data.DataType, data.Value, data.Unit,
+		data.Metadata, data.DedupKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to save device data: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to save device data: %w", err)
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// SaveDataBatch saves several readings with multi-row inserts.
+// Like SaveData, readings whose dedup key was already stored are ignored; the inserted readings are returned,
+// including those inserted before an error.
+func (r *DataRepository) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	defer startQueryTimer("data.save_batch").observe()
+
+	inserted := make([]*models.DeviceData, 0, len(data))
+	for start := 0; start < len(data); start += maxBatchRows {
+		end := start + maxBatchRows
+		if end > len(data) {
+			end = len(data)
+		}
+
+		rows, err := r.insertBatch(data[start:end])
+		if err != nil {
+			return inserted, err
+		}
+		inserted = append(inserted, rows...)
 	}
 
-	return nil
+	return inserted, nil
 }
 
-// GetDeviceData retrieves device data with limit
-func (r *DataRepository) GetDeviceData(deviceID string, limit int) ([]*models.DeviceData, error) {
+// insertBatch inserts the readings in a single statement and returns those that were inserted
+func (r *DataRepository) insertBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	const columns = 8
+
+	values := make([]string, 0, len(data))
+	args := make([]interface{}, 0, len(data)*columns)
+	for i, d := range data {
+		if r.units != nil {
+			d.Unit = r.units.Normalize(d.DataType, d.Unit)
+		}
+
+		p := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, NULLIF($%d, '')::jsonb, NULLIF($%d, ''))",
+			p+1, p+2, p+3, p+4, p+5, p+6, p+7, p+8))
+		args = append(args, d.ID, d.DeviceID, d.Timestamp, d.DataType, d.Value, d.Unit, d.Metadata, d.DedupKey)
+	}
+
 	query := `
-		SELECT id, device_id, timestamp, data_type, value, unit, metadata
-		FROM device_data 
-		WHERE device_id = $1
-		ORDER BY timestamp DESC
-		LIMIT $2
+		INSERT INTO device_data (id, device_id, timestamp, data_type, value, unit, metadata, dedup_key)
+		VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (device_id, dedup_key) DO NOTHING
+		RETURNING id
 	`
 
-	rows, err := r.db.Query(query, deviceID, limit)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save device data batch: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool, len(data))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan inserted device data id: %w", err)
+		}
+		ids[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to save device data batch: %w", err)
+	}
+
+	inserted := make([]*models.DeviceData, 0, len(ids))
+	for _, d := range data {
+		if ids[d.ID] {
+			inserted = append(inserted, d)
+		}
+	}
+	return inserted, nil
+}
+
+// GetDeviceData retrieves device data between start and end, newest first, paginated with limit and offset.
+// A zero start or end leaves that side of the range open.
+func (r *DataRepository) GetDeviceData(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+	defer startQueryTimer("data.list").observe()
+
+	data, err := r.listDeviceData(deviceID, "", start, end, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query device data: %w", err)
 	}
+	return data, nil
+}
+
+// GetDeviceDataByType retrieves device data of one data type between start and end, newest first,
+// paginated with limit and offset. A zero start or end leaves that side of the range open.
+func (r *DataRepository) GetDeviceDataByType(deviceID string, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+	defer startQueryTimer("data.list_by_type").observe()
+
+	data, err := r.listDeviceData(deviceID, dataType, start, end, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device data by type: %w", err)
+	}
+	return data, nil
+}
+
+// listDeviceData runs the query shared by GetDeviceData and GetDeviceDataByType
+func (r *DataRepository) listDeviceData(deviceID string, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
+	where, args := dataFilter(deviceID, dataType, start, end)
+	args = append(args, limit, offset)
+	n := len(args)
+
+	query := fmt.Sprintf(`
+		SELECT id, device_id, timestamp, data_type, value, unit, COALESCE(metadata::text, '')
+		FROM device_data
+		WHERE %s
+		ORDER BY timestamp DESC
+		LIMIT $%d OFFSET $%d
+	`, where, n-1, n)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var data []*models.DeviceData
@@ -84,23 +235,130 @@ func (r *DataRepository) GetDeviceData(deviceID string, limit int) ([]*models.De
 	return data, nil
 }
 
-// GetDeviceDataByType retrieves device data filtered by data type
-func (r *DataRepository) GetDeviceDataByType(deviceID string, dataType string, limit int) ([]*models.DeviceData, error) {
+// GetRecentByTypes retrieves the perType most recent readings of each data type, newest first.
+// An empty types list includes every data type of the device.
+func (r *DataRepository) GetRecentByTypes(deviceID string, types []string, perType int) (map[string][]*models.DeviceData, error) {
+	defer startQueryTimer("data.recent_by_types").observe()
+
+	if perType <= 0 {
+		return nil, fmt.Errorf("perType must be positive")
+	}
+	// A nil slice would be sent as NULL rather than an empty array
+	if types == nil {
+		types = []string{}
+	}
+
 	query := `
-		SELECT id, device_id, timestamp, data_type, value, unit, metadata
-		FROM device_data 
-		WHERE device_id = $1 AND data_type = $2
+		SELECT id, device_id, timestamp, data_type, value, unit, COALESCE(metadata::text, '')
+		FROM (
+			SELECT id, device_id, timestamp, data_type, value, unit, metadata,
+				ROW_NUMBER() OVER (PARTITION BY data_type ORDER BY timestamp DESC) AS rn
+			FROM device_data
+			WHERE device_id = $1 AND (cardinality($2::text[]) = 0 OR data_type = ANY($2::text[]))
+		) ranked
+		WHERE rn <= $3
+		ORDER BY data_type, timestamp DESC
+	`
+
+	rows, err := r.db.Query(query, deviceID, pq.Array(types), perType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent device data: %w", err)
+	}
+	defer rows.Close()
+
+	data := make(map[string][]*models.DeviceData)
+	for rows.Next() {
+		item := &models.DeviceData{}
+		err := rows.Scan(
+			&item.ID,
+			&item.DeviceID,
+			&item.Timestamp,
+			&item.DataType,
+			&item.Value,
+			&item.Unit,
+			&item.Metadata,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device data: %w", err)
+		}
+		data[item.DataType] = append(data[item.DataType], item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return data, nil
+}
+
+// GetDataByTypeAllDevices retrieves readings of one data type across every device between start and end, newest first
+func (r *DataRepository) GetDataByTypeAllDevices(dataType string, start, end time.Time, limit int) ([]*models.DeviceData, error) {
+	defer startQueryTimer("data.list_by_type_all").observe()
+
+	query := `
+		SELECT id, device_id, timestamp, data_type, value, unit, COALESCE(metadata::text, '')
+		FROM device_data
+		WHERE data_type = $1 AND timestamp >= $2 AND timestamp <= $3
+		ORDER BY timestamp DESC, device_id
+		LIMIT $4
+	`
+
+	rows, err := r.db.Query(query, dataType, start, end, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data by type: %w", err)
+	}
+	defer rows.Close()
+
+	data := []*models.DeviceData{}
+	for rows.Next() {
+		item := &models.DeviceData{}
+		err := rows.Scan(
+			&item.ID,
+			&item.DeviceID,
+			&item.Timestamp,
+			&item.DataType,
+			&item.Value,
+			&item.Unit,
+			&item.Metadata,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device data: %w", err)
+		}
+		data = append(data, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return data, nil
+}
+
+// GetDataByMetadata retrieves a device's readings whose metadata sets key to value, newest first.
+// A value that is itself JSON also matches that JSON value, so "true" finds {"door_open": true} as well as {"door_open": "true"}.
+func (r *DataRepository) GetDataByMetadata(deviceID, key, value string, limit int) ([]*models.DeviceData, error) {
+	defer startQueryTimer("data.list_by_metadata").observe()
+
+	asString, asJSON, err := metadataFilters(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, device_id, timestamp, data_type, value, unit, COALESCE(metadata::text, '')
+		FROM device_data
+		WHERE device_id = $1 AND (metadata @> $2::jsonb OR metadata @> $3::jsonb)
 		ORDER BY timestamp DESC
-		LIMIT $3
+		LIMIT $4
 	`
 
-	rows, err := r.db.Query(query, deviceID, dataType, limit)
+	rows, err := r.db.Query(query, deviceID, asString, asJSON, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query device data by type: %w", err)
+		return nil, fmt.Errorf("failed to query data by metadata: %w", err)
 	}
 	defer rows.Close()
 
-	var data []*models.DeviceData
+	data := []*models.DeviceData{}
 	for rows.Next() {
 		item := &models.DeviceData{}
 		err := rows.Scan(
@@ -125,10 +383,35 @@ func (r *DataRepository) GetDeviceDataByType(deviceID string, dataType string, l
 	return data, nil
 }
 
-// GetLatestData retrieves the most recent data for a device
+// metadataFilters builds the JSON documents a reading's metadata must contain to set key to value:
+// one with value as a string, and one with value as JSON when it is valid JSON (otherwise the same document)
+func metadataFilters(key, value string) (asString, asJSON string, err error) {
+	if key == "" {
+		return "", "", fmt.Errorf("metadata key must not be empty")
+	}
+
+	doc, err := json.Marshal(map[string]string{key: value})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode metadata filter: %w", err)
+	}
+	asString = string(doc)
+
+	if !json.Valid([]byte(value)) {
+		return asString, asString, nil
+	}
+	doc, err = json.Marshal(map[string]json.RawMessage{key: json.RawMessage(value)})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode metadata filter: %w", err)
+	}
+	return asString, string(doc), nil
+}
+
+// GetLatestData retrieves the most recent data for a device, or ErrNoData when it has none
 func (r *DataRepository) GetLatestData(deviceID string) (*models.DeviceData, error) {
+	defer startQueryTimer("data.latest").observe()
+
 	query := `
-		SELECT id, device_id, timestamp, data_type, value, unit, metadata
+		SELECT id, device_id, timestamp, data_type, value, unit, COALESCE(metadata::text, '')
 		FROM device_data 
 		WHERE device_id = $1
 		ORDER BY timestamp DESC
@@ -147,7 +430,7 @@ func (r *DataRepository) GetLatestData(deviceID string) (*models.DeviceData, err
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no data found for device")
+			return nil, ErrNoData
 		}
 		return nil, fmt.Errorf("failed to get latest device data: %w", err)
 	}
@@ -155,20 +438,245 @@ func (r *DataRepository) GetLatestData(deviceID string) (*models.DeviceData, err
 	return data, nil
 }
 
-// DeleteOldData deletes device data older than the specified time
-func (r *DataRepository) DeleteOldData(deviceID string, olderThan time.Time) error {
-	query := `DELETE FROM device_data WHERE device_id = $1 AND timestamp < $2`
+// GetDataBounds returns the timestamps of a device's first and last readings, or ErrNoData when it has none
+func (r *DataRepository) GetDataBounds(deviceID string) (first, last time.Time, err error) {
+	defer startQueryTimer("data.bounds").observe()
+
+	query := `
+		SELECT MIN(timestamp), MAX(timestamp)
+		FROM device_data
+		WHERE device_id = $1
+	`
+
+	var minTimestamp, maxTimestamp sql.NullTime
+	if err := r.db.QueryRow(query, deviceID).Scan(&minTimestamp, &maxTimestamp); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get device data bounds: %w", err)
+	}
+	if !minTimestamp.Valid || !maxTimestamp.Valid {
+		return time.Time{}, time.Time{}, ErrNoData
+	}
+
+	return minTimestamp.Time, maxTimestamp.Time, nil
+}
+
+// GetDataTypes retrieves the distinct data types a device has reported
+func (r *DataRepository) GetDataTypes(deviceID string) ([]string, error) {
+	defer startQueryTimer("data.types").observe()
+
+	query := `
+		SELECT DISTINCT data_type
+		FROM device_data
+		WHERE device_id = $1
+		ORDER BY data_type
+	`
+
+	rows, err := r.db.Query(query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device data types: %w", err)
+	}
+	defer rows.Close()
+
+	dataTypes := []string{}
+	for rows.Next() {
+		var dataType string
+		if err := rows.Scan(&dataType); err != nil {
+			return nil, fmt.Errorf("failed to scan device data type: %w", err)
+		}
+		dataTypes = append(dataTypes, dataType)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return dataTypes, nil
+}
+
+// GetDataCount returns the number of data points stored for a device.
+// An empty device ID counts every device; an empty data type or zero start/end time leaves that filter out.
+func (r *DataRepository) GetDataCount(deviceID string, dataType string, start, end time.Time) (int, error) {
+	defer startQueryTimer("data.count").observe()
+
+	where, args := dataFilter(deviceID, dataType, start, end)
+	query := `SELECT COUNT(*) FROM device_data WHERE ` + where
+
+	var count int
+	if err := r.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count device data: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetDownsampled returns device data between start and end averaged into at most buckets points per data type.
+// When the range holds no more readings than buckets, the raw readings are returned as single-value points.
+func (r *DataRepository) GetDownsampled(deviceID string, dataType string, start, end time.Time, buckets int) ([]*models.DataPoint, error) {
+	defer startQueryTimer("data.downsample").observe()
+
+	if buckets <= 0 {
+		return nil, fmt.Errorf("buckets must be positive")
+	}
+	if start.IsZero() || end.IsZero() || !start.Before(end) {
+		return nil, fmt.Errorf("start must be before end")
+	}
+
+	count, err := r.GetDataCount(deviceID, dataType, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if count <= buckets {
+		return r.getRawPoints(deviceID, dataType, start, end)
+	}
+
+	where, args := dataFilter(deviceID, dataType, start, end)
+	args = append(args, start, end, buckets)
+	n := len(args)
+
+	// Readings exactly at end fall into width_bucket's overflow bucket, so clamp them into the last one
+	query := fmt.Sprintf(`
+		SELECT data_type,
+			LEAST(width_bucket(EXTRACT(EPOCH FROM timestamp),
+				EXTRACT(EPOCH FROM $%d::timestamp), EXTRACT(EPOCH FROM $%d::timestamp), $%d::int), $%d::int) AS bucket,
+			AVG(value), MIN(value), MAX(value), COUNT(*)
+		FROM device_data
+		WHERE %s
+		GROUP BY data_type, bucket
+		ORDER BY bucket, data_type
+	`, n-2, n-1, n, n, where)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query downsampled device data: %w", err)
+	}
+	defer rows.Close()
+
+	points := []*models.DataPoint{}
+	for rows.Next() {
+		point := &models.DataPoint{}
+		var bucket int
+		if err := rows.Scan(&point.DataType, &bucket, &point.Value, &point.Min, &point.Max, &point.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan downsampled device data: %w", err)
+		}
+		point.Timestamp = bucketStart(start, end, buckets, bucket)
+		points = append(points, point)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return points, nil
+}
+
+// getRawPoints returns the readings between start and end as single-value data points
+func (r *DataRepository) getRawPoints(deviceID string, dataType string, start, end time.Time) ([]*models.DataPoint, error) {
+	where, args := dataFilter(deviceID, dataType, start, end)
+	query := `SELECT timestamp, data_type, value FROM device_data WHERE ` + where + ` ORDER BY timestamp, data_type`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device data: %w", err)
+	}
+	defer rows.Close()
+
+	points := []*models.DataPoint{}
+	for rows.Next() {
+		point := &models.DataPoint{Count: 1}
+		if err := rows.Scan(&point.Timestamp, &point.DataType, &point.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan device data: %w", err)
+		}
+		point.Min = point.Value
+		point.Max = point.Value
+		points = append(points, point)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return points, nil
+}
+
+// bucketStart returns the start time of a 1-based bucket when [start, end] is split into buckets equal parts
+func bucketStart(start, end time.Time, buckets, bucket int) time.Time {
+	width := end.Sub(start) / time.Duration(buckets)
+	return start.Add(time.Duration(bucket-1) * width)
+}
+
+// dataFilter builds the WHERE clause and arguments shared by device data queries.
+// An empty device ID, data type or zero start/end time leaves that predicate out.
+func dataFilter(deviceID string, dataType string, start, end time.Time) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if deviceID != "" {
+		args = append(args, deviceID)
+		conditions = append(conditions, fmt.Sprintf("device_id = $%d", len(args)))
+	}
+
+	if dataType != "" {
+		args = append(args, dataType)
+		conditions = append(conditions, fmt.Sprintf("data_type = $%d", len(args)))
+	}
+
+	if !start.IsZero() {
+		args = append(args, start)
+		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", len(args)))
+	}
+
+	if !end.IsZero() {
+		args = append(args, end)
+		conditions = append(conditions, fmt.Sprintf("timestamp <= $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// DeleteOldData deletes device data older than the specified time and returns the number of deleted rows.
+// An empty deviceID deletes the old data of every device.
+func (r *DataRepository) DeleteOldData(deviceID string, olderThan time.Time) (int64, error) {
+	defer startQueryTimer("data.delete_old").observe()
+
+	query := `DELETE FROM device_data WHERE ($1 = '' OR device_id::text = $1) AND timestamp < $2`
 
 	result, err := r.db.Exec(query, deviceID, olderThan)
 	if err != nil {
-		return fmt.Errorf("failed to delete old device data: %w", err)
+		return 0, fmt.Errorf("failed to delete old device data: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// DeleteExpiredData deletes, for every device, the data older than the device's retention_days,
+// or defaultDays for devices without one. Data of devices whose effective retention is 0 is kept.
+func (r *DataRepository) DeleteExpiredData(defaultDays int, now time.Time) (int64, error) {
+	defer startQueryTimer("data.delete_expired").observe()
+
+	query := `
+		DELETE FROM device_data d
+		USING devices v
+		WHERE d.device_id = v.id
+			AND COALESCE(v.retention_days, $1) > 0
+			AND d.timestamp < $2::timestamp - make_interval(days => COALESCE(v.retention_days, $1))
+	`
+
+	result, err := r.db.Exec(query, defaultDays, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired device data: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
-	fmt.Printf("Deleted %d old data records for device %s", rowsAffected, deviceID)
-	return nil
+	return rowsAffected, nil
 }
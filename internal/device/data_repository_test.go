@@ -0,0 +1,694 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestDeviceData(deviceID string, timestamp time.Time) *models.DeviceData {
+	return &models.DeviceData{
+		ID:        uuid.New().String(),
+		DeviceID:  deviceID,
+		Timestamp: timestamp,
+		DataType:  "temperature",
+		Value:     25.5,
+		Unit:      "celsius",
+	}
+}
+
+func TestDataRepository_SaveData(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	t.Run("same reading with dedup key is stored once", func(t *testing.T) {
+		timestamp := time.Now().UTC().Truncate(time.Second)
+
+		first := createTestDeviceData(createdDevice.ID, timestamp)
+		first.DedupKey = "seq-1:temperature"
+		inserted, err := dataRepo.SaveData(first)
+		require.NoError(t, err)
+		assert.True(t, inserted)
+
+		// 再送されたメッセージはIDが異なっても同じdedup keyを持つ
+		replay := createTestDeviceData(createdDevice.ID, timestamp)
+		replay.DedupKey = "seq-1:temperature"
+		inserted, err = dataRepo.SaveData(replay)
+		require.NoError(t, err)
+		assert.False(t, inserted)
+
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM device_data WHERE device_id = $1 AND dedup_key = $2",
+			createdDevice.ID, "seq-1:temperature").Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("readings without dedup key are always stored", func(t *testing.T) {
+		timestamp := time.Now().UTC().Truncate(time.Second)
+
+		for i := 0; i < 2; i++ {
+			inserted, err := dataRepo.SaveData(createTestDeviceData(createdDevice.ID, timestamp))
+			require.NoError(t, err)
+			assert.True(t, inserted)
+		}
+
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM device_data WHERE device_id = $1 AND dedup_key IS NULL",
+			createdDevice.ID).Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+}
+
+func TestDataRepository_SaveDataBatch(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 1回のINSERTの上限を超える件数を用意し、1件は保存済みのdedup keyと重複させる
+	timestamp := time.Now().UTC().Truncate(time.Second)
+	existing := createTestDeviceData(createdDevice.ID, timestamp)
+	existing.DedupKey = "seq-1:temperature"
+	_, err = dataRepo.SaveData(existing)
+	require.NoError(t, err)
+
+	batch := make([]*models.DeviceData, 0, maxBatchRows+5)
+	for i := 0; i < maxBatchRows+5; i++ {
+		batch = append(batch, createTestDeviceData(createdDevice.ID, timestamp.Add(time.Duration(i)*time.Second)))
+	}
+	batch[0].DedupKey = "seq-1:temperature"
+
+	inserted, err := dataRepo.SaveDataBatch(batch)
+	require.NoError(t, err)
+	assert.Len(t, inserted, maxBatchRows+4)
+	assert.NotContains(t, inserted, batch[0])
+
+	count, err := dataRepo.GetDataCount(createdDevice.ID, "", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, maxBatchRows+5, count)
+}
+
+func TestDataRepository_GetDataTypes(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 複数の種類のデータを登録
+	for _, dataType := range []string{"temperature", "humidity", "temperature", "pressure", "humidity"} {
+		data := createTestDeviceData(createdDevice.ID, time.Now())
+		data.DataType = dataType
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	t.Run("distinct types for device with mixed readings", func(t *testing.T) {
+		dataTypes, err := dataRepo.GetDataTypes(createdDevice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"humidity", "pressure", "temperature"}, dataTypes)
+	})
+
+	t.Run("device without readings", func(t *testing.T) {
+		otherDevice, err := repo.Create(createTestDeviceRequest())
+		require.NoError(t, err)
+
+		dataTypes, err := dataRepo.GetDataTypes(otherDevice.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, dataTypes)
+	})
+}
+
+func TestDataRepository_GetDataBounds(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 順不同でデータを登録
+	base := time.Now().UTC().Truncate(time.Second)
+	for _, offset := range []time.Duration{2 * time.Hour, 0, time.Hour} {
+		_, err := dataRepo.SaveData(createTestDeviceData(createdDevice.ID, base.Add(-offset)))
+		require.NoError(t, err)
+	}
+
+	t.Run("device with data", func(t *testing.T) {
+		first, last, err := dataRepo.GetDataBounds(createdDevice.ID)
+		require.NoError(t, err)
+		assert.True(t, base.Add(-2*time.Hour).Equal(first.UTC()))
+		assert.True(t, base.Equal(last.UTC()))
+	})
+
+	t.Run("device without data", func(t *testing.T) {
+		otherDevice, err := repo.Create(createTestDeviceRequest())
+		require.NoError(t, err)
+
+		_, _, err = dataRepo.GetDataBounds(otherDevice.ID)
+		assert.ErrorIs(t, err, ErrNoData)
+	})
+}
+
+func TestDataFilter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		dataType      string
+		start         time.Time
+		end           time.Time
+		expectedWhere string
+		expectedArgs  []interface{}
+	}{
+		{
+			name:          "device only",
+			expectedWhere: "device_id = $1",
+			expectedArgs:  []interface{}{"device-1"},
+		},
+		{
+			name:          "with data type",
+			dataType:      "temperature",
+			expectedWhere: "device_id = $1 AND data_type = $2",
+			expectedArgs:  []interface{}{"device-1", "temperature"},
+		},
+		{
+			name:          "with start only",
+			start:         start,
+			expectedWhere: "device_id = $1 AND timestamp >= $2",
+			expectedArgs:  []interface{}{"device-1", start},
+		},
+		{
+			name:          "with end only",
+			end:           end,
+			expectedWhere: "device_id = $1 AND timestamp <= $2",
+			expectedArgs:  []interface{}{"device-1", end},
+		},
+		{
+			name:          "with range",
+			start:         start,
+			end:           end,
+			expectedWhere: "device_id = $1 AND timestamp >= $2 AND timestamp <= $3",
+			expectedArgs:  []interface{}{"device-1", start, end},
+		},
+		{
+			name:          "with data type and range",
+			dataType:      "temperature",
+			start:         start,
+			end:           end,
+			expectedWhere: "device_id = $1 AND data_type = $2 AND timestamp >= $3 AND timestamp <= $4",
+			expectedArgs:  []interface{}{"device-1", "temperature", start, end},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := dataFilter("device-1", tt.dataType, tt.start, tt.end)
+			assert.Equal(t, tt.expectedWhere, where)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestDataFilter_AllDevices(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	where, args := dataFilter("", "", time.Time{}, time.Time{})
+	assert.Equal(t, "TRUE", where)
+	assert.Empty(t, args)
+
+	where, args = dataFilter("", "temperature", start, time.Time{})
+	assert.Equal(t, "data_type = $1 AND timestamp >= $2", where)
+	assert.Equal(t, []interface{}{"temperature", start}, args)
+}
+
+func TestDataRepository_GetDataCount(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	base := time.Now().UTC().Truncate(time.Second)
+	for i, dataType := range []string{"temperature", "humidity", "temperature"} {
+		data := createTestDeviceData(createdDevice.ID, base.Add(time.Duration(i)*time.Hour))
+		data.DataType = dataType
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	t.Run("all data", func(t *testing.T) {
+		count, err := dataRepo.GetDataCount(createdDevice.ID, "", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("by data type", func(t *testing.T) {
+		count, err := dataRepo.GetDataCount(createdDevice.ID, "temperature", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("by time range", func(t *testing.T) {
+		count, err := dataRepo.GetDataCount(createdDevice.ID, "", base.Add(30*time.Minute), base.Add(90*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("by data type and time range", func(t *testing.T) {
+		count, err := dataRepo.GetDataCount(createdDevice.ID, "temperature", base.Add(30*time.Minute), time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestMetadataFilters(t *testing.T) {
+	tests := []struct {
+		key, value       string
+		asString, asJSON string
+	}{
+		{"quality", "good", `{"quality":"good"}`, `{"quality":"good"}`},
+		{"door_open", "true", `{"door_open":"true"}`, `{"door_open":true}`},
+		{"channel", "3", `{"channel":"3"}`, `{"channel":3}`},
+		{"note", `say "hi"`, `{"note":"say \"hi\""}`, `{"note":"say \"hi\""}`},
+	}
+
+	for _, tt := range tests {
+		asString, asJSON, err := metadataFilters(tt.key, tt.value)
+		require.NoError(t, err)
+		assert.Equal(t, tt.asString, asString, tt.key)
+		assert.Equal(t, tt.asJSON, asJSON, tt.key)
+	}
+
+	_, _, err := metadataFilters("", "good")
+	assert.Error(t, err)
+}
+
+func TestDataRepository_GetDataByMetadata(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// さまざまなメタデータを持つデータを登録
+	base := time.Now().UTC().Truncate(time.Second)
+	for i, metadata := range []string{
+		`{"quality": "good"}`,
+		`{"quality": "bad"}`,
+		`{"quality": "good", "door_open": true}`,
+		`{"door_open": "true"}`,
+		"",
+	} {
+		data := createTestDeviceData(createdDevice.ID, base.Add(time.Duration(i)*time.Minute))
+		data.Metadata = metadata
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	t.Run("string value", func(t *testing.T) {
+		data, err := dataRepo.GetDataByMetadata(createdDevice.ID, "quality", "good", 10)
+		require.NoError(t, err)
+		require.Len(t, data, 2)
+		// 新しい順に返される
+		assert.True(t, data[0].Timestamp.After(data[1].Timestamp))
+	})
+
+	t.Run("matches both string and boolean", func(t *testing.T) {
+		data, err := dataRepo.GetDataByMetadata(createdDevice.ID, "door_open", "true", 10)
+		require.NoError(t, err)
+		assert.Len(t, data, 2)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		data, err := dataRepo.GetDataByMetadata(createdDevice.ID, "quality", "good", 1)
+		require.NoError(t, err)
+		assert.Len(t, data, 1)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		data, err := dataRepo.GetDataByMetadata(createdDevice.ID, "quality", "unknown", 10)
+		require.NoError(t, err)
+		assert.Empty(t, data)
+	})
+}
+
+func TestBucketStart(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	assert.Equal(t, start, bucketStart(start, end, 24, 1))
+	assert.Equal(t, start.Add(time.Hour), bucketStart(start, end, 24, 2))
+	assert.Equal(t, start.Add(23*time.Hour), bucketStart(start, end, 24, 24))
+	assert.Equal(t, start.Add(12*time.Hour), bucketStart(start, end, 2, 2))
+}
+
+func TestDataRepository_GetDownsampled(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 1分ごとに4時間分のデータを登録 (値は経過分数)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Hour)
+	for i := 0; i < 240; i++ {
+		data := createTestDeviceData(createdDevice.ID, start.Add(time.Duration(i)*time.Minute))
+		data.Value = float64(i)
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	// 10分ごとに humidity も登録 (type 指定時は集計に含まれないこと)
+	for i := 0; i < 24; i++ {
+		data := createTestDeviceData(createdDevice.ID, start.Add(time.Duration(i)*10*time.Minute))
+		data.DataType = "humidity"
+		data.Value = 50
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	t.Run("averages readings into hourly buckets", func(t *testing.T) {
+		points, err := dataRepo.GetDownsampled(createdDevice.ID, "temperature", start, end, 4)
+		require.NoError(t, err)
+		require.Len(t, points, 4)
+
+		for i, point := range points {
+			// 各バケットは60件、値は i*60 から i*60+59 の平均
+			assert.Equal(t, start.Add(time.Duration(i)*time.Hour), point.Timestamp)
+			assert.Equal(t, 60, point.Count)
+			assert.InDelta(t, float64(i*60)+29.5, point.Value, 0.0001)
+			assert.Equal(t, float64(i*60), point.Min)
+			assert.Equal(t, float64(i*60+59), point.Max)
+		}
+	})
+
+	t.Run("never returns more points than buckets", func(t *testing.T) {
+		points, err := dataRepo.GetDownsampled(createdDevice.ID, "temperature", start, end, 7)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(points), 7)
+
+		total := 0
+		for _, point := range points {
+			total += point.Count
+		}
+		assert.Equal(t, 240, total)
+	})
+
+	t.Run("type filter leaves other types out", func(t *testing.T) {
+		points, err := dataRepo.GetDownsampled(createdDevice.ID, "humidity", start, end, 4)
+		require.NoError(t, err)
+		require.Len(t, points, 4)
+
+		for _, point := range points {
+			assert.Equal(t, "humidity", point.DataType)
+			assert.Equal(t, 6, point.Count)
+			assert.Equal(t, float64(50), point.Value)
+		}
+	})
+
+	t.Run("without type buckets every type separately", func(t *testing.T) {
+		points, err := dataRepo.GetDownsampled(createdDevice.ID, "", start, end, 4)
+		require.NoError(t, err)
+		require.Len(t, points, 8)
+
+		totals := map[string]int{}
+		for _, point := range points {
+			totals[point.DataType] += point.Count
+		}
+		assert.Equal(t, map[string]int{"temperature": 240, "humidity": 24}, totals)
+	})
+
+	t.Run("small range falls back to raw data", func(t *testing.T) {
+		points, err := dataRepo.GetDownsampled(createdDevice.ID, "temperature", start, start.Add(9*time.Minute), 100)
+		require.NoError(t, err)
+		require.Len(t, points, 10)
+
+		for i, point := range points {
+			assert.Equal(t, 1, point.Count)
+			assert.Equal(t, float64(i), point.Value)
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := dataRepo.GetDownsampled(createdDevice.ID, "temperature", start, end, 0)
+		assert.Error(t, err)
+
+		_, err = dataRepo.GetDownsampled(createdDevice.ID, "temperature", end, start, 4)
+		assert.Error(t, err)
+	})
+}
+
+func TestDataRepository_GetRecentByTypes(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// temperature 5件, humidity 3件, pressure 2件を1分ごとに登録
+	base := time.Now().UTC().Truncate(time.Second)
+	counts := map[string]int{"temperature": 5, "humidity": 3, "pressure": 2}
+	for dataType, n := range counts {
+		for i := 0; i < n; i++ {
+			data := createTestDeviceData(createdDevice.ID, base.Add(time.Duration(i)*time.Minute))
+			data.DataType = dataType
+			data.Value = float64(i)
+			_, err := dataRepo.SaveData(data)
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("limits each requested type", func(t *testing.T) {
+		recent, err := dataRepo.GetRecentByTypes(createdDevice.ID, []string{"temperature", "humidity"}, 2)
+		require.NoError(t, err)
+		require.Len(t, recent, 2)
+
+		require.Len(t, recent["temperature"], 2)
+		assert.Equal(t, float64(4), recent["temperature"][0].Value)
+		assert.Equal(t, float64(3), recent["temperature"][1].Value)
+
+		require.Len(t, recent["humidity"], 2)
+		assert.Equal(t, float64(2), recent["humidity"][0].Value)
+	})
+
+	t.Run("empty types includes every type", func(t *testing.T) {
+		recent, err := dataRepo.GetRecentByTypes(createdDevice.ID, nil, 3)
+		require.NoError(t, err)
+		assert.Len(t, recent["temperature"], 3)
+		assert.Len(t, recent["humidity"], 3)
+		assert.Len(t, recent["pressure"], 2)
+	})
+
+	t.Run("unknown type is absent", func(t *testing.T) {
+		recent, err := dataRepo.GetRecentByTypes(createdDevice.ID, []string{"co2"}, 3)
+		require.NoError(t, err)
+		assert.Empty(t, recent)
+	})
+
+	t.Run("invalid perType", func(t *testing.T) {
+		_, err := dataRepo.GetRecentByTypes(createdDevice.ID, nil, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestDataRepository_ValuePrecision(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 単精度では丸められる値
+	values := []float64{23.456789012345, 0.1, 1013.2512345678, -40.000000001, 123456789.123456, 1e-10}
+	base := time.Now().UTC().Truncate(time.Second)
+	for i, value := range values {
+		data := createTestDeviceData(createdDevice.ID, base.Add(time.Duration(i)*time.Second))
+		data.Value = value
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	data, err := dataRepo.GetDeviceData(createdDevice.ID, time.Time{}, time.Time{}, len(values), 0)
+	require.NoError(t, err)
+	require.Len(t, data, len(values))
+
+	// 新しい順に返る
+	for i, item := range data {
+		assert.Equal(t, values[len(values)-1-i], item.Value)
+	}
+}
+
+func TestDataRepository_GetDeviceDataByTypeRange(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 1分おきに温度と湿度を交互に10件登録
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		data := createTestDeviceData(createdDevice.ID, base.Add(time.Duration(i)*time.Minute))
+		if i%2 == 1 {
+			data.DataType = "humidity"
+		}
+		data.Value = float64(i)
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		dataType string
+		start    time.Time
+		end      time.Time
+		limit    int
+		offset   int
+		expected []float64
+	}{
+		{name: "type only", dataType: "temperature", limit: 10, expected: []float64{8, 6, 4, 2, 0}},
+		{name: "type and offset", dataType: "temperature", limit: 2, offset: 1, expected: []float64{6, 4}},
+		{name: "type and range", dataType: "temperature", start: base.Add(2 * time.Minute), end: base.Add(6 * time.Minute), limit: 10, expected: []float64{6, 4, 2}},
+		{name: "type, range and offset", dataType: "humidity", start: base.Add(2 * time.Minute), limit: 2, offset: 1, expected: []float64{7, 5}},
+		{name: "offset past the end", dataType: "humidity", limit: 10, offset: 5, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := dataRepo.GetDeviceDataByType(createdDevice.ID, tt.dataType, tt.start, tt.end, tt.limit, tt.offset)
+			require.NoError(t, err)
+
+			var values []float64
+			for _, item := range data {
+				assert.Equal(t, tt.dataType, item.DataType)
+				values = append(values, item.Value)
+			}
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+
+	// 種別を指定しない場合も同じ条件で絞り込める
+	data, err := dataRepo.GetDeviceData(createdDevice.ID, base.Add(2*time.Minute), base.Add(4*time.Minute), 10, 1)
+	require.NoError(t, err)
+	require.Len(t, data, 2)
+	assert.Equal(t, 3.0, data[0].Value)
+	assert.Equal(t, 2.0, data[1].Value)
+}
+
+func TestDataRepository_GetDataByTypeAllDevices(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// テスト用のデバイスを2台作成し、交互にデータを登録
+	first, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+	second, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	for i := 0; i < 6; i++ {
+		deviceID := first.ID
+		if i%2 == 1 {
+			deviceID = second.ID
+		}
+		data := createTestDeviceData(deviceID, base.Add(time.Duration(i)*time.Minute))
+		_, err := dataRepo.SaveData(data)
+		require.NoError(t, err)
+	}
+
+	// 別の種類のデータは含まれない
+	humidity := createTestDeviceData(first.ID, base)
+	humidity.DataType = "humidity"
+	_, err = dataRepo.SaveData(humidity)
+	require.NoError(t, err)
+
+	t.Run("readings from every device ordered by timestamp", func(t *testing.T) {
+		data, err := dataRepo.GetDataByTypeAllDevices("temperature", base, base.Add(time.Hour), 100)
+		require.NoError(t, err)
+		require.Len(t, data, 6)
+
+		devices := make(map[string]bool)
+		for i, item := range data {
+			assert.Equal(t, "temperature", item.DataType)
+			devices[item.DeviceID] = true
+			if i > 0 {
+				assert.False(t, item.Timestamp.After(data[i-1].Timestamp))
+			}
+		}
+		assert.Len(t, devices, 2)
+	})
+
+	t.Run("range and limit", func(t *testing.T) {
+		data, err := dataRepo.GetDataByTypeAllDevices("temperature", base.Add(2*time.Minute), base.Add(time.Hour), 2)
+		require.NoError(t, err)
+		require.Len(t, data, 2)
+		assert.Equal(t, base.Add(5*time.Minute), data[0].Timestamp.UTC())
+	})
+}
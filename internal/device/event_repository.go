@@ -0,0 +1,138 @@
+package device
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"iot-platform-go/internal/database"
+	"iot-platform-go/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// EventRepositoryInterface defines the interface for device event (audit log) operations
+type EventRepositoryInterface interface {
+	Record(event *models.DeviceEvent) error
+	GetByDevice(deviceID string, limit, offset int) ([]*models.DeviceEvent, error)
+	CountByDevice(deviceID string) (int, error)
+}
+
+// EventRepository handles database operations for device events
+type EventRepository struct {
+	db database.Querier
+}
+
+// NewEventRepository creates a new device event repository
+func NewEventRepository(db *database.Database) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// WithTx returns a repository that runs its queries in tx
+func (r *EventRepository) WithTx(tx *sql.Tx) *EventRepository {
+	return &EventRepository{db: tx}
+}
+
+// NewEvent builds an event, encoding details as JSON. A nil details value leaves the detail blob empty.
+func NewEvent(deviceID, eventType, actor string, details interface{}) (*models.DeviceEvent, error) {
+	event := &models.DeviceEvent{
+		ID:        uuid.New().String(),
+		DeviceID:  deviceID,
+		EventType: eventType,
+		Actor:     actor,
+		CreatedAt: time.Now(),
+	}
+
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event details: %w", err)
+		}
+		event.Details = raw
+	}
+
+	return event, nil
+}
+
+// Record appends an event to the device's audit log
+func (r *EventRepository) Record(event *models.DeviceEvent) error {
+	defer startQueryTimer("event.record").observe()
+
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	var details interface{}
+	if len(event.Details) > 0 {
+		details = string(event.Details)
+	}
+
+	query := `
+		INSERT INTO device_events (id, device_id, event_type, actor, details, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+	`
+
+	_, err := r.db.Exec(query, event.ID, event.DeviceID, event.EventType, event.Actor, details, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record device event: %w", err)
+	}
+
+	return nil
+}
+
+// GetByDevice retrieves a page of a device's events, newest first
+func (r *EventRepository) GetByDevice(deviceID string, limit, offset int) ([]*models.DeviceEvent, error) {
+	defer startQueryTimer("event.list").observe()
+
+	query := `
+		SELECT id, device_id, event_type, actor, details, created_at
+		FROM device_events
+		WHERE device_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(query, deviceID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.DeviceEvent{}
+	for rows.Next() {
+		event := &models.DeviceEvent{}
+		var actor, details sql.NullString
+		err := rows.Scan(&event.ID, &event.DeviceID, &event.EventType, &actor, &details, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device event: %w", err)
+		}
+		event.Actor = actor.String
+		if details.Valid {
+			event.Details = json.RawMessage(details.String)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return events, nil
+}
+
+// CountByDevice returns the number of events recorded for a device
+func (r *EventRepository) CountByDevice(deviceID string) (int, error) {
+	defer startQueryTimer("event.count").observe()
+
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM device_events WHERE device_id = $1", deviceID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count device events: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,80 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEvent(t *testing.T) {
+	event, err := NewEvent("device-1", models.EventStatusChanged, "mqtt", map[string]string{"from": "offline", "to": "online"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "device-1", event.DeviceID)
+	assert.Equal(t, models.EventStatusChanged, event.EventType)
+	assert.Equal(t, "mqtt", event.Actor)
+	assert.JSONEq(t, `{"from":"offline","to":"online"}`, string(event.Details))
+	assert.False(t, event.CreatedAt.IsZero())
+
+	event, err = NewEvent("device-1", models.EventDeviceDeleted, "", nil)
+	require.NoError(t, err)
+	assert.Nil(t, event.Details)
+
+	_, err = NewEvent("device-1", models.EventDeviceUpdated, "", func() {})
+	assert.Error(t, err)
+}
+
+func TestEventRepository(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	eventRepo := NewEventRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 1秒ずつずらしてイベントを登録
+	base := time.Now().UTC().Truncate(time.Second)
+	for i, eventType := range []string{models.EventDeviceCreated, models.EventDeviceUpdated, models.EventStatusChanged} {
+		event, err := NewEvent(createdDevice.ID, eventType, "alice", map[string]int{"seq": i})
+		require.NoError(t, err)
+		event.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		require.NoError(t, eventRepo.Record(event))
+	}
+
+	t.Run("newest first", func(t *testing.T) {
+		events, err := eventRepo.GetByDevice(createdDevice.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		assert.Equal(t, models.EventStatusChanged, events[0].EventType)
+		assert.Equal(t, "alice", events[0].Actor)
+		assert.JSONEq(t, `{"seq":2}`, string(events[0].Details))
+		assert.Equal(t, models.EventDeviceCreated, events[2].EventType)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		events, err := eventRepo.GetByDevice(createdDevice.ID, 1, 1)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, models.EventDeviceUpdated, events[0].EventType)
+
+		count, err := eventRepo.CountByDevice(createdDevice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("events outlive the device", func(t *testing.T) {
+		require.NoError(t, repo.Delete(createdDevice.ID))
+
+		count, err := eventRepo.CountByDevice(createdDevice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+}
@@ -0,0 +1,82 @@
+package device
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchToucher updates the last seen time of several devices at once
+type BatchToucher interface {
+	TouchMany(ids []string, t time.Time) (int64, error)
+}
+
+// LastSeenBatcher collects the devices seen between flushes and updates them with one TouchMany,
+// so a burst of messages from many devices costs one statement instead of one per message.
+// Each flush stamps the devices with the latest time seen in that batch.
+type LastSeenBatcher struct {
+	toucher  BatchToucher
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	latest  time.Time
+}
+
+// NewLastSeenBatcher creates a batcher that flushes every interval
+func NewLastSeenBatcher(toucher BatchToucher, interval time.Duration) *LastSeenBatcher {
+	return &LastSeenBatcher{
+		toucher:  toucher,
+		interval: interval,
+		pending:  make(map[string]struct{}),
+	}
+}
+
+// Touch records that the device was seen at t; it is written on the next flush
+func (b *LastSeenBatcher) Touch(id string, t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending[id] = struct{}{}
+	if t.After(b.latest) {
+		b.latest = t
+	}
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes what is pending and returns
+func (b *LastSeenBatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-ctx.Done():
+			b.Flush()
+			return
+		}
+	}
+}
+
+// Flush writes the pending devices' last seen time
+func (b *LastSeenBatcher) Flush() {
+	b.mu.Lock()
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	ids := make([]string, 0, len(b.pending))
+	for id := range b.pending {
+		ids = append(ids, id)
+	}
+	latest := b.latest
+	b.pending = make(map[string]struct{})
+	b.latest = time.Time{}
+	b.mu.Unlock()
+
+	if _, err := b.toucher.TouchMany(ids, latest); err != nil {
+		log.Printf("⚠️ Failed to update last seen for %d devices: %v", len(ids), err)
+	}
+}
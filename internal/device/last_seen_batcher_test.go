@@ -0,0 +1,111 @@
+package device
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingToucher keeps the IDs and time of each TouchMany call
+type recordingToucher struct {
+	mu    sync.Mutex
+	calls [][]string
+	times []time.Time
+}
+
+func (r *recordingToucher) TouchMany(ids []string, t time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sorted := append([]string{}, ids...)
+	sort.Strings(sorted)
+	r.calls = append(r.calls, sorted)
+	r.times = append(r.times, t)
+	return int64(len(ids)), nil
+}
+
+func (r *recordingToucher) callCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.calls)
+}
+
+func TestLastSeenBatcher_Flush(t *testing.T) {
+	toucher := &recordingToucher{}
+	batcher := NewLastSeenBatcher(toucher, time.Hour)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	batcher.Touch("device-2", base)
+	batcher.Touch("device-1", base.Add(2*time.Second))
+	batcher.Touch("device-2", base.Add(time.Second))
+
+	batcher.Flush()
+	require.Equal(t, 1, toucher.callCount())
+	assert.Equal(t, []string{"device-1", "device-2"}, toucher.calls[0])
+	assert.True(t, toucher.times[0].Equal(base.Add(2*time.Second)))
+
+	// Nothing pending, so no statement
+	batcher.Flush()
+	assert.Equal(t, 1, toucher.callCount())
+}
+
+func TestLastSeenBatcher_RunFlushesOnStop(t *testing.T) {
+	toucher := &recordingToucher{}
+	batcher := NewLastSeenBatcher(toucher, time.Hour)
+	batcher.Touch("device-1", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		batcher.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	require.Equal(t, 1, toucher.callCount())
+	assert.Equal(t, []string{"device-1"}, toucher.calls[0])
+}
+
+func TestLastSeenBatcher_RunFlushesEveryInterval(t *testing.T) {
+	toucher := &recordingToucher{}
+	batcher := NewLastSeenBatcher(toucher, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go batcher.Run(ctx)
+
+	batcher.Touch("device-1", time.Now())
+	assert.Eventually(t, func() bool { return toucher.callCount() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestLastSeenBatcher_UpdatesMockRepository(t *testing.T) {
+	repo := NewMockRepository()
+	for _, id := range []string{"device-1", "device-2"} {
+		repo.AddDevice(&models.Device{ID: id, LastSeen: time.Now().Add(-time.Hour)})
+	}
+
+	batcher := NewLastSeenBatcher(repo, time.Hour)
+	seenAt := time.Now()
+	batcher.Touch("device-1", seenAt)
+	batcher.Touch("device-2", seenAt)
+	batcher.Flush()
+
+	for _, id := range []string{"device-1", "device-2"} {
+		device, err := repo.GetByID(id)
+		require.NoError(t, err)
+		assert.True(t, device.LastSeen.Equal(seenAt), id)
+	}
+}
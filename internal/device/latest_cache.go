@@ -0,0 +1,152 @@
+package device
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"iot-platform-go/pkg/models"
+)
+
+type latestEntry struct {
+	data    models.DeviceData
+	expires time.Time
+}
+
+// CachedDataRepository serves GetLatestData from an in-memory cache per device.
+// Readings saved through it refresh the cached value, so polling the latest reading
+// only reaches the database after the TTL or when data is deleted. Entries are only
+// created on a read, so a backfilled older reading never becomes the cached latest.
+type CachedDataRepository struct {
+	DataRepositoryInterface
+
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]latestEntry
+}
+
+// NewCachedDataRepository wraps repo with a latest-reading cache whose entries live for ttl
+func NewCachedDataRepository(repo DataRepositoryInterface, ttl time.Duration) *CachedDataRepository {
+	return &CachedDataRepository{
+		DataRepositoryInterface: repo,
+		ttl:                     ttl,
+		now:                     time.Now,
+		entries:                 make(map[string]latestEntry),
+	}
+}
+
+// GetLatestData returns the cached latest reading, loading it from the repository on a miss
+func (r *CachedDataRepository) GetLatestData(deviceID string) (*models.DeviceData, error) {
+	r.mu.Lock()
+	entry, ok := r.entries[deviceID]
+	if ok && !r.now().Before(entry.expires) {
+		delete(r.entries, deviceID)
+		ok = false
+	}
+	r.mu.Unlock()
+
+	if ok {
+		data := entry.data
+		return &data, nil
+	}
+
+	data, err := r.DataRepositoryInterface.GetLatestData(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.entries[deviceID] = latestEntry{data: *data, expires: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+
+	return data, nil
+}
+
+// SaveData saves a reading and refreshes the device's cached value when the reading is newer
+func (r *CachedDataRepository) SaveData(data *models.DeviceData) (bool, error) {
+	inserted, err := r.DataRepositoryInterface.SaveData(data)
+	if err == nil && inserted {
+		r.refresh(data)
+	}
+	return inserted, err
+}
+
+// SaveDataBatch saves readings and refreshes the cached values of their devices
+func (r *CachedDataRepository) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	inserted, err := r.DataRepositoryInterface.SaveDataBatch(data)
+	for _, d := range inserted {
+		r.refresh(d)
+	}
+	return inserted, err
+}
+
+// DeleteOldData deletes a device's old readings and drops its cached value.
+// An empty deviceID deletes across all devices and drops every cached value.
+func (r *CachedDataRepository) DeleteOldData(deviceID string, olderThan time.Time) (int64, error) {
+	deleted, err := r.DataRepositoryInterface.DeleteOldData(deviceID, olderThan)
+	if deviceID == "" {
+		r.InvalidateAll()
+	} else {
+		r.Invalidate(deviceID)
+	}
+	return deleted, err
+}
+
+// DeleteExpiredData deletes readings past retention and drops every cached value
+func (r *CachedDataRepository) DeleteExpiredData(defaultDays int, now time.Time) (int64, error) {
+	deleted, err := r.DataRepositoryInterface.DeleteExpiredData(defaultDays, now)
+	r.InvalidateAll()
+	return deleted, err
+}
+
+// RollupData rolls up and prunes old raw data through the wrapped repository, then drops the cached
+// values older than before, which the rollup deleted. The wrapped repository must be a DataRoller.
+func (r *CachedDataRepository) RollupData(granularity string, before time.Time) (RollupResult, error) {
+	roller, ok := r.DataRepositoryInterface.(DataRoller)
+	if !ok {
+		return RollupResult{}, fmt.Errorf("data repository does not support rollups")
+	}
+
+	result, err := roller.RollupData(granularity, before)
+	if err != nil {
+		return result, err
+	}
+
+	r.mu.Lock()
+	for deviceID, entry := range r.entries {
+		if entry.data.Timestamp.Before(before) {
+			delete(r.entries, deviceID)
+		}
+	}
+	r.mu.Unlock()
+
+	return result, nil
+}
+
+// Invalidate drops the cached latest reading of a device
+func (r *CachedDataRepository) Invalidate(deviceID string) {
+	r.mu.Lock()
+	delete(r.entries, deviceID)
+	r.mu.Unlock()
+}
+
+// InvalidateAll drops the cached latest reading of every device
+func (r *CachedDataRepository) InvalidateAll() {
+	r.mu.Lock()
+	clear(r.entries)
+	r.mu.Unlock()
+}
+
+// refresh replaces a device's cached value with data unless the cached reading is newer
+func (r *CachedDataRepository) refresh(data *models.DeviceData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[data.DeviceID]
+	if !ok || data.Timestamp.Before(entry.data.Timestamp) {
+		return
+	}
+	r.entries[data.DeviceID] = latestEntry{data: *data, expires: r.now().Add(r.ttl)}
+}
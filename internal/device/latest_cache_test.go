@@ -0,0 +1,213 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCountingLatestRepo returns a mock whose GetLatestData returns latest and counts its calls
+func newCountingLatestRepo(latest *models.DeviceData, calls *int) *MockDataRepository {
+	repo := NewMockDataRepository()
+	repo.SetGetLatestDataFunc(func(deviceID string) (*models.DeviceData, error) {
+		*calls++
+		if latest == nil {
+			return nil, ErrNoData
+		}
+		data := *latest
+		return &data, nil
+	})
+	return repo
+}
+
+func TestCachedDataRepository_Hit(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	cached := NewCachedDataRepository(newCountingLatestRepo(createTestDeviceData("device-1", ts), &calls), time.Minute)
+
+	first, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+	second, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, calls, "the second read should be served from the cache")
+	assert.Equal(t, first.Value, second.Value)
+	assert.True(t, second.Timestamp.Equal(ts))
+}
+
+func TestCachedDataRepository_Expiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	cached := NewCachedDataRepository(newCountingLatestRepo(createTestDeviceData("device-1", now), &calls), time.Minute)
+	cached.now = func() time.Time { return now }
+
+	_, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = cached.GetLatestData("device-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, calls, "an expired entry should be reloaded")
+}
+
+func TestCachedDataRepository_IngestionRefreshes(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	cached := NewCachedDataRepository(newCountingLatestRepo(createTestDeviceData("device-1", ts), &calls), time.Minute)
+
+	_, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+
+	// A newer reading replaces the cached value
+	newer := createTestDeviceData("device-1", ts.Add(time.Second))
+	newer.Value = 30.5
+	_, err = cached.SaveData(newer)
+	require.NoError(t, err)
+
+	latest, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, 30.5, latest.Value)
+
+	// An older reading, e.g. a backfill, does not
+	older := createTestDeviceData("device-1", ts.Add(-time.Hour))
+	older.Value = -1
+	_, err = cached.SaveDataBatch([]*models.DeviceData{older})
+	require.NoError(t, err)
+
+	latest, err = cached.GetLatestData("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, 30.5, latest.Value)
+
+	assert.Equal(t, 1, calls)
+}
+
+func TestCachedDataRepository_DuplicateDoesNotRefresh(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	repo := newCountingLatestRepo(createTestDeviceData("device-1", ts), &calls)
+	repo.SetSaveDataFunc(func(data *models.DeviceData) (bool, error) {
+		return false, nil
+	})
+	cached := NewCachedDataRepository(repo, time.Minute)
+
+	_, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+
+	duplicate := createTestDeviceData("device-1", ts.Add(time.Second))
+	duplicate.Value = 99
+	_, err = cached.SaveData(duplicate)
+	require.NoError(t, err)
+
+	latest, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, 99.0, latest.Value)
+}
+
+func TestCachedDataRepository_Invalidation(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	cached := NewCachedDataRepository(newCountingLatestRepo(createTestDeviceData("device-1", ts), &calls), time.Minute)
+
+	_, err := cached.GetLatestData("device-1")
+	require.NoError(t, err)
+
+	_, err = cached.DeleteOldData("device-1", ts)
+	require.NoError(t, err)
+	_, err = cached.GetLatestData("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	_, err = cached.DeleteExpiredData(30, ts)
+	require.NoError(t, err)
+	_, err = cached.GetLatestData("device-1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestCachedDataRepository_FleetWideDeleteInvalidatesAll(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	cached := NewCachedDataRepository(newCountingLatestRepo(createTestDeviceData("device-1", ts), &calls), time.Minute)
+
+	for _, id := range []string{"device-1", "device-2"} {
+		_, err := cached.GetLatestData(id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+
+	// An empty device ID deletes old data of every device
+	_, err := cached.DeleteOldData("", ts)
+	require.NoError(t, err)
+
+	for _, id := range []string{"device-1", "device-2"} {
+		_, err := cached.GetLatestData(id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, calls)
+}
+
+// rollupRepo is a data repository whose rollup reports the cutoff it was run with
+type rollupRepo struct {
+	*MockDataRepository
+	before time.Time
+}
+
+func (r *rollupRepo) RollupData(granularity string, before time.Time) (RollupResult, error) {
+	r.before = before
+	return RollupResult{Buckets: 1, Pruned: 1}, nil
+}
+
+func TestCachedDataRepository_RollupInvalidatesPrunedValues(t *testing.T) {
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	latest := map[string]*models.DeviceData{
+		"old-device": createTestDeviceData("old-device", cutoff.Add(-time.Hour)),
+		"new-device": createTestDeviceData("new-device", cutoff.Add(time.Hour)),
+	}
+	calls := map[string]int{}
+	repo := &rollupRepo{MockDataRepository: NewMockDataRepository()}
+	repo.SetGetLatestDataFunc(func(deviceID string) (*models.DeviceData, error) {
+		calls[deviceID]++
+		data := *latest[deviceID]
+		return &data, nil
+	})
+	cached := NewCachedDataRepository(repo, time.Minute)
+
+	for id := range latest {
+		_, err := cached.GetLatestData(id)
+		require.NoError(t, err)
+	}
+
+	result, err := cached.RollupData(RollupHourly, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, RollupResult{Buckets: 1, Pruned: 1}, result)
+	assert.Equal(t, cutoff, repo.before)
+
+	// Only the value the rollup pruned is reloaded
+	for id := range latest {
+		_, err := cached.GetLatestData(id)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, map[string]int{"old-device": 2, "new-device": 1}, calls)
+}
+
+func TestCachedDataRepository_RollupUnsupported(t *testing.T) {
+	cached := NewCachedDataRepository(NewMockDataRepository(), time.Minute)
+	_, err := cached.RollupData(RollupHourly, time.Now())
+	assert.Error(t, err)
+}
+
+func TestCachedDataRepository_NoDataIsNotCached(t *testing.T) {
+	calls := 0
+	cached := NewCachedDataRepository(newCountingLatestRepo(nil, &calls), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, err := cached.GetLatestData("device-1")
+		assert.ErrorIs(t, err, ErrNoData)
+	}
+	assert.Equal(t, 2, calls)
+}
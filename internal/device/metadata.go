@@ -0,0 +1,36 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrMetadataNotObject is returned when merging into metadata that is not a JSON object
+var ErrMetadataNotObject = errors.New("device metadata is not a JSON object")
+
+// mergeMetadata shallow-merges patch into the current metadata and returns the merged JSON object.
+// Keys in patch replace existing ones and a null value removes the key. Empty metadata counts as {}.
+func mergeMetadata(current string, patch map[string]json.RawMessage) (string, error) {
+	merged := make(map[string]json.RawMessage)
+	if strings.TrimSpace(current) != "" {
+		if err := json.Unmarshal([]byte(current), &merged); err != nil || merged == nil {
+			return "", ErrMetadataNotObject
+		}
+	}
+
+	for key, value := range patch {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
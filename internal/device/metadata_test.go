@@ -0,0 +1,43 @@
+package device
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     string
+		patch       string
+		expected    string
+		expectedErr error
+	}{
+		{"add key to empty metadata", "", `{"floor":3}`, `{"floor":3}`, nil},
+		{"add new key", `{"floor":3}`, `{"room":"lab"}`, `{"floor":3,"room":"lab"}`, nil},
+		{"overwrite existing key", `{"floor":3,"room":"lab"}`, `{"floor":4}`, `{"floor":4,"room":"lab"}`, nil},
+		{"nested objects are replaced", `{"geo":{"lat":1,"lon":2}}`, `{"geo":{"lat":5}}`, `{"geo":{"lat":5}}`, nil},
+		{"null removes key", `{"floor":3,"room":"lab"}`, `{"room":null}`, `{"floor":3}`, nil},
+		{"current metadata not an object", `"basement"`, `{"floor":3}`, "", ErrMetadataNotObject},
+		{"current metadata not JSON", `basement`, `{"floor":3}`, "", ErrMetadataNotObject},
+		{"current metadata null", `null`, `{"floor":3}`, "", ErrMetadataNotObject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(tt.patch), &patch))
+
+			merged, err := mergeMetadata(tt.current, patch)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, merged)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package device
+
+import (
+	"iot-platform-go/pkg/models"
+	"sync"
+)
+
+// MockEventRepository is a mock implementation of the device event repository for testing
+type MockEventRepository struct {
+	mu         sync.Mutex
+	events     []*models.DeviceEvent
+	recordFunc func(event *models.DeviceEvent) error
+}
+
+// NewMockEventRepository creates a new mock event repository
+func NewMockEventRepository() *MockEventRepository {
+	return &MockEventRepository{}
+}
+
+// Record appends an event
+func (m *MockEventRepository) Record(event *models.DeviceEvent) error {
+	if m.recordFunc != nil {
+		return m.recordFunc(event)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, event)
+	return nil
+}
+
+// GetByDevice returns a page of a device's events, newest first
+func (m *MockEventRepository) GetByDevice(deviceID string, limit, offset int) ([]*models.DeviceEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*models.DeviceEvent{}
+	skipped := 0
+	for i := len(m.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if m.events[i].DeviceID != deviceID {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		events = append(events, m.events[i])
+	}
+
+	return events, nil
+}
+
+// CountByDevice returns the number of events recorded for a device
+func (m *MockEventRepository) CountByDevice(deviceID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, event := range m.events {
+		if event.DeviceID == deviceID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Events returns every recorded event in the order it was recorded
+func (m *MockEventRepository) Events() []*models.DeviceEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*models.DeviceEvent(nil), m.events...)
+}
+
+// SetRecordFunc sets a custom record function for testing
+func (m *MockEventRepository) SetRecordFunc(fn func(event *models.DeviceEvent) error) {
+	m.recordFunc = fn
+}
@@ -1,26 +1,51 @@
 package device
 
 import (
+	"encoding/json"
 	"fmt"
 	"iot-platform-go/pkg/models"
+	"sort"
 	"time"
 )
 
 // MockRepository is a mock implementation of the device repository for testing
 type MockRepository struct {
 	devices          map[string]*models.Device
+	retentionDays    map[string]int
+	tokenHashes      map[string]string
+	statusHistory    map[string][]*models.StatusChange // newest last
+	settings         map[string]map[string]json.RawMessage
 	createFunc       func(req *models.CreateDeviceRequest) (*models.Device, error)
+	createBatchFunc  func(reqs []*models.CreateDeviceRequest) ([]*models.Device, error)
 	getByIDFunc      func(id string) (*models.Device, error)
+	getByNameFunc    func(name string) (*models.Device, error)
+	existsFunc       func(id string) (bool, error)
 	getAllFunc       func() ([]*models.Device, error)
 	updateFunc       func(id string, req *models.UpdateDeviceRequest) (*models.Device, error)
+	mergeMetaFunc    func(id string, patch map[string]json.RawMessage) (string, error)
 	deleteFunc       func(id string) error
 	updateStatusFunc func(id string, status string) error
+	touchFunc        func(id string, t time.Time) error
+	touchManyFunc    func(ids []string, t time.Time) (int64, error)
+	setRetentionFunc func(id string, days int) error
+	setTokenHashFunc func(id string, hash string) error
+	getStatusesFunc  func(ids []string) (map[string]*models.DeviceStatus, error)
+	getFacetsFunc    func() ([]models.FacetValue, []models.FacetValue, error)
+	countStatusFunc  func() (map[string]int, error)
+	countActiveFunc  func(since time.Time) (int, error)
+	notSeenFunc      func(t time.Time) ([]*models.Device, error)
+	historyFunc      func(id string, limit, offset int) ([]*models.StatusChange, error)
+	setSettingsFunc  func(id string, settings map[string]json.RawMessage) error
 }
 
 // NewMockRepository creates a new mock repository
 func NewMockRepository() *MockRepository {
 	return &MockRepository{
-		devices: make(map[string]*models.Device),
+		devices:       make(map[string]*models.Device),
+		retentionDays: make(map[string]int),
+		tokenHashes:   make(map[string]string),
+		statusHistory: make(map[string][]*models.StatusChange),
+		settings:      make(map[string]map[string]json.RawMessage),
 	}
 }
 
@@ -46,6 +71,34 @@ func (m *MockRepository) Create(req *models.CreateDeviceRequest) (*models.Device
 	return device, nil
 }
 
+// CreateBatch creates several devices; if any fails, none are kept
+func (m *MockRepository) CreateBatch(reqs []*models.CreateDeviceRequest) ([]*models.Device, error) {
+	if m.createBatchFunc != nil {
+		return m.createBatchFunc(reqs)
+	}
+
+	devices := make([]*models.Device, 0, len(reqs))
+	for i, req := range reqs {
+		device := &models.Device{
+			ID:        fmt.Sprintf("mock-device-id-%d", i+1),
+			Name:      req.Name,
+			Type:      req.Type,
+			Location:  req.Location,
+			Status:    "offline",
+			LastSeen:  time.Now(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Metadata:  req.Metadata,
+		}
+		devices = append(devices, device)
+	}
+
+	for _, device := range devices {
+		m.devices[device.ID] = device
+	}
+	return devices, nil
+}
+
 // GetByID retrieves a device by ID
 func (m *MockRepository) GetByID(id string) (*models.Device, error) {
 	if m.getByIDFunc != nil {
@@ -60,13 +113,47 @@ func (m *MockRepository) GetByID(id string) (*models.Device, error) {
 	return device, nil
 }
 
+// GetByName retrieves a device by name, failing when the name is not unique
+func (m *MockRepository) GetByName(name string) (*models.Device, error) {
+	if m.getByNameFunc != nil {
+		return m.getByNameFunc(name)
+	}
+
+	var found *models.Device
+	for _, device := range m.devices {
+		if device.Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("device name is not unique")
+		}
+		found = device
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("device not found")
+	}
+
+	return found, nil
+}
+
+// Exists reports whether a device exists
+func (m *MockRepository) Exists(id string) (bool, error) {
+	if m.existsFunc != nil {
+		return m.existsFunc(id)
+	}
+
+	_, exists := m.devices[id]
+	return exists, nil
+}
+
 // GetAll retrieves all devices
 func (m *MockRepository) GetAll() ([]*models.Device, error) {
 	if m.getAllFunc != nil {
 		return m.getAllFunc()
 	}
 
-	var devices []*models.Device
+	devices := []*models.Device{}
 	for _, device := range m.devices {
 		devices = append(devices, device)
 	}
@@ -104,6 +191,27 @@ func (m *MockRepository) Update(id string, req *models.UpdateDeviceRequest) (*mo
 	return device, nil
 }
 
+// MergeMetadata shallow-merges patch into the device's metadata
+func (m *MockRepository) MergeMetadata(id string, patch map[string]json.RawMessage) (string, error) {
+	if m.mergeMetaFunc != nil {
+		return m.mergeMetaFunc(id, patch)
+	}
+
+	device, exists := m.devices[id]
+	if !exists {
+		return "", fmt.Errorf("device not found")
+	}
+
+	merged, err := mergeMetadata(device.Metadata, patch)
+	if err != nil {
+		return "", err
+	}
+
+	device.Metadata = merged
+	device.UpdatedAt = time.Now()
+	return merged, nil
+}
+
 // Delete deletes a device
 func (m *MockRepository) Delete(id string) error {
 	if m.deleteFunc != nil {
@@ -115,6 +223,8 @@ func (m *MockRepository) Delete(id string) error {
 	}
 
 	delete(m.devices, id)
+	delete(m.statusHistory, id)
+	delete(m.settings, id)
 	return nil
 }
 
@@ -129,24 +239,279 @@ func (m *MockRepository) UpdateStatus(id string, status string) error {
 		return fmt.Errorf("device not found")
 	}
 
+	now := time.Now()
+	if device.Status != status {
+		m.statusHistory[id] = append(m.statusHistory[id], &models.StatusChange{
+			ID:         fmt.Sprintf("status-change-%d", len(m.statusHistory[id])+1),
+			DeviceID:   id,
+			FromStatus: device.Status,
+			ToStatus:   status,
+			ChangedAt:  now,
+		})
+	}
+
 	device.Status = status
-	device.LastSeen = time.Now()
-	device.UpdatedAt = time.Now()
+	device.LastSeen = now
+	device.UpdatedAt = now
 	m.devices[id] = device
 
 	return nil
 }
 
+// GetStatusHistory returns a page of the status changes recorded by UpdateStatus, newest first
+func (m *MockRepository) GetStatusHistory(id string, limit, offset int) ([]*models.StatusChange, error) {
+	if m.historyFunc != nil {
+		return m.historyFunc(id, limit, offset)
+	}
+
+	recorded := m.statusHistory[id]
+	history := []*models.StatusChange{}
+	for i := len(recorded) - 1 - offset; i >= 0 && len(history) < limit; i-- {
+		history = append(history, recorded[i])
+	}
+	return history, nil
+}
+
+// CountStatusHistory returns the number of status changes recorded by UpdateStatus
+func (m *MockRepository) CountStatusHistory(id string) (int, error) {
+	return len(m.statusHistory[id]), nil
+}
+
+// Touch updates device last seen time
+func (m *MockRepository) Touch(id string, t time.Time) error {
+	if m.touchFunc != nil {
+		return m.touchFunc(id, t)
+	}
+
+	device, exists := m.devices[id]
+	if !exists {
+		return fmt.Errorf("device not found")
+	}
+
+	device.LastSeen = t
+	m.devices[id] = device
+
+	return nil
+}
+
+// TouchMany updates the last seen time of the devices that exist
+func (m *MockRepository) TouchMany(ids []string, t time.Time) (int64, error) {
+	if m.touchManyFunc != nil {
+		return m.touchManyFunc(ids, t)
+	}
+
+	var updated int64
+	for _, id := range ids {
+		if device, exists := m.devices[id]; exists {
+			device.LastSeen = t
+			updated++
+		}
+	}
+
+	return updated, nil
+}
+
+// GetStatuses returns the status of the requested devices that exist
+func (m *MockRepository) GetStatuses(ids []string) (map[string]*models.DeviceStatus, error) {
+	if m.getStatusesFunc != nil {
+		return m.getStatusesFunc(ids)
+	}
+
+	statuses := make(map[string]*models.DeviceStatus)
+	for _, id := range ids {
+		if device, exists := m.devices[id]; exists {
+			statuses[id] = &models.DeviceStatus{
+				DeviceID: device.ID,
+				Status:   device.Status,
+				LastSeen: device.LastSeen,
+			}
+		}
+	}
+
+	return statuses, nil
+}
+
+// GetFacets counts the distinct types and statuses of the stored devices
+func (m *MockRepository) GetFacets() ([]models.FacetValue, []models.FacetValue, error) {
+	if m.getFacetsFunc != nil {
+		return m.getFacetsFunc()
+	}
+
+	typeCounts := make(map[string]int)
+	statusCounts := make(map[string]int)
+	for _, device := range m.devices {
+		typeCounts[device.Type]++
+		statusCounts[device.Status]++
+	}
+
+	return facetValues(typeCounts), facetValues(statusCounts), nil
+}
+
+// CountByStatus counts the stored devices per status
+func (m *MockRepository) CountByStatus() (map[string]int, error) {
+	if m.countStatusFunc != nil {
+		return m.countStatusFunc()
+	}
+
+	counts := make(map[string]int)
+	for _, device := range m.devices {
+		counts[device.Status]++
+	}
+	return counts, nil
+}
+
+// CountActiveSince counts the stored devices last seen at or after since
+func (m *MockRepository) CountActiveSince(since time.Time) (int, error) {
+	if m.countActiveFunc != nil {
+		return m.countActiveFunc(since)
+	}
+
+	count := 0
+	for _, device := range m.devices {
+		if !device.LastSeen.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetDevicesNotSeenSince returns the stored devices last seen before t, the stalest first
+func (m *MockRepository) GetDevicesNotSeenSince(t time.Time) ([]*models.Device, error) {
+	if m.notSeenFunc != nil {
+		return m.notSeenFunc(t)
+	}
+
+	devices := []*models.Device{}
+	for _, device := range m.devices {
+		if device.LastSeen.Before(t) {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if !devices[i].LastSeen.Equal(devices[j].LastSeen) {
+			return devices[i].LastSeen.Before(devices[j].LastSeen)
+		}
+		return devices[i].ID < devices[j].ID
+	})
+	return devices, nil
+}
+
+// facetValues converts counts keyed by value into facet values sorted by value
+func facetValues(counts map[string]int) []models.FacetValue {
+	values := make([]models.FacetValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, models.FacetValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Value < values[j].Value })
+	return values
+}
+
+// GetRetentionDays returns the device's retention in days
+func (m *MockRepository) GetRetentionDays(id string) (int, error) {
+	if _, exists := m.devices[id]; !exists {
+		return 0, fmt.Errorf("device not found")
+	}
+
+	return m.retentionDays[id], nil
+}
+
+// SetRetentionDays sets the device's retention in days
+func (m *MockRepository) SetRetentionDays(id string, days int) error {
+	if m.setRetentionFunc != nil {
+		return m.setRetentionFunc(id, days)
+	}
+
+	if _, exists := m.devices[id]; !exists {
+		return fmt.Errorf("device not found")
+	}
+
+	if days == 0 {
+		delete(m.retentionDays, id)
+	} else {
+		m.retentionDays[id] = days
+	}
+
+	return nil
+}
+
+// GetTokenHash returns the hash of the device's provisioning token
+func (m *MockRepository) GetTokenHash(id string) (string, error) {
+	if _, exists := m.devices[id]; !exists {
+		return "", fmt.Errorf("device not found")
+	}
+
+	return m.tokenHashes[id], nil
+}
+
+// SetTokenHash stores the hash of the device's provisioning token
+func (m *MockRepository) SetTokenHash(id string, hash string) error {
+	if m.setTokenHashFunc != nil {
+		return m.setTokenHashFunc(id, hash)
+	}
+
+	if _, exists := m.devices[id]; !exists {
+		return fmt.Errorf("device not found")
+	}
+
+	m.tokenHashes[id] = hash
+	return nil
+}
+
+// GetSettings returns the settings stored for the device
+func (m *MockRepository) GetSettings(id string) (map[string]json.RawMessage, error) {
+	if _, exists := m.devices[id]; !exists {
+		return nil, fmt.Errorf("device not found")
+	}
+
+	settings := make(map[string]json.RawMessage, len(m.settings[id]))
+	for key, value := range m.settings[id] {
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// SetSettings replaces the settings stored for the device
+func (m *MockRepository) SetSettings(id string, settings map[string]json.RawMessage) error {
+	if m.setSettingsFunc != nil {
+		return m.setSettingsFunc(id, settings)
+	}
+
+	if _, exists := m.devices[id]; !exists {
+		return fmt.Errorf("device not found")
+	}
+
+	m.settings[id] = make(map[string]json.RawMessage, len(settings))
+	for key, value := range settings {
+		m.settings[id][key] = value
+	}
+	return nil
+}
+
 // SetCreateFunc sets a custom create function for testing
 func (m *MockRepository) SetCreateFunc(fn func(req *models.CreateDeviceRequest) (*models.Device, error)) {
 	m.createFunc = fn
 }
 
+// SetCreateBatchFunc sets a custom create batch function for testing
+func (m *MockRepository) SetCreateBatchFunc(fn func(reqs []*models.CreateDeviceRequest) ([]*models.Device, error)) {
+	m.createBatchFunc = fn
+}
+
 // SetGetByIDFunc sets a custom get by ID function for testing
 func (m *MockRepository) SetGetByIDFunc(fn func(id string) (*models.Device, error)) {
 	m.getByIDFunc = fn
 }
 
+// SetGetByNameFunc sets a custom get by name function for testing
+func (m *MockRepository) SetGetByNameFunc(fn func(name string) (*models.Device, error)) {
+	m.getByNameFunc = fn
+}
+
+// SetExistsFunc sets a custom exists function for testing
+func (m *MockRepository) SetExistsFunc(fn func(id string) (bool, error)) {
+	m.existsFunc = fn
+}
+
 // SetGetAllFunc sets a custom get all function for testing
 func (m *MockRepository) SetGetAllFunc(fn func() ([]*models.Device, error)) {
 	m.getAllFunc = fn
@@ -157,6 +522,16 @@ func (m *MockRepository) SetUpdateFunc(fn func(id string, req *models.UpdateDevi
 	m.updateFunc = fn
 }
 
+// SetMergeMetadataFunc sets a custom metadata merge function for testing
+func (m *MockRepository) SetMergeMetadataFunc(fn func(id string, patch map[string]json.RawMessage) (string, error)) {
+	m.mergeMetaFunc = fn
+}
+
+// SetTouchManyFunc sets a custom batch touch function for testing
+func (m *MockRepository) SetTouchManyFunc(fn func(ids []string, t time.Time) (int64, error)) {
+	m.touchManyFunc = fn
+}
+
 // SetDeleteFunc sets a custom delete function for testing
 func (m *MockRepository) SetDeleteFunc(fn func(id string) error) {
 	m.deleteFunc = fn
@@ -167,6 +542,56 @@ func (m *MockRepository) SetUpdateStatusFunc(fn func(id string, status string) e
 	m.updateStatusFunc = fn
 }
 
+// SetTouchFunc sets a custom touch function for testing
+func (m *MockRepository) SetTouchFunc(fn func(id string, t time.Time) error) {
+	m.touchFunc = fn
+}
+
+// SetSetRetentionFunc sets a custom set retention function for testing
+func (m *MockRepository) SetSetRetentionFunc(fn func(id string, days int) error) {
+	m.setRetentionFunc = fn
+}
+
+// SetSetTokenHashFunc sets a custom set token hash function for testing
+func (m *MockRepository) SetSetTokenHashFunc(fn func(id string, hash string) error) {
+	m.setTokenHashFunc = fn
+}
+
+// SetGetStatusesFunc sets a custom get statuses function for testing
+func (m *MockRepository) SetGetStatusesFunc(fn func(ids []string) (map[string]*models.DeviceStatus, error)) {
+	m.getStatusesFunc = fn
+}
+
+// SetGetFacetsFunc sets a custom get facets function for testing
+func (m *MockRepository) SetGetFacetsFunc(fn func() ([]models.FacetValue, []models.FacetValue, error)) {
+	m.getFacetsFunc = fn
+}
+
+// SetCountByStatusFunc sets a custom count by status function for testing
+func (m *MockRepository) SetCountByStatusFunc(fn func() (map[string]int, error)) {
+	m.countStatusFunc = fn
+}
+
+// SetCountActiveSinceFunc sets a custom active device count function for testing
+func (m *MockRepository) SetCountActiveSinceFunc(fn func(since time.Time) (int, error)) {
+	m.countActiveFunc = fn
+}
+
+// SetGetDevicesNotSeenSinceFunc sets a custom stale device listing function for testing
+func (m *MockRepository) SetGetDevicesNotSeenSinceFunc(fn func(t time.Time) ([]*models.Device, error)) {
+	m.notSeenFunc = fn
+}
+
+// SetGetStatusHistoryFunc sets a custom status history function for testing
+func (m *MockRepository) SetGetStatusHistoryFunc(fn func(id string, limit, offset int) ([]*models.StatusChange, error)) {
+	m.historyFunc = fn
+}
+
+// SetSetSettingsFunc sets a custom set settings function for testing
+func (m *MockRepository) SetSetSettingsFunc(fn func(id string, settings map[string]json.RawMessage) error) {
+	m.setSettingsFunc = fn
+}
+
 // AddDevice adds a device to the mock repository for testing
 func (m *MockRepository) AddDevice(device *models.Device) {
 	m.devices[device.ID] = device
@@ -175,4 +600,8 @@ func (m *MockRepository) AddDevice(device *models.Device) {
 // Clear clears all devices from the mock repository
 func (m *MockRepository) Clear() {
 	m.devices = make(map[string]*models.Device)
+	m.retentionDays = make(map[string]int)
+	m.tokenHashes = make(map[string]string)
+	m.statusHistory = make(map[string][]*models.StatusChange)
+	m.settings = make(map[string]map[string]json.RawMessage)
 }
@@ -0,0 +1,26 @@
+package device
+
+import (
+	"time"
+
+	"iot-platform-go/internal/metrics"
+)
+
+// QueryDurationMetric is the name of the per-operation query timing metric
+const QueryDurationMetric = "db_query_duration"
+
+// queryTimer measures how long a repository operation takes
+type queryTimer struct {
+	operation string
+	start     time.Time
+}
+
+// startQueryTimer starts timing the named operation (e.g. device.create); call observe when it finishes
+func startQueryTimer(operation string) queryTimer {
+	return queryTimer{operation: operation, start: time.Now()}
+}
+
+// observe records the elapsed time under the operation label
+func (t queryTimer) observe() {
+	metrics.Default.TimingVec(QueryDurationMetric).Observe(t.operation, time.Since(t.start))
+}
@@ -0,0 +1,108 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SplitReadings separates an MQTT data payload into numeric readings and everything else.
+// Numbers and numeric strings become readings; booleans, other strings, nulls, objects, arrays
+// and non-finite numbers are returned as extras so they can be kept as metadata instead of being coerced.
+func SplitReadings(data map[string]interface{}) (map[string]float64, map[string]interface{}) {
+	readings := make(map[string]float64)
+	extras := make(map[string]interface{})
+
+	for dataType, value := range data {
+		if number, ok := numericValue(value); ok {
+			readings[dataType] = number
+		} else {
+			extras[dataType] = value
+		}
+	}
+
+	return readings, extras
+}
+
+// ExtrasMetadata encodes the values SplitReadings set aside as JSON, stored as metadata on the readings.
+// It returns "" when there are none.
+func ExtrasMetadata(extras map[string]interface{}) string {
+	if len(extras) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(extras)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// ErrMissingDataType is returned by ReadingDefaults.Apply for a reading without a data type
+var ErrMissingDataType = errors.New("reading has no data_type")
+
+// ReadingDefaults fills in the data type and unit of single-value readings sent without them.
+// The zero value has no default data type, so readings without one are rejected.
+type ReadingDefaults struct {
+	DataType string
+	Unit     string
+	// Reject disables the defaults: a reading without a data type is rejected and one without a unit is stored without one
+	Reject bool
+}
+
+// Apply returns the data type and unit to store for a reading sent with dataType and unit.
+// It returns ErrMissingDataType when dataType is empty and no default applies.
+func (d ReadingDefaults) Apply(dataType, unit string) (string, string, error) {
+	if d.Reject {
+		if dataType == "" {
+			return "", "", ErrMissingDataType
+		}
+		return dataType, unit, nil
+	}
+
+	if dataType == "" {
+		if d.DataType == "" {
+			return "", "", ErrMissingDataType
+		}
+		dataType = d.DataType
+	}
+	if unit == "" {
+		unit = d.Unit
+	}
+	return dataType, unit, nil
+}
+
+// numericValue converts a decoded JSON value to a finite float64
+func numericValue(value interface{}) (float64, bool) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case float32:
+		number = float64(v)
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		number = parsed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		number = parsed
+	default:
+		return 0, false
+	}
+
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
@@ -0,0 +1,117 @@
+package device
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtrasMetadata(t *testing.T) {
+	assert.Equal(t, "", ExtrasMetadata(nil))
+	assert.JSONEq(t, `{"door_open":true,"mode":"eco"}`, ExtrasMetadata(map[string]interface{}{"door_open": true, "mode": "eco"}))
+}
+
+func TestSplitReadings(t *testing.T) {
+	payload := `{
+		"temperature": 23.5,
+		"humidity": 60,
+		"pressure": "1013.25",
+		"door_open": true,
+		"mode": "eco",
+		"location": {"lat": 35.6, "lon": 139.7},
+		"history": [1, 2, 3],
+		"battery": null,
+		"signal": "NaN"
+	}`
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payload), &data))
+
+	readings, extras := SplitReadings(data)
+
+	assert.Equal(t, map[string]float64{
+		"temperature": 23.5,
+		"humidity":    60,
+		"pressure":    1013.25,
+	}, readings)
+
+	assert.Equal(t, true, extras["door_open"])
+	assert.Equal(t, "eco", extras["mode"])
+	assert.Equal(t, map[string]interface{}{"lat": 35.6, "lon": 139.7}, extras["location"])
+	assert.Equal(t, []interface{}{1.0, 2.0, 3.0}, extras["history"])
+	assert.Contains(t, extras, "battery")
+	assert.Nil(t, extras["battery"])
+	assert.Equal(t, "NaN", extras["signal"])
+	assert.Len(t, extras, 6)
+}
+
+func TestSplitReadings_NumberTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected float64
+		numeric  bool
+	}{
+		{"float64", 1.5, 1.5, true},
+		{"int", 2, 2, true},
+		{"int64", int64(3), 3, true},
+		{"json number", json.Number("4.25"), 4.25, true},
+		{"invalid json number", json.Number("abc"), 0, false},
+		{"numeric string with spaces", " 5 ", 5, true},
+		{"non-numeric string", "high", 0, false},
+		{"infinite string", "Inf", 0, false},
+		{"bool", false, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readings, extras := SplitReadings(map[string]interface{}{"value": tt.value})
+			if tt.numeric {
+				assert.Equal(t, tt.expected, readings["value"])
+				assert.Empty(t, extras)
+			} else {
+				assert.Empty(t, readings)
+				assert.Equal(t, tt.value, extras["value"])
+			}
+		})
+	}
+}
+
+func TestSplitReadings_Empty(t *testing.T) {
+	readings, extras := SplitReadings(nil)
+	assert.Empty(t, readings)
+	assert.Empty(t, extras)
+}
+
+func TestReadingDefaults(t *testing.T) {
+	defaults := ReadingDefaults{DataType: "value", Unit: "celsius"}
+
+	tests := []struct {
+		name         string
+		defaults     ReadingDefaults
+		dataType     string
+		unit         string
+		expectedType string
+		expectedUnit string
+		expectedErr  error
+	}{
+		{"sent fields are kept", defaults, "humidity", "percent", "humidity", "percent", nil},
+		{"missing data type and unit are defaulted", defaults, "", "", "value", "celsius", nil},
+		{"missing unit is defaulted", defaults, "temperature", "", "temperature", "celsius", nil},
+		{"no default data type", ReadingDefaults{Unit: "celsius"}, "", "", "", "", ErrMissingDataType},
+		{"no default unit", ReadingDefaults{DataType: "value"}, "", "", "value", "", nil},
+		{"reject missing data type", ReadingDefaults{DataType: "value", Unit: "celsius", Reject: true}, "", "", "", "", ErrMissingDataType},
+		{"reject keeps a missing unit empty", ReadingDefaults{DataType: "value", Unit: "celsius", Reject: true}, "temperature", "", "temperature", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataType, unit, err := tt.defaults.Apply(tt.dataType, tt.unit)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, tt.expectedType, dataType)
+			assert.Equal(t, tt.expectedUnit, unit)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package device
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,30 +12,73 @@ import (
 	"iot-platform-go/pkg/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // RepositoryInterface defines the interface for device repository operations
 type RepositoryInterface interface {
 	Create(req *models.CreateDeviceRequest) (*models.Device, error)
+	CreateBatch(reqs []*models.CreateDeviceRequest) ([]*models.Device, error)
 	GetByID(id string) (*models.Device, error)
+	GetByName(name string) (*models.Device, error)
+	Exists(id string) (bool, error)
 	GetAll() ([]*models.Device, error)
 	Update(id string, req *models.UpdateDeviceRequest) (*models.Device, error)
+	MergeMetadata(id string, patch map[string]json.RawMessage) (string, error)
 	Delete(id string) error
 	UpdateStatus(id string, status string) error
+	GetStatusHistory(id string, limit, offset int) ([]*models.StatusChange, error)
+	CountStatusHistory(id string) (int, error)
+	Touch(id string, t time.Time) error
+	TouchMany(ids []string, t time.Time) (int64, error)
+	GetStatuses(ids []string) (map[string]*models.DeviceStatus, error)
+	GetFacets() (types []models.FacetValue, statuses []models.FacetValue, err error)
+	CountByStatus() (map[string]int, error)
+	CountActiveSince(since time.Time) (int, error)
+	GetDevicesNotSeenSince(t time.Time) ([]*models.Device, error)
+	GetRetentionDays(id string) (int, error)
+	SetRetentionDays(id string, days int) error
+	GetTokenHash(id string) (string, error)
+	SetTokenHash(id string, hash string) error
+	GetSettings(id string) (map[string]json.RawMessage, error)
+	SetSettings(id string, settings map[string]json.RawMessage) error
+}
+
+// ErrDeviceNameTaken is returned when unique device names are enforced and the name is already in use
+var ErrDeviceNameTaken = errors.New("device name already exists")
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// deviceNameError maps a violation of the unique device name index to ErrDeviceNameTaken
+func deviceNameError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == database.DeviceNameUniqueIndex {
+		return ErrDeviceNameTaken
+	}
+	return err
 }
 
 // Repository handles database operations for devices
 type Repository struct {
-	db *database.Database
+	db   database.Querier
+	conn *database.Database // nil when bound to a transaction
 }
 
 // NewRepository creates a new device repository
 func NewRepository(db *database.Database) *Repository {
-	return &Repository{db: db}
+	return &Repository{db: db, conn: db}
+}
+
+// WithTx returns a repository that runs its queries in tx
+func (r *Repository) WithTx(tx *sql.Tx) *Repository {
+	return &Repository{db: tx}
 }
 
 // Create creates a new device
 func (r *Repository) Create(req *models.CreateDeviceRequest) (*models.Device, error) {
+	defer startQueryTimer("device.create").observe()
+
 	device := &models.Device{
 		ID:        uuid.New().String(),
 		Name:      req.Name,
@@ -53,23 +99,57 @@ func (r *Repository) Create(req *models.CreateDeviceRequest) (*models.Device, er
 	_, err := r.db.Exec(query, device.ID, device.Name, device.Type, device.Location,
 		device.Status, device.LastSeen, device.CreatedAt, device.UpdatedAt, device.Metadata)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create device: %w", err)
+		return nil, fmt.Errorf("failed to create device: %w", deviceNameError(err))
 	}
 
 	return device, nil
 }
 
+// CreateBatch creates several devices in one transaction; if any fails, none are created
+func (r *Repository) CreateBatch(reqs []*models.CreateDeviceRequest) ([]*models.Device, error) {
+	defer startQueryTimer("device.create_batch").observe()
+
+	// Already bound to a transaction, so the caller commits or rolls back
+	if r.conn == nil {
+		return r.createAll(reqs)
+	}
+
+	var devices []*models.Device
+	err := r.conn.WithTx(context.Background(), func(tx *sql.Tx) error {
+		var err error
+		devices, err = r.WithTx(tx).createAll(reqs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// createAll creates each device in turn, stopping at the first failure
+func (r *Repository) createAll(reqs []*models.CreateDeviceRequest) ([]*models.Device, error) {
+	devices := make([]*models.Device, 0, len(reqs))
+	for i, req := range reqs {
+		device, err := r.Create(req)
+		if err != nil {
+			return nil, fmt.Errorf("device %d: %w", i, err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
 // GetByID retrieves a device by ID
 func (r *Repository) GetByID(id string) (*models.Device, error) {
-	device := &models.Device{}
+	defer startQueryTimer("device.get").observe()
+
 	query := `
-		SELECT id, name, type, location, status, last_seen, created_at, updated_at, metadata
+		SELECT id, name, type, location, status, metadata, created_at, updated_at, last_seen
 		FROM devices WHERE id = $1
 	`
 
-	err := r.db.QueryRow(query, id).Scan(
-		&device.ID, &device.Name, &device.Type, &device.Location,
-		&device.Status, &device.LastSeen, &device.CreatedAt, &device.UpdatedAt, &device.Metadata)
+	device, err := scanDevice(r.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("device not found")
@@ -80,8 +160,103 @@ func (r *Repository) GetByID(id string) (*models.Device, error) {
 	return device, nil
 }
 
+// GetByName retrieves a device by its name.
+// Names are not unique, so an error is returned when more than one device has the name.
+func (r *Repository) GetByName(name string) (*models.Device, error) {
+	defer startQueryTimer("device.get_by_name").observe()
+
+	// Two rows are enough to tell a unique name from a duplicated one
+	query := `
+		SELECT id, name, type, location, status, metadata, created_at, updated_at, last_seen
+		FROM devices WHERE name = $1
+		LIMIT 2
+	`
+
+	rows, err := r.db.Query(query, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []*models.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	switch len(devices) {
+	case 0:
+		return nil, fmt.Errorf("device not found")
+	case 1:
+		return devices[0], nil
+	default:
+		return nil, fmt.Errorf("device name is not unique")
+	}
+}
+
+// Exists reports whether a device exists without loading it
+func (r *Repository) Exists(id string) (bool, error) {
+	defer startQueryTimer("device.exists").observe()
+
+	// IDs that are not UUIDs cannot exist and would make the cast fail
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM devices WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check device existence: %w", err)
+	}
+
+	return exists, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDevice scans the columns id, name, type, location, status, metadata, created_at, updated_at, last_seen.
+// location, metadata and last_seen are nullable and read back as zero values.
+func scanDevice(row rowScanner) (*models.Device, error) {
+	device := &models.Device{}
+	var location, metadata sql.NullString
+	var lastSeen sql.NullTime
+
+	err := row.Scan(
+		&device.ID,
+		&device.Name,
+		&device.Type,
+		&location,
+		&device.Status,
+		&metadata,
+		&device.CreatedAt,
+		&device.UpdatedAt,
+		&lastSeen,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	device.Location = location.String
+	device.Metadata = metadata.String
+	device.LastSeen = lastSeen.Time
+
+	return device, nil
+}
+
 // GetAll retrieves all devices
 func (r *Repository) GetAll() ([]*models.Device, error) {
+	defer startQueryTimer("device.list").observe()
+
 	query := `
 		SELECT id, name, type, location, status, metadata, created_at, updated_at, last_seen
 		FROM devices
@@ -94,20 +269,9 @@ func (r *Repository) GetAll() ([]*models.Device, error) {
 	}
 	defer rows.Close()
 
-	var devices []*models.Device
+	devices := []*models.Device{} // never nil, so an empty list renders as []
 	for rows.Next() {
-		device := &models.Device{}
-		err := rows.Scan(
-			&device.ID,
-			&device.Name,
-			&device.Type,
-			&device.Location,
-			&device.Status,
-			&device.Metadata,
-			&device.CreatedAt,
-			&device.UpdatedAt,
-			&device.LastSeen,
-		)
+		device, err := scanDevice(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan device: %w", err)
 		}
@@ -123,6 +287,8 @@ func (r *Repository) GetAll() ([]*models.Device, error) {
 
 // Update updates a device
 func (r *Repository) Update(id string, req *models.UpdateDeviceRequest) (*models.Device, error) {
+	defer startQueryTimer("device.update").observe()
+
 	device, err := r.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -156,14 +322,63 @@ func (r *Repository) Update(id string, req *models.UpdateDeviceRequest) (*models
 	_, err = r.db.Exec(query, device.Name, device.Type, device.Location,
 		device.Status, device.Metadata, device.UpdatedAt, device.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update device: %w", err)
+		return nil, fmt.Errorf("failed to update device: %w", deviceNameError(err))
 	}
 
 	return device, nil
 }
 
+// MergeMetadata shallow-merges patch into the device's metadata and returns the merged metadata.
+// The row is locked for the read-modify-write so concurrent merges are not lost.
+func (r *Repository) MergeMetadata(id string, patch map[string]json.RawMessage) (string, error) {
+	defer startQueryTimer("device.merge_metadata").observe()
+
+	// Already bound to a transaction, so the caller commits or rolls back
+	if r.conn == nil {
+		return r.mergeMetadata(id, patch)
+	}
+
+	var merged string
+	err := r.conn.WithTx(context.Background(), func(tx *sql.Tx) error {
+		var err error
+		merged, err = r.WithTx(tx).mergeMetadata(id, patch)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return merged, nil
+}
+
+// mergeMetadata reads the metadata with a row lock, merges patch into it and writes it back
+func (r *Repository) mergeMetadata(id string, patch map[string]json.RawMessage) (string, error) {
+	var current sql.NullString
+	err := r.db.QueryRow(`SELECT metadata FROM devices WHERE id = $1 FOR UPDATE`, id).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("device not found")
+		}
+		return "", fmt.Errorf("failed to get device metadata: %w", err)
+	}
+
+	merged, err := mergeMetadata(current.String, patch)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = r.db.Exec(`UPDATE devices SET metadata = $1, updated_at = $2 WHERE id = $3`, merged, time.Now(), id)
+	if err != nil {
+		return "", fmt.Errorf("failed to update device metadata: %w", err)
+	}
+
+	return merged, nil
+}
+
 // Delete deletes a device
 func (r *Repository) Delete(id string) error {
+	defer startQueryTimer("device.delete").observe()
+
 	query := `DELETE FROM devices WHERE id = $1`
 	result, err := r.db.Exec(query, id)
 	if err != nil {
@@ -182,18 +397,478 @@ func (r *Repository) Delete(id string) error {
 	return nil
 }
 
-// UpdateStatus updates the status and last seen time of a device
+// UpdateStatus updates the status and last seen time of a device.
+// A change of status is recorded in the status history in the same transaction; the same status is not.
 func (r *Repository) UpdateStatus(id string, status string) error {
+	defer startQueryTimer("device.update_status").observe()
+
+	// Already bound to a transaction, so the caller commits or rolls back
+	if r.conn == nil {
+		return r.updateStatus(id, status)
+	}
+
+	return r.conn.WithTx(context.Background(), func(tx *sql.Tx) error {
+		return r.WithTx(tx).updateStatus(id, status)
+	})
+}
+
+// updateStatus reads the current status with a row lock, updates it and records the transition when it changed
+func (r *Repository) updateStatus(id string, status string) error {
+	var previous sql.NullString
+	err := r.db.QueryRow(`SELECT status FROM devices WHERE id = $1 FOR UPDATE`, id).Scan(&previous)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("device not found")
+		}
+		return fmt.Errorf("failed to get device status: %w", err)
+	}
+
+	now := time.Now()
 	query := `
 		UPDATE devices 
 		SET status = $1, last_seen = $2, updated_at = $3
 		WHERE id = $4
 	`
 
-	_, err := r.db.Exec(query, status, time.Now(), time.Now(), id)
+	_, err = r.db.Exec(query, status, now, now, id)
 	if err != nil {
 		return fmt.Errorf("failed to update device status: %w", err)
 	}
 
+	if previous.Valid && previous.String == status {
+		return nil
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO device_status_history (id, device_id, from_status, to_status, changed_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.New().String(), id, previous, status, now)
+	if err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	return nil
+}
+
+// GetStatusHistory retrieves a page of a device's status changes, newest first
+func (r *Repository) GetStatusHistory(id string, limit, offset int) ([]*models.StatusChange, error) {
+	defer startQueryTimer("device.status_history").observe()
+
+	query := `
+		SELECT id, device_id, COALESCE(from_status, ''), to_status, changed_at
+		FROM device_status_history
+		WHERE device_id = $1
+		ORDER BY changed_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.Query(query, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []*models.StatusChange{}
+	for rows.Next() {
+		change := &models.StatusChange{}
+		err := rows.Scan(&change.ID, &change.DeviceID, &change.FromStatus, &change.ToStatus, &change.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan status change: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return history, nil
+}
+
+// CountStatusHistory returns the number of status changes recorded for a device
+func (r *Repository) CountStatusHistory(id string) (int, error) {
+	defer startQueryTimer("device.status_history_count").observe()
+
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM device_status_history WHERE device_id = $1", id).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count status history: %w", err)
+	}
+
+	return count, nil
+}
+
+// Touch updates only the last seen time of a device
+func (r *Repository) Touch(id string, t time.Time) error {
+	defer startQueryTimer("device.touch").observe()
+
+	query := `UPDATE devices SET last_seen = $1 WHERE id = $2`
+
+	result, err := r.db.Exec(query, t, id)
+	if err != nil {
+		return fmt.Errorf("failed to touch device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("device not found")
+	}
+
+	return nil
+}
+
+// TouchMany sets the last seen time of several devices in one statement and returns how many were updated.
+// IDs of devices that do not exist are ignored.
+func (r *Repository) TouchMany(ids []string, t time.Time) (int64, error) {
+	defer startQueryTimer("device.touch_many").observe()
+
+	validIDs := validDeviceIDs(ids)
+	if len(validIDs) == 0 {
+		return 0, nil
+	}
+
+	query := `UPDATE devices SET last_seen = $1 WHERE id = ANY($2::uuid[])`
+
+	result, err := r.db.Exec(query, t, pq.Array(validIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to touch devices: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// validDeviceIDs drops IDs that are not UUIDs, which cannot exist and would make a uuid[] cast fail
+func validDeviceIDs(ids []string) []string {
+	validIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			validIDs = append(validIDs, id)
+		}
+	}
+	return validIDs
+}
+
+// GetStatuses retrieves the status of several devices in one query, keyed by device ID.
+// IDs that do not exist are absent from the result.
+func (r *Repository) GetStatuses(ids []string) (map[string]*models.DeviceStatus, error) {
+	defer startQueryTimer("device.get_statuses").observe()
+
+	statuses := make(map[string]*models.DeviceStatus)
+
+	validIDs := validDeviceIDs(ids)
+	if len(validIDs) == 0 {
+		return statuses, nil
+	}
+
+	query := `SELECT id, status, last_seen FROM devices WHERE id = ANY($1::uuid[])`
+
+	rows, err := r.db.Query(query, pq.Array(validIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device statuses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		status := &models.DeviceStatus{}
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&status.DeviceID, &status.Status, &lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan device status: %w", err)
+		}
+		status.LastSeen = lastSeen.Time
+		statuses[status.DeviceID] = status
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// GetFacets returns the distinct device types and statuses with the number of devices having each, sorted by value
+func (r *Repository) GetFacets() (types []models.FacetValue, statuses []models.FacetValue, err error) {
+	defer startQueryTimer("device.get_facets").observe()
+
+	query := `
+		SELECT 'type', type, COUNT(*) FROM devices GROUP BY type
+		UNION ALL
+		SELECT 'status', COALESCE(status, ''), COUNT(*) FROM devices GROUP BY COALESCE(status, '')
+		ORDER BY 1, 2
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query device facets: %w", err)
+	}
+	defer rows.Close()
+
+	types = []models.FacetValue{}
+	statuses = []models.FacetValue{}
+	for rows.Next() {
+		var facet string
+		var value models.FacetValue
+		if err := rows.Scan(&facet, &value.Value, &value.Count); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan device facet: %w", err)
+		}
+		if facet == "type" {
+			types = append(types, value)
+		} else {
+			statuses = append(statuses, value)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return types, statuses, nil
+}
+
+// CountByStatus returns the number of devices per status; devices without a status count under ""
+func (r *Repository) CountByStatus() (map[string]int, error) {
+	defer startQueryTimer("device.count_by_status").observe()
+
+	rows, err := r.db.Query(`SELECT COALESCE(status, ''), COUNT(*) FROM devices GROUP BY COALESCE(status, '')`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count devices by status: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan device count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CountActiveSince returns the number of devices last seen at or after since
+func (r *Repository) CountActiveSince(since time.Time) (int, error) {
+	defer startQueryTimer("device.count_active").observe()
+
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM devices WHERE last_seen >= $1`, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active devices: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetDevicesNotSeenSince returns the devices last seen before t, the stalest first.
+// Devices never seen come first; a device last seen exactly at t is not included.
+func (r *Repository) GetDevicesNotSeenSince(t time.Time) ([]*models.Device, error) {
+	defer startQueryTimer("device.list_stale").observe()
+
+	query := `
+		SELECT id, name, type, location, status, metadata, created_at, updated_at, last_seen
+		FROM devices
+		WHERE last_seen IS NULL OR last_seen < $1
+		ORDER BY last_seen ASC NULLS FIRST, id ASC
+	`
+
+	rows, err := r.db.Query(query, t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*models.Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return devices, nil
+}
+
+// GetRetentionDays returns how many days of data are kept for a device; 0 means the global default applies
+func (r *Repository) GetRetentionDays(id string) (int, error) {
+	defer startQueryTimer("device.get_retention").observe()
+
+	var days sql.NullInt64
+	err := r.db.QueryRow(`SELECT retention_days FROM devices WHERE id = $1`, id).Scan(&days)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("device not found")
+		}
+		return 0, fmt.Errorf("failed to get device retention: %w", err)
+	}
+
+	return int(days.Int64), nil
+}
+
+// SetRetentionDays sets how many days of data are kept for a device; 0 reverts to the global default
+func (r *Repository) SetRetentionDays(id string, days int) error {
+	defer startQueryTimer("device.set_retention").observe()
+
+	query := `UPDATE devices SET retention_days = NULLIF($1, 0), updated_at = $2 WHERE id = $3`
+
+	result, err := r.db.Exec(query, days, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to set device retention: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("device not found")
+	}
+
+	return nil
+}
+
+// GetTokenHash returns the hash of the device's provisioning token, or "" when it has none
+func (r *Repository) GetTokenHash(id string) (string, error) {
+	defer startQueryTimer("device.get_token").observe()
+
+	// IDs that are not UUIDs cannot exist and would make the cast fail
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("device not found")
+	}
+
+	var hash sql.NullString
+	err := r.db.QueryRow(`SELECT token_hash FROM devices WHERE id = $1`, id).Scan(&hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("device not found")
+		}
+		return "", fmt.Errorf("failed to get device token: %w", err)
+	}
+
+	return hash.String, nil
+}
+
+// SetTokenHash stores the hash of the device's provisioning token, replacing any previous one
+func (r *Repository) SetTokenHash(id string, hash string) error {
+	defer startQueryTimer("device.set_token").observe()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("device not found")
+	}
+
+	query := `UPDATE devices SET token_hash = NULLIF($1, ''), updated_at = $2 WHERE id = $3`
+
+	result, err := r.db.Exec(query, hash, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to set device token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("device not found")
+	}
+
+	return nil
+}
+
+// GetSettings returns the settings stored for a device, without the configured defaults
+func (r *Repository) GetSettings(id string) (map[string]json.RawMessage, error) {
+	defer startQueryTimer("device.get_settings").observe()
+
+	exists, err := r.Exists(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("device not found")
+	}
+
+	rows, err := r.db.Query(`SELECT key, value FROM device_settings WHERE device_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan device setting: %w", err)
+		}
+		settings[key] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate device settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// SetSettings replaces the settings stored for a device
+func (r *Repository) SetSettings(id string, settings map[string]json.RawMessage) error {
+	defer startQueryTimer("device.set_settings").observe()
+
+	// Already bound to a transaction, so the caller commits or rolls back
+	if r.conn == nil {
+		return r.setSettings(id, settings)
+	}
+
+	return r.conn.WithTx(context.Background(), func(tx *sql.Tx) error {
+		return r.WithTx(tx).setSettings(id, settings)
+	})
+}
+
+// setSettings locks the device row, then deletes its settings and inserts the new ones
+func (r *Repository) setSettings(id string, settings map[string]json.RawMessage) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("device not found")
+	}
+
+	var locked string
+	err := r.db.QueryRow(`SELECT id FROM devices WHERE id = $1 FOR UPDATE`, id).Scan(&locked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("device not found")
+		}
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM device_settings WHERE device_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to clear device settings: %w", err)
+	}
+
+	now := time.Now()
+	for key, value := range settings {
+		_, err := r.db.Exec(`INSERT INTO device_settings (device_id, key, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			id, key, []byte(value), now)
+		if err != nil {
+			return fmt.Errorf("failed to save device setting %s: %w", key, err)
+		}
+	}
+
 	return nil
 }
@@ -1,14 +1,22 @@
 package device
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"iot-platform-go/internal/config"
 	"iot-platform-go/internal/database"
+	"iot-platform-go/internal/metrics"
 	"iot-platform-go/pkg/models"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,6 +45,8 @@ func setupTestDatabase(t *testing.T) *database.Database {
 	// テスト用のテーブルをクリーンアップ
 	_, err = db.Exec("DELETE FROM device_data")
 	require.NoError(t, err)
+	_, err = db.Exec("DELETE FROM device_events")
+	require.NoError(t, err)
 	_, err = db.Exec("DELETE FROM devices")
 	require.NoError(t, err)
 
@@ -63,11 +73,20 @@ func createTestUpdateRequest() *models.UpdateDeviceRequest {
 
 // MockDataRepository is a mock implementation of DataRepositoryInterface
 type MockDataRepository struct {
-	saveDataFunc            func(*models.DeviceData) error
-	getDeviceDataFunc       func(string, int) ([]*models.DeviceData, error)
-	getDeviceDataByTypeFunc func(string, string, int) ([]*models.DeviceData, error)
+	saveDataFunc            func(*models.DeviceData) (bool, error)
+	saveDataBatchFunc       func([]*models.DeviceData) ([]*models.DeviceData, error)
+	getDeviceDataFunc       func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)
+	getDeviceDataByTypeFunc func(string, string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)
+	getRecentByTypesFunc    func(string, []string, int) (map[string][]*models.DeviceData, error)
+	getDataByTypeAllFunc    func(string, time.Time, time.Time, int) ([]*models.DeviceData, error)
+	getDataByMetadataFunc   func(string, string, string, int) ([]*models.DeviceData, error)
 	getLatestDataFunc       func(string) (*models.DeviceData, error)
-	deleteOldDataFunc       func(string, time.Time) error
+	getDataBoundsFunc       func(string) (time.Time, time.Time, error)
+	getDataTypesFunc        func(string) ([]string, error)
+	getDataCountFunc        func(string, string, time.Time, time.Time) (int, error)
+	getDownsampledFunc      func(string, string, time.Time, time.Time, int) ([]*models.DataPoint, error)
+	deleteOldDataFunc       func(string, time.Time) (int64, error)
+	deleteExpiredDataFunc   func(int, time.Time) (int64, error)
 }
 
 // NewMockDataRepository creates a new mock data repository
@@ -76,50 +95,127 @@ func NewMockDataRepository() *MockDataRepository {
 }
 
 // SetSaveDataFunc sets the mock function for SaveData
-func (m *MockDataRepository) SetSaveDataFunc(fn func(*models.DeviceData) error) {
+func (m *MockDataRepository) SetSaveDataFunc(fn func(*models.DeviceData) (bool, error)) {
 	m.saveDataFunc = fn
 }
 
+// SetSaveDataBatchFunc sets the mock function for SaveDataBatch
+func (m *MockDataRepository) SetSaveDataBatchFunc(fn func([]*models.DeviceData) ([]*models.DeviceData, error)) {
+	m.saveDataBatchFunc = fn
+}
+
 // SetGetDeviceDataFunc sets the mock function for GetDeviceData
-func (m *MockDataRepository) SetGetDeviceDataFunc(fn func(string, int) ([]*models.DeviceData, error)) {
+func (m *MockDataRepository) SetGetDeviceDataFunc(fn func(string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)) {
 	m.getDeviceDataFunc = fn
 }
 
 // SetGetDeviceDataByTypeFunc sets the mock function for GetDeviceDataByType
-func (m *MockDataRepository) SetGetDeviceDataByTypeFunc(fn func(string, string, int) ([]*models.DeviceData, error)) {
+func (m *MockDataRepository) SetGetDeviceDataByTypeFunc(fn func(string, string, time.Time, time.Time, int, int) ([]*models.DeviceData, error)) {
 	m.getDeviceDataByTypeFunc = fn
 }
 
+// SetGetRecentByTypesFunc sets the mock function for GetRecentByTypes
+func (m *MockDataRepository) SetGetRecentByTypesFunc(fn func(string, []string, int) (map[string][]*models.DeviceData, error)) {
+	m.getRecentByTypesFunc = fn
+}
+
+// SetGetDataByTypeAllDevicesFunc sets the mock function for GetDataByTypeAllDevices
+func (m *MockDataRepository) SetGetDataByTypeAllDevicesFunc(fn func(string, time.Time, time.Time, int) ([]*models.DeviceData, error)) {
+	m.getDataByTypeAllFunc = fn
+}
+
+// SetGetDataByMetadataFunc sets the mock function for GetDataByMetadata
+func (m *MockDataRepository) SetGetDataByMetadataFunc(fn func(string, string, string, int) ([]*models.DeviceData, error)) {
+	m.getDataByMetadataFunc = fn
+}
+
 // SetGetLatestDataFunc sets the mock function for GetLatestData
 func (m *MockDataRepository) SetGetLatestDataFunc(fn func(string) (*models.DeviceData, error)) {
 	m.getLatestDataFunc = fn
 }
 
+// SetGetDataBoundsFunc sets the mock function for GetDataBounds
+func (m *MockDataRepository) SetGetDataBoundsFunc(fn func(string) (time.Time, time.Time, error)) {
+	m.getDataBoundsFunc = fn
+}
+
+// SetGetDataTypesFunc sets the mock function for GetDataTypes
+func (m *MockDataRepository) SetGetDataTypesFunc(fn func(string) ([]string, error)) {
+	m.getDataTypesFunc = fn
+}
+
+// SetGetDataCountFunc sets the mock function for GetDataCount
+func (m *MockDataRepository) SetGetDataCountFunc(fn func(string, string, time.Time, time.Time) (int, error)) {
+	m.getDataCountFunc = fn
+}
+
+// SetGetDownsampledFunc sets the mock function for GetDownsampled
+func (m *MockDataRepository) SetGetDownsampledFunc(fn func(string, string, time.Time, time.Time, int) ([]*models.DataPoint, error)) {
+	m.getDownsampledFunc = fn
+}
+
 // SetDeleteOldDataFunc sets the mock function for DeleteOldData
-func (m *MockDataRepository) SetDeleteOldDataFunc(fn func(string, time.Time) error) {
+func (m *MockDataRepository) SetDeleteOldDataFunc(fn func(string, time.Time) (int64, error)) {
 	m.deleteOldDataFunc = fn
 }
 
+// SetDeleteExpiredDataFunc sets the mock function for DeleteExpiredData
+func (m *MockDataRepository) SetDeleteExpiredDataFunc(fn func(int, time.Time) (int64, error)) {
+	m.deleteExpiredDataFunc = fn
+}
+
 // SaveData implements DataRepositoryInterface
-func (m *MockDataRepository) SaveData(data *models.DeviceData) error {
+func (m *MockDataRepository) SaveData(data *models.DeviceData) (bool, error) {
 	if m.saveDataFunc != nil {
 		return m.saveDataFunc(data)
 	}
-	return nil
+	return true, nil
+}
+
+// SaveDataBatch implements DataRepositoryInterface
+func (m *MockDataRepository) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	if m.saveDataBatchFunc != nil {
+		return m.saveDataBatchFunc(data)
+	}
+	return data, nil
 }
 
 // GetDeviceData implements DataRepositoryInterface
-func (m *MockDataRepository) GetDeviceData(deviceID string, limit int) ([]*models.DeviceData, error) {
+func (m *MockDataRepository) GetDeviceData(deviceID string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
 	if m.getDeviceDataFunc != nil {
-		return m.getDeviceDataFunc(deviceID, limit)
+		return m.getDeviceDataFunc(deviceID, start, end, limit, offset)
 	}
 	return []*models.DeviceData{}, nil
 }
 
 // GetDeviceDataByType implements DataRepositoryInterface
-func (m *MockDataRepository) GetDeviceDataByType(deviceID string, dataType string, limit int) ([]*models.DeviceData, error) {
+func (m *MockDataRepository) GetDeviceDataByType(deviceID string, dataType string, start, end time.Time, limit, offset int) ([]*models.DeviceData, error) {
 	if m.getDeviceDataByTypeFunc != nil {
-		return m.getDeviceDataByTypeFunc(deviceID, dataType, limit)
+		return m.getDeviceDataByTypeFunc(deviceID, dataType, start, end, limit, offset)
+	}
+	return []*models.DeviceData{}, nil
+}
+
+// GetRecentByTypes implements DataRepositoryInterface
+func (m *MockDataRepository) GetRecentByTypes(deviceID string, types []string, perType int) (map[string][]*models.DeviceData, error) {
+	if m.getRecentByTypesFunc != nil {
+		return m.getRecentByTypesFunc(deviceID, types, perType)
+	}
+	return map[string][]*models.DeviceData{}, nil
+}
+
+// GetDataByTypeAllDevices implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataByTypeAllDevices(dataType string, start, end time.Time, limit int) ([]*models.DeviceData, error) {
+	if m.getDataByTypeAllFunc != nil {
+		return m.getDataByTypeAllFunc(dataType, start, end, limit)
+	}
+	return []*models.DeviceData{}, nil
+}
+
+// GetDataByMetadata implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataByMetadata(deviceID, key, value string, limit int) ([]*models.DeviceData, error) {
+	if m.getDataByMetadataFunc != nil {
+		return m.getDataByMetadataFunc(deviceID, key, value, limit)
 	}
 	return []*models.DeviceData{}, nil
 }
@@ -132,12 +228,52 @@ func (m *MockDataRepository) GetLatestData(deviceID string) (*models.DeviceData,
 	return nil, nil
 }
 
+// GetDataBounds implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataBounds(deviceID string) (time.Time, time.Time, error) {
+	if m.getDataBoundsFunc != nil {
+		return m.getDataBoundsFunc(deviceID)
+	}
+	return time.Time{}, time.Time{}, ErrNoData
+}
+
+// GetDataTypes implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataTypes(deviceID string) ([]string, error) {
+	if m.getDataTypesFunc != nil {
+		return m.getDataTypesFunc(deviceID)
+	}
+	return []string{}, nil
+}
+
+// GetDataCount implements DataRepositoryInterface
+func (m *MockDataRepository) GetDataCount(deviceID string, dataType string, start, end time.Time) (int, error) {
+	if m.getDataCountFunc != nil {
+		return m.getDataCountFunc(deviceID, dataType, start, end)
+	}
+	return 0, nil
+}
+
+// GetDownsampled implements DataRepositoryInterface
+func (m *MockDataRepository) GetDownsampled(deviceID string, dataType string, start, end time.Time, buckets int) ([]*models.DataPoint, error) {
+	if m.getDownsampledFunc != nil {
+		return m.getDownsampledFunc(deviceID, dataType, start, end, buckets)
+	}
+	return []*models.DataPoint{}, nil
+}
+
 // DeleteOldData implements DataRepositoryInterface
-func (m *MockDataRepository) DeleteOldData(deviceID string, olderThan time.Time) error {
+func (m *MockDataRepository) DeleteOldData(deviceID string, olderThan time.Time) (int64, error) {
 	if m.deleteOldDataFunc != nil {
 		return m.deleteOldDataFunc(deviceID, olderThan)
 	}
-	return nil
+	return 0, nil
+}
+
+// DeleteExpiredData implements DataRepositoryInterface
+func (m *MockDataRepository) DeleteExpiredData(defaultDays int, now time.Time) (int64, error) {
+	if m.deleteExpiredDataFunc != nil {
+		return m.deleteExpiredDataFunc(defaultDays, now)
+	}
+	return 0, nil
 }
 
 func TestRepository_Create(t *testing.T) {
@@ -244,6 +380,93 @@ func TestRepository_GetByID(t *testing.T) {
 	}
 }
 
+func TestRepository_CreateBatch(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	t.Run("all devices are created", func(t *testing.T) {
+		devices, err := repo.CreateBatch([]*models.CreateDeviceRequest{
+			{Name: "Device 1", Type: "temperature"},
+			{Name: "Device 2", Type: "humidity"},
+		})
+		require.NoError(t, err)
+		assert.Len(t, devices, 2)
+
+		all, err := repo.GetAll()
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+	})
+
+	t.Run("failure rolls back the whole batch", func(t *testing.T) {
+		_, err := db.Exec("DELETE FROM devices")
+		require.NoError(t, err)
+
+		// 2件目の名前がカラム長を超えるため途中で失敗する
+		_, err = repo.CreateBatch([]*models.CreateDeviceRequest{
+			{Name: "Device 1", Type: "temperature"},
+			{Name: strings.Repeat("x", 300), Type: "humidity"},
+		})
+		assert.Error(t, err)
+
+		all, err := repo.GetAll()
+		require.NoError(t, err)
+		assert.Empty(t, all)
+	})
+}
+
+func TestDatabase_WithTx_Rollback(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+
+	// デバイスとデータを登録した後にエラーを返す
+	err := db.WithTx(context.Background(), func(tx *sql.Tx) error {
+		created, err := repo.WithTx(tx).Create(createTestDeviceRequest())
+		require.NoError(t, err)
+
+		_, err = dataRepo.WithTx(tx).SaveData(createTestDeviceData(created.ID, time.Now()))
+		require.NoError(t, err)
+
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM devices").Scan(&count))
+	assert.Equal(t, 0, count)
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM device_data").Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestRepository_GetByID_NullColumns(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// 必須カラムのみの最小限の行を直接登録 (location, metadata, last_seen は NULL)
+	var id string
+	err := db.QueryRow(`INSERT INTO devices (name, type) VALUES ('Minimal Device', 'temperature') RETURNING id`).Scan(&id)
+	require.NoError(t, err)
+
+	device, err := repo.GetByID(id)
+	require.NoError(t, err)
+
+	assert.Equal(t, id, device.ID)
+	assert.Equal(t, "Minimal Device", device.Name)
+	assert.Equal(t, "offline", device.Status)
+	assert.Equal(t, "", device.Location)
+	assert.Equal(t, "", device.Metadata)
+	assert.True(t, device.LastSeen.IsZero())
+}
+
 func TestRepository_GetAll(t *testing.T) {
 	t.Skip("Skipping repository test as it requires database setup")
 	db := setupTestDatabase(t)
@@ -278,6 +501,53 @@ func TestRepository_GetAll(t *testing.T) {
 	})
 }
 
+func TestRepository_GetAll_Empty(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// デバイスが無い場合も nil ではなく空のスライスを返す
+	devices, err := repo.GetAll()
+	require.NoError(t, err)
+	require.NotNil(t, devices)
+
+	encoded, err := json.Marshal(devices)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(encoded))
+}
+
+func TestMockRepository_GetAll_Empty(t *testing.T) {
+	devices, err := NewMockRepository().GetAll()
+	require.NoError(t, err)
+
+	encoded, err := json.Marshal(devices)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(encoded))
+}
+
+func TestRepository_GetAll_NullColumns(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// location, metadata, last_seen が NULL の行を直接登録
+	_, err := db.Exec(`INSERT INTO devices (name, type, location, metadata, last_seen) VALUES ('Null Device', 'temperature', NULL, NULL, NULL)`)
+	require.NoError(t, err)
+
+	retrievedDevices, err := repo.GetAll()
+	require.NoError(t, err)
+	require.Len(t, retrievedDevices, 1)
+
+	assert.Equal(t, "Null Device", retrievedDevices[0].Name)
+	assert.Equal(t, "", retrievedDevices[0].Location)
+	assert.Equal(t, "", retrievedDevices[0].Metadata)
+	assert.True(t, retrievedDevices[0].LastSeen.IsZero())
+}
+
 func TestRepository_Update(t *testing.T) {
 	t.Skip("Skipping repository test as it requires database setup")
 	db := setupTestDatabase(t)
@@ -354,6 +624,34 @@ func TestRepository_Update(t *testing.T) {
 	}
 }
 
+func TestRepository_MergeMetadata(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 新しいキーの追加と既存キーの上書き
+	merged, err := repo.MergeMetadata(createdDevice.ID, map[string]json.RawMessage{
+		"model":    json.RawMessage(`"TEMP-002"`),
+		"firmware": json.RawMessage(`"1.2.0"`),
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"manufacturer":"Test Corp","model":"TEMP-002","firmware":"1.2.0"}`, merged)
+
+	device, err := repo.GetByID(createdDevice.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, merged, device.Metadata)
+
+	// 存在しないデバイス
+	_, err = repo.MergeMetadata("non-existent-id", map[string]json.RawMessage{"model": json.RawMessage(`"x"`)})
+	assert.EqualError(t, err, "device not found")
+}
+
 func TestRepository_Delete(t *testing.T) {
 	t.Skip("Skipping repository test as it requires database setup")
 	db := setupTestDatabase(t)
@@ -463,6 +761,197 @@ func TestRepository_UpdateStatus(t *testing.T) {
 	}
 }
 
+func TestRepository_StatusHistory(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを作成 (初期ステータスは offline)
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 同じステータスへの更新は履歴に残らない
+	for _, status := range []string{"offline", "online", "online", "maintenance", "maintenance", "offline"} {
+		require.NoError(t, repo.UpdateStatus(createdDevice.ID, status))
+	}
+
+	total, err := repo.CountStatusHistory(createdDevice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+
+	// 新しい順に返される
+	history, err := repo.GetStatusHistory(createdDevice.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, "maintenance", history[0].FromStatus)
+	assert.Equal(t, "offline", history[0].ToStatus)
+	assert.Equal(t, "online", history[1].FromStatus)
+	assert.Equal(t, "maintenance", history[1].ToStatus)
+	assert.Equal(t, "offline", history[2].FromStatus)
+	assert.Equal(t, "online", history[2].ToStatus)
+	assert.False(t, history[0].ChangedAt.Before(history[1].ChangedAt))
+
+	// ページング
+	page, err := repo.GetStatusHistory(createdDevice.ID, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, history[1].ID, page[0].ID)
+
+	// デバイス削除で履歴も削除される
+	require.NoError(t, repo.Delete(createdDevice.ID))
+	total, err = repo.CountStatusHistory(createdDevice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+}
+
+func TestRepository_GetFacets(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// 種別とステータスの異なるデバイスを作成
+	for _, deviceType := range []string{"temperature", "temperature", "humidity"} {
+		req := createTestDeviceRequest()
+		req.Type = deviceType
+		created, err := repo.Create(req)
+		require.NoError(t, err)
+		if deviceType == "humidity" {
+			require.NoError(t, repo.UpdateStatus(created.ID, "online"))
+		}
+	}
+
+	types, statuses, err := repo.GetFacets()
+	require.NoError(t, err)
+
+	assert.Equal(t, []models.FacetValue{{Value: "humidity", Count: 1}, {Value: "temperature", Count: 2}}, types)
+	assert.Equal(t, []models.FacetValue{{Value: "offline", Count: 2}, {Value: "online", Count: 1}}, statuses)
+}
+
+func TestRepository_CountByStatusAndActive(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// オンラインのデバイスを1台、オフラインのデバイスを2台作成
+	var ids []string
+	for i := 0; i < 3; i++ {
+		created, err := repo.Create(createTestDeviceRequest())
+		require.NoError(t, err)
+		ids = append(ids, created.ID)
+	}
+	require.NoError(t, repo.UpdateStatus(ids[0], "online"))
+
+	counts, err := repo.CountByStatus()
+	require.NoError(t, err)
+	assert.Equal(t, 1, counts["online"])
+	assert.Equal(t, 2, counts["offline"])
+
+	// 最近見えたデバイスだけを数える
+	since := time.Now().Add(time.Hour)
+	require.NoError(t, repo.Touch(ids[1], since.Add(time.Minute)))
+	active, err := repo.CountActiveSince(since)
+	require.NoError(t, err)
+	assert.Equal(t, 1, active)
+}
+
+func TestMockRepository_CountByStatusAndActive(t *testing.T) {
+	repo := NewMockRepository()
+	now := time.Now()
+	repo.AddDevice(&models.Device{ID: "device-1", Status: "online", LastSeen: now})
+	repo.AddDevice(&models.Device{ID: "device-2", Status: "online", LastSeen: now.Add(-2 * time.Hour)})
+	repo.AddDevice(&models.Device{ID: "device-3", Status: "offline", LastSeen: now.Add(-time.Minute)})
+
+	counts, err := repo.CountByStatus()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"online": 2, "offline": 1}, counts)
+
+	active, err := repo.CountActiveSince(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, active)
+}
+
+func TestRepository_GetDevicesNotSeenSince(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		created, err := repo.Create(createTestDeviceRequest())
+		require.NoError(t, err)
+		ids = append(ids, created.ID)
+	}
+
+	// カットオフちょうどに見えたデバイスは古いとみなさない
+	cutoff := time.Now().Add(-30 * time.Minute).Truncate(time.Microsecond)
+	require.NoError(t, repo.Touch(ids[0], cutoff.Add(-time.Minute)))
+	require.NoError(t, repo.Touch(ids[1], cutoff.Add(-time.Hour)))
+	require.NoError(t, repo.Touch(ids[2], cutoff))
+
+	// 一度も見えていないデバイスが最も古い
+	_, err := db.Exec(`UPDATE devices SET last_seen = NULL WHERE id = $1`, ids[3])
+	require.NoError(t, err)
+
+	stale, err := repo.GetDevicesNotSeenSince(cutoff)
+	require.NoError(t, err)
+	require.Len(t, stale, 3)
+	assert.Equal(t, ids[3], stale[0].ID)
+	assert.True(t, stale[0].LastSeen.IsZero())
+	assert.Equal(t, ids[1], stale[1].ID)
+	assert.Equal(t, ids[0], stale[2].ID)
+}
+
+func TestMockRepository_GetDevicesNotSeenSince(t *testing.T) {
+	cutoff := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		lastSeen time.Time
+		stale    bool
+	}{
+		{name: "seen at the cutoff", lastSeen: cutoff, stale: false},
+		{name: "seen just before the cutoff", lastSeen: cutoff.Add(-time.Nanosecond), stale: true},
+		{name: "seen after the cutoff", lastSeen: cutoff.Add(time.Second), stale: false},
+		{name: "never seen", lastSeen: time.Time{}, stale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMockRepository()
+			repo.AddDevice(&models.Device{ID: "device-1", LastSeen: tt.lastSeen})
+
+			stale, err := repo.GetDevicesNotSeenSince(cutoff)
+			require.NoError(t, err)
+			if tt.stale {
+				require.Len(t, stale, 1)
+				assert.Equal(t, "device-1", stale[0].ID)
+			} else {
+				assert.Empty(t, stale)
+			}
+		})
+	}
+
+	t.Run("stalest first", func(t *testing.T) {
+		repo := NewMockRepository()
+		repo.AddDevice(&models.Device{ID: "device-1", LastSeen: cutoff.Add(-time.Minute)})
+		repo.AddDevice(&models.Device{ID: "device-2", LastSeen: cutoff.Add(-time.Hour)})
+		repo.AddDevice(&models.Device{ID: "device-3", LastSeen: cutoff.Add(-time.Minute)})
+
+		stale, err := repo.GetDevicesNotSeenSince(cutoff)
+		require.NoError(t, err)
+		require.Len(t, stale, 3)
+		assert.Equal(t, []string{"device-2", "device-1", "device-3"}, []string{stale[0].ID, stale[1].ID, stale[2].ID})
+	})
+}
+
 func TestRepository_Integration(t *testing.T) {
 	t.Skip("Skipping repository test as it requires database setup")
 	db := setupTestDatabase(t)
@@ -546,3 +1035,404 @@ func TestRepository_DataValidation(t *testing.T) {
 		assert.Equal(t, createReq.Name, device.Name)
 	})
 }
+
+func TestRepository_Touch(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを作成
+	createReq := createTestDeviceRequest()
+	createdDevice, err := repo.Create(createReq)
+	require.NoError(t, err)
+
+	before, err := repo.GetByID(createdDevice.ID)
+	require.NoError(t, err)
+
+	t.Run("last_seen advances without altering other fields", func(t *testing.T) {
+		seenAt := before.LastSeen.Add(time.Minute)
+		err := repo.Touch(createdDevice.ID, seenAt)
+		assert.NoError(t, err)
+
+		after, err := repo.GetByID(createdDevice.ID)
+		require.NoError(t, err)
+		assert.True(t, after.LastSeen.After(before.LastSeen))
+		assert.Equal(t, before.Name, after.Name)
+		assert.Equal(t, before.Type, after.Type)
+		assert.Equal(t, before.Location, after.Location)
+		assert.Equal(t, before.Status, after.Status)
+		assert.Equal(t, before.Metadata, after.Metadata)
+		assert.True(t, before.UpdatedAt.Equal(after.UpdatedAt))
+	})
+
+	t.Run("device not found", func(t *testing.T) {
+		err := repo.Touch("00000000-0000-0000-0000-000000000000", time.Now())
+		assert.Error(t, err)
+	})
+}
+
+func TestRepository_TouchMany(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを複数作成
+	var ids []string
+	for i := 0; i < 3; i++ {
+		created, err := repo.Create(createTestDeviceRequest())
+		require.NoError(t, err)
+		ids = append(ids, created.ID)
+	}
+
+	// 存在しないIDやUUIDでないIDは無視される
+	seenAt := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	updated, err := repo.TouchMany(append(ids, "00000000-0000-0000-0000-000000000000", "not-a-uuid"), seenAt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(ids)), updated)
+
+	for _, id := range ids {
+		device, err := repo.GetByID(id)
+		require.NoError(t, err)
+		assert.True(t, device.LastSeen.Equal(seenAt))
+	}
+}
+
+func TestRepository_Exists(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{"existing device", createdDevice.ID, true},
+		{"non-existent device", "00000000-0000-0000-0000-000000000000", false},
+		{"invalid UUID", "invalid-uuid", false},
+		{"empty ID", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := repo.Exists(tt.id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, exists)
+		})
+	}
+}
+
+func TestRepository_TokenHashMalformedID(t *testing.T) {
+	// A malformed ID is rejected before it reaches the database, where the uuid cast would fail
+	repo := NewRepository(nil)
+
+	_, err := repo.GetTokenHash("not-a-uuid")
+	assert.EqualError(t, err, "device not found")
+
+	err = repo.SetTokenHash("not-a-uuid", "hash")
+	assert.EqualError(t, err, "device not found")
+}
+
+func TestMockRepository_Exists(t *testing.T) {
+	repo := NewMockRepository()
+	repo.AddDevice(&models.Device{ID: "device-1", Name: "Test Device"})
+
+	exists, err := repo.Exists("device-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = repo.Exists("missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	repo.SetExistsFunc(func(id string) (bool, error) {
+		return false, assert.AnError
+	})
+	_, err = repo.Exists("device-1")
+	assert.Error(t, err)
+}
+
+func TestRepository_GetByName(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// 名前が一意なデバイスと重複するデバイスを作成
+	unique, err := repo.Create(&models.CreateDeviceRequest{Name: "Unique Sensor", Type: "temperature"})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err := repo.Create(&models.CreateDeviceRequest{Name: "Shared Sensor", Type: "humidity"})
+		require.NoError(t, err)
+	}
+
+	found, err := repo.GetByName("Unique Sensor")
+	require.NoError(t, err)
+	assert.Equal(t, unique.ID, found.ID)
+
+	_, err = repo.GetByName("Missing Sensor")
+	require.Error(t, err)
+	assert.Equal(t, "device not found", err.Error())
+
+	_, err = repo.GetByName("Shared Sensor")
+	require.Error(t, err)
+	assert.Equal(t, "device name is not unique", err.Error())
+}
+
+func TestDeviceNameError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		taken bool
+	}{
+		{"unique name index", &pq.Error{Code: uniqueViolation, Constraint: database.DeviceNameUniqueIndex}, true},
+		{"other unique constraint", &pq.Error{Code: uniqueViolation, Constraint: "devices_pkey"}, false},
+		{"other database error", &pq.Error{Code: "23503", Constraint: database.DeviceNameUniqueIndex}, false},
+		{"not a database error", errors.New("connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("failed to create device: %w", deviceNameError(tt.err))
+			assert.Equal(t, tt.taken, errors.Is(err, ErrDeviceNameTaken))
+		})
+	}
+}
+
+func TestMockRepository_GetByName(t *testing.T) {
+	repo := NewMockRepository()
+	repo.AddDevice(&models.Device{ID: "device-1", Name: "Unique Sensor"})
+	repo.AddDevice(&models.Device{ID: "device-2", Name: "Shared Sensor"})
+	repo.AddDevice(&models.Device{ID: "device-3", Name: "Shared Sensor"})
+
+	found, err := repo.GetByName("Unique Sensor")
+	require.NoError(t, err)
+	assert.Equal(t, "device-1", found.ID)
+
+	_, err = repo.GetByName("Missing Sensor")
+	require.Error(t, err)
+	assert.Equal(t, "device not found", err.Error())
+
+	_, err = repo.GetByName("Shared Sensor")
+	require.Error(t, err)
+	assert.Equal(t, "device name is not unique", err.Error())
+}
+
+func TestMockRepository_Touch(t *testing.T) {
+	repo := NewMockRepository()
+	original := &models.Device{
+		ID:       "device-1",
+		Name:     "Test Device",
+		Type:     "temperature",
+		Location: "Test Room",
+		Status:   "offline",
+		LastSeen: time.Now().Add(-time.Hour),
+	}
+	repo.AddDevice(original)
+	before := *original
+
+	seenAt := time.Now()
+	require.NoError(t, repo.Touch("device-1", seenAt))
+
+	after, err := repo.GetByID("device-1")
+	require.NoError(t, err)
+	assert.True(t, after.LastSeen.Equal(seenAt))
+	assert.Equal(t, before.Name, after.Name)
+	assert.Equal(t, before.Status, after.Status)
+	assert.Equal(t, before.UpdatedAt, after.UpdatedAt)
+
+	assert.Error(t, repo.Touch("missing", seenAt))
+}
+
+func TestMockRepository_TouchMany(t *testing.T) {
+	repo := NewMockRepository()
+	for _, id := range []string{"device-1", "device-2", "device-3"} {
+		repo.AddDevice(&models.Device{ID: id, LastSeen: time.Now().Add(-time.Hour)})
+	}
+
+	seenAt := time.Now()
+	updated, err := repo.TouchMany([]string{"device-1", "device-2", "device-3", "missing"}, seenAt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), updated)
+
+	for _, id := range []string{"device-1", "device-2", "device-3"} {
+		device, err := repo.GetByID(id)
+		require.NoError(t, err)
+		assert.True(t, device.LastSeen.Equal(seenAt), id)
+	}
+}
+
+func TestQueryTimer(t *testing.T) {
+	timing := metrics.Default.TimingVec(QueryDurationMetric)
+	before := timing.Stats("test.query").Count
+
+	startQueryTimer("test.query").observe()
+
+	assert.Equal(t, before+1, timing.Stats("test.query").Count)
+}
+
+func TestRepository_QueryMetrics(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	timing := metrics.Default.TimingVec(QueryDurationMetric)
+	before := timing.Stats("device.create").Count
+
+	_, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	stats := timing.Stats("device.create")
+	assert.GreaterOrEqual(t, stats.Count, before+1)
+	assert.Greater(t, stats.TotalMs, 0.0)
+
+	pool := db.PoolStats()
+	assert.GreaterOrEqual(t, pool.OpenConnections, 1)
+}
+
+func TestRepository_RetentionDays(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを作成
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	t.Run("default retention", func(t *testing.T) {
+		days, err := repo.GetRetentionDays(createdDevice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, days)
+	})
+
+	t.Run("custom retention", func(t *testing.T) {
+		require.NoError(t, repo.SetRetentionDays(createdDevice.ID, 14))
+
+		days, err := repo.GetRetentionDays(createdDevice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 14, days)
+	})
+
+	t.Run("reset to default", func(t *testing.T) {
+		require.NoError(t, repo.SetRetentionDays(createdDevice.ID, 0))
+
+		days, err := repo.GetRetentionDays(createdDevice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, days)
+	})
+
+	t.Run("non-existent device", func(t *testing.T) {
+		err := repo.SetRetentionDays("00000000-0000-0000-0000-000000000000", 7)
+		assert.Error(t, err)
+		assert.Equal(t, "device not found", err.Error())
+	})
+}
+
+func TestMockRepository_RetentionDays(t *testing.T) {
+	repo := NewMockRepository()
+	device := &models.Device{ID: "device-1", Name: "Test Device"}
+	repo.AddDevice(device)
+
+	days, err := repo.GetRetentionDays(device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, days)
+
+	assert.NoError(t, repo.SetRetentionDays(device.ID, 7))
+	days, err = repo.GetRetentionDays(device.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, days)
+
+	err = repo.SetRetentionDays("missing", 7)
+	assert.Error(t, err)
+	assert.Equal(t, "device not found", err.Error())
+}
+
+func TestRepository_GetStatuses(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	// テスト用のデバイスを作成
+	first, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+	second, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateStatus(second.ID, "offline"))
+
+	t.Run("found devices", func(t *testing.T) {
+		statuses, err := repo.GetStatuses([]string{first.ID, second.ID})
+		require.NoError(t, err)
+		assert.Len(t, statuses, 2)
+		assert.Equal(t, "offline", statuses[second.ID].Status)
+	})
+
+	t.Run("missing and invalid ids are omitted", func(t *testing.T) {
+		statuses, err := repo.GetStatuses([]string{first.ID, "00000000-0000-0000-0000-000000000000", "not-a-uuid"})
+		require.NoError(t, err)
+		assert.Len(t, statuses, 1)
+		assert.Contains(t, statuses, first.ID)
+	})
+}
+
+func TestMockRepository_GetStatuses(t *testing.T) {
+	repo := NewMockRepository()
+	device := &models.Device{ID: "device-1", Status: "online"}
+	repo.AddDevice(device)
+
+	statuses, err := repo.GetStatuses([]string{"device-1", "missing"})
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "online", statuses["device-1"].Status)
+}
+
+func TestRepository_Settings(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 設定がないデバイス
+	settings, err := repo.GetSettings(createdDevice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, settings)
+
+	// 設定の保存と置き換え
+	require.NoError(t, repo.SetSettings(createdDevice.ID, map[string]json.RawMessage{
+		"interval": json.RawMessage(`30`),
+		"mode":     json.RawMessage(`"eco"`),
+	}))
+	require.NoError(t, repo.SetSettings(createdDevice.ID, map[string]json.RawMessage{
+		"interval": json.RawMessage(`60`),
+	}))
+
+	settings, err = repo.GetSettings(createdDevice.ID)
+	require.NoError(t, err)
+	require.Len(t, settings, 1)
+	assert.JSONEq(t, `60`, string(settings["interval"]))
+
+	// 存在しないデバイス
+	_, err = repo.GetSettings("00000000-0000-0000-0000-000000000000")
+	assert.EqualError(t, err, "device not found")
+	err = repo.SetSettings("non-existent-id", map[string]json.RawMessage{"interval": json.RawMessage(`30`)})
+	assert.EqualError(t, err, "device not found")
+}
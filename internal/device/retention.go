@@ -0,0 +1,51 @@
+package device
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RetentionSweeper periodically deletes device data past each device's retention period
+type RetentionSweeper struct {
+	dataRepo    DataRepositoryInterface
+	defaultDays int
+	interval    time.Duration
+	now         func() time.Time
+}
+
+// NewRetentionSweeper creates a sweeper that runs every interval.
+// defaultDays applies to devices without their own retention; 0 keeps their data forever.
+func NewRetentionSweeper(dataRepo DataRepositoryInterface, defaultDays int, interval time.Duration) *RetentionSweeper {
+	return &RetentionSweeper{
+		dataRepo:    dataRepo,
+		defaultDays: defaultDays,
+		interval:    interval,
+		now:         time.Now,
+	}
+}
+
+// Sweep deletes expired data once and returns the number of deleted rows
+func (s *RetentionSweeper) Sweep() (int64, error) {
+	return s.dataRepo.DeleteExpiredData(s.defaultDays, s.now())
+}
+
+// Run sweeps immediately and then on every interval until ctx is cancelled
+func (s *RetentionSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := s.Sweep(); err != nil {
+			log.Printf("Retention sweep failed: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Retention sweep deleted %d expired data records", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
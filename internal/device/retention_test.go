@@ -0,0 +1,103 @@
+package device
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionSweeper_Sweep(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetDeleteExpiredDataFunc(func(defaultDays int, at time.Time) (int64, error) {
+		assert.Equal(t, 30, defaultDays)
+		assert.Equal(t, now, at)
+		return 42, nil
+	})
+
+	sweeper := NewRetentionSweeper(dataRepo, 30, time.Hour)
+	sweeper.now = func() time.Time { return now }
+
+	deleted, err := sweeper.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), deleted)
+}
+
+func TestRetentionSweeper_Run(t *testing.T) {
+	sweeps := make(chan struct{}, 10)
+
+	dataRepo := NewMockDataRepository()
+	dataRepo.SetDeleteExpiredDataFunc(func(defaultDays int, at time.Time) (int64, error) {
+		sweeps <- struct{}{}
+		return 0, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewRetentionSweeper(dataRepo, 30, 10*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	// Initial sweep plus at least one on the interval
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sweeps:
+		case <-time.After(time.Second):
+			t.Fatal("expected retention sweep to run")
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected sweeper to stop after cancel")
+	}
+}
+
+func TestDataRepository_DeleteExpiredData(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// カスタム保持期間(7日)のデバイスとデフォルト保持期間のデバイスを作成
+	customDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+	require.NoError(t, repo.SetRetentionDays(customDevice.ID, 7))
+
+	defaultDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 各デバイスに3日前、10日前、40日前のデータを登録
+	for _, deviceID := range []string{customDevice.ID, defaultDevice.ID} {
+		for _, age := range []int{3, 10, 40} {
+			_, err := dataRepo.SaveData(createTestDeviceData(deviceID, now.AddDate(0, 0, -age)))
+			require.NoError(t, err)
+		}
+	}
+
+	deleted, err := dataRepo.DeleteExpiredData(30, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+
+	t.Run("custom retention keeps only recent data", func(t *testing.T) {
+		count, err := dataRepo.GetDataCount(customDevice.ID, "", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("default retention applies to devices without one", func(t *testing.T) {
+		count, err := dataRepo.GetDataCount(defaultDevice.ID, "", time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+}
@@ -0,0 +1,184 @@
+package device
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Rollup granularities, the period each device_data_rollup row averages
+const (
+	RollupHourly = "hour"
+	RollupDaily  = "day"
+)
+
+// RollupResult reports what a rollup run did
+type RollupResult struct {
+	Buckets int64 // rollup rows written, or merged with rows from earlier runs
+	Pruned  int64 // raw device_data rows deleted
+}
+
+// DataRoller rolls up raw device data older than a cutoff
+type DataRoller interface {
+	RollupData(granularity string, before time.Time) (RollupResult, error)
+}
+
+// rollupSteps are the two halves of a rollup, run in one transaction
+type rollupSteps interface {
+	aggregateRaw(granularity string, before time.Time) (int64, error)
+	pruneRaw(before time.Time) (int64, error)
+}
+
+// rollupData aggregates the raw data older than before, then deletes it.
+// Nothing is deleted unless the aggregation succeeded.
+func rollupData(steps rollupSteps, granularity string, before time.Time) (RollupResult, error) {
+	buckets, err := steps.aggregateRaw(granularity, before)
+	if err != nil {
+		return RollupResult{}, err
+	}
+
+	pruned, err := steps.pruneRaw(before)
+	if err != nil {
+		return RollupResult{}, err
+	}
+
+	return RollupResult{Buckets: buckets, Pruned: pruned}, nil
+}
+
+// RollupData aggregates the raw data older than before into device_data_rollup averages, minimums
+// and maximums per device, data type, unit and granularity bucket, then deletes the raw rows.
+// Both run in one transaction, so a failure leaves the raw data in place. Buckets rolled up by an
+// earlier run are merged with the new rows, weighted by their sample counts.
+func (r *DataRepository) RollupData(granularity string, before time.Time) (RollupResult, error) {
+	defer startQueryTimer("data.rollup").observe()
+
+	if granularity != RollupHourly && granularity != RollupDaily {
+		return RollupResult{}, fmt.Errorf("invalid rollup granularity %q", granularity)
+	}
+
+	// Already bound to a transaction, so the caller commits or rolls back
+	if r.conn == nil {
+		return rollupData(r, granularity, before)
+	}
+
+	var result RollupResult
+	err := r.conn.WithTx(context.Background(), func(tx *sql.Tx) error {
+		var err error
+		result, err = rollupData(r.WithTx(tx), granularity, before)
+		return err
+	})
+	if err != nil {
+		return RollupResult{}, err
+	}
+
+	return result, nil
+}
+
+// aggregateRaw writes the rollup rows of the raw data older than before
+func (r *DataRepository) aggregateRaw(granularity string, before time.Time) (int64, error) {
+	query := `
+		INSERT INTO device_data_rollup
+			(device_id, data_type, unit, granularity, bucket, avg_value, min_value, max_value, sample_count)
+		SELECT device_id, data_type, COALESCE(unit, ''), $1::text, date_trunc($1::text, timestamp),
+			AVG(value), MIN(value), MAX(value), COUNT(*)
+		FROM device_data
+		WHERE timestamp < $2
+		GROUP BY 1, 2, 3, 4, 5
+		ON CONFLICT (device_id, data_type, unit, granularity, bucket) DO UPDATE SET
+			avg_value = (device_data_rollup.avg_value * device_data_rollup.sample_count
+				+ EXCLUDED.avg_value * EXCLUDED.sample_count)
+				/ (device_data_rollup.sample_count + EXCLUDED.sample_count),
+			min_value = LEAST(device_data_rollup.min_value, EXCLUDED.min_value),
+			max_value = GREATEST(device_data_rollup.max_value, EXCLUDED.max_value),
+			sample_count = device_data_rollup.sample_count + EXCLUDED.sample_count
+	`
+
+	result, err := r.db.Exec(query, granularity, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll up device data: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// pruneRaw deletes the raw data older than before
+func (r *DataRepository) pruneRaw(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM device_data WHERE timestamp < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune rolled up device data: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// RollupPolicy selects the raw data rolled up: data older than AfterDays, into Granularity buckets
+type RollupPolicy struct {
+	AfterDays   int
+	Granularity string
+}
+
+// DataRollup periodically rolls up and prunes old raw device data
+type DataRollup struct {
+	roller   DataRoller
+	policy   RollupPolicy
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewDataRollup creates a rollup job that runs every interval
+func NewDataRollup(roller DataRoller, policy RollupPolicy, interval time.Duration) *DataRollup {
+	return &DataRollup{
+		roller:   roller,
+		policy:   policy,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Rollup rolls up the data older than the policy's cutoff once. The cutoff is aligned to the start of
+// a bucket, so a bucket is rolled up once its data has all aged past the window.
+func (j *DataRollup) Rollup() (RollupResult, error) {
+	return j.roller.RollupData(j.policy.Granularity, j.cutoff())
+}
+
+// cutoff returns the start of the bucket holding the time AfterDays ago
+func (j *DataRollup) cutoff() time.Time {
+	cutoff := j.now().AddDate(0, 0, -j.policy.AfterDays)
+	if j.policy.Granularity == RollupDaily {
+		return time.Date(cutoff.Year(), cutoff.Month(), cutoff.Day(), 0, 0, 0, 0, cutoff.Location())
+	}
+	return cutoff.Truncate(time.Hour)
+}
+
+// Run rolls up immediately and then on every interval until ctx is cancelled
+func (j *DataRollup) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if result, err := j.Rollup(); err != nil {
+			log.Printf("Data rollup failed: %v", err)
+		} else if result.Pruned > 0 {
+			log.Printf("Data rollup wrote %d %s buckets and pruned %d raw data records",
+				result.Buckets, j.policy.Granularity, result.Pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
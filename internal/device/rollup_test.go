@@ -0,0 +1,204 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRollupSteps records the rollup steps run, failing them with the configured errors
+type fakeRollupSteps struct {
+	aggregateErr error
+	pruneErr     error
+	steps        []string
+}
+
+func (s *fakeRollupSteps) aggregateRaw(granularity string, before time.Time) (int64, error) {
+	s.steps = append(s.steps, "aggregate")
+	return 3, s.aggregateErr
+}
+
+func (s *fakeRollupSteps) pruneRaw(before time.Time) (int64, error) {
+	s.steps = append(s.steps, "prune")
+	return 120, s.pruneErr
+}
+
+// fakeRoller records the cutoffs it is asked to roll up
+type fakeRoller struct {
+	granularity string
+	cutoffs     chan time.Time
+}
+
+func (r *fakeRoller) RollupData(granularity string, before time.Time) (RollupResult, error) {
+	r.granularity = granularity
+	r.cutoffs <- before
+	return RollupResult{}, nil
+}
+
+func TestRollupData_PrunesAfterAggregation(t *testing.T) {
+	failed := errors.New("rollup failed")
+
+	tests := []struct {
+		name          string
+		steps         *fakeRollupSteps
+		expectedSteps []string
+		expectedErr   error
+	}{
+		{"aggregated then pruned", &fakeRollupSteps{}, []string{"aggregate", "prune"}, nil},
+		{"nothing pruned when aggregation fails", &fakeRollupSteps{aggregateErr: failed}, []string{"aggregate"}, failed},
+		{"prune failure is reported", &fakeRollupSteps{pruneErr: failed}, []string{"aggregate", "prune"}, failed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := rollupData(tt.steps, RollupHourly, time.Now())
+			assert.Equal(t, tt.expectedSteps, tt.steps.steps)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Zero(t, result)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, RollupResult{Buckets: 3, Pruned: 120}, result)
+		})
+	}
+}
+
+func TestDataRollup_Cutoff(t *testing.T) {
+	now := time.Date(2024, 6, 10, 15, 42, 7, 0, time.UTC)
+
+	tests := []struct {
+		granularity string
+		expected    time.Time
+	}{
+		{RollupHourly, time.Date(2024, 5, 11, 15, 0, 0, 0, time.UTC)},
+		{RollupDaily, time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.granularity, func(t *testing.T) {
+			roller := &fakeRoller{cutoffs: make(chan time.Time, 1)}
+			job := NewDataRollup(roller, RollupPolicy{AfterDays: 30, Granularity: tt.granularity}, time.Hour)
+			job.now = func() time.Time { return now }
+
+			_, err := job.Rollup()
+			require.NoError(t, err)
+			assert.Equal(t, tt.granularity, roller.granularity)
+			assert.Equal(t, tt.expected, <-roller.cutoffs)
+		})
+	}
+}
+
+func TestDataRollup_Run(t *testing.T) {
+	roller := &fakeRoller{cutoffs: make(chan time.Time, 10)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewDataRollup(roller, RollupPolicy{AfterDays: 30, Granularity: RollupHourly}, 10*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	// Initial rollup plus at least one on the interval
+	for i := 0; i < 2; i++ {
+		select {
+		case <-roller.cutoffs:
+		case <-time.After(time.Second):
+			t.Fatal("expected data rollup to run")
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected data rollup to stop after cancel")
+	}
+}
+
+func TestDataRepository_RollupData(t *testing.T) {
+	t.Skip("Skipping repository test as it requires database setup")
+	db := setupTestDatabase(t)
+	defer db.Close()
+	_, err := db.Exec("DELETE FROM device_data_rollup")
+	require.NoError(t, err)
+
+	repo := NewRepository(db)
+	dataRepo := NewDataRepository(db)
+	createdDevice, err := repo.Create(createTestDeviceRequest())
+	require.NoError(t, err)
+
+	// 10:00台に3件、11:00台に1件、カットオフ後に1件のデータを登録
+	hour := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, reading := range []struct {
+		offset time.Duration
+		value  float64
+	}{
+		{5 * time.Minute, 20}, {20 * time.Minute, 22}, {50 * time.Minute, 27},
+		{70 * time.Minute, 30},
+		{3 * time.Hour, 40},
+	} {
+		_, err := dataRepo.SaveData(&models.DeviceData{
+			ID:        uuid.New().String(),
+			DeviceID:  createdDevice.ID,
+			Timestamp: hour.Add(reading.offset),
+			DataType:  "temperature",
+			Value:     reading.value,
+			Unit:      "°C",
+		})
+		require.NoError(t, err)
+	}
+
+	cutoff := hour.Add(2 * time.Hour)
+	result, err := dataRepo.RollupData(RollupHourly, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, RollupResult{Buckets: 2, Pruned: 4}, result)
+
+	// ロールアップの平均・最小・最大・件数
+	var avg, minValue, maxValue float64
+	var count int
+	err = db.QueryRow(`SELECT avg_value, min_value, max_value, sample_count FROM device_data_rollup
+		WHERE device_id = $1 AND granularity = 'hour' AND bucket = $2`, createdDevice.ID, hour).Scan(&avg, &minValue, &maxValue, &count)
+	require.NoError(t, err)
+	assert.InDelta(t, 23, avg, 1e-9)
+	assert.Equal(t, 20.0, minValue)
+	assert.Equal(t, 27.0, maxValue)
+	assert.Equal(t, 3, count)
+
+	// カットオフ以降の生データだけが残る
+	remaining, err := dataRepo.GetDataCount(createdDevice.ID, "", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, remaining)
+
+	// 後から届いた古いデータは既存のバケットに件数で重み付けして統合される
+	_, err = dataRepo.SaveData(&models.DeviceData{
+		ID:        uuid.New().String(),
+		DeviceID:  createdDevice.ID,
+		Timestamp: hour.Add(30 * time.Minute),
+		DataType:  "temperature",
+		Value:     35,
+		Unit:      "°C",
+	})
+	require.NoError(t, err)
+	_, err = dataRepo.RollupData(RollupHourly, cutoff)
+	require.NoError(t, err)
+
+	err = db.QueryRow(`SELECT avg_value, min_value, max_value, sample_count FROM device_data_rollup
+		WHERE device_id = $1 AND granularity = 'hour' AND bucket = $2`, createdDevice.ID, hour).Scan(&avg, &minValue, &maxValue, &count)
+	require.NoError(t, err)
+	assert.InDelta(t, 26, avg, 1e-9)
+	assert.Equal(t, 20.0, minValue)
+	assert.Equal(t, 35.0, maxValue)
+	assert.Equal(t, 4, count)
+
+	// 不正な粒度は何も変更しない
+	_, err = dataRepo.RollupData("minute", cutoff)
+	assert.Error(t, err)
+}
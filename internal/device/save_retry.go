@@ -0,0 +1,87 @@
+package device
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"iot-platform-go/internal/database"
+	"iot-platform-go/internal/metrics"
+	"iot-platform-go/pkg/models"
+)
+
+// SaveRetriesMetric is the name of the counter of reading saves retried after a transient database error
+const SaveRetriesMetric = "db_save_retries"
+
+// ReadingSaver saves readings, one at a time reporting false for a duplicate, or in batches
+// returning the readings inserted
+type ReadingSaver interface {
+	SaveData(data *models.DeviceData) (bool, error)
+	SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error)
+}
+
+// RetryPolicy bounds how a save failing with a transient database error is retried
+type RetryPolicy struct {
+	Attempts int           // attempts in all, including the first; 1 or less disables retries
+	Backoff  time.Duration // wait before the first retry, doubled before each following one
+}
+
+// RetryingSaver saves readings, retrying saves that fail with a transient database error
+// (a lost connection, serialization failure or deadlock) and giving up at once on permanent ones.
+// A retry after a lost connection may find the first attempt committed after all. The reading's
+// primary key then fails the retry instead of storing the reading twice, and SaveData takes that
+// as saved. A batch is not all-or-nothing, so a batch retry failing the same way is returned.
+type RetryingSaver struct {
+	saver  ReadingSaver
+	policy RetryPolicy
+	sleep  func(time.Duration)
+}
+
+// NewRetryingSaver creates a saver that retries saves through saver as policy allows
+func NewRetryingSaver(saver ReadingSaver, policy RetryPolicy) *RetryingSaver {
+	return &RetryingSaver{saver: saver, policy: policy, sleep: time.Sleep}
+}
+
+// SaveData saves the reading, retrying transient errors; the last error is returned once attempts run out
+func (s *RetryingSaver) SaveData(data *models.DeviceData) (bool, error) {
+	var inserted bool
+	attempts, err := s.retry(fmt.Sprintf("saving %s for device %s", data.DataType, data.DeviceID), func() error {
+		var err error
+		inserted, err = s.saver.SaveData(data)
+		return err
+	})
+	if err != nil && attempts > 1 && database.IsUniqueViolation(err) {
+		// An earlier attempt was committed before its connection was lost
+		return true, nil
+	}
+	return inserted, err
+}
+
+// SaveDataBatch saves the readings, retrying transient errors; the last error is returned once attempts run out
+func (s *RetryingSaver) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	var inserted []*models.DeviceData
+	_, err := s.retry(fmt.Sprintf("saving a batch of %d readings", len(data)), func() error {
+		var err error
+		inserted, err = s.saver.SaveDataBatch(data)
+		return err
+	})
+	return inserted, err
+}
+
+// retry runs save until it succeeds, fails with a permanent error or the attempts run out,
+// and returns the number of attempts made with the last error
+func (s *RetryingSaver) retry(what string, save func() error) (int, error) {
+	backoff := s.policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := save()
+		if err == nil || attempt >= s.policy.Attempts || !database.IsTransientError(err) {
+			return attempt, err
+		}
+
+		log.Printf("⚠️ Transient error %s, retrying in %s (attempt %d of %d): %v",
+			what, backoff, attempt+1, s.policy.Attempts, err)
+		metrics.Default.Counter(SaveRetriesMetric).Inc()
+		s.sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,137 @@
+package device
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/metrics"
+	"iot-platform-go/pkg/models"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySaver fails the first len(errs) saves with errs in turn, then saves
+type flakySaver struct {
+	errs     []error
+	attempts int
+	saved    []*models.DeviceData
+}
+
+func (s *flakySaver) SaveData(data *models.DeviceData) (bool, error) {
+	s.attempts++
+	if s.attempts <= len(s.errs) {
+		return false, s.errs[s.attempts-1]
+	}
+	s.saved = append(s.saved, data)
+	return true, nil
+}
+
+func (s *flakySaver) SaveDataBatch(data []*models.DeviceData) ([]*models.DeviceData, error) {
+	s.attempts++
+	if s.attempts <= len(s.errs) {
+		return nil, s.errs[s.attempts-1]
+	}
+	s.saved = append(s.saved, data...)
+	return data, nil
+}
+
+func newTestRetryingSaver(saver ReadingSaver, attempts int) (*RetryingSaver, *[]time.Duration) {
+	var waits []time.Duration
+	retrying := NewRetryingSaver(saver, RetryPolicy{Attempts: attempts, Backoff: 100 * time.Millisecond})
+	retrying.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return retrying, &waits
+}
+
+func TestRetryingSaver_TransientErrorsPersist(t *testing.T) {
+	lost := fmt.Errorf("failed to save device data: %w", driver.ErrBadConn)
+	saver := &flakySaver{errs: []error{lost, &pq.Error{Code: "40001"}}}
+	retrying, waits := newTestRetryingSaver(saver, 3)
+	retries := metrics.Default.Counter(SaveRetriesMetric).Value()
+
+	reading := testReading(1)
+	inserted, err := retrying.SaveData(reading)
+
+	// Two failures, then the row is saved on the third attempt
+	require.NoError(t, err)
+	assert.True(t, inserted)
+	assert.Equal(t, 3, saver.attempts)
+	assert.Equal(t, []*models.DeviceData{reading}, saver.saved)
+
+	// The backoff doubles, and each retry is counted
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, *waits)
+	assert.Equal(t, retries+2, metrics.Default.Counter(SaveRetriesMetric).Value())
+}
+
+func TestRetryingSaver_GivesUp(t *testing.T) {
+	lost := fmt.Errorf("failed to save device data: %w", driver.ErrBadConn)
+	unique := fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23505"})
+
+	tests := []struct {
+		name             string
+		errs             []error
+		attempts         int
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{"permanent error is not retried", []error{unique}, 3, 1, unique},
+		{"attempts run out", []error{lost, lost, lost}, 3, 3, lost},
+		{"retries disabled", []error{lost}, 1, 1, lost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver := &flakySaver{errs: tt.errs}
+			retrying, _ := newTestRetryingSaver(saver, tt.attempts)
+
+			inserted, err := retrying.SaveData(testReading(1))
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.False(t, inserted)
+			assert.Equal(t, tt.expectedAttempts, saver.attempts)
+			assert.Empty(t, saver.saved)
+		})
+	}
+}
+
+func TestRetryingSaver_CommittedAttemptCountsAsSaved(t *testing.T) {
+	lost := fmt.Errorf("failed to save device data: %w", driver.ErrBadConn)
+	unique := fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23505"})
+
+	// The first attempt was committed but its connection was lost, so the retry hits the primary key
+	saver := &flakySaver{errs: []error{lost, unique}}
+	retrying, _ := newTestRetryingSaver(saver, 3)
+
+	inserted, err := retrying.SaveData(testReading(1))
+	require.NoError(t, err)
+	assert.True(t, inserted)
+	assert.Equal(t, 2, saver.attempts)
+}
+
+func TestRetryingSaver_Batch(t *testing.T) {
+	lost := fmt.Errorf("failed to save device data: %w", driver.ErrBadConn)
+	unique := fmt.Errorf("failed to save device data: %w", &pq.Error{Code: "23505"})
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		saver := &flakySaver{errs: []error{lost}}
+		retrying, waits := newTestRetryingSaver(saver, 3)
+
+		batch := []*models.DeviceData{testReading(1), testReading(2)}
+		inserted, err := retrying.SaveDataBatch(batch)
+		require.NoError(t, err)
+		assert.Equal(t, batch, inserted)
+		assert.Equal(t, batch, saver.saved)
+		assert.Equal(t, []time.Duration{100 * time.Millisecond}, *waits)
+	})
+
+	t.Run("a unique violation on retry is returned", func(t *testing.T) {
+		saver := &flakySaver{errs: []error{lost, unique}}
+		retrying, _ := newTestRetryingSaver(saver, 3)
+
+		_, err := retrying.SaveDataBatch([]*models.DeviceData{testReading(1), testReading(2)})
+		assert.ErrorIs(t, err, unique)
+		assert.Equal(t, 2, saver.attempts)
+	})
+}
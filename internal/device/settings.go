@@ -0,0 +1,90 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// MaxSettingKeyLength is the longest device setting key, matching the device_settings.key column
+const MaxSettingKeyLength = 100
+
+// ParseSettingsDefaults turns the configured setting defaults into JSON values.
+// A value that is valid JSON other than null is kept as is; anything else is taken as a string.
+func ParseSettingsDefaults(raw map[string]string) map[string]json.RawMessage {
+	defaults := make(map[string]json.RawMessage, len(raw))
+	for key, value := range raw {
+		if json.Valid([]byte(value)) && !isJSONNull(json.RawMessage(value)) {
+			defaults[key] = json.RawMessage(value)
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		defaults[key] = encoded
+	}
+	return defaults
+}
+
+// NormalizeSettings validates settings against defaults and drops null values, which revert a key to its default.
+// Keys must be non-empty and at most MaxSettingKeyLength long, and a key with a default must keep its JSON type.
+func NormalizeSettings(settings, defaults map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	normalized := make(map[string]json.RawMessage, len(settings))
+	for key, value := range settings {
+		if key == "" || len(key) > MaxSettingKeyLength {
+			return nil, fmt.Errorf("setting keys must be 1 to %d characters long", MaxSettingKeyLength)
+		}
+		if isJSONNull(value) {
+			continue
+		}
+		if def, ok := defaults[key]; ok && jsonKind(def) != jsonKind(value) {
+			return nil, fmt.Errorf("setting %s must be a %s like its default", key, jsonKind(def))
+		}
+		normalized[key] = value
+	}
+	return normalized, nil
+}
+
+// EffectiveSettings overlays the device's settings on the defaults.
+// It also returns the keys that fell back to their default, sorted.
+func EffectiveSettings(settings, defaults map[string]json.RawMessage) (map[string]json.RawMessage, []string) {
+	effective := make(map[string]json.RawMessage, len(settings)+len(defaults))
+	defaulted := []string{}
+	for key, value := range defaults {
+		if _, ok := settings[key]; !ok {
+			effective[key] = value
+			defaulted = append(defaulted, key)
+		}
+	}
+	for key, value := range settings {
+		effective[key] = value
+	}
+	sort.Strings(defaulted)
+	return effective, defaulted
+}
+
+// isJSONNull reports whether value is the JSON null
+func isJSONNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// jsonKind names the JSON type of a value: object, array, string, number or boolean
+func jsonKind(value json.RawMessage) string {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	switch trimmed[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
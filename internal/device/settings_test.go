@@ -0,0 +1,87 @@
+package device
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSettingsDefaults(t *testing.T) {
+	defaults := ParseSettingsDefaults(map[string]string{
+		"interval": "30",
+		"enabled":  "true",
+		"mode":     "eco",
+		"label":    `"quoted"`,
+		"empty":    "null",
+	})
+
+	assert.Equal(t, map[string]json.RawMessage{
+		"interval": json.RawMessage(`30`),
+		"enabled":  json.RawMessage(`true`),
+		"mode":     json.RawMessage(`"eco"`),
+		"label":    json.RawMessage(`"quoted"`),
+		"empty":    json.RawMessage(`"null"`),
+	}, defaults)
+}
+
+func TestNormalizeSettings(t *testing.T) {
+	defaults := map[string]json.RawMessage{
+		"interval": json.RawMessage(`30`),
+		"mode":     json.RawMessage(`"eco"`),
+	}
+
+	tests := []struct {
+		name      string
+		settings  string
+		expected  string
+		expectErr bool
+	}{
+		{"keys with defaults", `{"interval":60,"mode":"boost"}`, `{"interval":60,"mode":"boost"}`, false},
+		{"keys without defaults take any type", `{"thresholds":[1,2],"calibration":{"offset":0.5}}`, `{"thresholds":[1,2],"calibration":{"offset":0.5}}`, false},
+		{"null reverts to the default", `{"interval":null,"mode":"boost"}`, `{"mode":"boost"}`, false},
+		{"type differs from the default", `{"interval":"60"}`, "", true},
+		{"empty key", `{"":1}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var settings map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(tt.settings), &settings))
+
+			normalized, err := NormalizeSettings(settings, defaults)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			encoded, err := json.Marshal(normalized)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(encoded))
+		})
+	}
+}
+
+func TestEffectiveSettings(t *testing.T) {
+	defaults := map[string]json.RawMessage{
+		"interval": json.RawMessage(`30`),
+		"mode":     json.RawMessage(`"eco"`),
+		"enabled":  json.RawMessage(`true`),
+	}
+
+	effective, defaulted := EffectiveSettings(map[string]json.RawMessage{
+		"interval":    json.RawMessage(`60`),
+		"calibration": json.RawMessage(`{"offset":0.5}`),
+	}, defaults)
+
+	encoded, err := json.Marshal(effective)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"interval":60,"mode":"eco","enabled":true,"calibration":{"offset":0.5}}`, string(encoded))
+	assert.Equal(t, []string{"enabled", "mode"}, defaulted)
+
+	// Without defaults nothing is defaulted
+	_, defaulted = EffectiveSettings(nil, nil)
+	assert.Empty(t, defaulted)
+}
@@ -0,0 +1,129 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamp tolerances
+const (
+	// TimestampStrict accepts only RFC3339 strings
+	TimestampStrict = "strict"
+	// TimestampFlexible also accepts RFC3339 without a zone and Unix seconds or milliseconds
+	TimestampFlexible = "flexible"
+)
+
+// Timestamp sources, which decide the time a reading is stored with
+const (
+	// TimestampSourceDevice keeps the timestamp sent by the device
+	TimestampSourceDevice = "device"
+	// TimestampSourceServer always uses the time the reading was received
+	TimestampSourceServer = "server"
+	// TimestampSourceClamp keeps device timestamps within MaxSkew of the receive time and clamps the rest
+	TimestampSourceClamp = "clamp"
+)
+
+// DefaultTimestampMaxSkew is the clamp window used when none is configured
+const DefaultTimestampMaxSkew = 5 * time.Minute
+
+// TimestampPolicy chooses between the device's timestamp and the receive time.
+// The zero value keeps the device timestamp.
+type TimestampPolicy struct {
+	Source  string
+	MaxSkew time.Duration
+	// Tolerance is how raw timestamps sent over HTTP are parsed: strict or flexible (the default)
+	Tolerance string
+}
+
+// Resolve returns the timestamp to store for a reading the device dated deviceTime and the server received at receivedAt.
+// clamped reports whether a clamp policy moved the device timestamp into the window.
+func (p TimestampPolicy) Resolve(deviceTime, receivedAt time.Time) (resolved time.Time, clamped bool) {
+	switch p.Source {
+	case TimestampSourceServer:
+		return receivedAt, false
+	case TimestampSourceClamp:
+		skew := p.MaxSkew
+		if skew <= 0 {
+			skew = DefaultTimestampMaxSkew
+		}
+		if earliest := receivedAt.Add(-skew); deviceTime.Before(earliest) {
+			return earliest, true
+		}
+		if latest := receivedAt.Add(skew); deviceTime.After(latest) {
+			return latest, true
+		}
+		return deviceTime, false
+	default:
+		return deviceTime, false
+	}
+}
+
+// epochMillisThreshold separates Unix seconds from Unix milliseconds; larger values are milliseconds.
+// 1e12 seconds is tens of thousands of years away, while 1e12 milliseconds is September 2001.
+const epochMillisThreshold = 1e12
+
+// flexibleLayouts are the string layouts tried by the flexible tolerance, in order.
+// Layouts without a zone are read as UTC.
+var flexibleLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ParseTimestamp parses a message timestamp, given as the raw JSON value, with the given tolerance
+func ParseTimestamp(raw json.RawMessage, tolerance string) (time.Time, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %s: %w", raw, err)
+	}
+
+	switch v := value.(type) {
+	case string:
+		if tolerance == TimestampStrict {
+			return time.Parse(time.RFC3339, v)
+		}
+		return parseFlexibleString(v)
+	case float64:
+		if tolerance == TimestampStrict {
+			return time.Time{}, fmt.Errorf("timestamp %s must be an RFC3339 string", raw)
+		}
+		return parseEpoch(v)
+	default:
+		return time.Time{}, fmt.Errorf("timestamp %s must be a string or number", raw)
+	}
+}
+
+// parseFlexibleString parses an RFC3339-like string or a numeric string holding a Unix timestamp
+func parseFlexibleString(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range flexibleLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	if epoch, err := strconv.ParseFloat(value, 64); err == nil {
+		return parseEpoch(epoch)
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised timestamp format %q", value)
+}
+
+// parseEpoch converts Unix seconds or milliseconds (told apart by magnitude) to a UTC time
+func parseEpoch(epoch float64) (time.Time, error) {
+	if math.IsNaN(epoch) || math.IsInf(epoch, 0) || epoch < 0 {
+		return time.Time{}, fmt.Errorf("invalid Unix timestamp %v", epoch)
+	}
+
+	if epoch >= epochMillisThreshold {
+		return time.UnixMilli(int64(epoch)).UTC(), nil
+	}
+
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+}
@@ -0,0 +1,91 @@
+package device
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimestamp_Flexible(t *testing.T) {
+	expected := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		raw      string
+		expected time.Time
+	}{
+		{"RFC3339", `"2024-01-01T12:30:00Z"`, expected},
+		{"RFC3339 with offset", `"2024-01-01T21:30:00+09:00"`, expected},
+		{"RFC3339Nano", `"2024-01-01T12:30:00.123456789Z"`, expected.Add(123456789 * time.Nanosecond)},
+		{"RFC3339 without zone", `"2024-01-01T12:30:00"`, expected},
+		{"space separated without zone", `"2024-01-01 12:30:00.5"`, expected.Add(500 * time.Millisecond)},
+		{"Unix seconds", `1704112200`, expected},
+		{"fractional Unix seconds", `1704112200.25`, expected.Add(250 * time.Millisecond)},
+		{"Unix milliseconds", `1704112200123`, expected.Add(123 * time.Millisecond)},
+		{"Unix seconds as string", `"1704112200"`, expected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := ParseTimestamp(json.RawMessage(tt.raw), TimestampFlexible)
+			require.NoError(t, err)
+			assert.True(t, tt.expected.Equal(ts), "expected %s, got %s", tt.expected, ts)
+		})
+	}
+}
+
+func TestParseTimestamp_Unparseable(t *testing.T) {
+	for _, raw := range []string{`"01/01/2024"`, `"yesterday"`, `true`, `-5`, `{}`, `not json`} {
+		t.Run(raw, func(t *testing.T) {
+			_, err := ParseTimestamp(json.RawMessage(raw), TimestampFlexible)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseTimestamp_Strict(t *testing.T) {
+	ts, err := ParseTimestamp(json.RawMessage(`"2024-01-01T12:30:00Z"`), TimestampStrict)
+	require.NoError(t, err)
+	assert.True(t, time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC).Equal(ts))
+
+	for _, raw := range []string{`"2024-01-01T12:30:00"`, `1704112200`, `"1704112200"`} {
+		_, err := ParseTimestamp(json.RawMessage(raw), TimestampStrict)
+		assert.Error(t, err, "strict tolerance should reject %s", raw)
+	}
+}
+
+func TestTimestampPolicy_Resolve(t *testing.T) {
+	received := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	inWindow := received.Add(-2 * time.Minute)
+	future := received.Add(time.Hour)
+	past := received.Add(-24 * time.Hour)
+
+	tests := []struct {
+		name            string
+		policy          TimestampPolicy
+		deviceTime      time.Time
+		expected        time.Time
+		expectedClamped bool
+	}{
+		{"device in window", TimestampPolicy{Source: TimestampSourceDevice}, inWindow, inWindow, false},
+		{"device out of window", TimestampPolicy{Source: TimestampSourceDevice}, future, future, false},
+		{"zero value keeps device time", TimestampPolicy{}, past, past, false},
+		{"server in window", TimestampPolicy{Source: TimestampSourceServer}, inWindow, received, false},
+		{"server out of window", TimestampPolicy{Source: TimestampSourceServer}, past, received, false},
+		{"clamp in window", TimestampPolicy{Source: TimestampSourceClamp, MaxSkew: 5 * time.Minute}, inWindow, inWindow, false},
+		{"clamp future", TimestampPolicy{Source: TimestampSourceClamp, MaxSkew: 5 * time.Minute}, future, received.Add(5 * time.Minute), true},
+		{"clamp past", TimestampPolicy{Source: TimestampSourceClamp, MaxSkew: 5 * time.Minute}, past, received.Add(-5 * time.Minute), true},
+		{"clamp default skew", TimestampPolicy{Source: TimestampSourceClamp}, future, received.Add(DefaultTimestampMaxSkew), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, clamped := tt.policy.Resolve(tt.deviceTime, received)
+			assert.True(t, tt.expected.Equal(resolved), "expected %s, got %s", tt.expected, resolved)
+			assert.Equal(t, tt.expectedClamped, clamped)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package device
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+)
+
+// tokenBytes is the amount of randomness in a device token
+const tokenBytes = 32
+
+// GenerateToken returns a new random device token and the hash stored for it
+func GenerateToken() (token, hash string, err error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate device token: %w", err)
+	}
+
+	token = hex.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the SHA-256 hash of a device token.
+// Tokens are random, so a fast hash is enough to keep them unusable if the database leaks.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyToken reports whether token matches the stored hash; an empty hash matches nothing
+func VerifyToken(token, hash string) bool {
+	if token == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
@@ -0,0 +1,27 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, hash, err := GenerateToken()
+	require.NoError(t, err)
+
+	assert.Len(t, token, 2*tokenBytes)
+	assert.Equal(t, HashToken(token), hash)
+	assert.True(t, VerifyToken(token, hash))
+
+	other, _, err := GenerateToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	assert.False(t, VerifyToken(other, hash))
+}
+
+func TestVerifyToken_Empty(t *testing.T) {
+	assert.False(t, VerifyToken("", HashToken("")))
+	assert.False(t, VerifyToken("token", ""))
+}
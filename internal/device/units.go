@@ -0,0 +1,74 @@
+package device
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// UnitNormalizer maps unit aliases to a canonical unit per data type
+type UnitNormalizer struct {
+	aliases map[string]map[string]string // data type -> lower-case alias -> canonical unit
+	unknown sync.Map                     // data type + unit combinations already logged as unknown
+}
+
+// DefaultUnitAliases returns the built-in alias table keyed by data type and canonical unit
+func DefaultUnitAliases() map[string]map[string][]string {
+	return map[string]map[string][]string{
+		"temperature": {
+			"°C": {"c", "°c", "℃", "degc", "celsius"},
+			"°F": {"f", "°f", "℉", "degf", "fahrenheit"},
+			"K":  {"k", "kelvin"},
+		},
+		"humidity": {
+			"%": {"%", "%rh", "rh", "percent"},
+		},
+		"pressure": {
+			"hPa": {"hpa", "mbar", "millibar"},
+			"Pa":  {"pa", "pascal"},
+			"kPa": {"kpa", "kilopascal"},
+		},
+		"voltage": {
+			"V":  {"v", "volt", "volts"},
+			"mV": {"mv", "millivolt", "millivolts"},
+		},
+		"battery": {
+			"%": {"%", "percent"},
+		},
+	}
+}
+
+// NewUnitNormalizer creates a unit normalizer from an alias table keyed by data type and canonical unit
+func NewUnitNormalizer(table map[string]map[string][]string) *UnitNormalizer {
+	aliases := make(map[string]map[string]string, len(table))
+	for dataType, units := range table {
+		aliases[dataType] = make(map[string]string)
+		for canonical, unitAliases := range units {
+			aliases[dataType][strings.ToLower(canonical)] = canonical
+			for _, alias := range unitAliases {
+				aliases[dataType][strings.ToLower(alias)] = canonical
+			}
+		}
+	}
+
+	return &UnitNormalizer{aliases: aliases}
+}
+
+// Normalize returns the canonical unit for the data type.
+// Unknown units are returned unchanged and logged once.
+func (n *UnitNormalizer) Normalize(dataType, unit string) string {
+	trimmed := strings.TrimSpace(unit)
+	if trimmed == "" {
+		return unit
+	}
+
+	if canonical, ok := n.aliases[dataType][strings.ToLower(trimmed)]; ok {
+		return canonical
+	}
+
+	if _, logged := n.unknown.LoadOrStore(dataType+"\x00"+trimmed, true); !logged {
+		log.Printf("⚠️ Unknown unit %q for data type %q, storing as is", trimmed, dataType)
+	}
+
+	return unit
+}
@@ -0,0 +1,48 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitNormalizer_Normalize(t *testing.T) {
+	normalizer := NewUnitNormalizer(DefaultUnitAliases())
+
+	tests := []struct {
+		name     string
+		dataType string
+		unit     string
+		expected string
+	}{
+		{"celsius symbol", "temperature", "C", "°C"},
+		{"celsius with degree sign", "temperature", "°C", "°C"},
+		{"celsius name", "temperature", "celsius", "°C"},
+		{"celsius mixed case with spaces", "temperature", " Celsius ", "°C"},
+		{"fahrenheit", "temperature", "F", "°F"},
+		{"humidity percent", "humidity", "percent", "%"},
+		{"humidity relative", "humidity", "%RH", "%"},
+		{"pressure millibar", "pressure", "mbar", "hPa"},
+		{"pressure canonical", "pressure", "hPa", "hPa"},
+		{"voltage", "voltage", "volts", "V"},
+		{"unknown unit passes through", "temperature", "rankine", "rankine"},
+		{"unknown data type passes through", "co2", "ppm", "ppm"},
+		{"alias of another data type is not applied", "voltage", "C", "C"},
+		{"empty unit", "temperature", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizer.Normalize(tt.dataType, tt.unit))
+		})
+	}
+}
+
+func TestNewUnitNormalizer_CustomTable(t *testing.T) {
+	normalizer := NewUnitNormalizer(map[string]map[string][]string{
+		"co2": {"ppm": {"parts per million"}},
+	})
+
+	assert.Equal(t, "ppm", normalizer.Normalize("co2", "Parts Per Million"))
+	assert.Equal(t, "C", normalizer.Normalize("temperature", "C"))
+}
@@ -2,16 +2,25 @@ package influxdb
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"iot-platform-go/internal/config"
+	"iot-platform-go/internal/logging"
 	"iot-platform-go/pkg/models"
 
 	"github.com/google/uuid"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 )
 
 // Client represents an InfluxDB client
@@ -20,11 +29,31 @@ type Client struct {
 	writeAPI api.WriteAPIBlocking
 	queryAPI api.QueryAPI
 	config   *config.InfluxDBConfig
+
+	// bucketWriteAPIs write to the buckets data types are routed to, keyed by bucket
+	bucketWriteAPIs map[string]api.WriteAPIBlocking
+}
+
+// writePrecisions maps the INFLUXDB_PRECISION values to the precision points are written with
+var writePrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// clientOptions returns the client options for the config, writing with its precision (nanoseconds by default)
+func clientOptions(cfg *config.InfluxDBConfig) *influxdb2.Options {
+	precision, ok := writePrecisions[cfg.Precision]
+	if !ok {
+		precision = time.Nanosecond
+	}
+	return influxdb2.DefaultOptions().SetPrecision(precision)
 }
 
 // NewClient creates a new InfluxDB client
 func NewClient(cfg *config.InfluxDBConfig) (*Client, error) {
-	client := influxdb2.NewClient(cfg.URL, cfg.Token)
+	client := influxdb2.NewClientWithOptions(cfg.URL, cfg.Token, clientOptions(cfg))
 
 	// Test the connection
 	_, err := client.Ping(context.Background())
@@ -35,20 +64,70 @@ func NewClient(cfg *config.InfluxDBConfig) (*Client, error) {
 	writeAPI := client.WriteAPIBlocking(cfg.Org, cfg.Bucket)
 	queryAPI := client.QueryAPI(cfg.Org)
 
+	bucketWriteAPIs := make(map[string]api.WriteAPIBlocking)
+	for _, bucket := range cfg.Buckets {
+		if _, ok := bucketWriteAPIs[bucket]; !ok && bucket != cfg.Bucket {
+			bucketWriteAPIs[bucket] = client.WriteAPIBlocking(cfg.Org, bucket)
+		}
+	}
+
 	log.Printf("✅ Connected to InfluxDB at %s", cfg.URL)
 
 	return &Client{
-		client:   client,
-		writeAPI: writeAPI,
-		queryAPI: queryAPI,
-		config:   cfg,
+		client:          client,
+		writeAPI:        writeAPI,
+		queryAPI:        queryAPI,
+		config:          cfg,
+		bucketWriteAPIs: bucketWriteAPIs,
 	}, nil
 }
 
-// WriteDeviceData writes device data to InfluxDB
-func (c *Client) WriteDeviceData(data *models.DeviceData) error {
-	point := influxdb2.NewPoint(
-		"device_data",
+// ErrNonFiniteValue is returned for readings whose value is NaN or infinite
+var ErrNonFiniteValue = errors.New("value must be a finite number")
+
+// WriteDeviceData writes device data to the bucket and measurement its data type is routed to.
+// Readings with a NaN or infinite value are skipped, since InfluxDB cannot store them.
+func (c *Client) WriteDeviceData(ctx context.Context, data *models.DeviceData) error {
+	target := c.target(data.DataType)
+	point, err := newDataPoint(data, target.measurement)
+	if err != nil {
+		if errors.Is(err, ErrNonFiniteValue) {
+			log.Printf("Skipping InfluxDB write for device %s (%s): %v", data.DeviceID, data.DataType, err)
+			return nil
+		}
+		return err
+	}
+
+	err = c.writeAPIFor(target.bucket).WritePoint(ctx, point)
+	if err != nil {
+		return fmt.Errorf("failed to write data point: %w", err)
+	}
+
+	return nil
+}
+
+// writeAPIFor returns the write API of a bucket, the configured bucket's unless a data type is routed elsewhere
+func (c *Client) writeAPIFor(bucket string) api.WriteAPIBlocking {
+	if writeAPI, ok := c.bucketWriteAPIs[bucket]; ok {
+		return writeAPI
+	}
+	return c.writeAPI
+}
+
+// newDataPoint validates device data and builds the InfluxDB point for it in the given measurement
+func newDataPoint(data *models.DeviceData, measurement string) (*write.Point, error) {
+	if err := validateTag("device_id", data.DeviceID); err != nil {
+		return nil, err
+	}
+	if err := validateTag("data_type", data.DataType); err != nil {
+		return nil, err
+	}
+	if math.IsNaN(data.Value) || math.IsInf(data.Value, 0) {
+		return nil, ErrNonFiniteValue
+	}
+
+	return influxdb2.NewPoint(
+		measurement,
 		map[string]string{
 			"device_id": data.DeviceID,
 			"data_type": data.DataType,
@@ -58,36 +137,36 @@ func (c *Client) WriteDeviceData(data *models.DeviceData) error {
 			"value": data.Value,
 		},
 		data.Timestamp,
-	)
+	), nil
+}
 
-	err := c.writeAPI.WritePoint(context.Background(), point)
-	if err != nil {
-		return fmt.Errorf("failed to write data point: %w", err)
+// validateTag rejects empty tag values and values containing control characters,
+// which would otherwise produce malformed series
+func validateTag(key, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("tag %s must not be empty", key)
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("tag %s contains control characters", key)
 	}
-
 	return nil
 }
 
-// QueryDeviceData queries device data from InfluxDB
-func (c *Client) QueryDeviceData(deviceID string, dataType string, start time.Time, end time.Time, limit int) (
-	[]*models.DeviceData, error) {
-	query := fmt.Sprintf(`
-		from(bucket: %q)
-			|> range(start: %s, stop: %s)
-			|> filter(fn: (r) => r["_measurement"] == "device_data")
-			|> filter(fn: (r) => r["device_id"] == %q)
-	`, c.config.Bucket, start.Format(time.RFC3339), end.Format(time.RFC3339), deviceID)
-
-	if dataType != "" {
-		query += fmt.Sprintf(`|> filter(fn: (r) => r["data_type"] == %q)`, dataType)
-	}
+// QueryDeviceData queries device data from InfluxDB.
+// The query is cancelled when ctx is done or the configured query timeout elapses.
+func (c *Client) QueryDeviceData(ctx context.Context, deviceID string, dataType string, start time.Time, end time.Time,
+	limit int) ([]*models.DeviceData, error) {
+	query := c.querySource(deviceID, dataType, start, end)
 
 	query += fmt.Sprintf(`
 		|> sort(columns: ["_time"])
 		|> limit(n: %d)
 	`, limit)
 
-	result, err := c.queryAPI.Query(context.Background(), query)
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	result, err := c.queryAPI.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query data: %w", err)
 	}
@@ -95,125 +174,176 @@ func (c *Client) QueryDeviceData(deviceID string, dataType string, start time.Ti
 
 	var dataPoints []*models.DeviceData
 	for result.Next() {
-		record := result.Record()
-
-		// Parse the value using type switch
-		var value float64
-		switch v := record.Value().(type) {
-		case float64:
-			value = v
-		case int64:
-			value = float64(v)
-		default:
-			continue // Skip non-numeric values
-		}
-
-		// Get device_id from tags
-		deviceID := ""
-		if deviceIDVal, ok := record.ValueByKey("device_id").(string); ok {
-			deviceID = deviceIDVal
-		}
-
-		// Get data_type from tags
-		dataType := ""
-		if dataTypeVal, ok := record.ValueByKey("data_type").(string); ok {
-			dataType = dataTypeVal
-		}
-
-		// Get unit from tags
-		unit := ""
-		if unitVal, ok := record.ValueByKey("unit").(string); ok {
-			unit = unitVal
-		}
-
-		dataPoint := &models.DeviceData{
-			ID:        uuid.New().String(), // Generate new UUID for API response
-			DeviceID:  deviceID,
-			Timestamp: record.Time(),
-			DataType:  dataType,
-			Value:     value,
-			Unit:      unit,
-			Metadata:  "",
+		dataPoint, err := c.recordToDeviceData(result.Record())
+		if err != nil {
+			logging.Debugf("Skipping InfluxDB record for device %s: %v", deviceID, err)
+			continue
 		}
 		dataPoints = append(dataPoints, dataPoint)
 	}
 
+	// Next also stops when the query is cancelled or times out mid-stream, so partial data is not returned
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query result: %w", err)
+	}
+
 	return dataPoints, nil
 }
 
-// GetLatestDeviceData gets the latest data point for a device
-func (c *Client) GetLatestDeviceData(deviceID string, dataType string) (*models.DeviceData, error) {
+// GetLatestDeviceData gets the latest data point for a device.
+// The query is cancelled when ctx is done or the configured query timeout elapses.
+func (c *Client) GetLatestDeviceData(ctx context.Context, deviceID string, dataType string) (*models.DeviceData, error) {
 	end := time.Now()
 	start := end.Add(-24 * time.Hour) // Last 24 hours
 
-	query := fmt.Sprintf(`
-		from(bucket: %q)
-			|> range(start: %s, stop: %s)
-			|> filter(fn: (r) => r["_measurement"] == "device_data")
-			|> filter(fn: (r) => r["device_id"] == %q)
-	`, c.config.Bucket, start.Format(time.RFC3339), end.Format(time.RFC3339), deviceID)
-
-	if dataType != "" {
-		query += fmt.Sprintf(`|> filter(fn: (r) => r["data_type"] == %q)`, dataType)
-	}
+	query := c.querySource(deviceID, dataType, start, end)
 
 	query += `
 		|> sort(columns: ["_time"], desc: true)
 		|> limit(n: 1)
 	`
 
-	result, err := c.queryAPI.Query(context.Background(), query)
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	result, err := c.queryAPI.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query latest data: %w", err)
 	}
 	defer result.Close()
 
 	if !result.Next() {
+		if err := result.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read latest data: %w", err)
+		}
 		return nil, fmt.Errorf("no data found for device %s", deviceID)
 	}
 
-	record := result.Record()
-
-	// Parse the value using type switch
-	var value float64
-	switch v := record.Value().(type) {
-	case float64:
-		value = v
-	case int64:
-		value = float64(v)
-	default:
-		return nil, fmt.Errorf("invalid value type for device %s", deviceID)
+	dataPoint, err := c.recordToDeviceData(result.Record())
+	if err != nil {
+		return nil, fmt.Errorf("invalid latest data for device %s: %w", deviceID, err)
 	}
 
-	// Get device_id from tags
-	deviceIDFromRecord := ""
-	if deviceIDVal, ok := record.ValueByKey("device_id").(string); ok {
-		deviceIDFromRecord = deviceIDVal
-	}
+	return dataPoint, nil
+}
 
-	// Get data_type from tags
-	dataTypeFromRecord := ""
-	if dataTypeVal, ok := record.ValueByKey("data_type").(string); ok {
-		dataTypeFromRecord = dataTypeVal
+// recordToDeviceData converts a query record to device data, taking the device, type and unit from its tags
+func (c *Client) recordToDeviceData(record *query.FluxRecord) (*models.DeviceData, error) {
+	value, err := numericValue(record.Value(), c.config.BoolAsNumber)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get unit from tags
-	unit := ""
-	if unitVal, ok := record.ValueByKey("unit").(string); ok {
-		unit = unitVal
-	}
+	// Tags are missing from records written by other producers; leave those fields empty
+	deviceID, _ := record.ValueByKey("device_id").(string)
+	dataType, _ := record.ValueByKey("data_type").(string)
+	unit, _ := record.ValueByKey("unit").(string)
 
 	return &models.DeviceData{
 		ID:        uuid.New().String(), // Generate new UUID for API response
-		DeviceID:  deviceIDFromRecord,
+		DeviceID:  deviceID,
 		Timestamp: record.Time(),
-		DataType:  dataTypeFromRecord,
+		DataType:  dataType,
 		Value:     value,
 		Unit:      unit,
 		Metadata:  "",
 	}, nil
 }
 
+// numericValue converts a record value to a float64. Numeric strings are parsed;
+// booleans become 1 or 0 only when boolAsNumber is set.
+func numericValue(value interface{}, boolAsNumber bool) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("non-numeric string value %q", v)
+		}
+		return f, nil
+	case bool:
+		if !boolAsNumber {
+			return 0, fmt.Errorf("boolean value (set INFLUXDB_BOOL_AS_NUMBER to read booleans as 1/0)")
+		}
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// DeleteDeviceData deletes every point stored for a device, in every bucket and measurement data is routed to.
+// The delete is cancelled when ctx is done or the configured query timeout elapses.
+func (c *Client) DeleteDeviceData(ctx context.Context, deviceID string) error {
+	targets := c.targets()
+	predicates := make([]string, len(targets))
+	for i, target := range targets {
+		predicate, err := devicePredicate(target.measurement, deviceID)
+		if err != nil {
+			return err
+		}
+		predicates[i] = predicate
+	}
+
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	// The delete predicate does not support OR, so each measurement is deleted separately
+	for i, target := range targets {
+		err := c.client.DeleteAPI().DeleteWithName(ctx, c.config.Org, target.bucket, time.Unix(0, 0), time.Now(), predicates[i])
+		if err != nil {
+			return fmt.Errorf("failed to delete data for device %s: %w", deviceID, err)
+		}
+	}
+
+	return nil
+}
+
+// devicePredicate builds the delete predicate selecting a device's series in a measurement.
+// The predicate syntax has no escaping, so IDs containing quotes are rejected.
+func devicePredicate(measurement, deviceID string) (string, error) {
+	if err := validateTag("device_id", deviceID); err != nil {
+		return "", err
+	}
+	if strings.Contains(deviceID, `"`) {
+		return "", fmt.Errorf("tag device_id contains a double quote")
+	}
+	return fmt.Sprintf(`_measurement="%s" AND device_id="%s"`, measurement, deviceID), nil
+}
+
+// Ping checks that InfluxDB is reachable and ready, within the configured query timeout
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	ok, err := c.client.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to ping InfluxDB: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("InfluxDB is not ready")
+	}
+
+	return nil
+}
+
+// queryContext applies the configured query timeout to ctx; a timeout of zero leaves ctx unchanged
+func (c *Client) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.config.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.config.QueryTimeout)
+}
+
 // Close closes the InfluxDB client
 func (c *Client) Close() {
 	c.client.Close()
@@ -0,0 +1,370 @@
+package influxdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+	"iot-platform-go/pkg/models"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestDeviceData() *models.DeviceData {
+	return &models.DeviceData{
+		ID:        "data-1",
+		DeviceID:  "device-1",
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		DataType:  "temperature",
+		Value:     25.5,
+		Unit:      "celsius",
+	}
+}
+
+func TestNewDataPoint(t *testing.T) {
+	t.Run("valid point", func(t *testing.T) {
+		data := createTestDeviceData()
+
+		point, err := newDataPoint(data, defaultMeasurement)
+		require.NoError(t, err)
+
+		assert.Equal(t, "device_data", point.Name())
+		assert.Equal(t, data.Timestamp, point.Time())
+
+		tags := map[string]string{}
+		for _, tag := range point.TagList() {
+			tags[tag.Key] = tag.Value
+		}
+		assert.Equal(t, map[string]string{
+			"device_id": "device-1",
+			"data_type": "temperature",
+			"unit":      "celsius",
+		}, tags)
+
+		require.Len(t, point.FieldList(), 1)
+		assert.Equal(t, "value", point.FieldList()[0].Key)
+		assert.Equal(t, 25.5, point.FieldList()[0].Value)
+	})
+
+	tagTests := []struct {
+		name   string
+		modify func(*models.DeviceData)
+	}{
+		{
+			name:   "empty device id",
+			modify: func(d *models.DeviceData) { d.DeviceID = "" },
+		},
+		{
+			name:   "blank data type",
+			modify: func(d *models.DeviceData) { d.DataType = "  " },
+		},
+		{
+			name:   "device id with newline",
+			modify: func(d *models.DeviceData) { d.DeviceID = "device-1\nmalformed" },
+		},
+		{
+			name:   "data type with control character",
+			modify: func(d *models.DeviceData) { d.DataType = "temp\x00erature" },
+		},
+	}
+
+	for _, tt := range tagTests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := createTestDeviceData()
+			tt.modify(data)
+
+			point, err := newDataPoint(data, defaultMeasurement)
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, ErrNonFiniteValue)
+			assert.Nil(t, point)
+		})
+	}
+
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		t.Run("non-finite value", func(t *testing.T) {
+			data := createTestDeviceData()
+			data.Value = value
+
+			point, err := newDataPoint(data, defaultMeasurement)
+			assert.ErrorIs(t, err, ErrNonFiniteValue)
+			assert.Nil(t, point)
+		})
+	}
+}
+
+func TestWriteDeviceData_SkipsNonFiniteValue(t *testing.T) {
+	// A nil write API would panic if the point were written
+	client := &Client{config: &config.InfluxDBConfig{Bucket: "bucket"}}
+	data := createTestDeviceData()
+	data.Value = math.NaN()
+
+	assert.NoError(t, client.WriteDeviceData(context.Background(), data))
+}
+
+func TestWriteDeviceData_InvalidTags(t *testing.T) {
+	client := &Client{config: &config.InfluxDBConfig{Bucket: "bucket"}}
+	data := createTestDeviceData()
+	data.DeviceID = ""
+
+	assert.Error(t, client.WriteDeviceData(context.Background(), data))
+}
+
+func TestDevicePredicate(t *testing.T) {
+	predicate, err := devicePredicate(defaultMeasurement, "device-1")
+	require.NoError(t, err)
+	assert.Equal(t, `_measurement="device_data" AND device_id="device-1"`, predicate)
+
+	for _, id := range []string{"", "device-1\nmalformed", `device" OR device_id="other`} {
+		_, err := devicePredicate(defaultMeasurement, id)
+		assert.Error(t, err, "device id %q", id)
+	}
+}
+
+func TestDeleteDeviceData_InvalidDeviceID(t *testing.T) {
+	// A nil client would panic if the delete were sent
+	client := &Client{config: &config.InfluxDBConfig{Bucket: "bucket"}}
+
+	assert.Error(t, client.DeleteDeviceData(context.Background(), ""))
+}
+
+// newHangingClient returns a client whose server never answers until the request is cancelled
+func newHangingClient(t *testing.T, queryTimeout time.Duration) *Client {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stop) })
+
+	cfg := &config.InfluxDBConfig{URL: server.URL, Token: "token", Org: "org", Bucket: "bucket", QueryTimeout: queryTimeout}
+	client := influxdb2.NewClient(cfg.URL, cfg.Token)
+	t.Cleanup(client.Close)
+
+	return &Client{
+		client:   client,
+		writeAPI: client.WriteAPIBlocking(cfg.Org, cfg.Bucket),
+		queryAPI: client.QueryAPI(cfg.Org),
+		config:   cfg,
+	}
+}
+
+func TestQueryDeviceData_ContextCancelled(t *testing.T) {
+	client := newHangingClient(t, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.QueryDeviceData(ctx, "device-1", "", time.Now().Add(-time.Hour), time.Now(), 10)
+
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.True(t, errors.Is(err, context.Canceled), "expected context error, got %v", err)
+}
+
+func TestQueryDeviceData_TimeoutMidStream(t *testing.T) {
+	// The server sends one record, then hangs until the query times out
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		fmt.Fprint(w, "#datatype,string,long,dateTime:RFC3339,double,string,string,string\r\n"+
+			"#group,false,false,false,false,true,true,true\r\n"+
+			"#default,_result,,,,,,\r\n"+
+			",result,table,_time,_value,_field,device_id,data_type\r\n"+
+			",,0,2024-01-01T00:00:00Z,21.5,value,device-1,temperature\r\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stop) })
+
+	cfg := &config.InfluxDBConfig{URL: server.URL, Token: "token", Org: "org", Bucket: "bucket", QueryTimeout: 100 * time.Millisecond}
+	influx := influxdb2.NewClient(cfg.URL, cfg.Token)
+	t.Cleanup(influx.Close)
+	client := &Client{client: influx, queryAPI: influx.QueryAPI(cfg.Org), config: cfg}
+
+	data, err := client.QueryDeviceData(context.Background(), "device-1", "", time.Now().Add(-time.Hour), time.Now(), 10)
+
+	require.Error(t, err, "partial data must not be returned as a complete result")
+	assert.Nil(t, data)
+}
+
+func TestGetLatestDeviceData_QueryTimeout(t *testing.T) {
+	client := newHangingClient(t, 50*time.Millisecond)
+
+	start := time.Now()
+	_, err := client.GetLatestDeviceData(context.Background(), "device-1", "")
+
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "expected deadline error, got %v", err)
+}
+
+func TestNumericValue(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        interface{}
+		boolAsNumber bool
+		expected     float64
+		expectError  bool
+	}{
+		{name: "float64", value: 25.5, expected: 25.5},
+		{name: "int64", value: int64(-3), expected: -3},
+		{name: "uint64", value: uint64(42), expected: 42},
+		{name: "json.Number", value: json.Number("1.25"), expected: 1.25},
+		{name: "numeric string", value: " 18.5 ", expected: 18.5},
+		{name: "non-numeric string", value: "open", expectError: true},
+		{name: "NaN string", value: "NaN", expectError: true},
+		{name: "bool without flag", value: true, expectError: true},
+		{name: "true as number", value: true, boolAsNumber: true, expected: 1},
+		{name: "false as number", value: false, boolAsNumber: true, expected: 0},
+		{name: "unsupported type", value: []byte("1"), expectError: true},
+		{name: "nil", value: nil, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := numericValue(tt.value, tt.boolAsNumber)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
+
+// csvTable renders one annotated CSV table holding a single record whose _value has the given Flux data type
+func csvTable(table int, datatype, value string) string {
+	return fmt.Sprintf(`#datatype,string,long,dateTime:RFC3339,%s,string,string,string,string,string
+#group,false,false,false,false,true,true,true,true,true
+#default,_result,,,,,,,,
+,result,table,_time,_value,_field,_measurement,device_id,data_type,unit
+,,%d,2024-01-01T00:00:0%dZ,%s,value,device_data,device-1,type-%d,celsius
+
+`, datatype, table, table, value, table)
+}
+
+// newStubQueryClient returns a client whose queries are answered with the given annotated CSV
+func newStubQueryClient(t *testing.T, csv string, boolAsNumber bool) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		_, _ = w.Write([]byte(csv))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.InfluxDBConfig{URL: server.URL, Token: "token", Org: "org", Bucket: "bucket", BoolAsNumber: boolAsNumber}
+	client := influxdb2.NewClient(cfg.URL, cfg.Token)
+	t.Cleanup(client.Close)
+
+	return &Client{client: client, queryAPI: client.QueryAPI(cfg.Org), config: cfg}
+}
+
+func TestQueryDeviceData_ValueTypes(t *testing.T) {
+	csv := strings.Join([]string{
+		csvTable(0, "double", "25.5"),
+		csvTable(1, "long", "-3"),
+		csvTable(2, "unsignedLong", "42"),
+		csvTable(3, "string", "18.5"),
+		csvTable(4, "string", "open"),
+		csvTable(5, "boolean", "true"),
+	}, "")
+
+	valuesByType := func(points []*models.DeviceData) map[string]float64 {
+		values := make(map[string]float64)
+		for _, p := range points {
+			assert.Equal(t, "device-1", p.DeviceID)
+			assert.Equal(t, "celsius", p.Unit)
+			values[p.DataType] = p.Value
+		}
+		return values
+	}
+
+	t.Run("booleans skipped by default", func(t *testing.T) {
+		client := newStubQueryClient(t, csv, false)
+		points, err := client.QueryDeviceData(context.Background(), "device-1", "", time.Now().Add(-time.Hour), time.Now(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"type-0": 25.5, "type-1": -3, "type-2": 42, "type-3": 18.5}, valuesByType(points))
+	})
+
+	t.Run("booleans as numbers", func(t *testing.T) {
+		client := newStubQueryClient(t, csv, true)
+		points, err := client.QueryDeviceData(context.Background(), "device-1", "", time.Now().Add(-time.Hour), time.Now(), 10)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"type-0": 25.5, "type-1": -3, "type-2": 42, "type-3": 18.5, "type-5": 1}, valuesByType(points))
+	})
+}
+
+func TestGetLatestDeviceData_ValueTypes(t *testing.T) {
+	client := newStubQueryClient(t, csvTable(0, "unsignedLong", "7"), false)
+	latest, err := client.GetLatestDeviceData(context.Background(), "device-1", "")
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, latest.Value)
+
+	client = newStubQueryClient(t, csvTable(0, "string", "open"), false)
+	_, err = client.GetLatestDeviceData(context.Background(), "device-1", "")
+	assert.Error(t, err)
+}
+
+func TestWriteDeviceData_Precision(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		precision         string
+		expectedParam     string
+		expectedTimestamp string
+	}{
+		{"", "ns", "1704067200123456789"},
+		{"ns", "ns", "1704067200123456789"},
+		{"us", "us", "1704067200123456"},
+		{"ms", "ms", "1704067200123"},
+		{"s", "s", "1704067200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expectedParam, func(t *testing.T) {
+			var precision, body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v2/write" {
+					precision = r.URL.Query().Get("precision")
+					raw, _ := io.ReadAll(r.Body)
+					body = strings.TrimSpace(string(raw))
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			t.Cleanup(server.Close)
+
+			cfg := &config.InfluxDBConfig{URL: server.URL, Token: "token", Org: "org", Bucket: "bucket", Precision: tt.precision}
+			client, err := NewClient(cfg)
+			require.NoError(t, err)
+			t.Cleanup(client.Close)
+
+			data := createTestDeviceData()
+			data.Timestamp = timestamp
+			require.NoError(t, client.WriteDeviceData(context.Background(), data))
+
+			// The precision is sent with the write and the timestamp truncated to it
+			assert.Equal(t, tt.expectedParam, precision)
+			assert.True(t, strings.HasSuffix(body, " "+tt.expectedTimestamp), "line %q", body)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package influxdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InfluxDB health statuses
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+	StatusDisabled  = "disabled"
+)
+
+// Pinger checks whether InfluxDB is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthChecker reports InfluxDB health, reusing a ping result for ttl so frequent health polls don't hit InfluxDB
+type HealthChecker struct {
+	pinger Pinger
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	status    string
+}
+
+// NewHealthChecker creates a health checker; a nil pinger reports StatusDisabled
+func NewHealthChecker(pinger Pinger, ttl time.Duration) *HealthChecker {
+	return &HealthChecker{
+		pinger: pinger,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Status returns the cached ping result, pinging again once it is older than the ttl
+func (h *HealthChecker) Status(ctx context.Context) string {
+	if h.pinger == nil {
+		return StatusDisabled
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.status != "" && h.now().Sub(h.checkedAt) < h.ttl {
+		return h.status
+	}
+
+	h.status = StatusHealthy
+	if err := h.pinger.Ping(ctx); err != nil {
+		h.status = StatusUnhealthy
+	}
+	h.checkedAt = h.now()
+
+	return h.status
+}
@@ -0,0 +1,66 @@
+package influxdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubPinger returns a fixed result and counts calls
+type stubPinger struct {
+	err   error
+	calls int
+}
+
+func (p *stubPinger) Ping(ctx context.Context) error {
+	p.calls++
+	return p.err
+}
+
+func TestHealthChecker_Status(t *testing.T) {
+	tests := []struct {
+		name     string
+		pinger   *stubPinger
+		expected string
+	}{
+		{"healthy", &stubPinger{}, StatusHealthy},
+		{"unhealthy", &stubPinger{err: errors.New("connection refused")}, StatusUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewHealthChecker(tt.pinger, time.Minute)
+			assert.Equal(t, tt.expected, checker.Status(context.Background()))
+			assert.Equal(t, 1, tt.pinger.calls)
+		})
+	}
+}
+
+func TestHealthChecker_Disabled(t *testing.T) {
+	checker := NewHealthChecker(nil, time.Minute)
+	assert.Equal(t, StatusDisabled, checker.Status(context.Background()))
+}
+
+func TestHealthChecker_CachesResult(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pinger := &stubPinger{}
+
+	checker := NewHealthChecker(pinger, 10*time.Second)
+	checker.now = func() time.Time { return now }
+
+	assert.Equal(t, StatusHealthy, checker.Status(context.Background()))
+
+	// Within the ttl the cached result is returned even though InfluxDB went down
+	pinger.err = errors.New("connection refused")
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, StatusHealthy, checker.Status(context.Background()))
+	assert.Equal(t, 1, pinger.calls)
+
+	// Once the ttl has passed InfluxDB is pinged again
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, StatusUnhealthy, checker.Status(context.Background()))
+	assert.Equal(t, 2, pinger.calls)
+}
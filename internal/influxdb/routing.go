@@ -0,0 +1,111 @@
+package influxdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultMeasurement holds every data type without a measurement override
+const defaultMeasurement = "device_data"
+
+// target is a bucket and measurement that readings are written to
+type target struct {
+	bucket      string
+	measurement string
+}
+
+// target returns where readings of dataType are stored, falling back to the
+// configured bucket and the device_data measurement for unmapped types
+func (c *Client) target(dataType string) target {
+	t := target{bucket: c.config.Bucket, measurement: defaultMeasurement}
+	if bucket, ok := c.config.Buckets[dataType]; ok {
+		t.bucket = bucket
+	}
+	if measurement, ok := c.config.Measurements[dataType]; ok {
+		t.measurement = measurement
+	}
+	return t
+}
+
+// targets returns every bucket and measurement readings may be stored in, sorted
+func (c *Client) targets() []target {
+	dataTypes := map[string]struct{}{"": {}}
+	for dataType := range c.config.Buckets {
+		dataTypes[dataType] = struct{}{}
+	}
+	for dataType := range c.config.Measurements {
+		dataTypes[dataType] = struct{}{}
+	}
+
+	seen := make(map[target]struct{})
+	var targets []target
+	for dataType := range dataTypes {
+		t := c.target(dataType)
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		targets = append(targets, t)
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].bucket != targets[j].bucket {
+			return targets[i].bucket < targets[j].bucket
+		}
+		return targets[i].measurement < targets[j].measurement
+	})
+	return targets
+}
+
+// querySource builds the start of a Flux query selecting a device's readings between start and end.
+// A data type reads only from its own bucket and measurement; no data type reads from all of them.
+func (c *Client) querySource(deviceID, dataType string, start, end time.Time) string {
+	targets := c.targets()
+	if dataType != "" {
+		targets = []target{c.target(dataType)}
+	}
+
+	// Group measurements by bucket so each bucket is read once
+	var buckets []string
+	measurements := make(map[string][]string)
+	for _, t := range targets {
+		if _, ok := measurements[t.bucket]; !ok {
+			buckets = append(buckets, t.bucket)
+		}
+		measurements[t.bucket] = append(measurements[t.bucket], t.measurement)
+	}
+
+	tables := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		tables = append(tables, fmt.Sprintf(`from(bucket: %q)
+			|> range(start: %s, stop: %s)
+			|> filter(fn: (r) => %s)`,
+			bucket, start.Format(time.RFC3339), end.Format(time.RFC3339), measurementFilter(measurements[bucket])))
+	}
+
+	source := tables[0]
+	if len(tables) > 1 {
+		source = fmt.Sprintf("union(tables: [\n\t\t\t%s\n\t\t])", strings.Join(tables, ",\n\t\t\t"))
+	}
+
+	source += fmt.Sprintf(`
+			|> filter(fn: (r) => r["device_id"] == %q)
+	`, deviceID)
+
+	if dataType != "" {
+		source += fmt.Sprintf(`|> filter(fn: (r) => r["data_type"] == %q)`, dataType)
+	}
+
+	return source
+}
+
+// measurementFilter builds a Flux predicate matching any of the measurements
+func measurementFilter(measurements []string) string {
+	conditions := make([]string, len(measurements))
+	for i, measurement := range measurements {
+		conditions[i] = fmt.Sprintf(`r["_measurement"] == %q`, measurement)
+	}
+	return strings.Join(conditions, " or ")
+}
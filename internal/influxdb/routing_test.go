@@ -0,0 +1,164 @@
+package influxdb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routedConfig sends vibration to its own measurement and bucket, and current only to its own measurement
+func routedConfig(url string) *config.InfluxDBConfig {
+	return &config.InfluxDBConfig{
+		URL:          url,
+		Token:        "token",
+		Org:          "org",
+		Bucket:       "device-data",
+		Measurements: map[string]string{"vibration": "device_data_hf", "current": "device_data_hf"},
+		Buckets:      map[string]string{"vibration": "high-frequency"},
+	}
+}
+
+// recordedRequest is a write, query or delete received by the recording server
+type recordedRequest struct {
+	bucket string
+	body   string
+}
+
+// recordingServer answers InfluxDB pings, writes, queries and deletes, recording each request
+type recordingServer struct {
+	mu      sync.Mutex
+	writes  []recordedRequest
+	queries []string
+	deletes []recordedRequest
+}
+
+func newRecordingClient(t *testing.T) (*Client, *recordingServer) {
+	recorder := &recordingServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/ping":
+		case "/api/v2/write":
+			recorder.writes = append(recorder.writes, recordedRequest{bucket: r.URL.Query().Get("bucket"), body: string(body)})
+		case "/api/v2/query":
+			var q struct {
+				Query string `json:"query"`
+			}
+			_ = json.Unmarshal(body, &q)
+			recorder.queries = append(recorder.queries, q.Query)
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			_, _ = w.Write([]byte(csvTable(0, "double", "1")))
+			return
+		case "/api/v2/delete":
+			var d struct {
+				Predicate string `json:"predicate"`
+			}
+			_ = json.Unmarshal(body, &d)
+			recorder.deletes = append(recorder.deletes, recordedRequest{bucket: r.URL.Query().Get("bucket"), body: d.Predicate})
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(routedConfig(server.URL))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+
+	return client, recorder
+}
+
+func TestTarget(t *testing.T) {
+	client := &Client{config: routedConfig("")}
+
+	assert.Equal(t, target{bucket: "high-frequency", measurement: "device_data_hf"}, client.target("vibration"))
+	assert.Equal(t, target{bucket: "device-data", measurement: "device_data_hf"}, client.target("current"))
+	assert.Equal(t, target{bucket: "device-data", measurement: "device_data"}, client.target("temperature"))
+
+	assert.Equal(t, []target{
+		{bucket: "device-data", measurement: "device_data"},
+		{bucket: "device-data", measurement: "device_data_hf"},
+		{bucket: "high-frequency", measurement: "device_data_hf"},
+	}, client.targets())
+}
+
+func TestTarget_DefaultsToSingleMeasurement(t *testing.T) {
+	client := &Client{config: &config.InfluxDBConfig{Bucket: "device-data"}}
+
+	assert.Equal(t, target{bucket: "device-data", measurement: "device_data"}, client.target("vibration"))
+	assert.Equal(t, []target{{bucket: "device-data", measurement: "device_data"}}, client.targets())
+}
+
+func TestWriteDeviceData_Routing(t *testing.T) {
+	client, recorder := newRecordingClient(t)
+
+	for _, dataType := range []string{"vibration", "current", "temperature"} {
+		data := createTestDeviceData()
+		data.DataType = dataType
+		require.NoError(t, client.WriteDeviceData(context.Background(), data))
+	}
+
+	require.Len(t, recorder.writes, 3)
+	assert.Equal(t, "high-frequency", recorder.writes[0].bucket)
+	assert.True(t, strings.HasPrefix(recorder.writes[0].body, "device_data_hf,"), recorder.writes[0].body)
+	assert.Equal(t, "device-data", recorder.writes[1].bucket)
+	assert.True(t, strings.HasPrefix(recorder.writes[1].body, "device_data_hf,"), recorder.writes[1].body)
+	assert.Equal(t, "device-data", recorder.writes[2].bucket)
+	assert.True(t, strings.HasPrefix(recorder.writes[2].body, "device_data,"), recorder.writes[2].body)
+}
+
+func TestQueryDeviceData_Routing(t *testing.T) {
+	client, recorder := newRecordingClient(t)
+	start, end := time.Now().Add(-time.Hour), time.Now()
+
+	_, err := client.QueryDeviceData(context.Background(), "device-1", "vibration", start, end, 10)
+	require.NoError(t, err)
+	_, err = client.GetLatestDeviceData(context.Background(), "device-1", "temperature")
+	require.NoError(t, err)
+	_, err = client.QueryDeviceData(context.Background(), "device-1", "", start, end, 10)
+	require.NoError(t, err)
+
+	require.Len(t, recorder.queries, 3)
+
+	// A mapped type reads only its own bucket and measurement
+	assert.Contains(t, recorder.queries[0], `from(bucket: "high-frequency")`)
+	assert.Contains(t, recorder.queries[0], `r["_measurement"] == "device_data_hf"`)
+	assert.NotContains(t, recorder.queries[0], `"device-data"`)
+
+	// An unmapped type reads the default bucket and measurement
+	assert.Contains(t, recorder.queries[1], `from(bucket: "device-data")`)
+	assert.Contains(t, recorder.queries[1], `r["_measurement"] == "device_data")`)
+	assert.NotContains(t, recorder.queries[1], "high-frequency")
+
+	// No type reads everywhere data may be stored
+	assert.Contains(t, recorder.queries[2], "union(tables: [")
+	assert.Contains(t, recorder.queries[2], `from(bucket: "device-data")`)
+	assert.Contains(t, recorder.queries[2], `r["_measurement"] == "device_data" or r["_measurement"] == "device_data_hf"`)
+	assert.Contains(t, recorder.queries[2], `from(bucket: "high-frequency")`)
+}
+
+func TestDeleteDeviceData_Routing(t *testing.T) {
+	client, recorder := newRecordingClient(t)
+
+	require.NoError(t, client.DeleteDeviceData(context.Background(), "device-1"))
+
+	assert.Equal(t, []recordedRequest{
+		{bucket: "device-data", body: `_measurement="device_data" AND device_id="device-1"`},
+		{bucket: "device-data", body: `_measurement="device_data_hf" AND device_id="device-1"`},
+		{bucket: "high-frequency", body: `_measurement="device_data_hf" AND device_id="device-1"`},
+	}, recorder.deletes)
+}
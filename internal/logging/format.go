@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Log formats, selected with LOG_FORMAT
+const (
+	// FormatEmoji keeps messages as written, emoji prefixes included
+	FormatEmoji = "emoji"
+	// FormatPlain strips emoji so logs stay grep- and aggregator-friendly
+	FormatPlain = "plain"
+	// FormatJSON writes one JSON record per message, with the level inferred from its prefix
+	FormatJSON = "json"
+)
+
+// Log record levels in the json format
+const (
+	levelDebug = "debug"
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+const debugPrefix = "[DEBUG] "
+
+var emojiEnabled atomic.Bool
+
+func init() {
+	emojiEnabled.Store(true)
+}
+
+// SetFormat routes the standard logger, which every log call in the server goes through, via the given format.
+// An unknown format keeps the emoji format.
+func SetFormat(format string) {
+	emojiEnabled.Store(format != FormatPlain && format != FormatJSON)
+	if format == FormatJSON {
+		// Records carry their own timestamp
+		log.SetFlags(0)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+	log.SetOutput(NewWriter(os.Stderr, format))
+}
+
+// Sanitize returns message as the current format writes it, for logs kept outside the standard logger
+func Sanitize(message string) string {
+	if emojiEnabled.Load() {
+		return message
+	}
+	return StripEmoji(message)
+}
+
+// NewWriter wraps w so each message written by a log.Logger is rendered in the given format
+func NewWriter(w io.Writer, format string) io.Writer {
+	switch format {
+	case FormatPlain:
+		return plainWriter{w: w}
+	case FormatJSON:
+		return jsonWriter{w: w, now: time.Now}
+	default:
+		return w
+	}
+}
+
+// plainWriter strips emoji from each message
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, StripEmoji(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// jsonWriter writes each message as a {"time","level","msg"} record
+type jsonWriter struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+type jsonRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+func (j jsonWriter) Write(b []byte) (int, error) {
+	message := strings.TrimRight(string(b), "\n")
+	level := messageLevel(message)
+	message = strings.TrimPrefix(StripEmoji(message), debugPrefix)
+
+	record, err := json.Marshal(jsonRecord{
+		Time:    j.now().UTC().Format(time.RFC3339Nano),
+		Level:   level,
+		Message: message,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := j.w.Write(append(record, '\n')); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// messageLevel infers a level from the prefix messages are written with
+func messageLevel(message string) string {
+	switch {
+	case strings.HasPrefix(message, debugPrefix):
+		return levelDebug
+	case strings.HasPrefix(message, "⚠"):
+		return levelWarn
+	case strings.HasPrefix(message, "❌"):
+		return levelError
+	default:
+		return levelInfo
+	}
+}
+
+// StripEmoji removes emoji, and the space following them, from s
+func StripEmoji(s string) string {
+	var buf bytes.Buffer
+	buf.Grow(len(s))
+
+	skipSpace := false
+	for _, r := range s {
+		if isEmoji(r) {
+			skipSpace = true
+			continue
+		}
+		if skipSpace && r == ' ' {
+			skipSpace = false
+			continue
+		}
+		skipSpace = false
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// isEmoji reports whether r is a pictograph, dingbat or emoji modifier
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // pictographs, emoticons, transport and supplemental symbols
+		return true
+	case r >= 0x2300 && r <= 0x23FF: // technical symbols such as ⌛
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // miscellaneous symbols and dingbats, e.g. ⚠ ✅ ❌
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF: // arrows and stars such as ⭐
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r == 0x200D: // variation selectors and zero-width joiner
+		return true
+	}
+	return false
+}
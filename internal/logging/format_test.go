@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripEmoji(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"✅ Successfully connected to MQTT broker", "Successfully connected to MQTT broker"},
+		{"⚠️ Failed to update device status", "Failed to update device status"},
+		{"📡 RECEIVED DEVICE DATA from devices/d1/data", "RECEIVED DEVICE DATA from devices/d1/data"},
+		{"   - devices/+/data (device data)", "   - devices/+/data (device data)"},
+		{"Saved 21.5 °C, 70 ℉", "Saved 21.5 °C, 70 ℉"},
+		{"2024/01/01 00:00:00 🛑 Shutting down", "2024/01/01 00:00:00 Shutting down"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, StripEmoji(tt.in))
+	}
+}
+
+func TestNewWriter_Plain(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewWriter(&buf, FormatPlain), "", log.LstdFlags)
+
+	logger.Printf("✅ Successfully connected to MQTT broker: %s", "tcp://localhost:1883")
+	logger.Printf("⚠️ Failed to update device last seen: %v", "timeout")
+	logger.Println("📡 Subscribed to MQTT topics:")
+
+	output := buf.String()
+	assert.Contains(t, output, "Successfully connected to MQTT broker: tcp://localhost:1883\n")
+	assert.Contains(t, output, "Failed to update device last seen: timeout\n")
+	for _, r := range output {
+		assert.False(t, isEmoji(r), "unexpected emoji %q in %q", r, output)
+	}
+}
+
+func TestNewWriter_Emoji(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewWriter(&buf, FormatEmoji), "", 0)
+
+	logger.Println("✅ ready")
+	assert.Equal(t, "✅ ready\n", buf.String())
+}
+
+func TestNewWriter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, FormatJSON).(jsonWriter)
+	writer.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	logger := log.New(writer, "", 0)
+
+	logger.Println("✅ Connected")
+	logger.Println("⚠️ Failed to save")
+	logger.Println("❌ Failed to connect")
+	logger.Println("[DEBUG] skipped record")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+
+	expected := []jsonRecord{
+		{Time: "2024-01-01T00:00:00Z", Level: levelInfo, Message: "Connected"},
+		{Time: "2024-01-01T00:00:00Z", Level: levelWarn, Message: "Failed to save"},
+		{Time: "2024-01-01T00:00:00Z", Level: levelError, Message: "Failed to connect"},
+		{Time: "2024-01-01T00:00:00Z", Level: levelDebug, Message: "skipped record"},
+	}
+	for i, line := range lines {
+		var record jsonRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, expected[i], record)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	t.Cleanup(func() {
+		SetFormat(FormatEmoji)
+	})
+
+	SetFormat(FormatPlain)
+	assert.Equal(t, "RECEIVED DEVICE DATA", Sanitize("📡 RECEIVED DEVICE DATA"))
+
+	SetFormat(FormatEmoji)
+	assert.Equal(t, "📡 RECEIVED DEVICE DATA", Sanitize("📡 RECEIVED DEVICE DATA"))
+}
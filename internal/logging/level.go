@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LevelDebug enables debug logging; any other level (e.g. info) hides it
+const LevelDebug = "debug"
+
+var debugEnabled atomic.Bool
+
+// SetLevel sets the log level from LOG_LEVEL
+func SetLevel(level string) {
+	debugEnabled.Store(strings.EqualFold(strings.TrimSpace(level), LevelDebug))
+}
+
+// DebugEnabled reports whether debug messages are logged
+func DebugEnabled() bool {
+	return debugEnabled.Load()
+}
+
+// Debugf logs a message only when the level is debug
+func Debugf(format string, args ...interface{}) {
+	if debugEnabled.Load() {
+		log.Printf("[DEBUG] "+format, args...)
+	}
+}
@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugf(t *testing.T) {
+	var buf bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(output)
+		SetLevel("info")
+	})
+
+	SetLevel("info")
+	assert.False(t, DebugEnabled())
+	Debugf("hidden %d", 1)
+	assert.Empty(t, buf.String())
+
+	SetLevel("DEBUG")
+	assert.True(t, DebugEnabled())
+	Debugf("shown %d", 2)
+	assert.Contains(t, buf.String(), "[DEBUG] shown 2")
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	filePermission = 0644
+	dirPermission  = 0755
+	bytesPerMB     = 1024 * 1024
+)
+
+// RotatingFile is an append-only log file that rolls over once it grows past a size limit.
+// The file handle is kept open between writes and guarded by a mutex.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+// NewRotatingFile opens (or creates) the log file at path.
+// A maxBytes value of zero or less disables rotation.
+func NewRotatingFile(path string, maxBytes int64) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:     path,
+		maxBytes: maxBytes,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// MegabytesToBytes converts a size in megabytes to bytes
+func MegabytesToBytes(mb int) int64 {
+	return int64(mb) * bytesPerMB
+}
+
+// Path returns the path of the active log file
+func (f *RotatingFile) Path() string {
+	return f.path
+}
+
+// RotatedPath returns the path the active log file is moved to on rotation
+func (f *RotatingFile) RotatedPath() string {
+	return f.path + ".1"
+}
+
+// Write appends p to the log file, rotating it first if the write would exceed the size limit.
+// If the rotation fails but the current file could be reopened, p is still written and the rotation error returned.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, fmt.Errorf("log file %s is closed", f.path)
+	}
+
+	var rotateErr error
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if rotateErr = f.rotate(); rotateErr != nil && f.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to write to log file %s: %w", f.path, err)
+	}
+
+	return n, rotateErr
+}
+
+// Close closes the underlying log file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens the log file for appending and records its current size
+func (f *RotatingFile) open() error {
+	if dir := filepath.Dir(f.path); dir != "." {
+		if err := os.MkdirAll(dir, dirPermission); err != nil {
+			return fmt.Errorf("failed to create log directory %s: %w", dir, err)
+		}
+	}
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, filePermission)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", f.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", f.path, err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate moves the current log file aside and starts a new one. Callers must hold f.mu.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %w", f.path, err)
+	}
+	f.file = nil
+
+	if err := os.Rename(f.path, f.RotatedPath()); err != nil {
+		// Reopen the oversized file so Write can still append the entry
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate log file %s: %w", f.path, err)
+	}
+
+	return f.open()
+}
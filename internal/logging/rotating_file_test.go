@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "mqtt-received.log")
+
+	f, err := NewRotatingFile(path, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("first entry\n"))
+	require.NoError(t, err)
+	_, err = f.Write([]byte("second entry\n"))
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first entry\nsecond entry\n", string(content))
+
+	_, err = os.Stat(f.RotatedPath())
+	assert.True(t, os.IsNotExist(err), "rotation must be disabled when maxBytes is zero")
+}
+
+func TestRotatingFile_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt-received.log")
+	entry := strings.Repeat("x", 99) + "\n"
+
+	f, err := NewRotatingFile(path, 1024)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// 20 entries of 100 bytes exceed the 1KB limit
+	for i := 0; i < 20; i++ {
+		_, err := f.Write([]byte(entry))
+		require.NoError(t, err)
+	}
+
+	rolled, err := os.Stat(f.RotatedPath())
+	require.NoError(t, err, "expected a rolled log file to exist")
+	assert.LessOrEqual(t, rolled.Size(), int64(1024))
+
+	current, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, current.Size(), int64(1024))
+	assert.Greater(t, current.Size(), int64(0))
+}
+
+func TestRotatingFile_ReopenKeepsExistingSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt-received.log")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 1000)), 0644))
+
+	f, err := NewRotatingFile(path, 1024)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte(strings.Repeat("y", 100)))
+	require.NoError(t, err)
+
+	_, err = os.Stat(f.RotatedPath())
+	assert.NoError(t, err, "existing file size must count towards the limit")
+}
+
+func TestRotatingFile_RotationFailureKeepsEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt-received.log")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 1020)), 0644))
+
+	f, err := NewRotatingFile(path, 1024)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// A non-empty directory at the rotated path makes the rename fail
+	require.NoError(t, os.MkdirAll(filepath.Join(f.RotatedPath(), "blocker"), 0755))
+
+	n, err := f.Write([]byte("kept entry\n"))
+	assert.Error(t, err, "the rotation failure must be reported")
+	assert.Equal(t, len("kept entry\n"), n)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(content), "kept entry\n"), "the entry must be written to the current file")
+
+	// Later writes keep going to the current file
+	_, err = f.Write([]byte("next entry\n"))
+	assert.Error(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(content), "kept entry\nnext entry\n"))
+}
+
+func TestRotatingFile_WriteAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt-received.log")
+
+	f, err := NewRotatingFile(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = f.Write([]byte("entry\n"))
+	assert.Error(t, err)
+}
+
+func TestMegabytesToBytes(t *testing.T) {
+	assert.Equal(t, int64(0), MegabytesToBytes(0))
+	assert.Equal(t, int64(10*1024*1024), MegabytesToBytes(10))
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default is the registry served by the metrics endpoint
+var Default = NewRegistry()
+
+// Registry holds named counters, timings and gauges
+type Registry struct {
+	mu          sync.RWMutex
+	counters    map[string]*Counter
+	counterVecs map[string]*CounterVec
+	timings     map[string]*TimingVec
+	gauges      map[string]func() interface{}
+}
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:    make(map[string]*Counter),
+		counterVecs: make(map[string]*CounterVec),
+		timings:     make(map[string]*TimingVec),
+		gauges:      make(map[string]func() interface{}),
+	}
+}
+
+// Counter returns the counter with the given name, creating it if needed
+func (r *Registry) Counter(name string) *Counter {
+	r.mu.RLock()
+	c, ok := r.counters[name]
+	r.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.counters[name]; ok {
+		return c
+	}
+	c = &Counter{}
+	r.counters[name] = c
+	return c
+}
+
+// CounterVec returns the labelled counter with the given name, creating it if needed
+func (r *Registry) CounterVec(name string) *CounterVec {
+	r.mu.RLock()
+	c, ok := r.counterVecs[name]
+	r.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.counterVecs[name]; ok {
+		return c
+	}
+	c = &CounterVec{counts: make(map[string]int64)}
+	r.counterVecs[name] = c
+	return c
+}
+
+// TimingVec returns the labelled timing with the given name, creating it if needed
+func (r *Registry) TimingVec(name string) *TimingVec {
+	r.mu.RLock()
+	t, ok := r.timings[name]
+	r.mu.RUnlock()
+	if ok {
+		return t
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.timings[name]; ok {
+		return t
+	}
+	t = &TimingVec{stats: make(map[string]*timingStat)}
+	r.timings[name] = t
+	return t
+}
+
+// RegisterGauge registers a function evaluated on every snapshot; registering a name again replaces it
+func (r *Registry) RegisterGauge(name string, fn func() interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = fn
+}
+
+// Snapshot returns the current value of every metric, keyed by metric name
+func (r *Registry) Snapshot() map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make(map[string]interface{}, len(r.counters)+len(r.counterVecs)+len(r.timings)+len(r.gauges))
+	for name, c := range r.counters {
+		snapshot[name] = c.Value()
+	}
+	for name, c := range r.counterVecs {
+		snapshot[name] = c.Snapshot()
+	}
+	for name, t := range r.timings {
+		snapshot[name] = t.Snapshot()
+	}
+	for name, fn := range r.gauges {
+		snapshot[name] = fn()
+	}
+
+	return snapshot
+}
+
+// Counter is a monotonically increasing count
+type Counter struct {
+	value int64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.value, n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// CounterVec counts per label (e.g. per topic)
+type CounterVec struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// Inc increments the label's count by one
+func (c *CounterVec) Inc(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[label]++
+}
+
+// Value returns the current count for a single label
+func (c *CounterVec) Value(label string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[label]
+}
+
+// Snapshot returns the count for every label
+func (c *CounterVec) Snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]int64, len(c.counts))
+	for label, count := range c.counts {
+		snapshot[label] = count
+	}
+	return snapshot
+}
+
+// TimingStats summarizes the durations observed for one label
+type TimingStats struct {
+	Count   int64   `json:"count"`
+	TotalMs float64 `json:"total_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+// TimingVec records durations per label (e.g. per operation name)
+type TimingVec struct {
+	mu    sync.Mutex
+	stats map[string]*timingStat
+}
+
+type timingStat struct {
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+// Observe records a duration for the label
+func (t *TimingVec) Observe(label string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stat, ok := t.stats[label]
+	if !ok {
+		stat = &timingStat{}
+		t.stats[label] = stat
+	}
+
+	stat.count++
+	stat.total += d
+	if d > stat.max {
+		stat.max = d
+	}
+}
+
+// Stats returns the summary for a single label
+func (t *TimingVec) Stats(label string) TimingStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stat, ok := t.stats[label]
+	if !ok {
+		return TimingStats{}
+	}
+	return stat.summary()
+}
+
+// Snapshot returns the summary for every label
+func (t *TimingVec) Snapshot() map[string]TimingStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make(map[string]TimingStats, len(t.stats))
+	for label, stat := range t.stats {
+		snapshot[label] = stat.summary()
+	}
+	return snapshot
+}
+
+func (s *timingStat) summary() TimingStats {
+	stats := TimingStats{
+		Count:   s.count,
+		TotalMs: durationMs(s.total),
+		MaxMs:   durationMs(s.max),
+	}
+	if s.count > 0 {
+		stats.AvgMs = stats.TotalMs / float64(s.count)
+	}
+	return stats
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	registry := NewRegistry()
+
+	counter := registry.Counter("mqtt_messages_received")
+	counter.Inc()
+	counter.Add(2)
+
+	assert.Equal(t, int64(3), registry.Counter("mqtt_messages_received").Value())
+	assert.Equal(t, int64(3), registry.Snapshot()["mqtt_messages_received"])
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	registry := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.Counter("requests").Inc()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(50), registry.Counter("requests").Value())
+}
+
+func TestCounterVec(t *testing.T) {
+	registry := NewRegistry()
+
+	failed := registry.CounterVec("mqtt_messages_failed")
+	failed.Inc("devices/+/data")
+	failed.Inc("devices/+/data")
+	failed.Inc("devices/+/status")
+
+	assert.Equal(t, int64(2), registry.CounterVec("mqtt_messages_failed").Value("devices/+/data"))
+	assert.Equal(t, int64(0), failed.Value("devices/#"))
+
+	snapshot, ok := registry.Snapshot()["mqtt_messages_failed"].(map[string]int64)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]int64{"devices/+/data": 2, "devices/+/status": 1}, snapshot)
+}
+
+func TestTimingVec(t *testing.T) {
+	registry := NewRegistry()
+
+	timing := registry.TimingVec("db_query_duration")
+	timing.Observe("device.create", 10*time.Millisecond)
+	timing.Observe("device.create", 30*time.Millisecond)
+	timing.Observe("data.save", 5*time.Millisecond)
+
+	stats := timing.Stats("device.create")
+	assert.Equal(t, int64(2), stats.Count)
+	assert.Equal(t, 40.0, stats.TotalMs)
+	assert.Equal(t, 20.0, stats.AvgMs)
+	assert.Equal(t, 30.0, stats.MaxMs)
+
+	assert.Equal(t, TimingStats{}, timing.Stats("device.delete"))
+
+	snapshot, ok := registry.Snapshot()["db_query_duration"].(map[string]TimingStats)
+	assert.True(t, ok)
+	assert.Len(t, snapshot, 2)
+	assert.Equal(t, int64(1), snapshot["data.save"].Count)
+}
+
+func TestRegisterGauge(t *testing.T) {
+	registry := NewRegistry()
+
+	depth := 0
+	registry.RegisterGauge("queue_depth", func() interface{} { return depth })
+
+	depth = 5
+	assert.Equal(t, 5, registry.Snapshot()["queue_depth"])
+
+	registry.RegisterGauge("queue_depth", func() interface{} { return 7 })
+	assert.Equal(t, 7, registry.Snapshot()["queue_depth"])
+}
@@ -1,9 +1,11 @@
 package mqtt
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	"iot-platform-go/internal/config"
@@ -12,113 +14,217 @@ import (
 )
 
 const (
-	connectRetryInterval   = 5 * time.Second
-	disconnectTimeout      = 250 // milliseconds
 	connectionWaitTime     = 100 * time.Millisecond
 	connectionWaitAttempts = 10
+
+	// Used when the config leaves the reconnect intervals unset
+	defaultConnectRetryInterval = 5 * time.Second
+	defaultMaxReconnectInterval = time.Minute
+
+	// Used when the config leaves the ping timeout unset, matching the paho default
+	defaultPingTimeout = 10 * time.Second
+
+	// Used when the config leaves the disconnect timeout unset
+	defaultDisconnectTimeout = 250 * time.Millisecond
+
+	// Retained payloads published to the status topic
+	statusOnline  = "online"
+	statusOffline = "offline"
 )
 
 // Client represents an MQTT client
 type Client struct {
-	client   mqtt.Client
-	config   *config.MQTTConfig
-	handlers map[string]MessageHandler
+	client mqtt.Client
+	config *config.MQTTConfig
+	queue  *publishQueue
+
+	// handlerSlots caps the messages handled at once; nil when unlimited
+	handlerSlots chan struct{}
+
+	// heartbeatMu guards the heartbeat times, written by RunHeartbeat and the heartbeat subscription
+	heartbeatMu      sync.Mutex
+	heartbeatStarted time.Time
+	lastHeartbeatOK  time.Time
+
+	// handlersMu guards handlers, which the paho callbacks read concurrently with Subscribe
+	handlersMu sync.RWMutex
+	handlers   map[string]MessageHandler
+
+	// handlingMu guards stopped; handling counts the messages being handled until WaitHandlers stops them
+	handlingMu sync.Mutex
+	stopped    bool
+	handling   sync.WaitGroup
 }
 
 // MessageHandler is a function type for handling MQTT messages
 type MessageHandler func(topic string, payload []byte)
 
-// NewClient creates a new MQTT client
+// NewClient creates a new MQTT client.
+// When cfg.QueueSize is positive, messages published while disconnected are queued and sent on reconnect.
+// When cfg.HandlerConcurrency is positive, at most that many received messages are handled at once.
 func NewClient(cfg *config.MQTTConfig) *Client {
-	return &Client{
+	c := &Client{
 		config:   cfg,
 		handlers: make(map[string]MessageHandler),
 	}
+
+	if cfg.QueueSize > 0 {
+		c.queue = newPublishQueue(cfg.QueueSize)
+	}
+
+	if cfg.HandlerConcurrency > 0 {
+		c.handlerSlots = make(chan struct{}, cfg.HandlerConcurrency)
+	}
+
+	return c
 }
 
 // Connect establishes a connection to the MQTT broker
 func (c *Client) Connect() error {
+	// Reject a broker URL paho would only fail on with an unclear error
+	if err := c.config.Validate(); err != nil {
+		return err
+	}
+
+	opts := c.clientOptions()
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	// Create client
+	c.client = mqtt.NewClient(opts)
+
+	// Connect to broker
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %v", token.Error())
+	}
+
+	log.Printf("Connected to MQTT broker: %s", c.config.Broker)
+	return nil
+}
+
+// clientOptions builds the paho client options from the config
+func (c *Client) clientOptions() *mqtt.ClientOptions {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(c.config.Broker)
 	opts.SetClientID(c.config.ClientID)
 	opts.SetKeepAlive(time.Duration(c.config.KeepAlive) * time.Second)
+	opts.SetPingTimeout(durationOrDefault(c.config.PingTimeout, defaultPingTimeout))
 	opts.SetConnectTimeout(time.Duration(c.config.ConnectTimeout) * time.Second)
 	opts.SetCleanSession(false) // Changed from c.config.CleanSession to false
 	opts.SetAutoReconnect(c.config.AutoReconnect)
 	opts.SetDefaultPublishHandler(c.defaultMessageHandler)
+	opts.SetOnConnectHandler(c.onConnect)
 
 	// Add connection stability settings
-	opts.SetMaxReconnectInterval(1 * time.Minute)
+	opts.SetMaxReconnectInterval(durationOrDefault(c.config.Reconnect.MaxInterval, defaultMaxReconnectInterval))
 	opts.SetConnectRetry(true)
-	opts.SetConnectRetryInterval(connectRetryInterval)
+	opts.SetConnectRetryInterval(durationOrDefault(c.config.Reconnect.Interval, defaultConnectRetryInterval))
 	opts.SetOrderMatters(false)
 	opts.SetResumeSubs(true)
 
+	// The broker publishes offline for us if the connection drops without a Disconnect
+	if c.config.StatusTopic != "" {
+		opts.SetWill(c.config.StatusTopic, statusOffline, c.config.QoS, true)
+	}
+
 	// Set credentials if provided
 	if c.config.Username != "" {
 		opts.SetUsername(c.config.Username)
 		opts.SetPassword(c.config.Password)
 	}
 
-	// Create client
-	c.client = mqtt.NewClient(opts)
+	return opts
+}
 
-	// Connect to broker
-	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %v", token.Error())
+// durationOrDefault returns d, or fallback when d is not positive
+func durationOrDefault(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
 	}
-
-	log.Printf("Connected to MQTT broker: %s", c.config.Broker)
-	return nil
+	return d
 }
 
-// Disconnect closes the MQTT connection
+// Disconnect publishes an offline status when a status topic is configured, then closes the
+// MQTT connection, letting in-flight messages complete for up to the configured disconnect timeout
 func (c *Client) Disconnect() {
 	if c.client != nil && c.client.IsConnected() {
-		c.client.Disconnect(disconnectTimeout) // 250ms timeout
+		timeout := durationOrDefault(c.config.DisconnectTimeout, defaultDisconnectTimeout)
+		if c.config.StatusTopic != "" {
+			c.publishOffline(timeout)
+		}
+		c.client.Disconnect(uint(timeout.Milliseconds()))
 		log.Println("Disconnected from MQTT broker")
 	}
 }
 
+// publishOffline publishes the retained offline status, waiting at most timeout for it to complete
+func (c *Client) publishOffline(timeout time.Duration) {
+	token := c.client.Publish(c.config.StatusTopic, c.config.QoS, true, statusOffline)
+	if !token.WaitTimeout(timeout) {
+		log.Printf("Timed out publishing offline status to %s", c.config.StatusTopic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		log.Printf("Failed to publish offline status: %v", err)
+	}
+}
+
 // Subscribe subscribes to a topic
 func (c *Client) Subscribe(topic string, handler MessageHandler) error {
-	// Wait for connection to be established
-	for i := 0; i < connectionWaitAttempts; i++ {
-		if c.client.IsConnected() {
-			break
-		}
-		time.Sleep(connectionWaitTime)
-	}
+	return c.SubscribeContext(context.Background(), topic, handler)
+}
 
-	if !c.client.IsConnected() {
-		return fmt.Errorf("MQTT client is not connected after waiting")
+// SubscribeContext subscribes to a topic like Subscribe, but stops waiting for the connection
+// and the broker's acknowledgement once ctx is done, returning ctx's error
+func (c *Client) SubscribeContext(ctx context.Context, topic string, handler MessageHandler) error {
+	return c.subscribe(ctx, topic, handler, nil)
+}
+
+// subscribe subscribes to a topic, calling onRetained after each retained message has been handled
+func (c *Client) subscribe(ctx context.Context, topic string, handler MessageHandler, onRetained func()) error {
+	if err := c.waitConnected(ctx); err != nil {
+		return err
 	}
 
 	// Store handler
+	c.handlersMu.Lock()
 	c.handlers[topic] = handler
+	c.handlersMu.Unlock()
 
 	// Subscribe to topic
 	token := c.client.Subscribe(topic, c.config.QoS, func(client mqtt.Client, msg mqtt.Message) {
-		// Find the appropriate handler for this topic
-		// First try exact match
-		if handler, exists := c.handlers[msg.Topic()]; exists {
-			handler(msg.Topic(), msg.Payload())
+		if !c.startHandling() {
 			return
 		}
+		defer c.handling.Done()
+
+		release := c.acquireHandlerSlot()
+		defer release()
 
-		// Then try wildcard matches
-		for pattern, handler := range c.handlers {
-			if c.topicMatches(pattern, msg.Topic()) {
-				handler(msg.Topic(), msg.Payload())
-				return
-			}
+		// Fall back to the default handler when no subscription matches the topic
+		handler, ok := c.handlerFor(msg.Topic())
+		if !ok {
+			c.defaultMessageHandler(client, msg)
+		} else {
+			handler(msg.Topic(), msg.Payload())
 		}
 
-		// If no handler found, use default handler
-		c.defaultMessageHandler(client, msg)
+		if onRetained != nil && msg.Retained() {
+			onRetained()
+		}
 	})
 
-	if token.Wait() && token.Error() != nil {
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return fmt.Errorf("stopped waiting for subscription to topic %s: %w", topic, ctx.Err())
+	}
+	if token.Error() != nil {
 		return fmt.Errorf("failed to subscribe to topic %s: %v", topic, token.Error())
 	}
 
@@ -126,10 +232,108 @@ func (c *Client) Subscribe(topic string, handler MessageHandler) error {
 	return nil
 }
 
+// waitConnected waits for the connection to be established, polling up to connectionWaitAttempts times.
+// It returns ctx's error as soon as ctx is done.
+func (c *Client) waitConnected(ctx context.Context) error {
+	ticker := time.NewTicker(connectionWaitTime)
+	defer ticker.Stop()
+
+	for i := 0; i < connectionWaitAttempts; i++ {
+		if c.client.IsConnected() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for the MQTT connection: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	if !c.client.IsConnected() {
+		return fmt.Errorf("MQTT client is not connected after waiting")
+	}
+	return nil
+}
+
+// startHandling counts a received message as being handled, or returns false once WaitHandlers has been called.
+// A message dropped then is not acknowledged over the closed connection, so the broker redelivers it.
+func (c *Client) startHandling() bool {
+	c.handlingMu.Lock()
+	defer c.handlingMu.Unlock()
+	if c.stopped {
+		return false
+	}
+	c.handling.Add(1)
+	return true
+}
+
+// WaitHandlers stops handling received messages and waits for those already being handled to finish,
+// returning ctx's error if it is done first. Call it after Disconnect, so nothing is handled after shutdown.
+func (c *Client) WaitHandlers(ctx context.Context) error {
+	c.handlingMu.Lock()
+	c.stopped = true
+	c.handlingMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.handling.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stopped waiting for MQTT message handlers: %w", ctx.Err())
+	}
+}
+
+// acquireHandlerSlot waits until fewer than HandlerConcurrency messages are being handled and
+// returns the function that frees the slot again. Paho runs each message on its own goroutine and
+// acknowledges it only once the callback returns, so waiting here also holds back the broker.
+func (c *Client) acquireHandlerSlot() (release func()) {
+	if c.handlerSlots == nil {
+		return func() {}
+	}
+	c.handlerSlots <- struct{}{}
+	return func() { <-c.handlerSlots }
+}
+
+// handlerFor finds the handler for a received topic, preferring an exact match over wildcard patterns
+func (c *Client) handlerFor(topic string) (MessageHandler, bool) {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+
+	if handler, exists := c.handlers[topic]; exists {
+		return handler, true
+	}
+
+	for pattern, handler := range c.handlers {
+		if MatchTopic(pattern, topic) {
+			return handler, true
+		}
+	}
+
+	return nil, false
+}
+
+// Subscriptions returns the subscribed topic filters in sorted order
+func (c *Client) Subscriptions() []string {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+
+	topics := make([]string, 0, len(c.handlers))
+	for topic := range c.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
 // Unsubscribe unsubscribes from a topic
 func (c *Client) Unsubscribe(topic string) error {
 	if !c.client.IsConnected() {
-		return fmt.Errorf("MQTT client is not connected")
+		return ErrNotConnected
 	}
 
 	token := c.client.Unsubscribe(topic)
@@ -138,19 +342,58 @@ func (c *Client) Unsubscribe(topic string) error {
 	}
 
 	// Remove handler
+	c.handlersMu.Lock()
 	delete(c.handlers, topic)
+	c.handlersMu.Unlock()
 
 	log.Printf("Unsubscribed from topic: %s", topic)
 	return nil
 }
 
+// UnsubscribeAll unsubscribes from every subscribed topic
+func (c *Client) UnsubscribeAll() error {
+	for _, topic := range c.Subscriptions() {
+		if err := c.Unsubscribe(topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Publish publishes a message to a topic
 func (c *Client) Publish(topic string, payload interface{}) error {
-	if !c.client.IsConnected() {
-		return fmt.Errorf("MQTT client is not connected")
+	return c.PublishWithOptions(topic, c.config.QoS, false, payload)
+}
+
+// PublishWithOptions publishes a message to a topic with an explicit QoS and retained flag.
+// While disconnected the message is queued if the publish queue is enabled.
+func (c *Client) PublishWithOptions(topic string, qos byte, retained bool, payload interface{}) error {
+	if !c.IsConnected() {
+		if c.queue == nil {
+			return ErrNotConnected
+		}
+
+		if c.queue.push(queuedMessage{topic: topic, qos: qos, retained: retained, payload: payload}) {
+			log.Printf("Publish queue full, dropped oldest message")
+		}
+		log.Printf("MQTT client is not connected, queued message for topic: %s", topic)
+		return nil
 	}
 
-	token := c.client.Publish(topic, c.config.QoS, false, payload)
+	return c.publish(topic, qos, retained, payload)
+}
+
+// QueueStats returns the state of the outbound publish queue; it is zero when queuing is disabled
+func (c *Client) QueueStats() QueueStats {
+	if c.queue == nil {
+		return QueueStats{}
+	}
+	return c.queue.stats()
+}
+
+// publish sends a message to the broker and waits for it to complete
+func (c *Client) publish(topic string, qos byte, retained bool, payload interface{}) error {
+	token := c.client.Publish(topic, qos, retained, payload)
 	if token.Wait() && token.Error() != nil {
 		return fmt.Errorf("failed to publish to topic %s: %v", topic, token.Error())
 	}
@@ -159,54 +402,41 @@ func (c *Client) Publish(topic string, payload interface{}) error {
 	return nil
 }
 
-// IsConnected returns true if the client is connected
-func (c *Client) IsConnected() bool {
-	return c.client != nil && c.client.IsConnected()
-}
-
-// defaultMessageHandler handles messages that don't have a specific handler
-func (c *Client) defaultMessageHandler(client mqtt.Client, msg mqtt.Message) {
-	log.Printf("Received message on topic %s: %s", msg.Topic(), string(msg.Payload()))
-}
-
-// topicMatches checks if a topic matches a pattern (supports + and # wildcards)
-func (c *Client) topicMatches(pattern, topic string) bool {
-	// Simple wildcard matching implementation
-	// This is a basic implementation - for production use a more robust MQTT topic matcher
-
-	// Split both pattern and topic by '/'
-	patternParts := strings.Split(pattern, "/")
-	topicParts := strings.Split(topic, "/")
-
-	// Handle # wildcard (matches everything after this point)
-	if len(patternParts) > 0 && patternParts[len(patternParts)-1] == "#" {
-		// Remove the # from pattern
-		patternParts = patternParts[:len(patternParts)-1]
-		// Check if topic starts with the pattern (excluding #)
-		if len(topicParts) >= len(patternParts) {
-			for i, part := range patternParts {
-				if i >= len(topicParts) {
-					return false
-				}
-				if part != "+" && part != topicParts[i] {
-					return false
-				}
-			}
-			return true
+// onConnect publishes the online status, subscribes to heartbeat round trips and
+// flushes messages queued while the client was disconnected
+func (c *Client) onConnect(_ mqtt.Client) {
+	if c.config.StatusTopic != "" {
+		if err := c.publish(c.config.StatusTopic, c.config.QoS, true, statusOnline); err != nil {
+			log.Printf("Failed to publish online status: %v", err)
 		}
-		return false
 	}
 
-	// Handle + wildcard and exact matching
-	if len(patternParts) != len(topicParts) {
-		return false
+	c.subscribeHeartbeat()
+
+	if c.queue == nil {
+		return
 	}
 
-	for i, patternPart := range patternParts {
-		if patternPart != "+" && patternPart != topicParts[i] {
-			return false
+	msgs := c.queue.drain()
+	for i, msg := range msgs {
+		if err := c.publish(msg.topic, msg.qos, msg.retained, msg.payload); err != nil {
+			log.Printf("Failed to flush publish queue: %v", err)
+			c.queue.requeue(msgs[i:])
+			return
 		}
 	}
 
-	return true
+	if len(msgs) > 0 {
+		log.Printf("Flushed %d queued messages", len(msgs))
+	}
+}
+
+// IsConnected returns true if the client is connected
+func (c *Client) IsConnected() bool {
+	return c.client != nil && c.client.IsConnected()
+}
+
+// defaultMessageHandler handles messages that don't have a specific handler
+func (c *Client) defaultMessageHandler(client mqtt.Client, msg mqtt.Message) {
+	log.Printf("Received message on topic %s: %s", msg.Topic(), string(msg.Payload()))
 }
@@ -0,0 +1,42 @@
+package mqtt
+
+import (
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// Client ID strategies
+const (
+	// ClientIDStable appends the hostname, so the ID survives restarts and persistent sessions resume
+	ClientIDStable = "stable"
+	// ClientIDRandom appends a random suffix, so every start gets a fresh session
+	ClientIDRandom = "random"
+)
+
+// ClientID builds the client ID for base using the given strategy.
+// Unknown strategies are treated as ClientIDStable.
+func ClientID(base, strategy string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+	return buildClientID(base, strategy, hostname, randomSuffix)
+}
+
+// buildClientID builds the client ID from an explicit hostname and random suffix source
+func buildClientID(base, strategy, hostname string, suffix func() string) string {
+	if strategy == ClientIDRandom {
+		return base + "-" + suffix()
+	}
+
+	if hostname == "" {
+		return base
+	}
+	return base + "-" + hostname
+}
+
+// randomSuffix returns 8 random hex characters
+func randomSuffix() string {
+	return uuid.New().String()[:8]
+}
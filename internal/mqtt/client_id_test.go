@@ -0,0 +1,44 @@
+package mqtt
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestBuildClientID(t *testing.T) {
+	suffix := func() string { return "a1b2c3d4" }
+
+	tests := []struct {
+		name     string
+		strategy string
+		hostname string
+		expected string
+	}{
+		{"stable uses hostname", ClientIDStable, "gateway-01", "iot-platform-server-gateway-01"},
+		{"stable without hostname", ClientIDStable, "", "iot-platform-server"},
+		{"unknown strategy is stable", "other", "gateway-01", "iot-platform-server-gateway-01"},
+		{"random uses suffix", ClientIDRandom, "gateway-01", "iot-platform-server-a1b2c3d4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildClientID("iot-platform-server", tt.strategy, tt.hostname, suffix); got != tt.expected {
+				t.Errorf("Expected client ID '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClientID(t *testing.T) {
+	if first, second := ClientID("receiver", ClientIDStable), ClientID("receiver", ClientIDStable); first != second {
+		t.Errorf("Expected stable client IDs to match, got '%s' and '%s'", first, second)
+	}
+
+	first, second := ClientID("receiver", ClientIDRandom), ClientID("receiver", ClientIDRandom)
+	if first == second {
+		t.Errorf("Expected random client IDs to differ, both were '%s'", first)
+	}
+	if !regexp.MustCompile(`^receiver-[0-9a-f]{8}$`).MatchString(first) {
+		t.Errorf("Unexpected random client ID '%s'", first)
+	}
+}
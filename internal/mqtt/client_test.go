@@ -1,12 +1,19 @@
 package mqtt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"iot-platform-go/internal/config"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 func TestNewClient(t *testing.T) {
@@ -34,6 +41,277 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestConnect_UnsupportedBrokerScheme(t *testing.T) {
+	client := NewClient(&config.MQTTConfig{Broker: "http://localhost:1883", ClientID: "test-client"})
+
+	err := client.Connect()
+	if err == nil {
+		t.Fatal("Expected an error for an http:// broker URL")
+	}
+	if !strings.Contains(err.Error(), `unsupported scheme "http"`) {
+		t.Errorf("Expected an unsupported scheme error, got %v", err)
+	}
+	if client.client != nil {
+		t.Error("Expected no paho client to be created")
+	}
+}
+
+func TestClientOptions_Reconnect(t *testing.T) {
+	cfg := &config.MQTTConfig{
+		Broker:   "tcp://localhost:1883",
+		ClientID: "test-client",
+		Reconnect: config.ReconnectConfig{
+			Interval:    2 * time.Second,
+			MaxInterval: 45 * time.Second,
+		},
+	}
+
+	opts := NewClient(cfg).clientOptions()
+	if opts.ConnectRetryInterval != 2*time.Second {
+		t.Errorf("Expected connect retry interval 2s, got %s", opts.ConnectRetryInterval)
+	}
+	if opts.MaxReconnectInterval != 45*time.Second {
+		t.Errorf("Expected max reconnect interval 45s, got %s", opts.MaxReconnectInterval)
+	}
+
+	// Unset intervals keep the previous defaults
+	opts = NewClient(&config.MQTTConfig{Broker: "tcp://localhost:1883"}).clientOptions()
+	if opts.ConnectRetryInterval != 5*time.Second {
+		t.Errorf("Expected default connect retry interval 5s, got %s", opts.ConnectRetryInterval)
+	}
+	if opts.MaxReconnectInterval != time.Minute {
+		t.Errorf("Expected default max reconnect interval 1m, got %s", opts.MaxReconnectInterval)
+	}
+}
+
+func TestClientOptions_PingTimeout(t *testing.T) {
+	cfg := &config.MQTTConfig{
+		Broker:      "tcp://localhost:1883",
+		ClientID:    "test-client",
+		KeepAlive:   60,
+		PingTimeout: 25 * time.Second,
+	}
+
+	opts := NewClient(cfg).clientOptions()
+	if opts.PingTimeout != 25*time.Second {
+		t.Errorf("Expected ping timeout 25s, got %s", opts.PingTimeout)
+	}
+	if opts.KeepAlive != 60 {
+		t.Errorf("Expected keep-alive 60s, got %d", opts.KeepAlive)
+	}
+
+	// Unset timeout keeps the paho default
+	opts = NewClient(&config.MQTTConfig{Broker: "tcp://localhost:1883"}).clientOptions()
+	if opts.PingTimeout != 10*time.Second {
+		t.Errorf("Expected default ping timeout 10s, got %s", opts.PingTimeout)
+	}
+}
+
+func TestClientOptions_StatusWill(t *testing.T) {
+	opts := NewClient(&config.MQTTConfig{Broker: "tcp://localhost:1883", QoS: 1, StatusTopic: "server/status"}).clientOptions()
+	if !opts.WillEnabled {
+		t.Fatal("Expected a will when a status topic is configured")
+	}
+	if opts.WillTopic != "server/status" || string(opts.WillPayload) != "offline" {
+		t.Errorf("Expected will offline on server/status, got %s on %s", opts.WillPayload, opts.WillTopic)
+	}
+	if !opts.WillRetained || opts.WillQos != 1 {
+		t.Errorf("Expected a retained QoS 1 will, got retained=%v qos=%d", opts.WillRetained, opts.WillQos)
+	}
+
+	opts = NewClient(&config.MQTTConfig{Broker: "tcp://localhost:1883"}).clientOptions()
+	if opts.WillEnabled {
+		t.Error("Expected no will without a status topic")
+	}
+}
+
+func TestDisconnect_Timeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		expected uint
+	}{
+		{"configured", 2 * time.Second, 2000},
+		{"unset uses the default", 0, 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{connected: true}
+			client := NewClient(&config.MQTTConfig{DisconnectTimeout: tt.timeout})
+			client.client = broker
+
+			client.Disconnect()
+
+			if broker.quiesce != tt.expected {
+				t.Errorf("Expected quiesce %dms, got %dms", tt.expected, broker.quiesce)
+			}
+			if len(broker.publishedTopics()) != 0 {
+				t.Errorf("Expected no status without a status topic, got %v", broker.publishedTopics())
+			}
+		})
+	}
+}
+
+func TestDisconnect_PublishesOfflineStatus(t *testing.T) {
+	broker := &fakeBroker{connected: true}
+	client := NewClient(&config.MQTTConfig{QoS: 1, StatusTopic: "server/status", DisconnectTimeout: time.Second})
+	client.client = broker
+
+	client.Disconnect()
+
+	if topics := broker.publishedTopics(); len(topics) != 1 || topics[0] != "server/status" {
+		t.Fatalf("Expected the offline status on server/status, got %v", topics)
+	}
+	if broker.lastValue != "offline" || !broker.lastRetain {
+		t.Errorf("Expected a retained offline status, got %v (retained=%v)", broker.lastValue, broker.lastRetain)
+	}
+	if broker.quiesce != 1000 {
+		t.Errorf("Expected quiesce 1000ms, got %dms", broker.quiesce)
+	}
+}
+
+func TestDisconnect_StalledStatusPublish(t *testing.T) {
+	broker := &fakeBroker{connected: true, stall: true}
+	client := NewClient(&config.MQTTConfig{StatusTopic: "server/status", DisconnectTimeout: 50 * time.Millisecond})
+	client.client = broker
+
+	// A broker that never acknowledges the status must not block shutdown
+	client.Disconnect()
+
+	if broker.quiesce != 50 {
+		t.Errorf("Expected disconnect after the stalled status publish, got quiesce %dms", broker.quiesce)
+	}
+}
+
+func TestWaitHandlers(t *testing.T) {
+	broker := &fakeBroker{connected: true}
+	client := NewClient(&config.MQTTConfig{QoS: 1})
+	client.client = broker
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var handled int32
+	err := client.Subscribe("devices/+/data", func(topic string, payload []byte) {
+		close(started)
+		<-release
+		atomic.AddInt32(&handled, 1)
+	})
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+
+	go broker.deliver(&fakeMessage{topic: "devices/d1/data"})
+	<-started
+
+	// A message being handled holds WaitHandlers until it finishes
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.WaitHandlers(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected WaitHandlers to time out while a message is handled, got %v", err)
+	}
+
+	close(release)
+	if err := client.WaitHandlers(context.Background()); err != nil {
+		t.Fatalf("WaitHandlers returned error: %v", err)
+	}
+
+	// Messages arriving afterwards are not handled
+	broker.deliver(&fakeMessage{topic: "devices/d2/data"})
+	if got := atomic.LoadInt32(&handled); got != 1 {
+		t.Errorf("Expected 1 handled message, got %d", got)
+	}
+}
+
+func TestSubscribe_HandlerConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		burst       int
+		maxInFlight int32
+	}{
+		{"capped", 4, 50, 4},
+		{"single", 1, 20, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{connected: true}
+			client := NewClient(&config.MQTTConfig{QoS: 1, HandlerConcurrency: tt.concurrency})
+			client.client = broker
+
+			var inFlight, peak, handled int32
+			err := client.Subscribe("devices/+/data", func(topic string, payload []byte) {
+				current := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+				for {
+					seen := atomic.LoadInt32(&peak)
+					if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+						break
+					}
+				}
+				// Hold the slot long enough for the rest of the burst to pile up
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&handled, 1)
+			})
+			if err != nil {
+				t.Fatalf("Subscribe returned error: %v", err)
+			}
+
+			msgs := make([]mqtt.Message, tt.burst)
+			for i := range msgs {
+				msgs[i] = &fakeMessage{topic: fmt.Sprintf("devices/d%d/data", i), payload: []byte(`{"value":1}`)}
+			}
+			broker.deliver(msgs...)
+
+			if handled != int32(tt.burst) {
+				t.Errorf("Expected %d handled messages, got %d", tt.burst, handled)
+			}
+			if peak > tt.maxInFlight {
+				t.Errorf("Expected at most %d messages in flight, got %d", tt.maxInFlight, peak)
+			}
+			if peak != tt.maxInFlight {
+				t.Errorf("Expected the burst to use all %d slots, got %d", tt.maxInFlight, peak)
+			}
+		})
+	}
+}
+
+func TestSubscribe_UnlimitedHandlerConcurrency(t *testing.T) {
+	broker := &fakeBroker{connected: true}
+	client := NewClient(&config.MQTTConfig{QoS: 1})
+	client.client = broker
+
+	// Without a limit every message of the burst is handled at once
+	const burst = 10
+	var started sync.WaitGroup
+	started.Add(burst)
+	err := client.Subscribe("devices/+/data", func(topic string, payload []byte) {
+		started.Done()
+		started.Wait()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+
+	msgs := make([]mqtt.Message, burst)
+	for i := range msgs {
+		msgs[i] = &fakeMessage{topic: "devices/d1/data"}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		broker.deliver(msgs...)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected all messages to be handled concurrently without a limit")
+	}
+}
+
 func TestClientConnection(t *testing.T) {
 	// Skip this test in CI/CD environment
 	if os.Getenv("CI") == "true" {
@@ -113,6 +391,45 @@ func TestMessageHandler(t *testing.T) {
 	}
 }
 
+func TestSubscriptions(t *testing.T) {
+	broker := &fakeBroker{connected: true}
+	client := NewClient(&config.MQTTConfig{QoS: 1})
+	client.client = broker
+
+	if got := client.Subscriptions(); len(got) != 0 {
+		t.Errorf("Expected no subscriptions, got %v", got)
+	}
+
+	handler := func(topic string, payload []byte) {}
+	for _, topic := range []string{"devices/+/status", "devices/+/data"} {
+		if err := client.Subscribe(topic, handler); err != nil {
+			t.Fatalf("Subscribe(%s) failed: %v", topic, err)
+		}
+	}
+
+	want := []string{"devices/+/data", "devices/+/status"}
+	if got := client.Subscriptions(); !equalTopics(got, want) {
+		t.Errorf("Expected subscriptions %v, got %v", want, got)
+	}
+
+	if err := client.Unsubscribe("devices/+/status"); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	if got := client.Subscriptions(); !equalTopics(got, []string{"devices/+/data"}) {
+		t.Errorf("Expected only devices/+/data after unsubscribe, got %v", got)
+	}
+
+	// Unsubscribing everything is repeatable
+	for i := 0; i < 2; i++ {
+		if err := client.UnsubscribeAll(); err != nil {
+			t.Fatalf("UnsubscribeAll failed: %v", err)
+		}
+		if got := client.Subscriptions(); len(got) != 0 {
+			t.Errorf("Expected no subscriptions after UnsubscribeAll, got %v", got)
+		}
+	}
+}
+
 func TestMessagePublishSubscribe(t *testing.T) {
 	// Skip this test in CI/CD environment
 	if os.Getenv("CI") == "true" {
@@ -0,0 +1,148 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"iot-platform-go/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// commandPublishTimeout bounds the wait for the broker to acknowledge a command sent without waiting for a response
+const commandPublishTimeout = 5 * time.Second
+
+// AckPublisher publishes a message and waits for the broker to acknowledge it
+type AckPublisher interface {
+	PublishAck(topic string, payload interface{}, timeout time.Duration) error
+}
+
+// commandMessage is published to a device's commands topic; the device echoes ID in its response
+type commandMessage struct {
+	ID      string    `json:"id"`
+	Command string    `json:"command"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// commandReply is a device's response to a pending command
+type commandReply struct {
+	payload    []byte
+	receivedAt time.Time
+}
+
+// pendingCommand is a command waiting for its response
+type pendingCommand struct {
+	deviceID string
+	replies  chan commandReply // buffered, so the first response never blocks the message handler
+}
+
+// Commands sends commands to devices over MQTT and correlates their responses by command ID.
+// Messages received on the command response topics must be passed to HandleResponse.
+type Commands struct {
+	publisher AckPublisher
+	prefix    string
+	now       func() time.Time
+	newID     func() string
+
+	mu      sync.Mutex
+	pending map[string]pendingCommand
+}
+
+// NewCommands creates a command sender publishing to the device command topics under prefix
+func NewCommands(publisher AckPublisher, prefix string) *Commands {
+	return &Commands{
+		publisher: publisher,
+		prefix:    prefix,
+		now:       time.Now,
+		newID:     uuid.NewString,
+		pending:   make(map[string]pendingCommand),
+	}
+}
+
+// Send publishes command to {prefix}/devices/{id}/commands and, with a positive timeout, waits that long
+// for the device's response. An error means the command was not sent or ctx was cancelled; a device that
+// does not respond in time only leaves the result's Responded false.
+func (c *Commands) Send(ctx context.Context, deviceID, command string, timeout time.Duration) (*models.CommandResult, error) {
+	msg := commandMessage{ID: c.newID(), Command: command, SentAt: c.now().UTC()}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s command: %w", command, err)
+	}
+	result := &models.CommandResult{DeviceID: deviceID, CommandID: msg.ID, Command: command, SentAt: msg.SentAt}
+	topic := DeviceCommandTopic(c.prefix, deviceID)
+
+	if timeout <= 0 {
+		if err := c.publisher.PublishAck(topic, payload, commandPublishTimeout); err != nil {
+			return nil, fmt.Errorf("failed to send %s command: %w", command, err)
+		}
+		return result, nil
+	}
+
+	// Register before publishing, so a fast response is not missed
+	replies := c.register(msg.ID, deviceID)
+	defer c.unregister(msg.ID)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.publisher.PublishAck(topic, payload, timeout); err != nil {
+		return nil, fmt.Errorf("failed to send %s command: %w", command, err)
+	}
+
+	select {
+	case reply := <-replies:
+		result.Responded = true
+		result.LatencyMS = float64(reply.receivedAt.Sub(msg.SentAt)) / float64(time.Millisecond)
+		result.Response = reply.payload
+		return result, nil
+	case <-waitCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("stopped waiting for %s response: %w", command, err)
+		}
+		return result, nil
+	}
+}
+
+// HandleResponse passes a device's response to the command waiting for it. Responses that are not
+// JSON, carry no pending command ID, or arrive on another device's topic are ignored, as are repeats.
+func (c *Commands) HandleResponse(topic string, payload []byte) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(payload, &response); err != nil || response.ID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	pending, ok := c.pending[response.ID]
+	if ok && topic == DeviceCommandResponseTopic(c.prefix, pending.deviceID) {
+		delete(c.pending, response.ID)
+	} else {
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if ok {
+		pending.replies <- commandReply{payload: append([]byte(nil), payload...), receivedAt: c.now().UTC()}
+	}
+}
+
+// register starts waiting for the response to a command
+func (c *Commands) register(id, deviceID string) <-chan commandReply {
+	replies := make(chan commandReply, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[id] = pendingCommand{deviceID: deviceID, replies: replies}
+	return replies
+}
+
+// unregister stops waiting for the response to a command
+func (c *Commands) unregister(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
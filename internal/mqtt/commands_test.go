@@ -0,0 +1,191 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDevice acknowledges published commands and answers them through respond, standing in for
+// the broker and the device on the other side of it
+type fakeDevice struct {
+	mu         sync.Mutex
+	published  []string
+	commands   []commandMessage
+	publishErr error
+	respond    func(topic string, command commandMessage)
+}
+
+func (d *fakeDevice) PublishAck(topic string, payload interface{}, _ time.Duration) error {
+	if d.publishErr != nil {
+		return d.publishErr
+	}
+
+	var command commandMessage
+	if err := json.Unmarshal(payload.([]byte), &command); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.published = append(d.published, topic)
+	d.commands = append(d.commands, command)
+	d.mu.Unlock()
+
+	if d.respond != nil {
+		go d.respond(topic, command)
+	}
+	return nil
+}
+
+func TestCommands_Send(t *testing.T) {
+	device := &fakeDevice{}
+	commands := NewCommands(device, "site-a")
+	responseTopic := DeviceCommandResponseTopic("site-a", "device-1")
+
+	device.respond = func(_ string, command commandMessage) {
+		// Responses that do not answer this command are ignored
+		commands.HandleResponse(responseTopic, []byte(`not json`))
+		commands.HandleResponse(responseTopic, []byte(`{"command":"pong"}`))
+		commands.HandleResponse(responseTopic, []byte(`{"id":"another-command","command":"pong"}`))
+		commands.HandleResponse(DeviceCommandResponseTopic("site-a", "device-2"), []byte(fmt.Sprintf(`{"id":%q,"from":"device-2"}`, command.ID)))
+
+		// The device's answer, delivered twice as with overlapping subscriptions
+		answer := []byte(fmt.Sprintf(`{"id":%q,"command":"pong"}`, command.ID))
+		commands.HandleResponse(responseTopic, answer)
+		commands.HandleResponse(responseTopic, answer)
+	}
+
+	result, err := commands.Send(context.Background(), "device-1", "ping", time.Second)
+	if err != nil {
+		t.Fatalf("Expected the ping to succeed, got %v", err)
+	}
+
+	if len(device.commands) != 1 {
+		t.Fatalf("Expected one published command, got %d", len(device.commands))
+	}
+	if device.published[0] != "site-a/devices/device-1/commands" {
+		t.Errorf("Expected the command on the device's commands topic, got %s", device.published[0])
+	}
+	if device.commands[0].Command != "ping" || device.commands[0].ID == "" {
+		t.Errorf("Expected a ping with an ID, got %+v", device.commands[0])
+	}
+
+	if !result.Responded {
+		t.Fatal("Expected the device's response")
+	}
+	if result.CommandID != device.commands[0].ID {
+		t.Errorf("Expected command ID %s, got %s", device.commands[0].ID, result.CommandID)
+	}
+	if result.LatencyMS < 0 {
+		t.Errorf("Expected a non-negative latency, got %v", result.LatencyMS)
+	}
+	expected := fmt.Sprintf(`{"id":%q,"command":"pong"}`, device.commands[0].ID)
+	if string(result.Response) != expected {
+		t.Errorf("Expected response %s, got %s", expected, result.Response)
+	}
+
+	// Nothing is left waiting
+	commands.mu.Lock()
+	defer commands.mu.Unlock()
+	if len(commands.pending) != 0 {
+		t.Errorf("Expected no pending commands, got %d", len(commands.pending))
+	}
+}
+
+func TestCommands_ConcurrentCorrelation(t *testing.T) {
+	device := &fakeDevice{}
+	commands := NewCommands(device, "")
+
+	// Devices answer on the response topic next to their commands topic, in reverse order
+	const count = 5
+	device.respond = func(topic string, command commandMessage) {
+		var index int
+		fmt.Sscanf(topic, "devices/device-%d/commands", &index)
+		time.Sleep(time.Duration(count-index) * 5 * time.Millisecond)
+		payload := fmt.Sprintf(`{"id":%q,"device":"device-%d"}`, command.ID, index)
+		commands.HandleResponse(topic+"/response", []byte(payload))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(deviceID string) {
+			defer wg.Done()
+
+			result, err := commands.Send(context.Background(), deviceID, "ping", time.Second)
+			if err != nil {
+				t.Errorf("Expected the ping of %s to succeed, got %v", deviceID, err)
+				return
+			}
+			var response struct {
+				ID     string `json:"id"`
+				Device string `json:"device"`
+			}
+			if err := json.Unmarshal(result.Response, &response); err != nil {
+				t.Errorf("Expected a JSON response, got %v", err)
+				return
+			}
+			if !result.Responded || response.ID != result.CommandID || response.Device != deviceID {
+				t.Errorf("Expected the response of %s to command %s, got %+v", deviceID, result.CommandID, response)
+			}
+		}(fmt.Sprintf("device-%d", i))
+	}
+	wg.Wait()
+}
+
+func TestCommands_Timeout(t *testing.T) {
+	commands := NewCommands(&fakeDevice{}, "")
+
+	result, err := commands.Send(context.Background(), "device-1", "ping", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected a timeout to be reported in the result, got %v", err)
+	}
+	if result.Responded || result.Response != nil {
+		t.Errorf("Expected no response, got %+v", result)
+	}
+
+	// A late response is dropped
+	commands.HandleResponse(DeviceCommandResponseTopic("", "device-1"), []byte(fmt.Sprintf(`{"id":%q}`, result.CommandID)))
+}
+
+func TestCommands_Cancelled(t *testing.T) {
+	commands := NewCommands(&fakeDevice{}, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := commands.Send(ctx, "device-1", "ping", time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCommands_NoWait(t *testing.T) {
+	device := &fakeDevice{}
+	commands := NewCommands(device, "")
+
+	result, err := commands.Send(context.Background(), "device-1", "ping", 0)
+	if err != nil {
+		t.Fatalf("Expected the command to be sent, got %v", err)
+	}
+	if result.Responded || len(device.commands) != 1 || result.CommandID != device.commands[0].ID {
+		t.Errorf("Expected the command sent without waiting, got %+v", result)
+	}
+	if len(commands.pending) != 0 {
+		t.Errorf("Expected no pending commands, got %d", len(commands.pending))
+	}
+}
+
+func TestCommands_PublishError(t *testing.T) {
+	commands := NewCommands(&fakeDevice{publishErr: ErrNotConnected}, "")
+
+	for _, timeout := range []time.Duration{0, time.Second} {
+		if _, err := commands.Send(context.Background(), "device-1", "ping", timeout); !errors.Is(err, ErrNotConnected) {
+			t.Errorf("Expected ErrNotConnected with timeout %s, got %v", timeout, err)
+		}
+	}
+	if len(commands.pending) != 0 {
+		t.Errorf("Expected no pending commands, got %d", len(commands.pending))
+	}
+}
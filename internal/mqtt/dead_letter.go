@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Dead-letter sink types
+const (
+	DeadLetterNone  = "none"
+	DeadLetterFile  = "file"
+	DeadLetterTopic = "topic"
+)
+
+// DeadLetter is a message that could not be processed, kept for later inspection
+type DeadLetter struct {
+	Topic      string    `json:"topic"`
+	Error      string    `json:"error"`
+	Payload    []byte    `json:"payload"` // raw bytes, base64 encoded in JSON
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// DeadLetterSink stores messages that could not be processed
+type DeadLetterSink interface {
+	Send(letter DeadLetter) error
+}
+
+// Publisher publishes a payload to a topic
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+// WriterDeadLetterSink writes dead letters to w as JSON lines
+type WriterDeadLetterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterDeadLetterSink creates a sink that appends one JSON object per dead letter to w
+func NewWriterDeadLetterSink(w io.Writer) *WriterDeadLetterSink {
+	return &WriterDeadLetterSink{w: w}
+}
+
+// Send writes the dead letter as a single line
+func (s *WriterDeadLetterSink) Send(letter DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return nil
+}
+
+// TopicDeadLetterSink publishes dead letters to an MQTT topic
+type TopicDeadLetterSink struct {
+	publisher Publisher
+	topic     string
+}
+
+// NewTopicDeadLetterSink creates a sink that publishes each dead letter as JSON to topic
+func NewTopicDeadLetterSink(publisher Publisher, topic string) *TopicDeadLetterSink {
+	return &TopicDeadLetterSink{publisher: publisher, topic: topic}
+}
+
+// Send publishes the dead letter
+func (s *TopicDeadLetterSink) Send(letter DeadLetter) error {
+	payload, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+
+	if err := s.publisher.Publish(s.topic, payload); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+	return nil
+}
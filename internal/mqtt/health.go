@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// BrokerConnection is the part of the client the broker check uses
+type BrokerConnection interface {
+	IsConnected() bool
+	PublishAck(topic string, payload interface{}, timeout time.Duration) error
+}
+
+// healthMessage is the payload published to the health topic
+type healthMessage struct {
+	ClientID string    `json:"client_id"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// BrokerCheck actively checks that the broker accepts publishes, which a connection paho still
+// reports as up does not guarantee. A result is reused for ttl so frequent health polls do not
+// turn into broker traffic.
+type BrokerCheck struct {
+	conn     BrokerConnection
+	topic    string
+	clientID string
+	timeout  time.Duration
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	status    string
+}
+
+// NewBrokerCheck creates a broker check publishing to {prefix}/devices/server/health and
+// waiting up to timeout for the broker to acknowledge
+func NewBrokerCheck(conn BrokerConnection, prefix, clientID string, timeout, ttl time.Duration) *BrokerCheck {
+	return &BrokerCheck{
+		conn:     conn,
+		topic:    HealthTopic(prefix),
+		clientID: clientID,
+		timeout:  timeout,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Status returns LivenessDisconnected without publishing when the client is not connected.
+// Otherwise it returns LivenessConnected when the broker acknowledged the health publish and
+// LivenessDegraded when it did not, publishing again once the previous result is older than the ttl.
+func (b *BrokerCheck) Status() string {
+	if !b.conn.IsConnected() {
+		return LivenessDisconnected
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.status != "" && b.now().Sub(b.checkedAt) < b.ttl {
+		return b.status
+	}
+
+	b.status = LivenessConnected
+	if err := b.publish(); err != nil {
+		log.Printf("⚠️ MQTT broker health check failed: %v", err)
+		b.status = LivenessDegraded
+	}
+	b.checkedAt = b.now()
+
+	return b.status
+}
+
+// publish sends one health message and waits for the broker to acknowledge it
+func (b *BrokerCheck) publish() error {
+	payload, err := json.Marshal(healthMessage{ClientID: b.clientID, SentAt: b.now().UTC()})
+	if err != nil {
+		return err
+	}
+	return b.conn.PublishAck(b.topic, payload, b.timeout)
+}
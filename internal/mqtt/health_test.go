@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeConnection reports connected and fails publishes with publishErr, recording what was published
+type fakeConnection struct {
+	connected  bool
+	publishErr error
+	topics     []string
+	payloads   [][]byte
+	timeouts   []time.Duration
+}
+
+func (f *fakeConnection) IsConnected() bool {
+	return f.connected
+}
+
+func (f *fakeConnection) PublishAck(topic string, payload interface{}, timeout time.Duration) error {
+	f.topics = append(f.topics, topic)
+	f.payloads = append(f.payloads, payload.([]byte))
+	f.timeouts = append(f.timeouts, timeout)
+	return f.publishErr
+}
+
+func newTestBrokerCheck(conn *fakeConnection) (*BrokerCheck, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	check := NewBrokerCheck(conn, "acme", "server-1", time.Second, 10*time.Second)
+	check.now = func() time.Time { return now }
+	return check, &now
+}
+
+func TestBrokerCheck_Reachable(t *testing.T) {
+	conn := &fakeConnection{connected: true}
+	check, _ := newTestBrokerCheck(conn)
+
+	if status := check.Status(); status != LivenessConnected {
+		t.Fatalf("Expected %s, got %s", LivenessConnected, status)
+	}
+	if len(conn.topics) != 1 || conn.topics[0] != "acme/devices/server/health" {
+		t.Fatalf("Expected one publish to acme/devices/server/health, got %v", conn.topics)
+	}
+	if conn.timeouts[0] != time.Second {
+		t.Errorf("Expected the configured timeout, got %s", conn.timeouts[0])
+	}
+
+	var msg healthMessage
+	if err := json.Unmarshal(conn.payloads[0], &msg); err != nil {
+		t.Fatalf("Expected a JSON health message, got %v", err)
+	}
+	if msg.ClientID != "server-1" || msg.SentAt.IsZero() {
+		t.Errorf("Expected the client ID and send time, got %+v", msg)
+	}
+}
+
+func TestBrokerCheck_PublishFails(t *testing.T) {
+	// paho still reports a connection, but the broker does not acknowledge
+	conn := &fakeConnection{connected: true, publishErr: ErrPublishTimeout}
+	check, now := newTestBrokerCheck(conn)
+
+	if status := check.Status(); status != LivenessDegraded {
+		t.Fatalf("Expected %s, got %s", LivenessDegraded, status)
+	}
+
+	// The result is reused within the ttl
+	*now = now.Add(5 * time.Second)
+	if status := check.Status(); status != LivenessDegraded || len(conn.topics) != 1 {
+		t.Errorf("Expected the cached %s without publishing, got %s after %d publishes", LivenessDegraded, status, len(conn.topics))
+	}
+
+	// And checked again once it is older, recovering with the broker
+	conn.publishErr = nil
+	*now = now.Add(5 * time.Second)
+	if status := check.Status(); status != LivenessConnected || len(conn.topics) != 2 {
+		t.Errorf("Expected %s after publishing again, got %s after %d publishes", LivenessConnected, status, len(conn.topics))
+	}
+}
+
+func TestBrokerCheck_Disconnected(t *testing.T) {
+	conn := &fakeConnection{publishErr: errors.New("unexpected publish")}
+	check, _ := newTestBrokerCheck(conn)
+
+	if status := check.Status(); status != LivenessDisconnected {
+		t.Errorf("Expected %s, got %s", LivenessDisconnected, status)
+	}
+	if len(conn.topics) != 0 {
+		t.Errorf("Expected no publish while disconnected, got %v", conn.topics)
+	}
+}
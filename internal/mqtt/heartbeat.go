@@ -0,0 +1,152 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Liveness states reported by Liveness
+const (
+	LivenessConnected    = "connected"
+	LivenessDisconnected = "disconnected"
+	LivenessUnresponsive = "unresponsive" // paho reports a connection, but heartbeats stopped succeeding
+	LivenessDegraded     = "degraded"     // paho reports a connection, but the broker did not acknowledge the health check
+)
+
+// heartbeatMissedLimit is how many heartbeat intervals may pass without a successful heartbeat
+// before the connection is considered unresponsive, so a single lost heartbeat is tolerated
+const heartbeatMissedLimit = 2
+
+// heartbeatMessage is the payload published to the heartbeat topic.
+// ClientID tells this server's heartbeats apart from other instances sharing the broker.
+type heartbeatMessage struct {
+	ClientID string    `json:"client_id"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// RunHeartbeat publishes a heartbeat every HeartbeatInterval until ctx is done; it returns at once when
+// heartbeats are disabled. A heartbeat succeeds when the broker acknowledges it (completes it at QoS 0),
+// or with HeartbeatRoundTrip when it is received back on the heartbeat topic.
+func (c *Client) RunHeartbeat(ctx context.Context) {
+	if !c.heartbeatEnabled() {
+		return
+	}
+	interval := c.config.HeartbeatInterval
+
+	c.heartbeatMu.Lock()
+	c.heartbeatStarted = time.Now()
+	c.heartbeatMu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.sendHeartbeat(interval); err != nil {
+			log.Printf("MQTT heartbeat failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeatEnabled reports whether the config enables heartbeats with a usable interval
+func (c *Client) heartbeatEnabled() bool {
+	return c.config.HeartbeatEnabled && c.config.HeartbeatInterval > 0
+}
+
+// sendHeartbeat publishes one heartbeat, waiting at most timeout for it to complete
+func (c *Client) sendHeartbeat(timeout time.Duration) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	payload, err := json.Marshal(heartbeatMessage{ClientID: c.config.ClientID, SentAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+
+	topic := HeartbeatTopic(c.config.TopicPrefix)
+	token := c.client.Publish(topic, c.config.QoS, false, payload)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("%w: topic %s after %s", ErrPublishTimeout, topic, timeout)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish heartbeat: %w", err)
+	}
+
+	if !c.config.HeartbeatRoundTrip {
+		c.recordHeartbeat()
+	}
+	return nil
+}
+
+// subscribeHeartbeat subscribes to the heartbeat topic when round trips are confirmed.
+// The subscription bypasses the handler map, so UnsubscribeAll leaves it in place.
+func (c *Client) subscribeHeartbeat() {
+	if !c.heartbeatEnabled() || !c.config.HeartbeatRoundTrip {
+		return
+	}
+
+	topic := HeartbeatTopic(c.config.TopicPrefix)
+	if token := c.client.Subscribe(topic, c.config.QoS, c.handleHeartbeat); token.Wait() && token.Error() != nil {
+		log.Printf("Failed to subscribe to heartbeat topic %s: %v", topic, token.Error())
+	}
+}
+
+// handleHeartbeat records a round trip when one of this client's heartbeats comes back
+func (c *Client) handleHeartbeat(_ mqtt.Client, msg mqtt.Message) {
+	var heartbeat heartbeatMessage
+	if err := json.Unmarshal(msg.Payload(), &heartbeat); err != nil || heartbeat.ClientID != c.config.ClientID {
+		return
+	}
+	c.recordHeartbeat()
+}
+
+// recordHeartbeat marks the latest heartbeat as successful now
+func (c *Client) recordHeartbeat() {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	c.lastHeartbeatOK = time.Now()
+}
+
+// LastHeartbeatOK returns when a heartbeat last succeeded, or the zero time if none has
+func (c *Client) LastHeartbeatOK() time.Time {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	return c.lastHeartbeatOK
+}
+
+// Liveness reports the connection state for health checks. While heartbeats run, a connection paho
+// still reports as up is unresponsive once no heartbeat has succeeded for heartbeatMissedLimit intervals.
+func (c *Client) Liveness() string {
+	if !c.IsConnected() {
+		return LivenessDisconnected
+	}
+
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+
+	// Heartbeats are disabled or have not started yet
+	if c.heartbeatStarted.IsZero() {
+		return LivenessConnected
+	}
+
+	// Before the first success, allow the same time from when heartbeats started
+	last := c.lastHeartbeatOK
+	if last.Before(c.heartbeatStarted) {
+		last = c.heartbeatStarted
+	}
+	if time.Since(last) > heartbeatMissedLimit*c.config.HeartbeatInterval {
+		return LivenessUnresponsive
+	}
+	return LivenessConnected
+}
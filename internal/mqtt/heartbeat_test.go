@@ -0,0 +1,229 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+)
+
+func newHeartbeatClient(cfg config.MQTTConfig) (*Client, *fakeBroker) {
+	cfg.HeartbeatEnabled = true
+	broker := &fakeBroker{connected: true}
+	client := NewClient(&cfg)
+	client.client = broker
+	return client, broker
+}
+
+func TestRunHeartbeat_PublishesOnSchedule(t *testing.T) {
+	client, broker := newHeartbeatClient(config.MQTTConfig{
+		ClientID:          "server-1",
+		TopicPrefix:       "acme",
+		QoS:               1,
+		HeartbeatInterval: 20 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client.RunHeartbeat(ctx)
+	}()
+
+	time.Sleep(110 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	// One heartbeat right away, then one per interval
+	topics := broker.publishedTopics()
+	if len(topics) < 4 || len(topics) > 7 {
+		t.Errorf("Expected about 6 heartbeats in 110ms at a 20ms interval, got %d", len(topics))
+	}
+	for _, topic := range topics {
+		if topic != "acme/devices/server/heartbeat" {
+			t.Fatalf("Expected heartbeats on acme/devices/server/heartbeat, got %s", topic)
+		}
+	}
+
+	var heartbeat heartbeatMessage
+	if err := json.Unmarshal(broker.lastValue.([]byte), &heartbeat); err != nil {
+		t.Fatalf("Expected a JSON heartbeat, got %v", err)
+	}
+	if heartbeat.ClientID != "server-1" || heartbeat.SentAt.IsZero() {
+		t.Errorf("Expected the client ID and send time, got %+v", heartbeat)
+	}
+
+	// Acknowledged heartbeats count as OK without a round trip
+	if time.Since(client.LastHeartbeatOK()) > time.Second {
+		t.Errorf("Expected a recent successful heartbeat, got %s", client.LastHeartbeatOK())
+	}
+
+	// Nothing is published once stopped
+	if count := len(broker.publishedTopics()); count != len(topics) {
+		t.Errorf("Expected no heartbeats after stopping, got %d more", count-len(topics))
+	}
+}
+
+func TestRunHeartbeat_Disabled(t *testing.T) {
+	client, broker := newHeartbeatClient(config.MQTTConfig{HeartbeatInterval: time.Millisecond})
+	client.config.HeartbeatEnabled = false
+
+	// Returns at once instead of running until the context is done
+	client.RunHeartbeat(context.Background())
+
+	if topics := broker.publishedTopics(); len(topics) != 0 {
+		t.Errorf("Expected no heartbeats when disabled, got %v", topics)
+	}
+	if client.Liveness() != LivenessConnected {
+		t.Errorf("Expected connected without heartbeats, got %s", client.Liveness())
+	}
+}
+
+func TestHeartbeat_FailedPublish(t *testing.T) {
+	client, broker := newHeartbeatClient(config.MQTTConfig{HeartbeatInterval: time.Second})
+	broker.stall = true
+
+	if err := client.sendHeartbeat(10 * time.Millisecond); err == nil {
+		t.Fatal("Expected an error for an unacknowledged heartbeat")
+	}
+	if !client.LastHeartbeatOK().IsZero() {
+		t.Error("Expected an unacknowledged heartbeat not to count as OK")
+	}
+
+	broker.setConnected(false)
+	if err := client.sendHeartbeat(10 * time.Millisecond); err != ErrNotConnected {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestHeartbeat_RoundTrip(t *testing.T) {
+	client, broker := newHeartbeatClient(config.MQTTConfig{
+		ClientID:           "server-1",
+		QoS:                1,
+		HeartbeatInterval:  time.Second,
+		HeartbeatRoundTrip: true,
+	})
+
+	// The heartbeat topic is subscribed on connect, outside the device subscriptions
+	client.onConnect(broker)
+	if broker.callback == nil {
+		t.Fatal("Expected a heartbeat subscription on connect")
+	}
+	if subscriptions := client.Subscriptions(); len(subscriptions) != 0 {
+		t.Errorf("Expected the heartbeat subscription to survive UnsubscribeAll, got %v", subscriptions)
+	}
+
+	// The broker acknowledging is not enough with round trips
+	if err := client.sendHeartbeat(time.Second); err != nil {
+		t.Fatalf("Unexpected heartbeat error: %v", err)
+	}
+	if !client.LastHeartbeatOK().IsZero() {
+		t.Fatal("Expected a heartbeat to count only once it comes back")
+	}
+
+	// Another instance's heartbeat and garbage are ignored
+	broker.deliver(
+		&fakeMessage{topic: HeartbeatTopic(""), payload: []byte(`{"client_id":"server-2"}`)},
+		&fakeMessage{topic: HeartbeatTopic(""), payload: []byte(`not json`)},
+	)
+	if !client.LastHeartbeatOK().IsZero() {
+		t.Fatal("Expected other heartbeats not to count")
+	}
+
+	broker.deliver(&fakeMessage{topic: HeartbeatTopic(""), payload: broker.lastValue.([]byte)})
+	if time.Since(client.LastHeartbeatOK()) > time.Second {
+		t.Errorf("Expected the returned heartbeat to count, got %s", client.LastHeartbeatOK())
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	interval := time.Minute
+
+	tests := []struct {
+		name      string
+		connected bool
+		started   time.Duration // ago; 0 means heartbeats have not started
+		lastOK    time.Duration // ago; 0 means none succeeded
+		expected  string
+	}{
+		{"disconnected", false, time.Second, time.Second, LivenessDisconnected},
+		{"heartbeats not started", true, 0, 0, LivenessConnected},
+		{"first heartbeat pending", true, time.Second, 0, LivenessConnected},
+		{"recent heartbeat", true, time.Hour, 30 * time.Second, LivenessConnected},
+		{"one missed heartbeat", true, time.Hour, 90 * time.Second, LivenessConnected},
+		{"heartbeats stopped", true, time.Hour, 3 * time.Minute, LivenessUnresponsive},
+		{"never succeeded", true, 3 * time.Minute, 0, LivenessUnresponsive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, broker := newHeartbeatClient(config.MQTTConfig{HeartbeatInterval: interval})
+			broker.setConnected(tt.connected)
+			if tt.started > 0 {
+				client.heartbeatStarted = time.Now().Add(-tt.started)
+			}
+			if tt.lastOK > 0 {
+				client.lastHeartbeatOK = time.Now().Add(-tt.lastOK)
+			}
+
+			if got := client.Liveness(); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHeartbeat_RoundTripWithBroker(t *testing.T) {
+	// Skip this test in CI/CD environment
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping MQTT heartbeat test in CI environment")
+	}
+
+	client := NewClient(&config.MQTTConfig{
+		Broker:             "tcp://localhost:1883",
+		ClientID:           "heartbeat-test-" + time.Now().Format("20060102150405"),
+		TopicPrefix:        "heartbeat-test",
+		KeepAlive:          60,
+		ConnectTimeout:     5,
+		QoS:                1,
+		AutoReconnect:      true,
+		HeartbeatEnabled:   true,
+		HeartbeatInterval:  100 * time.Millisecond,
+		HeartbeatRoundTrip: true,
+	})
+
+	connectChan := make(chan error, 1)
+	go func() {
+		connectChan <- client.Connect()
+	}()
+
+	select {
+	case err := <-connectChan:
+		if err != nil {
+			t.Skipf("Skipping test - MQTT broker not available: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Skip("Skipping test - MQTT broker connection timeout")
+	}
+	defer client.Disconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.RunHeartbeat(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.LastHeartbeatOK().IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a heartbeat round trip through the broker")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if client.Liveness() != LivenessConnected {
+		t.Errorf("Expected a connected client, got %s", client.Liveness())
+	}
+}
@@ -0,0 +1,34 @@
+package mqtt
+
+import "strings"
+
+// MatchTopic reports whether a topic matches a subscription pattern.
+// A + level matches exactly one topic level and a trailing # matches the parent level and any levels below it.
+// Empty levels (from leading, trailing or repeated slashes) are significant, and
+// wildcards in the first level never match topics starting with $.
+func MatchTopic(pattern, topic string) bool {
+	patternLevels := strings.Split(pattern, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	if strings.HasPrefix(topic, "$") &&
+		(patternLevels[0] == SingleLevelWildcard || patternLevels[0] == MultiLevelWildcard) {
+		return false
+	}
+
+	for i, level := range patternLevels {
+		if level == MultiLevelWildcard {
+			// # is only valid as the last level
+			return i == len(patternLevels)-1
+		}
+
+		if i >= len(topicLevels) {
+			return false
+		}
+
+		if level != SingleLevelWildcard && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(patternLevels) == len(topicLevels)
+}
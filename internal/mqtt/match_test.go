@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		topic   string
+		want    bool
+	}{
+		// Exact matching
+		{"exact match", "devices/device001/data", "devices/device001/data", true},
+		{"different level", "devices/device001/data", "devices/device001/status", false},
+		{"pattern longer than topic", "devices/device001/data", "devices/device001", false},
+		{"topic longer than pattern", "devices/device001", "devices/device001/data", false},
+		{"case sensitive", "devices/Device001/data", "devices/device001/data", false},
+
+		// Single-level wildcard
+		{"plus matches one level", "devices/+/data", "devices/device001/data", true},
+		{"plus does not match two levels", "devices/+/data", "devices/a/b/data", false},
+		{"plus does not match missing level", "devices/+/data", "devices/data", false},
+		{"plus matches empty level", "devices/+/data", "devices//data", true},
+		{"trailing plus", "devices/+", "devices/device001", true},
+		{"trailing plus does not match deeper levels", "devices/+", "devices/device001/data", false},
+		{"plus only", "+", "devices", true},
+		{"plus only does not match multi-level topic", "+", "devices/device001", false},
+		{"multiple plus", "+/+/data", "devices/device001/data", true},
+		{"plus inside level is literal", "devices/dev+/data", "devices/device001/data", false},
+
+		// Multi-level wildcard
+		{"hash matches everything", "#", "devices/device001/data", true},
+		{"hash matches single level", "#", "devices", true},
+		{"trailing hash", "devices/#", "devices/device001/data", true},
+		{"trailing hash matches parent level", "devices/#", "devices", true},
+		{"trailing hash with other prefix", "devices/#", "sensors/device001", false},
+		{"plus then hash", "devices/+/#", "devices/device001/data/raw", true},
+		{"hash not last level", "devices/#/data", "devices/device001/data", false},
+
+		// Leading and trailing slashes
+		{"leading slash exact", "/devices/data", "/devices/data", true},
+		{"leading slash is a level", "devices/data", "/devices/data", false},
+		{"plus matches empty first level", "+/devices/data", "/devices/data", true},
+		{"trailing slash is a level", "devices/data", "devices/data/", false},
+		{"trailing slash exact", "devices/data/", "devices/data/", true},
+		{"plus matches empty last level", "devices/data/+", "devices/data/", true},
+		{"hash matches trailing empty level", "devices/data/#", "devices/data/", true},
+
+		// Empty segments
+		{"repeated slashes exact", "devices//data", "devices//data", true},
+		{"repeated slashes differ", "devices//data", "devices/data", false},
+		{"empty pattern matches empty topic", "", "", true},
+		{"empty pattern does not match topic", "", "devices", false},
+		{"hash matches empty topic", "#", "", true},
+
+		// $-prefixed system topics
+		{"hash does not match system topic", "#", "$SYS/broker/uptime", false},
+		{"plus does not match system topic", "+/broker/uptime", "$SYS/broker/uptime", false},
+		{"explicit system topic pattern", "$SYS/#", "$SYS/broker/uptime", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+				t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzMatchTopic(f *testing.F) {
+	// Examples from the MQTT specification
+	seeds := [][2]string{
+		{"sport/tennis/player1/#", "sport/tennis/player1"},
+		{"sport/tennis/player1/#", "sport/tennis/player1/ranking"},
+		{"sport/tennis/player1/#", "sport/tennis/player1/score/wimbledon"},
+		{"sport/#", "sport"},
+		{"#", "sport/tennis"},
+		{"sport/tennis/+", "sport/tennis/player1"},
+		{"sport/tennis/+", "sport/tennis/player1/ranking"},
+		{"sport/+", "sport"},
+		{"sport/+", "sport/"},
+		{"+/+", "/finance"},
+		{"/+", "/finance"},
+		{"+", "/finance"},
+		{"+/monitor/Clients", "$SYS/monitor/Clients"},
+		{"$SYS/#", "$SYS/monitor/Clients"},
+		{"devices/+/data", "devices/device001/data"},
+		{"", ""},
+	}
+	for _, seed := range seeds {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, topic string) {
+		// Must never panic, whatever the input
+		matched := MatchTopic(pattern, topic)
+
+		isTopicName := !strings.ContainsAny(topic, SingleLevelWildcard+MultiLevelWildcard)
+		isSystemTopic := strings.HasPrefix(topic, "$")
+
+		// Topic names (no wildcards) always match themselves
+		if isTopicName && !MatchTopic(topic, topic) {
+			t.Errorf("MatchTopic(%q, %q) = false, want true", topic, topic)
+		}
+
+		// # on its own matches every non-system topic
+		if !isSystemTopic && !MatchTopic(MultiLevelWildcard, topic) {
+			t.Errorf("MatchTopic(%q, %q) = false, want true", MultiLevelWildcard, topic)
+		}
+
+		// A single + only matches single-level topics
+		if strings.Contains(topic, "/") && MatchTopic(SingleLevelWildcard, topic) {
+			t.Errorf("MatchTopic(%q, %q) = true, want false", SingleLevelWildcard, topic)
+		}
+
+		// Patterns without wildcards only match the identical topic
+		if !strings.ContainsAny(pattern, SingleLevelWildcard+MultiLevelWildcard) && matched != (pattern == topic) {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", pattern, topic, matched, pattern == topic)
+		}
+
+		// System topics are never matched by a leading wildcard
+		firstLevel := strings.SplitN(pattern, "/", 2)[0]
+		if isSystemTopic && matched && (firstLevel == SingleLevelWildcard || firstLevel == MultiLevelWildcard) {
+			t.Errorf("MatchTopic(%q, %q) = true, want false for system topic", pattern, topic)
+		}
+	})
+}
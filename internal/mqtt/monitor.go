@@ -0,0 +1,87 @@
+package mqtt
+
+import (
+	"log"
+	"time"
+
+	"iot-platform-go/internal/metrics"
+)
+
+// Message counter metric names, each labelled by subscription topic
+const (
+	MessagesReceivedMetric = "mqtt_messages_received"
+	MessagesParsedMetric   = "mqtt_messages_parsed"
+	MessagesFailedMetric   = "mqtt_messages_failed"
+	MessagesOversizeMetric = "mqtt_messages_oversize"
+)
+
+// ProcessFunc handles a message and returns an error when the payload cannot be parsed
+type ProcessFunc func(topic string, payload []byte) error
+
+// Monitor counts processed messages and dead-letters the ones that fail
+type Monitor struct {
+	registry   *metrics.Registry
+	sink       DeadLetterSink
+	maxPayload int
+	now        func() time.Time
+}
+
+// NewMonitor creates a monitor recording to registry; a nil sink only logs failed messages
+func NewMonitor(registry *metrics.Registry, sink DeadLetterSink) *Monitor {
+	return &Monitor{registry: registry, sink: sink, now: time.Now}
+}
+
+// SetMaxPayloadBytes sets the largest payload handed to handlers; 0 disables the limit.
+// Larger messages are counted and dropped without being dead-lettered.
+func (m *Monitor) SetMaxPayloadBytes(n int) {
+	m.maxPayload = n
+}
+
+// Wrap returns a handler that counts messages under the subscription topic and
+// sends payloads process rejects to the dead-letter sink
+func (m *Monitor) Wrap(subscription string, process ProcessFunc) MessageHandler {
+	return func(topic string, payload []byte) {
+		m.registry.CounterVec(MessagesReceivedMetric).Inc(subscription)
+		if m.oversize(subscription, topic, payload) {
+			return
+		}
+
+		err := process(topic, payload)
+		if err == nil {
+			m.registry.CounterVec(MessagesParsedMetric).Inc(subscription)
+			return
+		}
+
+		m.registry.CounterVec(MessagesFailedMetric).Inc(subscription)
+		log.Printf("❌ Failed to process message from %s: %v", topic, err)
+
+		if m.sink == nil {
+			return
+		}
+		letter := DeadLetter{Topic: topic, Error: err.Error(), Payload: payload, ReceivedAt: m.now()}
+		if err := m.sink.Send(letter); err != nil {
+			log.Printf("Failed to dead-letter message from %s: %v", topic, err)
+		}
+	}
+}
+
+// Guard returns a handler that drops oversized messages before calling handler
+func (m *Monitor) Guard(subscription string, handler MessageHandler) MessageHandler {
+	return func(topic string, payload []byte) {
+		if m.oversize(subscription, topic, payload) {
+			return
+		}
+		handler(topic, payload)
+	}
+}
+
+// oversize reports whether the payload exceeds the limit, counting and logging it if so
+func (m *Monitor) oversize(subscription, topic string, payload []byte) bool {
+	if m.maxPayload <= 0 || len(payload) <= m.maxPayload {
+		return false
+	}
+
+	m.registry.CounterVec(MessagesOversizeMetric).Inc(subscription)
+	log.Printf("⚠️ Dropping %d byte message from %s: larger than %d bytes", len(payload), topic, m.maxPayload)
+	return true
+}
@@ -0,0 +1,178 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"iot-platform-go/internal/metrics"
+)
+
+type recordingSink struct {
+	letters []DeadLetter
+}
+
+func (s *recordingSink) Send(letter DeadLetter) error {
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+type recordingPublisher struct {
+	topic   string
+	payload interface{}
+	err     error
+}
+
+func (p *recordingPublisher) Publish(topic string, payload interface{}) error {
+	p.topic = topic
+	p.payload = payload
+	return p.err
+}
+
+func parseJSON(topic string, payload []byte) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return nil
+}
+
+func TestMonitor_BadPayload(t *testing.T) {
+	registry := metrics.NewRegistry()
+	sink := &recordingSink{}
+	handler := NewMonitor(registry, sink).Wrap("devices/+/data", parseJSON)
+
+	handler("devices/sensor-1/data", []byte(`{"device_id":"sensor-1"}`))
+	handler("devices/sensor-1/data", []byte(`{not json`))
+
+	if got := registry.CounterVec(MessagesReceivedMetric).Value("devices/+/data"); got != 2 {
+		t.Errorf("Expected 2 received messages, got %d", got)
+	}
+	if got := registry.CounterVec(MessagesParsedMetric).Value("devices/+/data"); got != 1 {
+		t.Errorf("Expected 1 parsed message, got %d", got)
+	}
+	if got := registry.CounterVec(MessagesFailedMetric).Value("devices/+/data"); got != 1 {
+		t.Errorf("Expected 1 failed message, got %d", got)
+	}
+
+	if len(sink.letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(sink.letters))
+	}
+	letter := sink.letters[0]
+	if letter.Topic != "devices/sensor-1/data" {
+		t.Errorf("Expected dead letter topic devices/sensor-1/data, got %s", letter.Topic)
+	}
+	if string(letter.Payload) != `{not json` {
+		t.Errorf("Expected raw payload to be kept, got %q", letter.Payload)
+	}
+	if letter.Error == "" || letter.ReceivedAt.IsZero() {
+		t.Errorf("Expected error and receive time to be set, got %+v", letter)
+	}
+}
+
+func TestMonitor_NilSink(t *testing.T) {
+	registry := metrics.NewRegistry()
+	handler := NewMonitor(registry, nil).Wrap("devices/+/status", parseJSON)
+
+	handler("devices/sensor-1/status", []byte(`oops`))
+
+	if got := registry.CounterVec(MessagesFailedMetric).Value("devices/+/status"); got != 1 {
+		t.Errorf("Expected 1 failed message, got %d", got)
+	}
+}
+
+func TestMonitor_OversizePayload(t *testing.T) {
+	registry := metrics.NewRegistry()
+	sink := &recordingSink{}
+	monitor := NewMonitor(registry, sink)
+	monitor.SetMaxPayloadBytes(16)
+
+	processed := 0
+	handler := monitor.Wrap("devices/+/data", func(topic string, payload []byte) error {
+		processed++
+		return parseJSON(topic, payload)
+	})
+
+	handler("devices/sensor-1/data", []byte(`{"a":1}`))
+	handler("devices/sensor-1/data", bytes.Repeat([]byte("x"), 1<<20))
+
+	if processed != 1 {
+		t.Errorf("Expected only the small message to be processed, got %d", processed)
+	}
+	if got := registry.CounterVec(MessagesOversizeMetric).Value("devices/+/data"); got != 1 {
+		t.Errorf("Expected 1 oversize message, got %d", got)
+	}
+	if got := registry.CounterVec(MessagesReceivedMetric).Value("devices/+/data"); got != 2 {
+		t.Errorf("Expected 2 received messages, got %d", got)
+	}
+	if got := registry.CounterVec(MessagesFailedMetric).Value("devices/+/data"); got != 0 {
+		t.Errorf("Expected no failed messages, got %d", got)
+	}
+	if len(sink.letters) != 0 {
+		t.Errorf("Expected oversize messages not to be dead-lettered, got %d", len(sink.letters))
+	}
+
+	called := false
+	guarded := monitor.Guard("devices/#", func(topic string, payload []byte) { called = true })
+	guarded("devices/sensor-1/debug", bytes.Repeat([]byte("x"), 17))
+	if called {
+		t.Error("Expected guarded handler not to be called for an oversize message")
+	}
+	guarded("devices/sensor-1/debug", []byte("ok"))
+	if !called {
+		t.Error("Expected guarded handler to be called for a small message")
+	}
+}
+
+func TestWriterDeadLetterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterDeadLetterSink(&buf)
+
+	payload := []byte{0xff, 0xfe, '{'}
+	if err := sink.Send(DeadLetter{Topic: "devices/a/data", Error: "bad", Payload: payload}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := sink.Send(DeadLetter{Topic: "devices/b/data", Error: "bad", Payload: []byte("x")}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal(lines[0], &letter); err != nil {
+		t.Fatalf("Failed to decode dead letter: %v", err)
+	}
+	if !bytes.Equal(letter.Payload, payload) {
+		t.Errorf("Expected raw bytes %v, got %v", payload, letter.Payload)
+	}
+}
+
+func TestTopicDeadLetterSink(t *testing.T) {
+	publisher := &recordingPublisher{}
+	sink := NewTopicDeadLetterSink(publisher, "devices/dead-letter")
+
+	if err := sink.Send(DeadLetter{Topic: "devices/a/data", Error: "bad", Payload: []byte(`{not json`)}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if publisher.topic != "devices/dead-letter" {
+		t.Errorf("Expected publish to devices/dead-letter, got %s", publisher.topic)
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal(publisher.payload.([]byte), &letter); err != nil {
+		t.Fatalf("Failed to decode dead letter: %v", err)
+	}
+	if string(letter.Payload) != `{not json` {
+		t.Errorf("Expected raw payload, got %q", letter.Payload)
+	}
+
+	publisher.err = errors.New("not connected")
+	if err := sink.Send(DeadLetter{Topic: "devices/a/data"}); err == nil {
+		t.Error("Expected publish error to be returned")
+	}
+}
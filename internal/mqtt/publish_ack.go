@@ -0,0 +1,41 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrNotConnected is returned when publishing requires a live connection the client does not have
+	ErrNotConnected = errors.New("MQTT client is not connected")
+	// ErrPublishTimeout is returned by PublishAck when the broker does not acknowledge in time
+	ErrPublishTimeout = errors.New("MQTT publish not acknowledged before timeout")
+)
+
+// PublishAck publishes a message and waits up to timeout for the broker to acknowledge it.
+// The configured QoS is raised to at least 1 so there is an acknowledgement to wait for.
+// Messages are never queued: a disconnected client returns ErrNotConnected, an unacknowledged
+// publish ErrPublishTimeout, and a publish the broker rejects or the connection drops any other error.
+func (c *Client) PublishAck(topic string, payload interface{}, timeout time.Duration) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	qos := c.config.QoS
+	if qos < 1 {
+		qos = 1
+	}
+
+	token := c.client.Publish(topic, qos, false, payload)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("%w: topic %s after %s", ErrPublishTimeout, topic, timeout)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to topic %s: %w", topic, err)
+	}
+
+	log.Printf("Published acknowledged message to topic: %s", topic)
+	return nil
+}
@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+)
+
+func TestPublishAck(t *testing.T) {
+	tests := []struct {
+		name       string
+		connected  bool
+		stall      bool
+		publishErr error
+		wantErr    error
+		wantSent   bool
+	}{
+		{name: "acknowledged", connected: true, wantSent: true},
+		{name: "timeout", connected: true, stall: true, wantErr: ErrPublishTimeout},
+		{name: "broker error", connected: true, publishErr: errors.New("connection lost")},
+		{name: "not connected", wantErr: ErrNotConnected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{connected: tt.connected, stall: tt.stall, publishErr: tt.publishErr}
+			client := NewClient(&config.MQTTConfig{QoS: 0})
+			client.client = broker
+
+			err := client.PublishAck("devices/d1/data", []byte("{}"), time.Second)
+			switch {
+			case tt.publishErr != nil:
+				if !errors.Is(err, tt.publishErr) || errors.Is(err, ErrPublishTimeout) {
+					t.Errorf("Expected broker error %v, got %v", tt.publishErr, err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Expected %v, got %v", tt.wantErr, err)
+				}
+			case err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			if sent := len(broker.publishedTopics()) > 0; sent != tt.wantSent {
+				t.Errorf("Expected published=%v, got %v", tt.wantSent, sent)
+			}
+			if tt.connected && broker.lastQoS != 1 {
+				t.Errorf("Expected QoS 0 to be raised to 1, got %d", broker.lastQoS)
+			}
+		})
+	}
+}
+
+func TestPublishAck_TimeoutWithBroker(t *testing.T) {
+	// Skip this test in CI/CD environment
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping MQTT connection test in CI environment")
+	}
+
+	cfg := &config.MQTTConfig{
+		Broker:         "tcp://localhost:1883",
+		ClientID:       "test-ack-" + time.Now().Format("20060102150405"),
+		KeepAlive:      60,
+		ConnectTimeout: 5,
+		QoS:            2,
+		CleanSession:   true,
+	}
+
+	client := NewClient(cfg)
+
+	connectChan := make(chan error, 1)
+	go func() {
+		connectChan <- client.Connect()
+	}()
+
+	select {
+	case err := <-connectChan:
+		if err != nil {
+			t.Skipf("Skipping test - MQTT broker not available: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Skip("Skipping test - MQTT broker connection timeout")
+	}
+	defer client.Disconnect()
+
+	// A QoS 2 handshake needs several round trips, so a nanosecond deadline cannot be met
+	err := client.PublishAck("test/ack/timeout", []byte("{}"), time.Nanosecond)
+	if !errors.Is(err, ErrPublishTimeout) {
+		t.Errorf("Expected ErrPublishTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package mqtt
+
+import "sync"
+
+// queuedMessage is an outbound message waiting for the broker connection to come back
+type queuedMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  interface{}
+}
+
+// QueueStats reports the state of the outbound publish queue
+type QueueStats struct {
+	Depth    int   `json:"depth"`
+	Capacity int   `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// publishQueue is a bounded FIFO of outbound messages that drops the oldest message when full
+type publishQueue struct {
+	mu       sync.Mutex
+	messages []queuedMessage
+	capacity int
+	dropped  int64
+}
+
+// newPublishQueue creates a queue holding at most capacity messages
+func newPublishQueue(capacity int) *publishQueue {
+	return &publishQueue{capacity: capacity}
+}
+
+// push appends a message, dropping the oldest one if the queue is full.
+// It reports whether a message was dropped.
+func (q *publishQueue) push(msg queuedMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := false
+	if len(q.messages) >= q.capacity {
+		q.messages = q.messages[1:]
+		q.dropped++
+		dropped = true
+	}
+
+	q.messages = append(q.messages, msg)
+	return dropped
+}
+
+// requeue puts messages that could not be flushed back at the front of the queue,
+// keeping the newest messages if they no longer all fit
+func (q *publishQueue) requeue(msgs []queuedMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	combined := append(append([]queuedMessage{}, msgs...), q.messages...)
+	if overflow := len(combined) - q.capacity; overflow > 0 {
+		combined = combined[overflow:]
+		q.dropped += int64(overflow)
+	}
+
+	q.messages = combined
+}
+
+// drain removes and returns all queued messages in publish order
+func (q *publishQueue) drain() []queuedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msgs := q.messages
+	q.messages = nil
+	return msgs
+}
+
+// stats returns the current queue depth, capacity and drop count
+func (q *publishQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return QueueStats{
+		Depth:    len(q.messages),
+		Capacity: q.capacity,
+		Dropped:  q.dropped,
+	}
+}
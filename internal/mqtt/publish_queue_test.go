@@ -0,0 +1,266 @@
+package mqtt
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeToken is a completed token with an optional error
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// stalledToken is a token the broker never completes
+type stalledToken struct{}
+
+func (t *stalledToken) Wait() bool                     { return false }
+func (t *stalledToken) WaitTimeout(time.Duration) bool { return false }
+func (t *stalledToken) Error() error                   { return nil }
+func (t *stalledToken) Done() <-chan struct{}          { return make(chan struct{}) }
+
+// fakeBroker stands in for the paho client, recording published topics
+type fakeBroker struct {
+	mqtt.Client
+
+	mu         sync.Mutex
+	connected  bool
+	publishErr error
+	stall      bool
+	lastQoS    byte
+	lastRetain bool
+	lastValue  interface{}
+	published  []string
+	retained   []mqtt.Message // delivered to each new subscription
+	quiesce    uint           // milliseconds passed to Disconnect
+
+	// callback is the last subscription's, used by deliver
+	callback mqtt.MessageHandler
+}
+
+func (b *fakeBroker) IsConnected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connected
+}
+
+func (b *fakeBroker) setConnected(connected bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected = connected
+}
+
+func (b *fakeBroker) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastQoS = qos
+	b.lastRetain = retained
+	b.lastValue = payload
+	if b.stall {
+		return &stalledToken{}
+	}
+	if b.publishErr != nil {
+		return &fakeToken{err: b.publishErr}
+	}
+	b.published = append(b.published, topic)
+	return &fakeToken{}
+}
+
+func (b *fakeBroker) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	b.mu.Lock()
+	retained := append([]mqtt.Message{}, b.retained...)
+	stall := b.stall
+	b.callback = callback
+	b.mu.Unlock()
+
+	if stall {
+		return &stalledToken{}
+	}
+
+	go func() {
+		for _, msg := range retained {
+			callback(b, msg)
+		}
+	}()
+	return &fakeToken{}
+}
+
+// deliver hands each message to the last subscription on its own goroutine, as paho does when
+// order does not matter, and waits until all callbacks have returned
+func (b *fakeBroker) deliver(msgs ...mqtt.Message) {
+	b.mu.Lock()
+	callback := b.callback
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, msg := range msgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			callback(b, msg)
+		}()
+	}
+	wg.Wait()
+}
+
+func (b *fakeBroker) Unsubscribe(topics ...string) mqtt.Token {
+	return &fakeToken{}
+}
+
+func (b *fakeBroker) Disconnect(quiesce uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.quiesce = quiesce
+	b.connected = false
+}
+
+func (b *fakeBroker) publishedTopics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.published...)
+}
+
+func newQueueingClient(size int) (*Client, *fakeBroker) {
+	broker := &fakeBroker{}
+	client := NewClient(&config.MQTTConfig{QoS: 1, QueueSize: size})
+	client.client = broker
+	return client, broker
+}
+
+func equalTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPublishQueue_DropsOldest(t *testing.T) {
+	queue := newPublishQueue(2)
+
+	if queue.push(queuedMessage{topic: "a"}) || queue.push(queuedMessage{topic: "b"}) {
+		t.Error("Expected no message to be dropped below capacity")
+	}
+	if !queue.push(queuedMessage{topic: "c"}) {
+		t.Error("Expected oldest message to be dropped when full")
+	}
+
+	stats := queue.stats()
+	if stats.Depth != 2 || stats.Capacity != 2 || stats.Dropped != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	var topics []string
+	for _, msg := range queue.drain() {
+		topics = append(topics, msg.topic)
+	}
+	if !equalTopics(topics, []string{"b", "c"}) {
+		t.Errorf("Expected [b c], got %v", topics)
+	}
+	if queue.stats().Depth != 0 {
+		t.Error("Expected queue to be empty after drain")
+	}
+}
+
+func TestPublishQueue_Requeue(t *testing.T) {
+	queue := newPublishQueue(3)
+	queue.push(queuedMessage{topic: "new"})
+
+	queue.requeue([]queuedMessage{{topic: "old1"}, {topic: "old2"}, {topic: "old3"}})
+
+	var topics []string
+	for _, msg := range queue.drain() {
+		topics = append(topics, msg.topic)
+	}
+	if !equalTopics(topics, []string{"old2", "old3", "new"}) {
+		t.Errorf("Expected [old2 old3 new], got %v", topics)
+	}
+	if queue.stats().Dropped != 1 {
+		t.Errorf("Expected 1 dropped message, got %d", queue.stats().Dropped)
+	}
+}
+
+func TestPublish_NotConnectedWithoutQueue(t *testing.T) {
+	client, _ := newQueueingClient(0)
+
+	if err := client.Publish("devices/device001/command", "reboot"); err == nil {
+		t.Error("Expected error when publishing while disconnected without a queue")
+	}
+	if client.QueueStats() != (QueueStats{}) {
+		t.Errorf("Expected empty queue stats, got %+v", client.QueueStats())
+	}
+}
+
+func TestPublish_QueuedWhileDisconnected(t *testing.T) {
+	client, broker := newQueueingClient(10)
+
+	// Publish while the broker link is down
+	if err := client.Publish("devices/device001/command", "reboot"); err != nil {
+		t.Fatalf("Expected message to be queued, got error: %v", err)
+	}
+	if err := client.Publish("devices/device002/command", "reboot"); err != nil {
+		t.Fatalf("Expected message to be queued, got error: %v", err)
+	}
+
+	if depth := client.QueueStats().Depth; depth != 2 {
+		t.Errorf("Expected queue depth 2, got %d", depth)
+	}
+	if len(broker.publishedTopics()) != 0 {
+		t.Error("Expected nothing to be published while disconnected")
+	}
+
+	// Reconnect and let the OnConnect callback flush the queue
+	broker.setConnected(true)
+	client.onConnect(broker)
+
+	expected := []string{"devices/device001/command", "devices/device002/command"}
+	if got := broker.publishedTopics(); !equalTopics(got, expected) {
+		t.Errorf("Expected queued messages %v to be delivered, got %v", expected, got)
+	}
+	if depth := client.QueueStats().Depth; depth != 0 {
+		t.Errorf("Expected empty queue after flush, got depth %d", depth)
+	}
+
+	// Connected publishes go straight to the broker
+	if err := client.Publish("devices/device003/command", "reboot"); err != nil {
+		t.Fatalf("Unexpected publish error: %v", err)
+	}
+	if got := broker.publishedTopics(); len(got) != 3 {
+		t.Errorf("Expected 3 published messages, got %v", got)
+	}
+}
+
+func TestPublish_FlushFailureKeepsMessages(t *testing.T) {
+	client, broker := newQueueingClient(10)
+
+	if err := client.Publish("devices/device001/command", "reboot"); err != nil {
+		t.Fatalf("Expected message to be queued, got error: %v", err)
+	}
+
+	broker.setConnected(true)
+	broker.publishErr = errors.New("connection lost")
+	client.onConnect(broker)
+
+	if depth := client.QueueStats().Depth; depth != 1 {
+		t.Errorf("Expected message to stay queued after failed flush, got depth %d", depth)
+	}
+}
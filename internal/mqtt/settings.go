@@ -0,0 +1,17 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PublishDeviceSettings publishes a device's effective settings to {prefix}/devices/{id}/config.
+// The message is retained, so a device receives its current settings whenever it subscribes.
+func (c *Client) PublishDeviceSettings(deviceID string, settings map[string]json.RawMessage) error {
+	payload, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device settings: %w", err)
+	}
+
+	return c.PublishWithOptions(DeviceConfigTopic(c.config.TopicPrefix, deviceID), c.config.QoS, true, payload)
+}
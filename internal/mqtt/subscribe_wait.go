@@ -0,0 +1,40 @@
+package mqtt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SubscribeAndWait subscribes to a topic and waits until the broker's retained message for it
+// has been handled, or until timeout elapses. It reports whether a retained message was handled,
+// so callers can seed state such as device statuses before going on. For a wildcard topic the
+// wait ends after the first retained message; the rest are still handled as they arrive.
+func (c *Client) SubscribeAndWait(topic string, handler MessageHandler, timeout time.Duration) (bool, error) {
+	return c.SubscribeAndWaitContext(context.Background(), topic, handler, timeout)
+}
+
+// SubscribeAndWaitContext is SubscribeAndWait that also stops waiting once ctx is done, returning ctx's error
+func (c *Client) SubscribeAndWaitContext(ctx context.Context, topic string, handler MessageHandler, timeout time.Duration) (bool, error) {
+	received := make(chan struct{})
+	var once sync.Once
+
+	err := c.subscribe(ctx, topic, handler, func() {
+		once.Do(func() { close(received) })
+	})
+	if err != nil {
+		return false, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-received:
+		return true, nil
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeMessage is a received message delivered by fakeBroker
+type fakeMessage struct {
+	mqtt.Message
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+func (m *fakeMessage) Topic() string   { return m.topic }
+func (m *fakeMessage) Payload() []byte { return m.payload }
+func (m *fakeMessage) Retained() bool  { return m.retained }
+
+func TestSubscribeAndWait(t *testing.T) {
+	tests := []struct {
+		name         string
+		messages     []mqtt.Message
+		wantReceived bool
+		wantHandled  int
+	}{
+		{
+			name:         "retained message",
+			messages:     []mqtt.Message{&fakeMessage{topic: "devices/d1/status", payload: []byte(`{"status":"online"}`), retained: true}},
+			wantReceived: true,
+			wantHandled:  1,
+		},
+		{
+			name:         "no retained message",
+			wantReceived: false,
+		},
+		{
+			name:         "live message is not a replay",
+			messages:     []mqtt.Message{&fakeMessage{topic: "devices/d1/status", payload: []byte(`{"status":"online"}`)}},
+			wantReceived: false,
+			wantHandled:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{connected: true, retained: tt.messages}
+			client := NewClient(&config.MQTTConfig{QoS: 1})
+			client.client = broker
+
+			var mu sync.Mutex
+			handled := 0
+			received, err := client.SubscribeAndWait("devices/+/status", func(topic string, payload []byte) {
+				mu.Lock()
+				defer mu.Unlock()
+				handled++
+			}, 100*time.Millisecond)
+			if err != nil {
+				t.Fatalf("SubscribeAndWait returned error: %v", err)
+			}
+			if received != tt.wantReceived {
+				t.Errorf("Expected received %v, got %v", tt.wantReceived, received)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if handled != tt.wantHandled {
+				t.Errorf("Expected %d handled messages, got %d", tt.wantHandled, handled)
+			}
+		})
+	}
+}
+
+func TestSubscribeAndWait_RetainedWithBroker(t *testing.T) {
+	// Skip this test in CI/CD environment
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping MQTT connection test in CI environment")
+	}
+
+	cfg := &config.MQTTConfig{
+		Broker:         "tcp://localhost:1883",
+		ClientID:       "test-retained-" + time.Now().Format("20060102150405"),
+		KeepAlive:      60,
+		ConnectTimeout: 5,
+		QoS:            1,
+		CleanSession:   true,
+	}
+
+	client := NewClient(cfg)
+
+	connectChan := make(chan error, 1)
+	go func() {
+		connectChan <- client.Connect()
+	}()
+
+	select {
+	case err := <-connectChan:
+		if err != nil {
+			t.Skipf("Skipping test - MQTT broker not available: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Skip("Skipping test - MQTT broker connection timeout")
+	}
+	defer client.Disconnect()
+
+	topic := "test/retained/" + cfg.ClientID
+	if err := client.PublishWithOptions(topic, 1, true, []byte(`{"status":"online"}`)); err != nil {
+		t.Fatalf("Failed to publish retained message: %v", err)
+	}
+	// An empty retained message clears it from the broker
+	defer client.PublishWithOptions(topic, 1, true, []byte{})
+
+	var payload []byte
+	received, err := client.SubscribeAndWait(topic, func(topic string, p []byte) {
+		payload = p
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("SubscribeAndWait returned error: %v", err)
+	}
+	if !received {
+		t.Fatal("Expected the retained message to be replayed")
+	}
+	if string(payload) != `{"status":"online"}` {
+		t.Errorf("Expected retained payload, got %s", payload)
+	}
+}
+
+func TestSubscribeContext_CancelledWhileWaiting(t *testing.T) {
+	tests := []struct {
+		name   string
+		broker *fakeBroker
+	}{
+		// The connection wait would otherwise last connectionWaitAttempts × connectionWaitTime
+		{name: "waiting for the connection", broker: &fakeBroker{}},
+		{name: "waiting for the subscription", broker: &fakeBroker{connected: true, stall: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(&config.MQTTConfig{QoS: 1})
+			client.client = tt.broker
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := client.SubscribeContext(ctx, "devices/+/data", func(topic string, payload []byte) {})
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected a context cancellation error, got %v", err)
+			}
+			if elapsed > 500*time.Millisecond {
+				t.Errorf("Expected SubscribeContext to return promptly after cancellation, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestSubscribeAndWaitContext_Cancelled(t *testing.T) {
+	client := NewClient(&config.MQTTConfig{QoS: 1})
+	client.client = &fakeBroker{connected: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	received, err := client.SubscribeAndWaitContext(ctx, "devices/+/status", func(topic string, payload []byte) {}, time.Minute)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a context cancellation error, got %v", err)
+	}
+	if received {
+		t.Error("Expected no retained message to be reported")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected SubscribeAndWaitContext to return promptly after cancellation, took %s", elapsed)
+	}
+}
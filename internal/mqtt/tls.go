@@ -0,0 +1,44 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// tlsConfig returns the TLS settings for ssl, tls and wss brokers, or nil for plain tcp and ws brokers.
+// The server name comes from the broker host, so certificates are verified for it even over WebSocket.
+func (c *Client) tlsConfig() (*tls.Config, error) {
+	broker, err := url.Parse(c.config.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT broker URL %q: %w", c.config.Broker, err)
+	}
+
+	switch broker.Scheme {
+	case "ssl", "tls", "wss":
+	default:
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         broker.Hostname(),
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.config.TLSInsecureSkipVerify,
+	}
+
+	if c.config.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in MQTT CA file %s", c.config.TLSCAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	return tlsConfig, nil
+}
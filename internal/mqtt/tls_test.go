@@ -0,0 +1,182 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-platform-go/internal/config"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gorilla/websocket"
+)
+
+func TestClientOptions_WebSocketBroker(t *testing.T) {
+	for _, broker := range []string{"ws://localhost:9001/mqtt", "wss://broker.example.com:443/mqtt"} {
+		opts := NewClient(&config.MQTTConfig{Broker: broker}).clientOptions()
+		if len(opts.Servers) != 1 {
+			t.Fatalf("Expected one broker, got %d", len(opts.Servers))
+		}
+		// The path is part of the WebSocket endpoint and must be kept
+		if got := opts.Servers[0].String(); got != broker {
+			t.Errorf("Expected broker %s, got %s", broker, got)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	for _, broker := range []string{"tcp://localhost:1883", "ws://localhost:9001/mqtt"} {
+		tlsConfig, err := NewClient(&config.MQTTConfig{Broker: broker}).tlsConfig()
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", broker, err)
+		}
+		if tlsConfig != nil {
+			t.Errorf("Expected no TLS config for %s", broker)
+		}
+	}
+
+	for _, broker := range []string{"ssl://broker.example.com:8883", "tls://broker.example.com:8883", "wss://broker.example.com/mqtt"} {
+		tlsConfig, err := NewClient(&config.MQTTConfig{Broker: broker}).tlsConfig()
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", broker, err)
+		}
+		if tlsConfig == nil {
+			t.Fatalf("Expected a TLS config for %s", broker)
+		}
+		if tlsConfig.ServerName != "broker.example.com" {
+			t.Errorf("Expected server name broker.example.com for %s, got %q", broker, tlsConfig.ServerName)
+		}
+		if tlsConfig.MinVersion != tls.VersionTLS12 {
+			t.Errorf("Expected TLS 1.2 minimum for %s", broker)
+		}
+		if tlsConfig.InsecureSkipVerify {
+			t.Errorf("Expected certificate verification for %s", broker)
+		}
+	}
+}
+
+func TestTLSConfig_CAFile(t *testing.T) {
+	dir := t.TempDir()
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, caFile := range []string{filepath.Join(dir, "missing.pem"), empty} {
+		client := NewClient(&config.MQTTConfig{Broker: "wss://localhost/mqtt", TLSCAFile: caFile})
+		if _, err := client.tlsConfig(); err == nil {
+			t.Errorf("Expected an error for CA file %s", caFile)
+		}
+	}
+}
+
+// writeCAFile writes the certificate of a TLS test server as a PEM CA bundle
+func writeCAFile(t *testing.T, server *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, block, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newWebSocketBroker starts a TLS WebSocket server that accepts one MQTT connection,
+// answering CONNECT with a successful CONNACK and ignoring everything after it
+func newWebSocketBroker(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"mqtt"}}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mqtt" {
+			http.NotFound(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		connected := false
+		for {
+			_, packet, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			// CONNECT is packet type 1
+			if !connected && len(packet) > 0 && packet[0]>>4 == 1 {
+				connected = true
+				if err := conn.WriteMessage(websocket.BinaryMessage, []byte{0x20, 0x02, 0x00, 0x00}); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestConnect_SecureWebSocket(t *testing.T) {
+	server := newWebSocketBroker(t)
+	broker := "wss" + strings.TrimPrefix(server.URL, "https") + "/mqtt"
+
+	t.Run("trusted CA", func(t *testing.T) {
+		client := NewClient(&config.MQTTConfig{
+			Broker:         broker,
+			ClientID:       "wss-test",
+			KeepAlive:      60,
+			ConnectTimeout: 5,
+			TLSCAFile:      writeCAFile(t, server),
+		})
+
+		connectChan := make(chan error, 1)
+		go func() {
+			connectChan <- client.Connect()
+		}()
+
+		select {
+		case err := <-connectChan:
+			if err != nil {
+				t.Fatalf("Expected to connect over wss, got %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out connecting over wss")
+		}
+
+		if !client.IsConnected() {
+			t.Error("Expected client to be connected")
+		}
+		client.Disconnect()
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		client := NewClient(&config.MQTTConfig{
+			Broker:         broker,
+			ClientID:       "wss-test-untrusted",
+			KeepAlive:      60,
+			ConnectTimeout: 5,
+		})
+
+		// Connect retries until connected, so check the first attempt through the paho client instead
+		opts := client.clientOptions()
+		opts.SetConnectRetry(false)
+		tlsConfig, err := client.tlsConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+
+		token := mqtt.NewClient(opts).Connect()
+		if !token.WaitTimeout(10 * time.Second) {
+			t.Fatal("Timed out connecting over wss")
+		}
+		if token.Error() == nil {
+			t.Error("Expected the test server certificate to be rejected without its CA")
+		}
+	})
+}
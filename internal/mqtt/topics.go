@@ -0,0 +1,67 @@
+package mqtt
+
+import "strings"
+
+const (
+	// SingleLevelWildcard matches exactly one topic level
+	SingleLevelWildcard = "+"
+	// MultiLevelWildcard matches any number of trailing topic levels
+	MultiLevelWildcard = "#"
+)
+
+// BuildTopic joins the topic levels and prepends the namespace prefix if one is set
+func BuildTopic(prefix string, levels ...string) string {
+	topic := strings.Join(levels, "/")
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return topic
+	}
+
+	return prefix + "/" + topic
+}
+
+// DeviceDataTopic returns the data topic for a device ({prefix}/devices/{id}/data)
+func DeviceDataTopic(prefix, deviceID string) string {
+	return BuildTopic(prefix, "devices", deviceID, "data")
+}
+
+// DeviceStatusTopic returns the status topic for a device ({prefix}/devices/{id}/status)
+func DeviceStatusTopic(prefix, deviceID string) string {
+	return BuildTopic(prefix, "devices", deviceID, "status")
+}
+
+// DeviceCommandTopic returns the topic commands are sent to a device on ({prefix}/devices/{id}/commands)
+func DeviceCommandTopic(prefix, deviceID string) string {
+	return BuildTopic(prefix, "devices", deviceID, "commands")
+}
+
+// DeviceCommandResponseTopic returns the topic a device answers commands on ({prefix}/devices/{id}/commands/response)
+func DeviceCommandResponseTopic(prefix, deviceID string) string {
+	return BuildTopic(prefix, "devices", deviceID, "commands", "response")
+}
+
+// DeviceConfigTopic returns the topic a device's effective settings are published to ({prefix}/devices/{id}/config)
+func DeviceConfigTopic(prefix, deviceID string) string {
+	return BuildTopic(prefix, "devices", deviceID, "config")
+}
+
+// DeadLetterTopicName returns the default topic unparseable messages are published to ({prefix}/devices/dead-letter)
+func DeadLetterTopicName(prefix string) string {
+	return BuildTopic(prefix, "devices", "dead-letter")
+}
+
+// HeartbeatTopic returns the topic the server's liveness heartbeat is published to ({prefix}/devices/server/heartbeat)
+func HeartbeatTopic(prefix string) string {
+	return BuildTopic(prefix, "devices", "server", "heartbeat")
+}
+
+// HealthTopic returns the topic the health check publishes to ({prefix}/devices/server/health)
+func HealthTopic(prefix string) string {
+	return BuildTopic(prefix, "devices", "server", "health")
+}
+
+// AllDevicesTopic returns the pattern matching every device topic ({prefix}/devices/#)
+func AllDevicesTopic(prefix string) string {
+	return BuildTopic(prefix, "devices", MultiLevelWildcard)
+}
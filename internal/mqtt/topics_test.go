@@ -0,0 +1,121 @@
+package mqtt
+
+import (
+	"testing"
+)
+
+func TestBuildTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		levels   []string
+		expected string
+	}{
+		{"no prefix", "", []string{"devices", "device001", "data"}, "devices/device001/data"},
+		{"with prefix", "tenant-a", []string{"devices", "device001", "data"}, "tenant-a/devices/device001/data"},
+		{"nested prefix", "acme/site1", []string{"devices", "device001", "status"}, "acme/site1/devices/device001/status"},
+		{"prefix with slashes", "/tenant-a/", []string{"devices", "device001", "data"}, "tenant-a/devices/device001/data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildTopic(tt.prefix, tt.levels...); got != tt.expected {
+				t.Errorf("Expected topic '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDeviceTopics(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		data   string
+		status string
+		all    string
+	}{
+		{
+			name:   "no prefix",
+			prefix: "",
+			data:   "devices/+/data",
+			status: "devices/+/status",
+			all:    "devices/#",
+		},
+		{
+			name:   "with prefix",
+			prefix: "tenant-a",
+			data:   "tenant-a/devices/+/data",
+			status: "tenant-a/devices/+/status",
+			all:    "tenant-a/devices/#",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataPattern := DeviceDataTopic(tt.prefix, SingleLevelWildcard)
+			statusPattern := DeviceStatusTopic(tt.prefix, SingleLevelWildcard)
+			allPattern := AllDevicesTopic(tt.prefix)
+
+			if dataPattern != tt.data {
+				t.Errorf("Expected data pattern '%s', got '%s'", tt.data, dataPattern)
+			}
+			if statusPattern != tt.status {
+				t.Errorf("Expected status pattern '%s', got '%s'", tt.status, statusPattern)
+			}
+			if allPattern != tt.all {
+				t.Errorf("Expected all-devices pattern '%s', got '%s'", tt.all, allPattern)
+			}
+
+			// Published topics must be matched by the subscription patterns
+			dataTopic := DeviceDataTopic(tt.prefix, "device001")
+			if !MatchTopic(dataPattern, dataTopic) {
+				t.Errorf("Expected '%s' to match '%s'", dataTopic, dataPattern)
+			}
+			if !MatchTopic(allPattern, dataTopic) {
+				t.Errorf("Expected '%s' to match '%s'", dataTopic, allPattern)
+			}
+			if MatchTopic(dataPattern, DeviceStatusTopic(tt.prefix, "device001")) {
+				t.Errorf("Expected status topic not to match '%s'", dataPattern)
+			}
+
+			// Dead letters must not be fed back into the data or status handlers
+			deadLetter := DeadLetterTopicName(tt.prefix)
+			if MatchTopic(dataPattern, deadLetter) || MatchTopic(statusPattern, deadLetter) {
+				t.Errorf("Expected dead-letter topic '%s' not to match the data or status patterns", deadLetter)
+			}
+
+			// Nor commands and their responses
+			command := DeviceCommandTopic(tt.prefix, "device001")
+			response := DeviceCommandResponseTopic(tt.prefix, "device001")
+			for _, topic := range []string{command, response} {
+				if MatchTopic(dataPattern, topic) || MatchTopic(statusPattern, topic) {
+					t.Errorf("Expected command topic '%s' not to match the data or status patterns", topic)
+				}
+			}
+			if !MatchTopic(DeviceCommandResponseTopic(tt.prefix, SingleLevelWildcard), response) {
+				t.Errorf("Expected '%s' to match the command response pattern", response)
+			}
+
+			// Nor the settings published to devices
+			config := DeviceConfigTopic(tt.prefix, "device001")
+			if MatchTopic(dataPattern, config) || MatchTopic(statusPattern, config) {
+				t.Errorf("Expected config topic '%s' not to match the data or status patterns", config)
+			}
+
+			// Nor the server's heartbeat and health check
+			heartbeat := HeartbeatTopic(tt.prefix)
+			if MatchTopic(dataPattern, heartbeat) || MatchTopic(statusPattern, heartbeat) {
+				t.Errorf("Expected heartbeat topic '%s' not to match the data or status patterns", heartbeat)
+			}
+			health := HealthTopic(tt.prefix)
+			if MatchTopic(dataPattern, health) || MatchTopic(statusPattern, health) {
+				t.Errorf("Expected health topic '%s' not to match the data or status patterns", health)
+			}
+		})
+	}
+
+	// Unprefixed publishers must not leak into a prefixed namespace
+	if MatchTopic(DeviceDataTopic("tenant-a", SingleLevelWildcard), DeviceDataTopic("", "device001")) {
+		t.Error("Expected unprefixed topic not to match prefixed pattern")
+	}
+}
@@ -0,0 +1,265 @@
+package schema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed device_data.schema.json
+var deviceDataSchema []byte
+
+// Schema is a JSON Schema supporting the keywords needed to describe MQTT payloads:
+// type, required, properties, additionalProperties, items, enum, minLength, maxLength,
+// minimum, maximum and format (date-time). Other keywords are ignored.
+type Schema struct {
+	Type                 TypeList           `json:"type,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Format               string             `json:"format,omitempty"`
+}
+
+// TypeList holds the allowed JSON types; it accepts a single type or a list
+type TypeList []string
+
+// UnmarshalJSON accepts "type": "string" as well as "type": ["string", "null"]
+func (t *TypeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = TypeList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// Additional is the additionalProperties keyword: either a boolean or a schema for the extra properties
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalJSON accepts a boolean or a schema
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.Allowed = allowed
+		return nil
+	}
+
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// FieldError describes why the value at Path is invalid
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+// ValidationError lists every field that failed validation
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Error joins the field errors
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Path + ": " + fe.Message
+	}
+	return "invalid payload: " + strings.Join(parts, "; ")
+}
+
+// Parse parses a JSON Schema document
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	return &s, nil
+}
+
+// Load reads a JSON Schema from path
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// DeviceData returns the built-in schema for device data messages
+func DeviceData() *Schema {
+	s, err := Parse(deviceDataSchema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate decodes payload and checks it against the schema.
+// Malformed JSON and schema violations are both reported as a *ValidationError.
+func (s *Schema) Validate(payload []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return &ValidationError{Errors: []FieldError{{Path: "$", Message: "malformed JSON: " + err.Error()}}}
+	}
+
+	var errs []FieldError
+	s.validate("$", value, &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// validate appends the violations of value at path to errs
+func (s *Schema) validate(path string, value interface{}, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		fail("must be %s, got %s", strings.Join(s.Type, " or "), typeName(value))
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		fail("must be one of %v", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				fail("must be an RFC3339 date-time")
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		s.validateObject(path, v, errs)
+	}
+}
+
+// validateObject checks required, properties and additionalProperties in a stable order
+func (s *Schema) validateObject(path string, obj map[string]interface{}, errs *[]FieldError) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, FieldError{Path: childPath(path, name), Message: "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if prop, ok := s.Properties[key]; ok {
+			prop.validate(childPath(path, key), obj[key], errs)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if !s.AdditionalProperties.Allowed {
+			*errs = append(*errs, FieldError{Path: childPath(path, key), Message: "is not allowed"})
+		} else if s.AdditionalProperties.Schema != nil {
+			s.AdditionalProperties.Schema.validate(childPath(path, key), obj[key], errs)
+		}
+	}
+}
+
+// matches reports whether value is one of the allowed types
+func (t TypeList) matches(value interface{}) bool {
+	actual := typeName(value)
+	for _, want := range t {
+		if want == actual {
+			return true
+		}
+		if want == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the JSON Schema type of a decoded JSON value
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// inEnum reports whether value equals one of the enum values
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// childPath returns the path of a property of the object at path
+func childPath(path, name string) string {
+	if path == "$" {
+		return name
+	}
+	return path + "." + name
+}
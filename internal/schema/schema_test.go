@@ -0,0 +1,144 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fieldErrors returns the field errors of a validation failure keyed by path
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "expected a *ValidationError, got %v", err)
+
+	fields := make(map[string]string)
+	for _, fe := range validationErr.Errors {
+		fields[fe.Path] = fe.Message
+	}
+	return fields
+}
+
+func TestDeviceData_Validate(t *testing.T) {
+	s := DeviceData()
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedFields map[string]string
+	}{
+		{
+			name:    "valid payload",
+			payload: `{"device_id":"device001","timestamp":"2024-01-01T00:00:00Z","data":{"temperature":23.5,"door_open":true},"metadata":{"sequence":1}}`,
+		},
+		{
+			name:           "missing device_id",
+			payload:        `{"timestamp":"2024-01-01T00:00:00Z","data":{"temperature":23.5}}`,
+			expectedFields: map[string]string{"device_id": "is required"},
+		},
+		{
+			name:           "missing timestamp",
+			payload:        `{"device_id":"device001"}`,
+			expectedFields: map[string]string{"timestamp": "is required"},
+		},
+		{
+			name:    "single value",
+			payload: `{"device_id":"device001","timestamp":"2024-01-01T00:00:00Z","value":23.5,"data_type":"temperature","unit":"celsius"}`,
+		},
+		{
+			name:           "value is not a number",
+			payload:        `{"device_id":"device001","timestamp":"2024-01-01T00:00:00Z","value":"hot"}`,
+			expectedFields: map[string]string{"value": "must be number, got string"},
+		},
+		{
+			name:           "device_id is not a string",
+			payload:        `{"device_id":42,"timestamp":"2024-01-01T00:00:00Z","data":{}}`,
+			expectedFields: map[string]string{"device_id": "must be string, got integer"},
+		},
+		{
+			name:           "data is not an object",
+			payload:        `{"device_id":"device001","timestamp":"2024-01-01T00:00:00Z","data":[1,2]}`,
+			expectedFields: map[string]string{"data": "must be object, got array"},
+		},
+		{
+			name:           "empty device_id",
+			payload:        `{"device_id":"","timestamp":"2024-01-01T00:00:00Z","data":{}}`,
+			expectedFields: map[string]string{"device_id": "must be at least 1 characters"},
+		},
+		{
+			name:    "epoch timestamp",
+			payload: `{"device_id":"device001","timestamp":1704067200,"data":{}}`,
+		},
+		{
+			name:           "timestamp is neither string nor number",
+			payload:        `{"device_id":"device001","timestamp":true,"data":{}}`,
+			expectedFields: map[string]string{"timestamp": "must be string or number, got boolean"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate([]byte(tt.payload))
+			if tt.expectedFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tt.expectedFields, fieldErrors(t, err))
+		})
+	}
+}
+
+func TestValidate_MalformedJSON(t *testing.T) {
+	err := DeviceData().Validate([]byte(`{"device_id":`))
+	fields := fieldErrors(t, err)
+	assert.Contains(t, fields["$"], "malformed JSON")
+}
+
+func TestValidate_Keywords(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"type": "object",
+		"properties": {
+			"mode": {"enum": ["eco", "boost"]},
+			"level": {"type": "integer", "minimum": 0, "maximum": 10},
+			"tags": {"type": "array", "items": {"type": "string", "maxLength": 3}},
+			"note": {"type": ["string", "null"]},
+			"at": {"type": "string", "format": "date-time"}
+		},
+		"additionalProperties": false
+	}`))
+	require.NoError(t, err)
+
+	assert.NoError(t, s.Validate([]byte(`{"mode":"eco","level":3,"tags":["a","bb"],"note":null,"at":"2024-01-01T00:00:00Z"}`)))
+
+	err = s.Validate([]byte(`{"mode":"off","level":11.5,"tags":["abcd",1],"note":1,"at":"01/01/2024","extra":true}`))
+	assert.Equal(t, map[string]string{
+		"mode":    "must be one of [eco boost]",
+		"level":   "must be integer, got number",
+		"tags[0]": "must be at most 3 characters",
+		"tags[1]": "must be string, got integer",
+		"note":    "must be string or null, got integer",
+		"at":      "must be an RFC3339 date-time",
+		"extra":   "is not allowed",
+	}, fieldErrors(t, err))
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"object","required":["id"]}`), 0644))
+
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"id": "is required"}, fieldErrors(t, s.Validate([]byte(`{}`))))
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":5}`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
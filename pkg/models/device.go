@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Device represents an IoT device.
 type Device struct {
@@ -24,6 +27,17 @@ type DeviceData struct {
 	Value     float64   `json:"value"`
 	Unit      string    `json:"unit,omitempty"`
 	Metadata  string    `json:"metadata,omitempty"`
+	DedupKey  string    `json:"dedup_key,omitempty"`
+}
+
+// DataPoint represents device data aggregated over a time bucket.
+type DataPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	DataType  string    `json:"data_type"`
+	Value     float64   `json:"value"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Count     int       `json:"count"`
 }
 
 // CreateDeviceRequest represents the request to create a new device.
@@ -34,6 +48,11 @@ type CreateDeviceRequest struct {
 	Metadata string `json:"metadata,omitempty"`
 }
 
+// BulkCreateDevicesRequest represents the request to create several devices at once.
+type BulkCreateDevicesRequest struct {
+	Devices []*CreateDeviceRequest `json:"devices" binding:"required,min=1,max=100,dive"`
+}
+
 // UpdateDeviceRequest represents the request to update a device.
 type UpdateDeviceRequest struct {
 	Name     string `json:"name,omitempty"`
@@ -43,9 +62,191 @@ type UpdateDeviceRequest struct {
 	Metadata string `json:"metadata,omitempty"`
 }
 
+// SetRetentionRequest represents the request to set a device's data retention.
+// A value of 0 reverts the device to the global default.
+type SetRetentionRequest struct {
+	RetentionDays *int `json:"retention_days" binding:"required,min=0"`
+}
+
+// DeviceMetadataResponse is the body of PATCH /api/devices/:id/metadata.
+type DeviceMetadataResponse struct {
+	DeviceID string          `json:"device_id"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// UpdateDeviceSettingsRequest is the body of PUT /api/devices/:id/settings.
+// The settings replace the device's stored ones; a null value reverts that key to its default.
+type UpdateDeviceSettingsRequest struct {
+	Settings map[string]json.RawMessage `json:"settings" binding:"required"`
+}
+
+// DeviceSettingsResponse is the body of GET and PUT /api/devices/:id/settings.
+// Settings are the device's own settings over the configured defaults; Defaulted lists the keys taken from the defaults.
+type DeviceSettingsResponse struct {
+	DeviceID  string                     `json:"device_id"`
+	Settings  map[string]json.RawMessage `json:"settings"`
+	Defaulted []string                   `json:"defaulted"`
+}
+
+// FacetValue represents a distinct field value in the fleet and how many devices have it.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// ProvisionDeviceResponse represents a provisioned device and its token.
+// The token is only returned once; the server keeps its hash.
+type ProvisionDeviceResponse struct {
+	Device *Device `json:"device"`
+	Token  string  `json:"token"`
+}
+
+// IngestDataRequest represents a single reading sent by a device over HTTP.
+type IngestDataRequest struct {
+	DataType  string     `json:"data_type"` // with unit, defaulted when missing as configured
+	Value     *float64   `json:"value" binding:"required"`
+	Unit      string     `json:"unit,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"` // defaults to the time the reading is received
+	Metadata  string     `json:"metadata,omitempty"`
+}
+
+// BulkIngestDataRequest is a multi-metric reading in the MQTT message shape, sent by a device over HTTP.
+// Each numeric entry in Data becomes a reading; other values are kept as metadata on those readings.
+// A single Value is saved as a reading of DataType and Unit, defaulted like IngestDataRequest.
+type BulkIngestDataRequest struct {
+	DeviceID  string                 `json:"device_id,omitempty"` // must match the path when set
+	Timestamp json.RawMessage        `json:"timestamp,omitempty"` // RFC3339 string or Unix seconds/millis; defaults to the receive time
+	Data      map[string]interface{} `json:"data"`
+	DedupKey  string                 `json:"dedup_key,omitempty"`
+
+	Value    *float64 `json:"value,omitempty"`
+	DataType string   `json:"data_type,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+}
+
+// BulkIngestDataResponse is the body of POST /api/devices/:id/data/bulk.
+type BulkIngestDataResponse struct {
+	DeviceID   string        `json:"device_id"`
+	Data       []*DeviceData `json:"data"`              // the inserted readings
+	Inserted   int64         `json:"inserted"`          // excludes readings dropped as duplicates
+	Duplicates int64         `json:"duplicates"`        // readings dropped because their dedup key was already stored
+	Skipped    []string      `json:"skipped,omitempty"` // non-numeric entries stored as metadata instead
+}
+
 // DeviceStatus represents the current status of a device.
 type DeviceStatus struct {
 	DeviceID string    `json:"device_id"`
 	Status   string    `json:"status"`
 	LastSeen time.Time `json:"last_seen"`
 }
+
+// StatusChange is a recorded transition of a device's status.
+// FromStatus is empty when the previous status was unset.
+type StatusChange struct {
+	ID         string    `json:"id"`
+	DeviceID   string    `json:"device_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// StatusHistoryResponse is the body of GET /api/devices/:id/status/history.
+type StatusHistoryResponse struct {
+	DeviceID string          `json:"device_id"`
+	History  []*StatusChange `json:"history"`
+	Count    int             `json:"count"`
+	Total    int             `json:"total"`
+	Limit    int             `json:"limit"`
+	Offset   int             `json:"offset"`
+}
+
+// DeviceStatusResponse is the body of GET /api/devices/:id/status.
+type DeviceStatusResponse struct {
+	DeviceID string    `json:"device_id"`
+	Status   string    `json:"status"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DeviceListResponse is the body of GET /api/devices.
+type DeviceListResponse struct {
+	Devices []*Device `json:"devices"`
+	Count   int       `json:"count"`
+}
+
+// DeviceDataResponse is the body of GET /api/devices/:id/data.
+// Total and Offset are only set for reads served by PostgreSQL.
+type DeviceDataResponse struct {
+	DeviceID string        `json:"device_id"`
+	Data     []*DeviceData `json:"data"`
+	Count    int           `json:"count"`
+	Total    *int          `json:"total,omitempty"`
+	Limit    int           `json:"limit"`
+	Offset   *int          `json:"offset,omitempty"`
+	Source   string        `json:"source"`
+}
+
+// DeviceExport is the body of GET /api/devices/:id/export, a support bundle for one device.
+// DataBounds is nil when the device has no readings.
+type DeviceExport struct {
+	Device     *Device       `json:"device"`
+	Readings   []*DeviceData `json:"readings"` // newest first
+	DataBounds *DataBounds   `json:"data_bounds"`
+	ExportedAt time.Time     `json:"exported_at"`
+}
+
+// DataBounds holds the timestamps of a device's first and last readings
+type DataBounds struct {
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// FleetStatsResponse is the body of GET /api/stats.
+type FleetStatsResponse struct {
+	TotalDevices    int            `json:"total_devices"`
+	DevicesByStatus map[string]int `json:"devices_by_status"`
+	DataPointsToday int            `json:"data_points_today"` // readings timestamped since midnight UTC
+	ActiveLastHour  int            `json:"active_last_hour"`  // devices seen within the last hour
+	GeneratedAt     time.Time      `json:"generated_at"`
+}
+
+// Device event types
+const (
+	EventDeviceCreated = "device.created"
+	EventDeviceUpdated = "device.updated"
+	EventDeviceDeleted = "device.deleted"
+	EventStatusChanged = "device.status_changed"
+)
+
+// DeviceEvent represents an entry in a device's audit log.
+type DeviceEvent struct {
+	ID        string          `json:"id"`
+	DeviceID  string          `json:"device_id"`
+	EventType string          `json:"event_type"`
+	Actor     string          `json:"actor,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// CleanupRequest represents the request to delete old device data.
+// Without a device ID the data of every device is pruned.
+type CleanupRequest struct {
+	DeviceID  string `json:"device_id,omitempty"`
+	OlderThan string `json:"older_than" binding:"required"` // RFC3339 timestamp in the past
+}
+
+// Device commands
+const (
+	CommandPing = "ping"
+)
+
+// CommandResult is the outcome of a command sent to a device over MQTT.
+// Without a wait for the response, or when none arrives in time, Responded is false.
+type CommandResult struct {
+	DeviceID  string          `json:"device_id"`
+	CommandID string          `json:"command_id"` // echoed by the device as "id" to correlate its response
+	Command   string          `json:"command"`
+	SentAt    time.Time       `json:"sent_at"`
+	Responded bool            `json:"responded"`
+	LatencyMS float64         `json:"latency_ms,omitempty"` // round trip from publishing to the response
+	Response  json.RawMessage `json:"response,omitempty"`
+}
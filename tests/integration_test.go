@@ -170,7 +170,7 @@ func TestDeviceLifecycle(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var status models.DeviceStatus
+		var status models.DeviceStatusResponse
 		err = json.Unmarshal(w.Body.Bytes(), &status)
 		assert.NoError(t, err)
 		assert.Equal(t, deviceID, status.DeviceID)
@@ -184,12 +184,11 @@ func TestDeviceLifecycle(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var devicesResponse map[string]interface{}
+		var devicesResponse models.DeviceListResponse
 		err = json.Unmarshal(w.Body.Bytes(), &devicesResponse)
 		assert.NoError(t, err)
-		assert.Contains(t, devicesResponse, "devices")
-		assert.Contains(t, devicesResponse, "count")
-		assert.Equal(t, float64(1), devicesResponse["count"])
+		assert.Equal(t, 1, devicesResponse.Count)
+		assert.Len(t, devicesResponse.Devices, 1)
 
 		// Step 6: Delete the device
 		req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/devices/%s", deviceID), nil)
@@ -251,10 +250,10 @@ func TestMultipleDevices(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var devicesResponse map[string]interface{}
+		var devicesResponse models.DeviceListResponse
 		err := json.Unmarshal(w.Body.Bytes(), &devicesResponse)
 		assert.NoError(t, err)
-		assert.Equal(t, float64(3), devicesResponse["count"])
+		assert.Equal(t, 3, devicesResponse.Count)
 
 		// Verify each device can be retrieved individually
 		for _, deviceID := range deviceIDs {
@@ -292,7 +291,8 @@ func TestErrorHandling(t *testing.T) {
 		var response map[string]interface{}
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Contains(t, response["error"], "Invalid request body")
+		assert.Equal(t, api.ErrCodeInvalidRequest, response["code"])
+		assert.Contains(t, response["message"], "Invalid request body")
 	})
 
 	t.Run("get non-existent device", func(t *testing.T) {
@@ -306,7 +306,7 @@ func TestErrorHandling(t *testing.T) {
 		var response map[string]interface{}
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Contains(t, response["error"], "Device not found")
+		assert.Equal(t, api.ErrCodeDeviceNotFound, response["code"])
 	})
 
 	t.Run("update non-existent device", func(t *testing.T) {
@@ -326,7 +326,7 @@ func TestErrorHandling(t *testing.T) {
 		var response map[string]interface{}
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Contains(t, response["error"], "Device not found")
+		assert.Equal(t, api.ErrCodeDeviceNotFound, response["code"])
 	})
 
 	t.Run("delete non-existent device", func(t *testing.T) {
@@ -340,7 +340,7 @@ func TestErrorHandling(t *testing.T) {
 		var response map[string]interface{}
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Contains(t, response["error"], "Device not found")
+		assert.Equal(t, api.ErrCodeDeviceNotFound, response["code"])
 	})
 }
 
@@ -440,10 +440,10 @@ func TestConcurrentOperations(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var devicesResponse map[string]interface{}
+		var devicesResponse models.DeviceListResponse
 		err := json.Unmarshal(w.Body.Bytes(), &devicesResponse)
 		assert.NoError(t, err)
-		assert.Equal(t, float64(numDevices), devicesResponse["count"])
+		assert.Equal(t, numDevices, devicesResponse.Count)
 	})
 }
 
@@ -486,9 +486,9 @@ func TestPerformance(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var devicesResponse map[string]interface{}
+		var devicesResponse models.DeviceListResponse
 		err := json.Unmarshal(w.Body.Bytes(), &devicesResponse)
 		assert.NoError(t, err)
-		assert.Equal(t, float64(numDevices), devicesResponse["count"])
+		assert.Equal(t, numDevices, devicesResponse.Count)
 	})
 }